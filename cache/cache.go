@@ -12,6 +12,8 @@ type Cache struct {
 	ttl          time.Duration
 	items        map[string]*Item
 	getIfMissing func(string) (interface{}, error)
+	stop         chan struct{}
+	stopOnce     sync.Once
 }
 
 // Dump is a thread-safe way to fully clear the cache
@@ -33,6 +35,16 @@ func (cache *Cache) Set(key string, data interface{}) {
 	cache.mutex.Unlock()
 }
 
+// SetWithTTL is a thread-safe way to add new items to the map with a specific time to live
+// Items set with a specific time to live should be read with GetSimple, as Get extends their life with the cache TTL
+func (cache *Cache) SetWithTTL(key string, data interface{}, ttl time.Duration) {
+	cache.mutex.Lock()
+	item := &Item{data: data}
+	item.touch(ttl)
+	cache.items[key] = item
+	cache.mutex.Unlock()
+}
+
 // Delete is a thread-safe way to delete items from the map
 func (cache *Cache) Delete(key string) {
 	cache.mutex.Lock()
@@ -121,22 +133,32 @@ func (cache *Cache) startCleanupTimer() {
 	if duration < time.Second {
 		duration = time.Second
 	}
-	ticker := time.Tick(duration)
+	ticker := time.NewTicker(duration)
 	go (func() {
+		defer ticker.Stop()
 		for {
 			select {
-			case <-ticker:
+			case <-ticker.C:
 				cache.Cleanup()
+			case <-cache.stop:
+				return
 			}
 		}
 	})()
 }
 
+// Close stops the cleanup of the expired items
+// The cache can still be used, but its expired items are only removed on Cleanup
+func (cache *Cache) Close() {
+	cache.stopOnce.Do(func() { close(cache.stop) })
+}
+
 // NewCache is a helper to create instance of the Cache struct
 func NewCache(duration time.Duration) *Cache {
 	cache := &Cache{
 		ttl:   duration,
 		items: map[string]*Item{},
+		stop:  make(chan struct{}),
 	}
 	cache.startCleanupTimer()
 	return cache
@@ -1 +1,17 @@
 package ttlcache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheClose(t *testing.T) {
+	cache := NewCache(time.Minute)
+	cache.Set("key", "value")
+	cache.Close()
+	cache.Close()
+
+	if data, found := cache.Get("key"); !found || data != "value" {
+		t.Errorf("the cache should still be usable after Close, got %v %v", data, found)
+	}
+}
@@ -12,3 +12,20 @@ type Calendar interface {
 	Add(time.Time, time.Duration) time.Time
 	Sub(time.Time, time.Time) time.Duration
 }
+
+// OpenDayCalendar is a calendar which can tell if a day is open (a working day)
+type OpenDayCalendar interface {
+	Calendar
+	IsOpenDay(time.Time) bool
+}
+
+// IsOpenDay returns true if the day of t is open in a calendar
+// The calendars which are not an OpenDayCalendar are checked with the open duration of the day
+func IsOpenDay(c Calendar, t time.Time) bool {
+	if openDayCalendar, ok := c.(OpenDayCalendar); ok {
+		return openDayCalendar.IsOpenDay(t)
+	}
+	begin := dayBegin(t)
+	d := c.Sub(begin, begin.Add(Day))
+	return d != 0
+}
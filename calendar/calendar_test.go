@@ -91,3 +91,38 @@ func TestStandardCalendarSub(t *testing.T) {
 	calendar := defaultFrCalendar
 	testDelay(t, calendar, time.Date(2019, time.May, 15, 23, 0, 0, 0, time.UTC), time.Date(2019, time.May, 14, 22, 0, 0, 0, time.UTC), -1*Day+-1*time.Hour)
 }
+
+func TestIsOpenDay(t *testing.T) {
+
+	defaultFrCalendar := NewStandardCalendar("default-fr", FR)
+	customCalendar := NewCustomCalendar("test-calendar")
+	customCalendar.AddEntries(
+		NewEntry(time.Date(2019, time.May, 1, 0, 0, 0, 0, time.UTC), false, false),
+		NewEntry(time.Date(2019, time.May, 5, 0, 0, 0, 0, time.UTC), false, false),
+		NewEntry(time.Date(2019, time.May, 8, 0, 0, 0, 0, time.UTC), false, false),
+	)
+
+	// subCalendar hides the IsOpenDay implementation, to check the open days with Sub
+	type subCalendar struct{ Calendar }
+
+	for _, calendar := range [...]Calendar{defaultFrCalendar, customCalendar, subCalendar{defaultFrCalendar}} {
+		for _, d := range []time.Time{
+			time.Date(2019, time.May, 1, 14, 0, 0, 0, time.UTC),
+			time.Date(2019, time.May, 5, 0, 0, 0, 0, time.UTC),
+			time.Date(2019, time.May, 8, 23, 59, 0, 0, time.UTC),
+		} {
+			if IsOpenDay(calendar, d) {
+				t.Errorf("%s: %s should be a closed day", calendar.GetName(), d)
+			}
+		}
+		for _, d := range []time.Time{
+			time.Date(2019, time.May, 2, 14, 0, 0, 0, time.UTC),
+			time.Date(2019, time.May, 4, 0, 0, 0, 0, time.UTC),
+			time.Date(2019, time.May, 9, 23, 59, 0, 0, time.UTC),
+		} {
+			if !IsOpenDay(calendar, d) {
+				t.Errorf("%s: %s should be an open day", calendar.GetName(), d)
+			}
+		}
+	}
+}
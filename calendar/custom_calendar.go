@@ -58,6 +58,17 @@ func (calendar *CustomCalendar) AddEntries(entries ...Entry) {
 	calendar.entries = entriesSlice
 }
 
+// IsOpenDay returns true if the day of t has no entry, or a working day entry
+func (calendar *CustomCalendar) IsOpenDay(t time.Time) bool {
+	day := t.Truncate(Day)
+	for _, entry := range calendar.entries {
+		if entry.ID.Equal(day) {
+			return entry.WorkingDay
+		}
+	}
+	return true
+}
+
 // Add returns the time t+d, taking into account working days
 func (calendar *CustomCalendar) Add(t time.Time, d time.Duration) time.Time {
 	durationGap := time.Duration(0)
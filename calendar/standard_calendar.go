@@ -118,6 +118,11 @@ func (calendar *StandardCalendar) Sub(t time.Time, u time.Time) time.Duration {
 	return time.Duration(factor) * d
 }
 
+// IsOpenDay returns true if the day of t is a working day
+func (calendar *StandardCalendar) IsOpenDay(t time.Time) bool {
+	return calendar.c.IsWorkday(t)
+}
+
 func dayBegin(t time.Time) time.Time {
 	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
 }
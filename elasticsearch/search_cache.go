@@ -0,0 +1,250 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	ttlcache "github.com/myrteametrics/myrtea-sdk/v5/cache"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+	"github.com/myrteametrics/myrtea-sdk/v5/metrics"
+	"github.com/redis/rueidis"
+	"go.uber.org/zap"
+)
+
+// Names of the result cache metrics
+const (
+	MetricResultCacheHitLocal = "fact.cache.hit.local"
+	MetricResultCacheHitRedis = "fact.cache.hit.redis"
+	MetricResultCacheMiss     = "fact.cache.miss"
+)
+
+const defaultResultCachePrefix = "fact-result:"
+
+func init() {
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register(engine.PercentilesValue{})
+	gob.Register(engine.ExtendedStatsValue{})
+	gob.Register(time.Time{})
+	gob.Register(json.Number(""))
+}
+
+// ResultCacheConfig defines the time to live of the cached fact results
+// * ClosedTTL is used for the facts which time window ended before the execution time (immutable results)
+// * CurrentTTL is used for the other facts (current or unbounded time windows)
+// * Prefix is the prefix of the redis keys (default to "fact-result:")
+type ResultCacheConfig struct {
+	ClosedTTL  time.Duration
+	CurrentTTL time.Duration
+	Prefix     string
+}
+
+// ResultCacheStats are the hit and miss counters of a result cache
+type ResultCacheStats struct {
+	LocalHits int64 `json:"localHits"`
+	RedisHits int64 `json:"redisHits"`
+	Misses    int64 `json:"misses"`
+}
+
+// ResultCache caches the fact results, keyed by a stable hash of their contextualized search request
+// Results are cached in-process, and optionally in redis to be shared across instances
+type ResultCache struct {
+	config    ResultCacheConfig
+	local     *ttlcache.Cache
+	redis     rueidis.Client
+	localHits int64
+	redisHits int64
+	misses    int64
+}
+
+// NewResultCache returns a new result cache, shared with other instances through redis if client is not nil
+func NewResultCache(config ResultCacheConfig, client rueidis.Client) *ResultCache {
+	if config.Prefix == "" {
+		config.Prefix = defaultResultCachePrefix
+	}
+	return &ResultCache{
+		config: config,
+		local:  ttlcache.NewCache(config.CurrentTTL),
+		redis:  client,
+	}
+}
+
+// CacheKey returns the stable hash of the contextualized search request of a fact on some indices
+// The resolved time windows are part of the key of closed windows, as their relative date math (now-1d/d)
+// targets a different window every day
+func CacheKey(f engine.Fact, ti time.Time, indices []string, request *search.Request) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(f.Model))
+	sorted := append([]string{}, indices...)
+	sort.Strings(sorted)
+	b, err := json.Marshal(sorted)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(b)
+	b, err = json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(b)
+	if f.IsClosedWindow(ti) {
+		b, err = json.Marshal(f.TimeWindows(ti))
+		if err != nil {
+			return "", err
+		}
+		hash.Write(b)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Close stops the cleanup of the in-process cache
+func (c *ResultCache) Close() {
+	c.local.Close()
+}
+
+// TTL returns the time to live of the result of a fact executed at a time
+func (c *ResultCache) TTL(f engine.Fact, ti time.Time) time.Duration {
+	if f.IsClosedWindow(ti) {
+		return c.config.ClosedTTL
+	}
+	return c.config.CurrentTTL
+}
+
+// Execute returns the cached result of a fact, or executes its search request and caches its result
+// The indices must be the indices targeted by search (see SearchIndices), as the results are cached per indices
+func (c *ResultCache) Execute(ctx context.Context, f engine.Fact, ti time.Time, parameters map[string]interface{}, indices []string, search SearchFunc) (*engine.FactResult, error) {
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+	}
+	request, err := ConvertFactToSearchRequestV8(f, ti, parameters)
+	if err != nil {
+		return nil, err
+	}
+	key, err := CacheKey(f, ti, indices, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if result, ok := c.get(ctx, key); ok {
+		return result, nil
+	}
+	c.count(&c.misses, MetricResultCacheMiss)
+
+	var result *engine.FactResult
+	if f.Composite {
+		it, err := NewCompositeIterator(f, ti, parameters, search)
+		if err != nil {
+			return nil, err
+		}
+		result, err = it.All(ctx)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		response, err := search(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		result, err = ProcessSearchResponseV8(f, ti, response)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ttl := c.TTL(f, ti); ttl > 0 {
+		c.set(ctx, key, result, ttl)
+	}
+	return result, nil
+}
+
+// Stats returns the hit and miss counters of the cache
+func (c *ResultCache) Stats() ResultCacheStats {
+	return ResultCacheStats{
+		LocalHits: atomic.LoadInt64(&c.localHits),
+		RedisHits: atomic.LoadInt64(&c.redisHits),
+		Misses:    atomic.LoadInt64(&c.misses),
+	}
+}
+
+func (c *ResultCache) get(ctx context.Context, key string) (*engine.FactResult, bool) {
+	if data, ok := c.local.GetSimple(key); ok {
+		if result, err := decodeResult(data.([]byte)); err == nil {
+			c.count(&c.localHits, MetricResultCacheHitLocal)
+			return result, true
+		}
+	}
+	if c.redis == nil {
+		return nil, false
+	}
+	redisKey := c.config.Prefix + key
+	data, err := c.redis.Do(ctx, c.redis.B().Get().Key(redisKey).Build()).AsBytes()
+	if err != nil {
+		if !rueidis.IsRedisNil(err) {
+			zap.L().Warn("ResultCache redis get", zap.String("key", redisKey), zap.Error(err))
+		}
+		return nil, false
+	}
+	result, err := decodeResult(data)
+	if err != nil {
+		zap.L().Warn("ResultCache decode", zap.String("key", redisKey), zap.Error(err))
+		return nil, false
+	}
+	ttl, err := c.redis.Do(ctx, c.redis.B().Pttl().Key(redisKey).Build()).AsInt64()
+	if err == nil && ttl > 0 {
+		c.local.SetWithTTL(key, data, time.Duration(ttl)*time.Millisecond)
+	}
+	c.count(&c.redisHits, MetricResultCacheHitRedis)
+	return result, true
+}
+
+func (c *ResultCache) set(ctx context.Context, key string, result *engine.FactResult, ttl time.Duration) {
+	data, err := encodeResult(result)
+	if err != nil {
+		zap.L().Warn("ResultCache encode", zap.String("key", key), zap.Error(err))
+		return
+	}
+	c.local.SetWithTTL(key, data, ttl)
+	if c.redis == nil {
+		return
+	}
+	redisKey := c.config.Prefix + key
+	err = c.redis.Do(ctx, c.redis.B().Set().Key(redisKey).Value(rueidis.BinaryString(data)).Px(ttl).Build()).Error()
+	if err != nil {
+		zap.L().Warn("ResultCache redis set", zap.String("key", redisKey), zap.Error(err))
+	}
+}
+
+func (c *ResultCache) count(counter *int64, metric string) {
+	atomic.AddInt64(counter, 1)
+	if statter := metrics.C(); statter != nil {
+		if err := statter.Inc(metric, 1, 1.0); err != nil {
+			zap.L().Debug("ResultCache metric", zap.String("metric", metric), zap.Error(err))
+		}
+	}
+}
+
+// encodeResult encodes a fact result with gob, which keeps the values types (int64 documents counts, percentiles...)
+// The cached results are always decoded, so that callers cannot modify them
+func encodeResult(result *engine.FactResult) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(result); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeResult(data []byte) (*engine.FactResult, error) {
+	result := &engine.FactResult{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
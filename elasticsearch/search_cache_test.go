@@ -0,0 +1,128 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+)
+
+const cacheResponse = `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+	"hits":{"total":{"value":6,"relation":"eq"},"hits":[]},
+	"aggregations":{"carrier":{"buckets":[{"key":"dhl","doc_count":4,"parcels":{"value":4}},{"key":"ups","doc_count":2,"parcels":{"value":2}}]}}}`
+
+func TestResultCacheExecute(t *testing.T) {
+	cache := NewResultCache(ResultCacheConfig{ClosedTTL: time.Hour, CurrentTTL: time.Minute}, nil)
+	defer cache.Close()
+	ti := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	calls := 0
+	searchFunc := func(ctx context.Context, request *search.Request) (*search.Response, error) {
+		calls++
+		return fakeSearch(t, cacheResponse)(ctx, request)
+	}
+
+	f := engine.Fact{
+		Name:       "test",
+		Model:      "parcel",
+		Intent:     &engine.IntentFragment{Name: "parcels", Operator: engine.Count, Term: "id"},
+		Dimensions: []*engine.DimensionFragment{{Name: "carrier", Operator: engine.By, Term: "carrier"}},
+		Condition:  &engine.LeafConditionFragment{Operator: engine.Between, Field: "date", Value: "now-1d/d", Value2: "now/d"},
+	}
+	for i := 0; i < 2; i++ {
+		result, err := cache.Execute(context.Background(), f, ti, nil, []string{"parcel-current"}, searchFunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if docCount, _ := result.Buckets["carrier"][0].GetValue(engine.DocCountAgg); docCount != int64(4) {
+			t.Errorf("invalid documents count %v (%T)", docCount, docCount)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected a single search, got %d", calls)
+	}
+
+	// The same relative closed window targets another day
+	if _, err := cache.Execute(context.Background(), f, ti.Add(24*time.Hour), nil, []string{"parcel-current"}, searchFunc); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected a new search for another day, got %d searches", calls)
+	}
+
+	// The same fact on other indices
+	if _, err := cache.Execute(context.Background(), f, ti, nil, []string{"parcel-archive"}, searchFunc); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected a new search for other indices, got %d searches", calls)
+	}
+
+	expected := ResultCacheStats{LocalHits: 1, Misses: 3}
+	if stats := cache.Stats(); stats != expected {
+		t.Errorf("invalid stats\nexpected: %+v\nactual:   %+v", expected, stats)
+	}
+}
+
+func TestResultCacheExecuteSortedSelect(t *testing.T) {
+	cache := NewResultCache(ResultCacheConfig{ClosedTTL: time.Hour, CurrentTTL: time.Minute}, nil)
+	defer cache.Close()
+	ti := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	calls := 0
+	searchFunc := func(ctx context.Context, request *search.Request) (*search.Response, error) {
+		calls++
+		return decodeSearchResponse(strings.NewReader(`{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+			"hits":{"total":{"value":1,"relation":"eq"},"hits":[
+				{"_index":"parcel-1","_id":"abc","_source":{"status":"late"},"sort":[9007199254740993,"abc"]}
+			]}}`))
+	}
+
+	f := engine.Fact{
+		Name:      "test",
+		Model:     "parcel",
+		Intent:    &engine.IntentFragment{Operator: engine.Select, Term: "parcel"},
+		Condition: &engine.LeafConditionFragment{Operator: engine.Between, Field: "date", Value: "now-1d/d", Value2: "now/d"},
+		Sort:      []types.SortCombinations{map[string]interface{}{"date": "desc"}, "_id"},
+	}
+	for i := 0; i < 2; i++ {
+		result, err := cache.Execute(context.Background(), f, ti, nil, []string{"parcel-current"}, searchFunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Hits) != 1 || len(result.Hits[0].Sort) != 2 || result.Hits[0].Sort[0] != json.Number("9007199254740993") {
+			t.Fatalf("invalid hits %+v", result.Hits)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected a single search, got %d", calls)
+	}
+}
+
+func TestResultCacheTTL(t *testing.T) {
+	cache := NewResultCache(ResultCacheConfig{ClosedTTL: time.Hour, CurrentTTL: time.Minute}, nil)
+	defer cache.Close()
+	ti := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	windows := []struct {
+		from     string
+		to       string
+		expected time.Duration
+	}{
+		{"now-1d/d", "now/d", time.Hour},
+		{"now/d", "now", time.Minute},
+		{"2024-03-01T00:00:00.000", "2024-04-01T00:00:00.000", time.Minute},
+	}
+	for _, window := range windows {
+		f := engine.Fact{
+			Intent:    &engine.IntentFragment{Operator: engine.Count, Term: "id"},
+			Condition: &engine.LeafConditionFragment{Operator: engine.Between, Field: "date", Value: window.from, Value2: window.to},
+		}
+		if ttl := cache.TTL(f, ti); ttl != window.expected {
+			t.Errorf("window %s - %s: expected TTL %s, got %s", window.from, window.to, window.expected, ttl)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package elasticsearch
+
+import (
+	"errors"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+)
+
+// ComparisonAggName is the name of the filters aggregation of a comparison fact
+const ComparisonAggName = "comparison"
+
+// buildElasticComparison wraps the aggregations of a comparison fact in a filters aggregation with a bucket per window,
+// and replaces the request query with the union of both windows
+func buildElasticComparison(f engine.Fact, request *search.Request, aggregations map[string]types.Aggregations, parameters map[string]interface{}) (map[string]types.Aggregations, error) {
+	if request.Query == nil {
+		return nil, errors.New("no range condition on comparison field " + f.Comparison.Field)
+	}
+	shifted, err := f.Comparison.ShiftCondition(f.Condition)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := buildElasticFilter(shifted, parameters)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		return nil, errors.New("no range condition on comparison field " + f.Comparison.Field)
+	}
+
+	current := *request.Query
+	request.Query = &types.Query{
+		Bool: &types.BoolQuery{
+			Should:             []types.Query{current, *previous},
+			MinimumShouldMatch: 1,
+		},
+	}
+
+	return map[string]types.Aggregations{
+		ComparisonAggName: {
+			Filters: &types.FiltersAggregation{
+				Filters: map[string]types.Query{
+					engine.ComparisonCurrent:  current,
+					engine.ComparisonPrevious: *previous,
+				},
+			},
+			Aggregations: aggregations,
+		},
+	}, nil
+}
+
+// parseComparisonAggregation parses the window buckets of a comparison fact, and compares their result trees
+// The result total is the documents count of the current window
+func parseComparisonAggregation(result *engine.FactResult, aggs map[string]interface{}, f engine.Fact, dimensions []*engine.DimensionFragment) error {
+	raw, ok := aggs[ComparisonAggName].(map[string]interface{})
+	if !ok {
+		return errors.New("aggregation " + ComparisonAggName + " not found")
+	}
+	buckets, ok := raw["buckets"].(map[string]interface{})
+	if !ok {
+		return errors.New("aggregation " + ComparisonAggName + " has no buckets")
+	}
+
+	items := make(map[string]*engine.Item, 2)
+	for _, window := range []string{engine.ComparisonCurrent, engine.ComparisonPrevious} {
+		bucket, ok := buckets[window].(map[string]interface{})
+		if !ok {
+			return errors.New("bucket " + window + " not found in aggregation " + ComparisonAggName)
+		}
+		item := &engine.Item{}
+		docCount, _ := bucket["doc_count"].(float64)
+		item.SetValue(engine.DocCountAgg, int64(docCount))
+		if err := parseAggregations(item, bucket, f.Intent, f.Pipelines, dimensions); err != nil {
+			return err
+		}
+		items[window] = item
+	}
+
+	result.Item = *items[engine.ComparisonCurrent]
+	if docCount, ok := result.GetValue(engine.DocCountAgg); ok {
+		result.Total = docCount.(int64)
+	}
+	result.Compare(&f, *items[engine.ComparisonPrevious])
+	return nil
+}
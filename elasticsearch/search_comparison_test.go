@@ -0,0 +1,97 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+)
+
+func TestConvertFactToSearchRequestComparison(t *testing.T) {
+	f := engine.Fact{
+		Name:   "test",
+		Model:  "parcel",
+		Intent: &engine.IntentFragment{Name: "parcels", Operator: engine.Count, Term: "id"},
+		Dimensions: []*engine.DimensionFragment{
+			{Name: "carrier", Operator: engine.By, Term: "carrier"},
+		},
+		Condition:  &engine.LeafConditionFragment{Operator: engine.Between, Field: "date", Value: "2024-03-15T00:00:00.000", Value2: "now"},
+		Comparison: &engine.ComparisonFragment{Field: "date", Shift: "1w"},
+	}
+	request, err := ConvertFactToSearchRequestV8(f, time.Now(), map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(request.Query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"bool":{"minimum_should_match":1,"should":[` +
+		`{"range":{"date":{"gte":"2024-03-15T00:00:00.000","lt":"now"}}},` +
+		`{"range":{"date":{"gte":"2024-03-15T00:00:00.000||-1w","lt":"now-1w"}}}]}}`
+	if string(b) != expected {
+		t.Errorf("invalid query\nexpected: %s\nactual:   %s", expected, b)
+	}
+
+	b, err = json.Marshal(request.Aggregations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{"comparison":{"aggregations":{"carrier":{"aggregations":{"parcels":{"cardinality":{"field":"id"}}},"terms":{"field":"carrier","size":100}}},` +
+		`"filters":{"filters":{"current":{"range":{"date":{"gte":"2024-03-15T00:00:00.000","lt":"now"}}},` +
+		`"previous":{"range":{"date":{"gte":"2024-03-15T00:00:00.000||-1w","lt":"now-1w"}}}}}}}`
+	if string(b) != expected {
+		t.Errorf("invalid aggregations\nexpected: %s\nactual:   %s", expected, b)
+	}
+}
+
+func TestParseSearchResponseV8Comparison(t *testing.T) {
+	f := engine.Fact{
+		Name:   "test",
+		Model:  "parcel",
+		Intent: &engine.IntentFragment{Name: "parcels", Operator: engine.Count, Term: "id"},
+		Dimensions: []*engine.DimensionFragment{
+			{Name: "carrier", Operator: engine.By, Term: "carrier"},
+		},
+		Condition:  &engine.LeafConditionFragment{Operator: engine.Between, Field: "date", Value: "2024-03-15T00:00:00.000", Value2: "now"},
+		Comparison: &engine.ComparisonFragment{Field: "date", Shift: "1w"},
+	}
+	raw := `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+		"hits":{"total":{"value":9,"relation":"eq"},"hits":[]},
+		"aggregations":{"comparison":{"buckets":{
+			"current":{"doc_count":6,"carrier":{"buckets":[{"key":"dhl","doc_count":4,"parcels":{"value":4}},{"key":"ups","doc_count":2,"parcels":{"value":2}}]}},
+			"previous":{"doc_count":3,"carrier":{"buckets":[{"key":"dhl","doc_count":2,"parcels":{"value":2}},{"key":"fedex","doc_count":1,"parcels":{"value":1}}]}}
+		}}}}`
+	result, err := ProcessSearchResponseV8(f, time.Now(), newSearchResponse(t, raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 6 {
+		t.Errorf("invalid total %d", result.Total)
+	}
+	if result.Comparison == nil {
+		t.Fatal("missing comparison")
+	}
+	if docCount, _ := result.Comparison.PreviousItem.GetValue(engine.DocCountAgg); docCount != int64(3) {
+		t.Errorf("invalid previous documents count %v", docCount)
+	}
+
+	carriers := result.Buckets["carrier"]
+	if len(carriers) != 2 {
+		t.Fatalf("invalid carriers %+v", carriers)
+	}
+	if previous, _ := carriers[0].GetValue("parcels_previous"); previous != 2.0 {
+		t.Errorf("invalid previous value %v", previous)
+	}
+	if delta, _ := carriers[0].GetValue("parcels_delta"); delta != 2.0 {
+		t.Errorf("invalid delta %v", delta)
+	}
+	if relativeDelta, _ := carriers[0].GetValue("parcels_relative_delta"); relativeDelta != 1.0 {
+		t.Errorf("invalid relative delta %v", relativeDelta)
+	}
+	if _, ok := carriers[1].GetValue("parcels_previous"); ok {
+		t.Error("ups has no previous value")
+	}
+}
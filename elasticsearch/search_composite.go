@@ -0,0 +1,350 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+	"go.uber.org/zap"
+)
+
+// CompositeAggName is the name of the composite aggregation of a fact in composite mode
+const CompositeAggName = "composite"
+
+const defaultCompositeSize = 1000
+
+// SearchFunc executes a search request and returns its response
+type SearchFunc func(ctx context.Context, request *search.Request) (*search.Response, error)
+
+// SearchIndices returns a SearchFunc executing the search requests on some indices with the global client
+// The numeric sort values of the hits are json.Number, which keep the precision of the long values (dates in nanoseconds,
+// _shard_doc...) to be used as search_after
+func SearchIndices(indices ...string) SearchFunc {
+	return func(ctx context.Context, request *search.Request) (*search.Response, error) {
+		s := C().Search().Request(request).TypedKeys(true)
+		for _, index := range indices {
+			s.Index(index)
+		}
+		res, err := s.Perform(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode < 299 {
+			return decodeSearchResponse(res.Body)
+		}
+		errorResponse := types.NewElasticsearchError()
+		if err := json.NewDecoder(res.Body).Decode(errorResponse); err != nil {
+			return nil, err
+		}
+		if errorResponse.Status == 0 {
+			errorResponse.Status = res.StatusCode
+		}
+		return nil, errorResponse
+	}
+}
+
+// buildElasticComposite builds a composite aggregation with a source per dimension, in the dimensions order
+func buildElasticComposite(name string, intent types.Aggregations, dimensions []*engine.DimensionFragment, size int, pipelines map[string]types.Aggregations) (string, types.Aggregations, error) {
+	if size == 0 {
+		size = defaultCompositeSize
+	}
+
+	composite := &types.CompositeAggregation{
+		Size: some.Int(size),
+	}
+
+	for _, frag := range dimensions {
+		source := types.CompositeAggregationSource{}
+		var order *sortorder.SortOrder
+		if frag.OrderDirection == "desc" {
+			order = &sortorder.Desc
+		}
+
+		switch frag.Operator {
+		case engine.By:
+			source.Terms = &types.CompositeTermsAggregation{
+				Field: some.String(frag.Term),
+				Order: order,
+			}
+			if frag.Missing != "" {
+				source.Terms.MissingBucket = some.Bool(true)
+			}
+
+		case engine.Histogram:
+			interval := types.Float64(frag.Interval)
+			if interval == 0 {
+				interval = engine.DefaultHistogramInterval
+			}
+			source.Histogram = &types.CompositeHistogramAggregation{
+				Field:    some.String(frag.Term),
+				Interval: interval,
+				Order:    order,
+			}
+
+		case engine.DateHistogram:
+			histogram := &types.CompositeDateHistogramAggregation{
+				Field: some.String(frag.Term),
+				Order: order,
+			}
+			if frag.TimeZone != "" {
+				histogram.TimeZone = some.String(frag.TimeZone)
+			}
+			if frag.CalendarFixed {
+				interval := frag.DateInterval
+				if interval == "" {
+					interval = "1d"
+				} else if _, err := time.ParseDuration(interval); err != nil {
+					return "", types.Aggregations{}, err
+				}
+				histogram.FixedInterval = some.String(interval)
+			} else {
+				interval := frag.DateInterval
+				if interval == "" {
+					interval = "month" // default ?
+				}
+				histogram.CalendarInterval = some.String(interval)
+			}
+			source.DateHistogram = histogram
+
+		default:
+			return "", types.Aggregations{}, errors.New("dimension " + frag.Operator.String() + " is not supported in composite mode")
+		}
+
+		composite.Sources = append(composite.Sources, map[string]types.CompositeAggregationSource{frag.AggregationName(): source})
+	}
+
+	agg := types.Aggregations{
+		Composite:    composite,
+		Aggregations: map[string]types.Aggregations{name: intent},
+	}
+	for pipelineName, pipeline := range pipelines {
+		agg.Aggregations[pipelineName] = pipeline
+	}
+	return CompositeAggName, agg, nil
+}
+
+// SetCompositeAfterKey sets the after key of the composite aggregation of a search request, to fetch the following page
+func SetCompositeAfterKey(request *search.Request, afterKey map[string]interface{}) error {
+	agg, ok := request.Aggregations[CompositeAggName]
+	if !ok || agg.Composite == nil {
+		return errors.New("no composite aggregation in search request")
+	}
+	after := make(types.CompositeAggregateKey, len(afterKey))
+	for k, v := range afterKey {
+		after[k] = v
+	}
+	agg.Composite.After = after
+	request.Aggregations[CompositeAggName] = agg
+	return nil
+}
+
+// parseCompositeAggregation converts the flat composite buckets to the standard fact result tree (last dimension first)
+// The documents count of the intermediate items is the sum of their sub-items documents count
+func parseCompositeAggregation(result *engine.FactResult, aggs map[string]interface{}, intent *engine.IntentFragment, pipelines []*engine.PipelineFragment, dimensions []*engine.DimensionFragment) error {
+	raw, ok := aggs[CompositeAggName].(map[string]interface{})
+	if !ok {
+		return errors.New("aggregation " + CompositeAggName + " not found")
+	}
+	rawBuckets, ok := raw["buckets"].([]interface{})
+	if !ok {
+		return errors.New("aggregation " + CompositeAggName + " has no buckets")
+	}
+	if afterKey, ok := raw["after_key"].(map[string]interface{}); ok && len(rawBuckets) > 0 {
+		result.AfterKey = afterKey
+	}
+
+	intentName := intent.AggregationName()
+	index := make(itemIndex)
+	for _, rawBucket := range rawBuckets {
+		bucket, ok := rawBucket.(map[string]interface{})
+		if !ok {
+			return errors.New("invalid bucket in aggregation " + CompositeAggName)
+		}
+		keys, ok := bucket["key"].(map[string]interface{})
+		if !ok {
+			return errors.New("invalid bucket key in aggregation " + CompositeAggName)
+		}
+		docCount, _ := bucket["doc_count"].(float64)
+
+		item := &result.Item
+		for i := len(dimensions) - 1; i >= 0; i-- {
+			name := dimensions[i].AggregationName()
+			key := keys[name]
+			if key == nil && dimensions[i].Missing != "" {
+				key = dimensions[i].Missing
+			}
+			item = index.findOrAdd(item, name, formatBucketKey(key))
+			addDocCount(item, int64(docCount))
+		}
+
+		rawIntent, ok := bucket[intentName].(map[string]interface{})
+		if !ok {
+			return errors.New("aggregation " + intentName + " not found")
+		}
+		value, err := parseMetricValue(intent, rawIntent)
+		if err != nil {
+			return err
+		}
+		item.SetValue(intentName, value)
+		parsePipelines(item, bucket, pipelines)
+	}
+	return nil
+}
+
+// itemIndex indexes the sub-items of the items of a result tree by dimension and key
+type itemIndex map[*engine.Item]map[string]*engine.Item
+
+// findOrAdd returns the sub-item of a dimension with a key, added if it does not exist
+func (index itemIndex) findOrAdd(parent *engine.Item, dimension string, key string) *engine.Item {
+	children, ok := index[parent]
+	if !ok {
+		children = make(map[string]*engine.Item)
+		for name, items := range parent.Buckets {
+			for _, item := range items {
+				children[name+"\x00"+item.Key] = item
+			}
+		}
+		index[parent] = children
+	}
+	if item, ok := children[dimension+"\x00"+key]; ok {
+		return item
+	}
+	if parent.Buckets == nil {
+		parent.Buckets = make(map[string][]*engine.Item)
+	}
+	item := &engine.Item{Key: key}
+	parent.Buckets[dimension] = append(parent.Buckets[dimension], item)
+	children[dimension+"\x00"+key] = item
+	return item
+}
+
+// merge adds the sub-items of src in dst, the documents count of the items existing in both are summed
+func (index itemIndex) merge(dst *engine.Item, src *engine.Item) {
+	for dimension, items := range src.Buckets {
+		for _, item := range items {
+			existing := index.findOrAdd(dst, dimension, item.Key)
+			for name, agg := range item.Aggs {
+				if name == engine.DocCountAgg {
+					addDocCount(existing, agg.Value)
+					continue
+				}
+				existing.SetValue(name, agg.Value)
+			}
+			index.merge(existing, item)
+		}
+	}
+}
+
+func addDocCount(item *engine.Item, count interface{}) {
+	previous, _ := item.GetValue(engine.DocCountAgg)
+	p, _ := previous.(int64)
+	c, _ := count.(int64)
+	item.SetValue(engine.DocCountAgg, p+c)
+}
+
+// CompositeIterator pages the composite aggregation of a fact with its after key until exhaustion
+type CompositeIterator struct {
+	fact    engine.Fact
+	ti      time.Time
+	request *search.Request
+	search  SearchFunc
+	page    *engine.FactResult
+	done    bool
+	err     error
+}
+
+// NewCompositeIterator builds the search request of a fact in composite mode and returns an iterator on its pages
+func NewCompositeIterator(f engine.Fact, ti time.Time, parameters map[string]interface{}, search SearchFunc) (*CompositeIterator, error) {
+	if !f.Composite {
+		return nil, errors.New("fact is not in composite mode")
+	}
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+	}
+	request, err := ConvertFactToSearchRequestV8(f, ti, parameters)
+	if err != nil {
+		return nil, err
+	}
+	request.Size = some.Int(0)
+	return &CompositeIterator{fact: f, ti: ti, request: request, search: search}, nil
+}
+
+// Next fetches the next page, and returns false when every page has been fetched or if an error occurred
+func (it *CompositeIterator) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+	if it.page != nil {
+		if err := SetCompositeAfterKey(it.request, it.page.AfterKey); err != nil {
+			it.err = err
+			it.done = true
+			return false
+		}
+	}
+
+	response, err := it.search(ctx, it.request)
+	if err != nil {
+		zap.L().Warn("CompositeIterator search", zap.Error(err))
+		it.err = err
+		it.done = true
+		return false
+	}
+	page, err := ParseSearchResponseV8(it.fact, response)
+	if err != nil {
+		it.err = err
+		it.done = true
+		return false
+	}
+	it.page = page
+	if page.AfterKey == nil {
+		it.done = true
+		return len(page.Buckets) > 0
+	}
+	return true
+}
+
+// Page returns the last fetched page (without restitution)
+func (it *CompositeIterator) Page() *engine.FactResult {
+	return it.page
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *CompositeIterator) Err() error {
+	return it.err
+}
+
+// All fetches every remaining page, merges them in a single result and applies the fact restitution steps
+func (it *CompositeIterator) All(ctx context.Context) (*engine.FactResult, error) {
+	var result *engine.FactResult
+	index := make(itemIndex)
+	for it.Next(ctx) {
+		page := it.Page()
+		if result == nil {
+			result = &engine.FactResult{Item: engine.Item{Aggs: page.Aggs}, Total: page.Total}
+		}
+		index.merge(&result.Item, &page.Item)
+	}
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+	if result == nil {
+		result = &engine.FactResult{}
+		if it.page != nil {
+			result.Aggs = it.page.Aggs
+			result.Total = it.page.Total
+		}
+	}
+	if err := it.fact.Restitute(&result.Item, it.ti); err != nil {
+		zap.L().Warn("Restitute", zap.Error(err))
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+)
+
+func TestConvertFactToCompositeSearchRequest(t *testing.T) {
+	f := engine.Fact{
+		Name:   "test",
+		Model:  "parcel",
+		Intent: &engine.IntentFragment{Name: "weight", Operator: engine.Sum, Term: "weight"},
+		Dimensions: []*engine.DimensionFragment{
+			{Name: "customer", Operator: engine.By, Term: "customer", Missing: "none"},
+			{Name: "day", Operator: engine.DateHistogram, Term: "date", DateInterval: "day"},
+		},
+		Composite:     true,
+		CompositeSize: 2,
+	}
+	request, err := ConvertFactToSearchRequestV8(f, time.Now(), map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCompositeAfterKey(request, map[string]interface{}{"customer": "c2", "day": 1704067200000}); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(request.Aggregations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"composite":{"aggregations":{"weight":{"sum":{"field":"weight"}}},"composite":{"after":{"customer":"c2","day":1704067200000},"size":2,"sources":[{"customer":{"terms":{"field":"customer","missing_bucket":true}}},{"day":{"date_histogram":{"calendar_interval":"day","field":"date"}}}]}}}`
+	if string(b) != expected {
+		t.Errorf("invalid composite aggregation\nexpected: %s\ngot:      %s", expected, string(b))
+	}
+}
+
+func TestCompositeIterator(t *testing.T) {
+	f := engine.Fact{
+		Name:   "test",
+		Model:  "parcel",
+		Intent: &engine.IntentFragment{Name: "weight", Operator: engine.Sum, Term: "weight"},
+		Dimensions: []*engine.DimensionFragment{
+			{Name: "customer", Operator: engine.By, Term: "customer", Missing: "none"},
+			{Name: "day", Operator: engine.DateHistogram, Term: "date", DateInterval: "day"},
+		},
+		Composite:     true,
+		CompositeSize: 2,
+	}
+	pages := []string{
+		`{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+			"hits":{"total":{"value":4,"relation":"eq"},"hits":[]},
+			"aggregations":{"composite":{"after_key":{"customer":"c1","day":1704153600000},"buckets":[
+				{"key":{"customer":"c1","day":1704067200000},"doc_count":1,"weight":{"value":1.5}},
+				{"key":{"customer":"c1","day":1704153600000},"doc_count":1,"weight":{"value":2}}
+			]}}}`,
+		`{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+			"hits":{"total":{"value":4,"relation":"eq"},"hits":[]},
+			"aggregations":{"composite":{"after_key":{"customer":null,"day":1704067200000},"buckets":[
+				{"key":{"customer":"c2","day":1704067200000},"doc_count":1,"weight":{"value":3}},
+				{"key":{"customer":null,"day":1704067200000},"doc_count":1,"weight":{"value":4}}
+			]}}}`,
+		`{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+			"hits":{"total":{"value":4,"relation":"eq"},"hits":[]},
+			"aggregations":{"composite":{"buckets":[]}}}`,
+	}
+
+	calls := 0
+	searchFunc := func(ctx context.Context, request *search.Request) (*search.Response, error) {
+		if calls > 0 && request.Aggregations[CompositeAggName].Composite.After == nil {
+			t.Errorf("page %d requested without after key", calls)
+		}
+		response := search.NewResponse()
+		err := json.Unmarshal([]byte(pages[calls]), response)
+		calls++
+		return response, err
+	}
+
+	it, err := NewCompositeIterator(f, time.Now(), nil, searchFunc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := it.All(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 pages, got %d", calls)
+	}
+	if result.Total != 4 {
+		t.Errorf("invalid total %d", result.Total)
+	}
+
+	days := result.Buckets["day"]
+	if len(days) != 2 || days[0].Key != "1704067200000" || days[1].Key != "1704153600000" {
+		t.Fatalf("invalid days %+v", days)
+	}
+	if docCount, _ := days[0].GetValue(engine.DocCountAgg); docCount != int64(3) {
+		t.Errorf("invalid first day doc count %v", docCount)
+	}
+	customers := days[0].Buckets["customer"]
+	if len(customers) != 3 || customers[0].Key != "c1" || customers[1].Key != "c2" || customers[2].Key != "none" {
+		t.Fatalf("invalid customers %+v", customers)
+	}
+	if value, _ := customers[2].GetValue("weight"); value != 4.0 {
+		t.Errorf("invalid missing customer weight %v", value)
+	}
+}
@@ -0,0 +1,332 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+	"go.uber.org/zap"
+)
+
+const (
+	deleteIndicesAggName  = "indices"
+	deleteSamplesAggName  = "samples"
+	defaultDeleteSamples  = 10
+	maxDeleteIndicesCount = 1000
+)
+
+// DeleteByQueryFunc executes a delete-by-query request deleting at most maxDocs documents (0 means no limit)
+// and returns the number of deleted documents
+type DeleteByQueryFunc func(ctx context.Context, query *types.Query, maxDocs int64) (int64, error)
+
+// DeleteTarget is the target of a delete fact execution, which counts and deletes the documents on the same indices
+type DeleteTarget struct {
+	indices       []string
+	search        SearchFunc
+	deleteByQuery DeleteByQueryFunc
+}
+
+// DeleteIndices returns a DeleteTarget executing the count search and the delete-by-query requests on some indices
+// with the global client
+func DeleteIndices(indices ...string) DeleteTarget {
+	return DeleteTarget{
+		indices:       indices,
+		search:        SearchIndices(indices...),
+		deleteByQuery: deleteByQueryIndices(indices...),
+	}
+}
+
+// deleteByQueryIndices returns a DeleteByQueryFunc executing the delete-by-query requests on some indices with the global client
+func deleteByQueryIndices(indices ...string) DeleteByQueryFunc {
+	return func(ctx context.Context, query *types.Query, maxDocs int64) (int64, error) {
+		d := C().DeleteByQuery(strings.Join(indices, ",")).Query(query)
+		if maxDocs > 0 {
+			d.MaxDocs(maxDocs)
+		}
+		response, err := d.Do(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if response.Deleted == nil {
+			return 0, nil
+		}
+		return *response.Deleted, nil
+	}
+}
+
+// DeleteAudit is the audit record of a delete fact execution (dry-runs and aborted executions included)
+type DeleteAudit struct {
+	Time       time.Time              `json:"time"`
+	User       string                 `json:"user"`
+	FactID     int64                  `json:"factId"`
+	FactName   string                 `json:"factName"`
+	Model      string                 `json:"model"`
+	Indices    []string               `json:"indices"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Query      json.RawMessage        `json:"query,omitempty"`
+	DryRun     bool                   `json:"dryRun"`
+	Matched    int64                  `json:"matched"`
+	Deleted    int64                  `json:"deleted"`
+	Aborted    bool                   `json:"aborted"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// AuditFunc records the audit of a delete fact execution
+type AuditFunc func(ctx context.Context, audit DeleteAudit) error
+
+// LogAudit is an AuditFunc writing the audit records in the global logger
+func LogAudit(ctx context.Context, audit DeleteAudit) error {
+	zap.L().Info("Delete fact audit",
+		zap.Time("time", audit.Time),
+		zap.String("user", audit.User),
+		zap.Int64("factId", audit.FactID),
+		zap.String("factName", audit.FactName),
+		zap.String("model", audit.Model),
+		zap.Strings("indices", audit.Indices),
+		zap.Any("parameters", audit.Parameters),
+		zap.ByteString("query", audit.Query),
+		zap.Bool("dryRun", audit.DryRun),
+		zap.Int64("matched", audit.Matched),
+		zap.Int64("deleted", audit.Deleted),
+		zap.Bool("aborted", audit.Aborted),
+		zap.String("error", audit.Error),
+	)
+	return nil
+}
+
+// DeleteOptions defines the safety controls of a delete fact execution
+// * User is the user running the delete, mandatory for the audit record
+// * DryRun only reports the matching documents, without deleting them
+// * MaxDocuments aborts the execution if more documents match (0 means no limit), and caps the delete-by-query
+// * SampleSize is the number of sample ids reported per index (default to 10)
+type DeleteOptions struct {
+	User         string
+	DryRun       bool
+	MaxDocuments int64
+	SampleSize   int
+}
+
+// DeleteIndexReport is the number of documents matching a delete fact in an index, with some of their ids
+type DeleteIndexReport struct {
+	Index     string   `json:"index"`
+	Count     int64    `json:"count"`
+	SampleIDs []string `json:"sampleIds"`
+}
+
+// DeleteReport is the report of a delete fact execution
+type DeleteReport struct {
+	DryRun  bool                `json:"dryRun"`
+	Matched int64               `json:"matched"`
+	Deleted int64               `json:"deleted"`
+	Indices []DeleteIndexReport `json:"indices"`
+}
+
+// MaxDocumentsError is returned when a delete fact matches more documents than allowed
+type MaxDocumentsError struct {
+	Matched      int64
+	MaxDocuments int64
+}
+
+func (e MaxDocumentsError) Error() string {
+	return fmt.Sprintf("delete aborted: %d documents match, more than the maximum of %d", e.Matched, e.MaxDocuments)
+}
+
+// ExecuteDeleteFact counts the documents matching a delete fact per index, then deletes them unless DryRun is set
+// or more documents than MaxDocuments match. A delete fact without condition, or which query matches every document,
+// is refused. Every execution, refused ones included, is recorded with audit, and the report is returned even if the execution has been aborted
+func ExecuteDeleteFact(ctx context.Context, f engine.Fact, ti time.Time, parameters map[string]interface{}, options DeleteOptions,
+	target DeleteTarget, audit AuditFunc) (*DeleteReport, error) {
+	if audit == nil {
+		return nil, errors.New("missing delete audit")
+	}
+	if options.SampleSize <= 0 {
+		options.SampleSize = defaultDeleteSamples
+	}
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+	}
+
+	record := DeleteAudit{
+		Time:       ti,
+		User:       options.User,
+		FactID:     f.ID,
+		FactName:   f.Name,
+		Model:      f.Model,
+		Indices:    target.indices,
+		Parameters: copyParameters(parameters),
+		DryRun:     options.DryRun,
+	}
+	report, err := executeDelete(ctx, f, ti, parameters, options, target, &record)
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if auditErr := audit(ctx, record); auditErr != nil {
+		zap.L().Error("Delete fact audit", zap.Error(auditErr), zap.Any("audit", record))
+		if err == nil {
+			err = errors.New("delete audit failed: " + auditErr.Error())
+		}
+	}
+	return report, err
+}
+
+func executeDelete(ctx context.Context, f engine.Fact, ti time.Time, parameters map[string]interface{}, options DeleteOptions,
+	target DeleteTarget, record *DeleteAudit) (*DeleteReport, error) {
+	if err := checkDelete(f, options, target); err != nil {
+		record.Aborted = true
+		return nil, err
+	}
+
+	request, err := ConvertFactToSearchRequestV8(f, ti, parameters)
+	if err != nil {
+		return nil, err
+	}
+	if record.Query, err = json.Marshal(request.Query); err != nil {
+		return nil, err
+	}
+	if matchesAllDocuments(request.Query) {
+		record.Aborted = true
+		return nil, errors.New("refusing to delete a fact which query matches every document")
+	}
+
+	request.Size = some.Int(0)
+	request.TrackTotalHits = true
+	request.Aggregations = map[string]types.Aggregations{
+		deleteIndicesAggName: {
+			Terms: &types.TermsAggregation{Field: some.String("_index"), Size: some.Int(maxDeleteIndicesCount)},
+			Aggregations: map[string]types.Aggregations{
+				deleteSamplesAggName: {TopHits: &types.TopHitsAggregation{Size: some.Int(options.SampleSize), Source_: false}},
+			},
+		},
+	}
+	response, err := target.search(ctx, request)
+	if err != nil {
+		zap.L().Warn("ExecuteDeleteFact search", zap.Error(err))
+		return nil, err
+	}
+	report, err := parseDeleteReport(response)
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = options.DryRun
+	record.Matched = report.Matched
+
+	if options.MaxDocuments > 0 && report.Matched > options.MaxDocuments {
+		record.Aborted = true
+		return report, MaxDocumentsError{Matched: report.Matched, MaxDocuments: options.MaxDocuments}
+	}
+	if options.DryRun || report.Matched == 0 {
+		return report, nil
+	}
+
+	deleted, err := target.deleteByQuery(ctx, request.Query, options.MaxDocuments)
+	report.Deleted = deleted
+	record.Deleted = deleted
+	if err != nil {
+		zap.L().Warn("ExecuteDeleteFact delete by query", zap.Error(err))
+		return report, err
+	}
+	return report, nil
+}
+
+// checkDelete refuses the delete facts which cannot be executed before any request is built
+func checkDelete(f engine.Fact, options DeleteOptions, target DeleteTarget) error {
+	if f.Intent == nil || f.Intent.Operator != engine.Delete {
+		return errors.New("fact intent is not delete")
+	}
+	if f.Condition == nil {
+		return errors.New("refusing to delete a fact without condition")
+	}
+	if len(target.indices) == 0 {
+		return errors.New("missing delete indices")
+	}
+	if options.User == "" {
+		return errors.New("missing user for the delete audit")
+	}
+	return nil
+}
+
+// matchesAllDocuments returns true if a query does not restrict the matching documents, like the empty bool query
+// built from a condition which optional fragments are all unset
+func matchesAllDocuments(query *types.Query) bool {
+	if query == nil || query.MatchAll != nil {
+		return true
+	}
+	if query.Bool == nil {
+		return reflect.DeepEqual(*query, types.Query{})
+	}
+	if len(query.Bool.MustNot) > 0 {
+		return false
+	}
+	for i := range query.Bool.Must {
+		if !matchesAllDocuments(&query.Bool.Must[i]) {
+			return false
+		}
+	}
+	for i := range query.Bool.Filter {
+		if !matchesAllDocuments(&query.Bool.Filter[i]) {
+			return false
+		}
+	}
+	for i := range query.Bool.Should {
+		if matchesAllDocuments(&query.Bool.Should[i]) {
+			return true
+		}
+	}
+	// should clauses only restrict the documents without must or filter clauses
+	return len(query.Bool.Should) == 0 || len(query.Bool.Must)+len(query.Bool.Filter) > 0
+}
+
+func parseDeleteReport(response *search.Response) (*DeleteReport, error) {
+	report := &DeleteReport{Indices: make([]DeleteIndexReport, 0)}
+	if response.Hits.Total != nil {
+		report.Matched = response.Hits.Total.Value
+	}
+
+	b, err := json.Marshal(response.Aggregations)
+	if err != nil {
+		return nil, err
+	}
+	var aggs struct {
+		Indices struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int64  `json:"doc_count"`
+				Samples  struct {
+					Hits struct {
+						Hits []struct {
+							ID string `json:"_id"`
+						} `json:"hits"`
+					} `json:"hits"`
+				} `json:"samples"`
+			} `json:"buckets"`
+		} `json:"indices"`
+	}
+	if err := json.Unmarshal(b, &aggs); err != nil {
+		return nil, err
+	}
+	for _, bucket := range aggs.Indices.Buckets {
+		index := DeleteIndexReport{Index: bucket.Key, Count: bucket.DocCount, SampleIDs: make([]string, 0, len(bucket.Samples.Hits.Hits))}
+		for _, hit := range bucket.Samples.Hits.Hits {
+			index.SampleIDs = append(index.SampleIDs, hit.ID)
+		}
+		report.Indices = append(report.Indices, index)
+	}
+	return report, nil
+}
+
+// copyParameters copies the user parameters, before the date keywords are added by the contextualization
+func copyParameters(parameters map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(parameters))
+	for k, v := range parameters {
+		copied[k] = v
+	}
+	return copied
+}
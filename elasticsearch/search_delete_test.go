@@ -0,0 +1,223 @@
+package elasticsearch
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+)
+
+const deleteResponse = `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+	"hits":{"total":{"value":5,"relation":"eq"},"hits":[]},
+	"aggregations":{"indices":{"buckets":[
+		{"key":"parcel-2024.01","doc_count":3,"samples":{"hits":{"total":{"value":3,"relation":"eq"},"hits":[{"_index":"parcel-2024.01","_id":"a"},{"_index":"parcel-2024.01","_id":"b"}]}}},
+		{"key":"parcel-2024.02","doc_count":2,"samples":{"hits":{"total":{"value":2,"relation":"eq"},"hits":[{"_index":"parcel-2024.02","_id":"c"}]}}}
+	]}}}`
+
+type deleteRecorder struct {
+	calls   int
+	maxDocs int64
+	deleted int64
+	err     error
+	audits  []DeleteAudit
+}
+
+func (r *deleteRecorder) deleteByQuery(ctx context.Context, query *types.Query, maxDocs int64) (int64, error) {
+	r.calls++
+	r.maxDocs = maxDocs
+	if r.err != nil {
+		return r.deleted, r.err
+	}
+	return 5, nil
+}
+
+func (r *deleteRecorder) target(t *testing.T) DeleteTarget {
+	return DeleteTarget{indices: []string{"parcel-*"}, search: fakeSearch(t, deleteResponse), deleteByQuery: r.deleteByQuery}
+}
+
+func (r *deleteRecorder) audit(ctx context.Context, audit DeleteAudit) error {
+	r.audits = append(r.audits, audit)
+	return nil
+}
+
+func TestExecuteDeleteFactDryRun(t *testing.T) {
+	f := engine.Fact{
+		ID:        12,
+		Intent:    &engine.IntentFragment{Operator: engine.Delete},
+		Condition: &engine.LeafConditionFragment{Operator: engine.For, Field: "status", Value: "lost"},
+	}
+	recorder := &deleteRecorder{}
+	parameters := map[string]interface{}{"status": "lost"}
+	report, err := ExecuteDeleteFact(context.Background(), f, time.Now(), parameters,
+		DeleteOptions{User: "admin", DryRun: true, SampleSize: 2}, recorder.target(t), recorder.audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &DeleteReport{DryRun: true, Matched: 5, Indices: []DeleteIndexReport{
+		{Index: "parcel-2024.01", Count: 3, SampleIDs: []string{"a", "b"}},
+		{Index: "parcel-2024.02", Count: 2, SampleIDs: []string{"c"}},
+	}}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("invalid report\nexpected: %+v\nactual:   %+v", expected, report)
+	}
+	if recorder.calls != 0 {
+		t.Error("dry-run should not delete documents")
+	}
+	if len(recorder.audits) != 1 {
+		t.Fatalf("expected an audit record, got %d", len(recorder.audits))
+	}
+	audit := recorder.audits[0]
+	if audit.User != "admin" || audit.FactID != 12 || !audit.DryRun || audit.Matched != 5 ||
+		!reflect.DeepEqual(audit.Indices, []string{"parcel-*"}) ||
+		!reflect.DeepEqual(audit.Parameters, map[string]interface{}{"status": "lost"}) ||
+		string(audit.Query) != `{"term":{"status":{"value":"lost"}}}` {
+		t.Errorf("invalid audit %+v (query %s)", audit, audit.Query)
+	}
+}
+
+func TestExecuteDeleteFactMaxDocuments(t *testing.T) {
+	f := engine.Fact{
+		ID:        12,
+		Intent:    &engine.IntentFragment{Operator: engine.Delete},
+		Condition: &engine.LeafConditionFragment{Operator: engine.For, Field: "status", Value: "lost"},
+	}
+	recorder := &deleteRecorder{}
+	parameters := map[string]interface{}{"status": "lost"}
+	report, err := ExecuteDeleteFact(context.Background(), f, time.Now(), parameters,
+		DeleteOptions{User: "admin", MaxDocuments: 4}, recorder.target(t), recorder.audit)
+	var maxErr MaxDocumentsError
+	if !errors.As(err, &maxErr) || maxErr.Matched != 5 || report == nil {
+		t.Fatalf("expected a max documents error, got %v", err)
+	}
+	if recorder.calls != 0 || !recorder.audits[0].Aborted || recorder.audits[0].Error == "" {
+		t.Errorf("delete should be aborted and audited, got %d calls and %+v", recorder.calls, recorder.audits)
+	}
+
+	report, err = ExecuteDeleteFact(context.Background(), f, time.Now(), map[string]interface{}{"status": "lost"},
+		DeleteOptions{User: "admin", MaxDocuments: 10}, recorder.target(t), recorder.audit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Deleted != 5 || recorder.calls != 1 || recorder.maxDocs != 10 || recorder.audits[1].Deleted != 5 {
+		t.Errorf("invalid delete %+v, %d calls with max docs %d", report, recorder.calls, recorder.maxDocs)
+	}
+
+	if _, err := ExecuteDeleteFact(context.Background(), f, time.Now(), nil,
+		DeleteOptions{}, recorder.target(t), recorder.audit); err == nil {
+		t.Error("expected an error without user")
+	}
+
+	f.Condition = nil
+	if _, err := ExecuteDeleteFact(context.Background(), f, time.Now(), nil,
+		DeleteOptions{User: "admin", DryRun: true}, recorder.target(t), recorder.audit); err == nil {
+		t.Error("expected an error without condition")
+	}
+
+	f.Condition = &engine.LeafConditionFragment{Operator: engine.For, Field: "status", Value: "lost"}
+	if _, err := ExecuteDeleteFact(context.Background(), f, time.Now(), nil,
+		DeleteOptions{User: "admin", DryRun: true}, DeleteTarget{}, recorder.audit); err == nil {
+		t.Error("expected an error without indices")
+	}
+
+	if len(recorder.audits) != 5 {
+		t.Fatalf("the refused deletes should be audited, got %d audit records", len(recorder.audits))
+	}
+	for _, audit := range recorder.audits[2:] {
+		if !audit.Aborted || audit.Error == "" || audit.Matched != 0 {
+			t.Errorf("invalid refused delete audit %+v", audit)
+		}
+	}
+	if recorder.calls != 1 {
+		t.Errorf("the refused deletes should not delete documents, got %d calls", recorder.calls)
+	}
+}
+
+func TestExecuteDeleteFactDeleteError(t *testing.T) {
+	f := engine.Fact{
+		ID:        12,
+		Name:      "lost parcels",
+		Model:     "parcel",
+		Intent:    &engine.IntentFragment{Operator: engine.Delete},
+		Condition: &engine.LeafConditionFragment{Operator: engine.For, Field: "status", Value: "lost"},
+	}
+	recorder := &deleteRecorder{deleted: 2, err: errors.New("version conflict")}
+	report, err := ExecuteDeleteFact(context.Background(), f, time.Now(), map[string]interface{}{"status": "lost"},
+		DeleteOptions{User: "admin"}, recorder.target(t), recorder.audit)
+	if err == nil || report == nil {
+		t.Fatalf("expected the delete by query error with a report, got %v", err)
+	}
+	if report.Matched != 5 || report.Deleted != 2 || recorder.calls != 1 || recorder.maxDocs != 0 {
+		t.Errorf("invalid delete %+v, %d calls with max docs %d", report, recorder.calls, recorder.maxDocs)
+	}
+	if len(recorder.audits) != 1 {
+		t.Fatalf("expected an audit record, got %d", len(recorder.audits))
+	}
+	audit := recorder.audits[0]
+	if audit.User != "admin" || audit.FactID != 12 || audit.FactName != "lost parcels" || audit.Model != "parcel" ||
+		audit.DryRun || audit.Aborted || audit.Matched != 5 || audit.Deleted != 2 || audit.Error != "version conflict" {
+		t.Errorf("invalid audit %+v", audit)
+	}
+}
+
+func TestExecuteDeleteFactMatchAll(t *testing.T) {
+	conditions := map[string]engine.ConditionFragment{
+		"unset optional for": &engine.BooleanFragment{Operator: engine.And, Fragments: []engine.ConditionFragment{
+			&engine.LeafConditionFragment{Operator: engine.OptionalFor, Field: "customer", Value: "customer"},
+		}},
+		"false if": &engine.BooleanFragment{Operator: engine.If, Expression: "1 == 2", Fragments: []engine.ConditionFragment{
+			&engine.LeafConditionFragment{Operator: engine.For, Field: "status", Value: "status"},
+		}},
+	}
+	for name, condition := range conditions {
+		t.Run(name, func(t *testing.T) {
+			f := engine.Fact{ID: 12, Name: "purge", Model: "parcel", Intent: &engine.IntentFragment{Operator: engine.Delete, Term: "parcel"}, Condition: condition}
+			if ok, err := f.IsValid(); !ok {
+				t.Fatalf("the delete fact should be valid: %v", err)
+			}
+			if err := f.ContextualizeCondition(time.Now(), map[string]interface{}{"status": "lost"}); err != nil {
+				t.Fatal(err)
+			}
+			recorder := &deleteRecorder{}
+			_, err := ExecuteDeleteFact(context.Background(), f, time.Now(), map[string]interface{}{},
+				DeleteOptions{User: "admin"}, recorder.target(t), recorder.audit)
+			if err == nil {
+				t.Fatal("expected an error for a query matching every document")
+			}
+			if recorder.calls != 0 {
+				t.Error("a query matching every document should not delete documents")
+			}
+			if len(recorder.audits) != 1 || !recorder.audits[0].Aborted || recorder.audits[0].Error == "" {
+				t.Errorf("the refused delete should be audited, got %+v", recorder.audits)
+			}
+		})
+	}
+}
+
+func TestMatchesAllDocuments(t *testing.T) {
+	term := types.Query{Term: map[string]types.TermQuery{"status": {Value: "lost"}}}
+	queries := []struct {
+		query    *types.Query
+		expected bool
+	}{
+		{nil, true},
+		{&types.Query{}, true},
+		{&types.Query{MatchAll: &types.MatchAllQuery{}}, true},
+		{&types.Query{Bool: &types.BoolQuery{}}, true},
+		{&types.Query{Bool: &types.BoolQuery{Must: []types.Query{{Bool: &types.BoolQuery{}}}}}, true},
+		{&types.Query{Bool: &types.BoolQuery{Must: []types.Query{{}}, Should: []types.Query{term}}}, true},
+		{&term, false},
+		{&types.Query{Bool: &types.BoolQuery{Must: []types.Query{term}}}, false},
+		{&types.Query{Bool: &types.BoolQuery{Should: []types.Query{term}}}, false},
+		{&types.Query{Bool: &types.BoolQuery{MustNot: []types.Query{{}}}}, false},
+	}
+	for i, q := range queries {
+		if matchesAllDocuments(q.query) != q.expected {
+			t.Errorf("query %d: expected %t", i, q.expected)
+		}
+	}
+}
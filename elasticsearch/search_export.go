@@ -0,0 +1,257 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/some"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultExportPageSize  = 1000
+	defaultExportKeepAlive = "1m"
+)
+
+// PointInTime opens and closes the point-in-times used by the exports
+type PointInTime interface {
+	Open(ctx context.Context, keepAlive string) (string, error)
+	Close(ctx context.Context, id string) error
+}
+
+type indicesPointInTime struct {
+	indices string
+}
+
+// PointInTimeIndices returns a PointInTime opening the point-in-times on some indices with the global client
+func PointInTimeIndices(indices ...string) PointInTime {
+	return &indicesPointInTime{indices: strings.Join(indices, ",")}
+}
+
+func (pit *indicesPointInTime) Open(ctx context.Context, keepAlive string) (string, error) {
+	response, err := C().OpenPointInTime(pit.indices).KeepAlive(keepAlive).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return response.Id, nil
+}
+
+func (pit *indicesPointInTime) Close(ctx context.Context, id string) error {
+	_, err := C().ClosePointInTime().Id(id).Do(ctx)
+	return err
+}
+
+// ExportOptions defines the pagination of an export
+// * PageSize is the number of hits fetched by search request (default to 1000)
+// * KeepAlive is the time a point-in-time is kept alive between two pages (default to 1m)
+// * PitID and SearchAfter are the point-in-time id and the sort values of the last exported hit of an interrupted export, to resume it
+// The numeric sort values are json.Number (see SearchIndices) to keep the precision of the long values, they must be kept
+// as json.Number (or decoded with json.Decoder.UseNumber) by a caller storing them
+// The sort values are only meaningful in their point-in-time (the implicit _shard_doc tiebreaker is not stable across point-in-times),
+// so an export is always resumed in the point-in-time of the interrupted export, before its keep alive expires
+type ExportOptions struct {
+	PageSize    int
+	KeepAlive   string
+	PitID       string
+	SearchAfter []interface{}
+}
+
+// HitFunc is called for every exported hit, the export stops if it returns an error
+type HitFunc func(hit engine.Hit) error
+
+// Exporter streams every hit of a Select fact, paging with search_after in a point-in-time
+// It is not limited by index.max_result_window, and can be resumed with the point-in-time id and the sort values of the last exported hit
+type Exporter struct {
+	request  *search.Request
+	search   SearchFunc
+	pit      PointInTime
+	options  ExportOptions
+	pitID    string
+	lastSort []interface{}
+	count    int64
+}
+
+// NewExporter builds the search request of a Select fact and returns an exporter on its hits
+// The search function must not target any index, as the point-in-time defines the searched indices
+func NewExporter(f engine.Fact, ti time.Time, parameters map[string]interface{}, search SearchFunc, pit PointInTime, options ExportOptions) (*Exporter, error) {
+	if f.Intent == nil || f.Intent.Operator != engine.Select {
+		return nil, errors.New("export requires a select intent")
+	}
+	if len(options.SearchAfter) > 0 && options.PitID == "" {
+		return nil, errors.New("resuming an export requires the point-in-time id of the interrupted export")
+	}
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+	}
+	if options.PageSize <= 0 {
+		options.PageSize = defaultExportPageSize
+	}
+	if options.KeepAlive == "" {
+		options.KeepAlive = defaultExportKeepAlive
+	}
+	request, err := ConvertFactToSearchRequestV8(f, ti, parameters)
+	if err != nil {
+		return nil, err
+	}
+	request.Size = some.Int(options.PageSize)
+	request.TrackTotalHits = false
+	if len(request.Sort) == 0 {
+		// _shard_doc is the most efficient sort in a point-in-time, and is also the implicit tiebreaker of every sort
+		request.Sort = []types.SortCombinations{"_shard_doc"}
+	}
+	return &Exporter{request: request, search: search, pit: pit, options: options, pitID: options.PitID, lastSort: options.SearchAfter}, nil
+}
+
+// Export calls fn on every hit until exhaustion, cancellation of ctx or an error, in the point-in-time of ExportOptions.PitID or in a new one
+// The point-in-time is closed once every hit is exported. If the export is interrupted, it is kept open until its keep alive expires,
+// and PitID and LastSort return the options to resume the export from (the caller closes it with the PointInTime if it is not resumed)
+func (e *Exporter) Export(ctx context.Context, fn HitFunc) error {
+	if e.pitID == "" {
+		id, err := e.pit.Open(ctx, e.options.KeepAlive)
+		if err != nil {
+			return err
+		}
+		e.pitID = id
+	}
+
+	if err := e.export(ctx, fn); err != nil {
+		return err
+	}
+
+	if err := e.pit.Close(ctx, e.pitID); err != nil {
+		zap.L().Warn("Exporter close point-in-time", zap.Error(err))
+	}
+	e.pitID = ""
+	return nil
+}
+
+func (e *Exporter) export(ctx context.Context, fn HitFunc) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		e.request.Pit = &types.PointInTimeReference{Id: e.pitID, KeepAlive: e.options.KeepAlive}
+		e.request.SearchAfter = nil
+		for _, value := range e.lastSort {
+			e.request.SearchAfter = append(e.request.SearchAfter, value)
+		}
+
+		response, err := e.search(ctx, e.request)
+		if err != nil {
+			zap.L().Warn("Exporter search", zap.Error(err))
+			return err
+		}
+		if response.PitId != nil && *response.PitId != "" {
+			e.pitID = *response.PitId
+		}
+		hits, err := parseHits(response.Hits.Hits)
+		if err != nil {
+			return err
+		}
+		for _, hit := range hits {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(hit); err != nil {
+				return err
+			}
+			e.lastSort = hit.Sort
+			e.count++
+		}
+		if len(hits) < e.options.PageSize {
+			return nil
+		}
+	}
+}
+
+// ExportNDJSON writes the source of every hit as a JSON document per line
+func (e *Exporter) ExportNDJSON(ctx context.Context, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return e.Export(ctx, func(hit engine.Hit) error {
+		return encoder.Encode(hit.Source)
+	})
+}
+
+// ExportCSV writes a header with the columns, then a line per hit with the values of the columns in its source
+// Columns are dot separated paths in the source, objects and arrays values are written as JSON
+func (e *Exporter) ExportCSV(ctx context.Context, w io.Writer, columns []string) error {
+	if len(columns) == 0 {
+		return errors.New("missing CSV columns")
+	}
+	writer := csv.NewWriter(w)
+	if e.lastSort == nil {
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(columns))
+	err := e.Export(ctx, func(hit engine.Hit) error {
+		for i, column := range columns {
+			value, err := csvValue(lookupSource(hit.Source, column))
+			if err != nil {
+				return err
+			}
+			record[i] = value
+		}
+		return writer.Write(record)
+	})
+	writer.Flush()
+	if err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// LastSort returns the sort values of the last exported hit, to be used as ExportOptions.SearchAfter to resume the export
+func (e *Exporter) LastSort() []interface{} {
+	return e.lastSort
+}
+
+// PitID returns the id of the point-in-time of an interrupted export, to be used as ExportOptions.PitID to resume the export
+// It is empty once every hit is exported, as the point-in-time is closed
+func (e *Exporter) PitID() string {
+	return e.pitID
+}
+
+// Count returns the number of hits exported by the exporter
+func (e *Exporter) Count() int64 {
+	return e.count
+}
+
+func lookupSource(source map[string]interface{}, path string) interface{} {
+	var value interface{} = source
+	for _, part := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	return value
+}
+
+func csvValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	return fmt.Sprint(value), nil
+}
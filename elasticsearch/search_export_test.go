@@ -0,0 +1,195 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+)
+
+type fakePointInTime struct {
+	opened int
+	closed int
+}
+
+func (pit *fakePointInTime) Open(ctx context.Context, keepAlive string) (string, error) {
+	pit.opened++
+	return "pit-id", nil
+}
+
+func (pit *fakePointInTime) Close(ctx context.Context, id string) error {
+	pit.closed++
+	return nil
+}
+
+// pagingSearch serves 5 documents sorted by their seq field, after the search_after value
+func pagingSearch(t *testing.T, requests *[]*search.Request) SearchFunc {
+	return func(ctx context.Context, request *search.Request) (*search.Response, error) {
+		b, _ := json.Marshal(request)
+		copied := search.NewRequest()
+		if err := json.Unmarshal(b, copied); err != nil {
+			t.Fatal(err)
+		}
+		*requests = append(*requests, copied)
+
+		after := -1.0
+		if len(request.SearchAfter) > 0 {
+			after = request.SearchAfter[0].(float64)
+		}
+		hits := make([]string, 0)
+		for seq := 0; seq < 5 && len(hits) < *request.Size; seq++ {
+			if float64(seq) > after {
+				hits = append(hits, fmt.Sprintf(`{"_index":"parcel","_id":"%d","_source":{"seq":%d,"carrier":{"name":"c%d"},"tags":["a","b"]},"sort":[%d]}`, seq, seq, seq, seq))
+			}
+		}
+		return newSearchResponse(t, `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},"pit_id":"pit-id",
+			"hits":{"hits":[`+strings.Join(hits, ",")+`]}}`), nil
+	}
+}
+
+func TestExporterNDJSON(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Operator: engine.Select},
+		Sort:   []types.SortCombinations{map[string]interface{}{"seq": "asc"}},
+	}
+	requests := make([]*search.Request, 0)
+	pit := &fakePointInTime{}
+	exporter, err := NewExporter(f, time.Now(), nil, pagingSearch(t, &requests), pit, ExportOptions{PageSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := exporter.ExportNDJSON(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 5 || lines[0] != `{"carrier":{"name":"c0"},"seq":0,"tags":["a","b"]}` {
+		t.Errorf("invalid export %s", buf.String())
+	}
+	if len(requests) != 3 || exporter.Count() != 5 {
+		t.Errorf("expected 3 pages and 5 hits, got %d pages and %d hits", len(requests), exporter.Count())
+	}
+	if requests[0].Pit == nil || requests[0].Pit.Id != "pit-id" || requests[0].SearchAfter != nil {
+		t.Errorf("invalid first page request %+v", requests[0])
+	}
+	if !reflect.DeepEqual(requests[2].SearchAfter, []types.FieldValue{3.0}) {
+		t.Errorf("invalid search after %v", requests[2].SearchAfter)
+	}
+	if pit.opened != 1 || pit.closed != 1 || exporter.PitID() != "" {
+		t.Errorf("point-in-time should be opened and closed once, got %d and %d", pit.opened, pit.closed)
+	}
+}
+
+func TestExporterCSVResume(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Operator: engine.Select},
+		Sort:   []types.SortCombinations{map[string]interface{}{"seq": "asc"}},
+	}
+	requests := make([]*search.Request, 0)
+	pit := &fakePointInTime{}
+	exporter, err := NewExporter(f, time.Now(), nil, pagingSearch(t, &requests), pit, ExportOptions{PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := errors.New("stop")
+	exported := 0
+	err = exporter.Export(context.Background(), func(hit engine.Hit) error {
+		if exported == 2 {
+			return stop
+		}
+		exported++
+		return nil
+	})
+	if err != stop || !reflect.DeepEqual(exporter.LastSort(), []interface{}{1.0}) || exporter.PitID() != "pit-id" {
+		t.Fatalf("expected an interrupted export after the second hit, got %v %v %q", err, exporter.LastSort(), exporter.PitID())
+	}
+	if pit.closed != 0 {
+		t.Error("the point-in-time of an interrupted export must be kept open")
+	}
+
+	if _, err := NewExporter(f, time.Now(), nil, pagingSearch(t, &requests), pit, ExportOptions{SearchAfter: exporter.LastSort()}); err == nil {
+		t.Error("expected an error when resuming without the point-in-time id")
+	}
+	exporter, err = NewExporter(f, time.Now(), nil, pagingSearch(t, &requests), pit, ExportOptions{PitID: exporter.PitID(), SearchAfter: exporter.LastSort()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := exporter.ExportCSV(context.Background(), &buf, []string{"seq", "carrier.name", "tags"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := "2,c2,\"[\"\"a\"\",\"\"b\"\"]\"\n3,c3,\"[\"\"a\"\",\"\"b\"\"]\"\n4,c4,\"[\"\"a\"\",\"\"b\"\"]\"\n"
+	if buf.String() != expected {
+		t.Errorf("invalid export\nexpected: %s\nactual:   %s", expected, buf.String())
+	}
+	if pit.opened != 1 || pit.closed != 1 {
+		t.Errorf("the export should be resumed in its point-in-time, got %d opened and %d closed", pit.opened, pit.closed)
+	}
+}
+
+func TestExporterCancel(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Operator: engine.Select},
+		Sort:   []types.SortCombinations{map[string]interface{}{"seq": "asc"}},
+	}
+	requests := make([]*search.Request, 0)
+	pit := &fakePointInTime{}
+	exporter, err := NewExporter(f, time.Now(), nil, pagingSearch(t, &requests), pit, ExportOptions{PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err = exporter.Export(ctx, func(hit engine.Hit) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || exporter.Count() != 1 || exporter.PitID() == "" {
+		t.Errorf("expected a cancelled export after a hit, got %v after %d hits", err, exporter.Count())
+	}
+
+	f.Intent.Operator = engine.Count
+	if _, err := NewExporter(f, time.Now(), nil, pagingSearch(t, &requests), pit, ExportOptions{}); err == nil {
+		t.Error("expected an error for a fact without select intent")
+	}
+}
+
+func TestExporterSortPrecision(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Operator: engine.Select},
+		Sort:   []types.SortCombinations{map[string]interface{}{"date_nanos": "asc"}},
+	}
+	searchAfters := make([]string, 0)
+	searchFunc := func(ctx context.Context, request *search.Request) (*search.Response, error) {
+		b, _ := json.Marshal(request.SearchAfter)
+		searchAfters = append(searchAfters, string(b))
+		hits := ""
+		if len(searchAfters) == 1 {
+			hits = `{"_index":"parcel","_id":"a","_source":{},"sort":[1704067200123456789,"a"]}`
+		}
+		return decodeSearchResponse(strings.NewReader(`{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+			"hits":{"hits":[` + hits + `]}}`))
+	}
+	exporter, err := NewExporter(f, time.Now(), nil, searchFunc, &fakePointInTime{}, ExportOptions{PageSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Export(context.Background(), func(hit engine.Hit) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(searchAfters) != 2 || searchAfters[1] != `[1704067200123456789,"a"]` {
+		t.Errorf("the sort values should keep their precision, got %v", searchAfters)
+	}
+	if !reflect.DeepEqual(exporter.LastSort(), []interface{}{json.Number("1704067200123456789"), "a"}) {
+		t.Errorf("invalid last sort %v", exporter.LastSort())
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/calendarinterval"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
 
 	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/some"
@@ -36,12 +37,34 @@ func ConvertFactToSearchRequestV8(f engine.Fact, ti time.Time, parameters map[st
 			zap.L().Warn("buildElasticAgg", zap.Error(err))
 			return nil, err
 		}
-		aggName, agg, err := buildElasticBucket(mainAggName, mainAgg, f.Dimensions)
+		pipelines, err := buildElasticPipelines(f.Pipelines)
 		if err != nil {
-			zap.L().Warn("buildElasticBucket", zap.Error(err))
+			zap.L().Warn("buildElasticPipelines", zap.Error(err))
 			return nil, err
 		}
+		var aggName string
+		var agg types.Aggregations
+		if f.Composite {
+			aggName, agg, err = buildElasticComposite(mainAggName, mainAgg, f.Dimensions, f.CompositeSize, pipelines)
+			if err != nil {
+				zap.L().Warn("buildElasticComposite", zap.Error(err))
+				return nil, err
+			}
+		} else {
+			aggName, agg, err = buildElasticBucket(mainAggName, mainAgg, f.Dimensions, pipelines)
+			if err != nil {
+				zap.L().Warn("buildElasticBucket", zap.Error(err))
+				return nil, err
+			}
+		}
 		aggregations := map[string]types.Aggregations{aggName: agg}
+		if f.Comparison != nil {
+			aggregations, err = buildElasticComparison(f, request, aggregations, parameters)
+			if err != nil {
+				zap.L().Warn("buildElasticComparison", zap.Error(err))
+				return nil, err
+			}
+		}
 		request.Aggregations = aggregations
 	}
 
@@ -53,32 +76,51 @@ func ConvertFactToSearchRequestV8(f engine.Fact, ti time.Time, parameters map[st
 }
 
 // // buildElasticBucket
-func buildElasticBucket(name string, intent types.Aggregations, dimensions []*engine.DimensionFragment) (string, types.Aggregations, error) {
+// The pipelines aggregations are siblings of the intent aggregation, in the first dimension buckets
+func buildElasticBucket(name string, intent types.Aggregations, dimensions []*engine.DimensionFragment, pipelines map[string]types.Aggregations) (string, types.Aggregations, error) {
 	var output types.Aggregations
 
 	output = intent
-	for _, frag := range dimensions {
+	for i, frag := range dimensions {
 
 		agg := types.Aggregations{
 			Aggregations: make(map[string]types.Aggregations),
 		}
+		if i == 0 {
+			for pipelineName, pipeline := range pipelines {
+				agg.Aggregations[pipelineName] = pipeline
+			}
+		}
 
 		switch frag.Operator {
 		case engine.By:
 			size := frag.Size
 			if size == 0 {
-				size = 100 // default ?
+				size = engine.DefaultDimensionSize
 			}
 			agg.Terms = &types.TermsAggregation{
 				Field: some.String(frag.Term),
 				Size:  some.Int(size),
 			}
+			if frag.Missing != "" {
+				agg.Terms.Missing = frag.Missing
+			}
+			if frag.MinDocCount != nil {
+				agg.Terms.MinDocCount = some.Int(*frag.MinDocCount)
+			}
+			if frag.OrderBy != "" {
+				direction := sortorder.Desc
+				if frag.OrderDirection == "asc" {
+					direction = sortorder.Asc
+				}
+				agg.Terms.Order = map[string]sortorder.SortOrder{frag.OrderBy: direction}
+			}
 			agg.Aggregations[name] = output
 
 		case engine.Histogram:
 			var interval = types.Float64(frag.Interval)
 			if interval == 0 {
-				interval = 100 // default ?
+				interval = engine.DefaultHistogramInterval
 			}
 			agg.Histogram = &types.HistogramAggregation{
 				Field:    some.String(frag.Term),
@@ -117,15 +159,75 @@ func buildElasticBucket(name string, intent types.Aggregations, dimensions []*en
 
 			agg.DateHistogram = histogramAgg
 			agg.Aggregations[name] = output
-		}
 
-		output = agg
+		case engine.Range:
+			rangeAgg := &types.RangeAggregation{
+				Field: some.String(frag.Term),
+			}
+			for _, r := range frag.Ranges {
+				aggRange := types.AggregationRange{}
+				if r.Key != "" {
+					aggRange.Key = some.String(r.Key)
+				}
+				if from, ok := convertValueToESFloat64(r.From); ok {
+					aggRange.From = &from
+				}
+				if to, ok := convertValueToESFloat64(r.To); ok {
+					aggRange.To = &to
+				}
+				rangeAgg.Ranges = append(rangeAgg.Ranges, aggRange)
+			}
+			agg.Range = rangeAgg
+			agg.Aggregations[name] = output
+
+		case engine.DateRange:
+			dateRangeAgg := &types.DateRangeAggregation{
+				Field: some.String(frag.Term),
+			}
+			if frag.TimeZone != "" {
+				dateRangeAgg.TimeZone = some.String(frag.TimeZone)
+			}
+			for _, r := range frag.Ranges {
+				expr := types.DateRangeExpression{
+					From: r.From,
+					To:   r.To,
+				}
+				if r.Key != "" {
+					expr.Key = some.String(r.Key)
+				}
+				dateRangeAgg.Ranges = append(dateRangeAgg.Ranges, expr)
+			}
+			agg.DateRange = dateRangeAgg
+			agg.Aggregations[name] = output
+
+		case engine.GeoHashGrid:
+			size := frag.Size
+			if size == 0 {
+				size = engine.DefaultDimensionSize
+			}
+			agg.GeohashGrid = &types.GeoHashGridAggregation{
+				Field:     some.String(frag.Term),
+				Precision: frag.GeoPrecision(),
+				Size:      some.Int(size),
+			}
+			agg.Aggregations[name] = output
 
-		name = fmt.Sprintf("%s_%s", frag.Operator.String(), frag.Term)
-		if frag.Name != "" {
-			name = frag.Name
+		case engine.GeoTileGrid:
+			size := frag.Size
+			if size == 0 {
+				size = engine.DefaultDimensionSize
+			}
+			agg.GeotileGrid = &types.GeoTileGridAggregation{
+				Field:     some.String(frag.Term),
+				Precision: some.Int(frag.GeoPrecision()),
+				Size:      some.Int(size),
+			}
+			agg.Aggregations[name] = output
 		}
 
+		output = agg
+
+		name = frag.AggregationName()
 	}
 	return name, output, nil
 }
@@ -135,10 +237,7 @@ func buildElasticAgg(frag *engine.IntentFragment) (string, types.Aggregations, e
 		return "", types.Aggregations{}, errors.New("no intent fragment")
 	}
 
-	name := fmt.Sprintf("%s_%s", frag.Operator.String(), frag.Term)
-	if frag.Name != "" {
-		name = frag.Name
-	}
+	name := frag.AggregationName()
 
 	agg := types.Aggregations{
 		Aggregations: make(map[string]types.Aggregations),
@@ -170,12 +269,87 @@ func buildElasticAgg(frag *engine.IntentFragment) (string, types.Aggregations, e
 			Field: some.String(frag.Term),
 		}
 
+	case engine.Percentiles:
+		percentiles := &types.PercentilesAggregation{
+			Field: some.String(frag.Term),
+		}
+		for _, percent := range frag.Percents {
+			percentiles.Percents = append(percentiles.Percents, types.Float64(percent))
+		}
+		agg.Percentiles = percentiles
+
+	case engine.Median:
+		agg.Percentiles = &types.PercentilesAggregation{
+			Field:    some.String(frag.Term),
+			Percents: []types.Float64{50},
+		}
+
+	case engine.ExtendedStats:
+		agg.ExtendedStats = &types.ExtendedStatsAggregation{
+			Field: some.String(frag.Term),
+		}
+
+	case engine.ValueCount:
+		agg.ValueCount = &types.ValueCountAggregation{
+			Field: some.String(frag.Term),
+		}
+
+	case engine.DistinctCount:
+		agg.Cardinality = &types.CardinalityAggregation{
+			Field: some.String(frag.Term),
+		}
+		if frag.PrecisionThreshold > 0 {
+			agg.Cardinality.PrecisionThreshold = some.Int(frag.PrecisionThreshold)
+		}
+
 	default:
 		return "", types.Aggregations{}, errors.New("Invalid intent kind: " + frag.Operator.String())
 	}
 	return name, agg, nil
 }
 
+// buildElasticPipelines builds the pipeline aggregations of the secondary intents, by name
+func buildElasticPipelines(pipelines []*engine.PipelineFragment) (map[string]types.Aggregations, error) {
+	aggs := make(map[string]types.Aggregations, len(pipelines))
+	for _, frag := range pipelines {
+		agg := types.Aggregations{}
+
+		switch frag.Operator {
+		case engine.BucketScript:
+			bucketsPath := make(map[string]string, len(frag.Variables))
+			for variable, path := range frag.Variables {
+				bucketsPath[variable] = path
+			}
+			agg.BucketScript = &types.BucketScriptAggregation{
+				BucketsPath: bucketsPath,
+				Script:      &types.Script{Source: some.String(frag.Script)},
+			}
+
+		case engine.CumulativeSum:
+			agg.CumulativeSum = &types.CumulativeSumAggregation{
+				BucketsPath: frag.Intent,
+			}
+
+		case engine.Derivative:
+			agg.Derivative = &types.DerivativeAggregation{
+				BucketsPath: frag.Intent,
+			}
+
+		case engine.MovingAvg:
+			agg.MovingFn = &types.MovingFunctionAggregation{
+				BucketsPath: frag.Intent,
+				Script:      some.String("MovingFunctions.unweightedAvg(values)"),
+				Window:      some.Int(frag.Window),
+			}
+
+		default:
+			return nil, errors.New("Invalid pipeline kind: " + frag.Operator.String())
+		}
+		aggs[frag.Name] = agg
+	}
+	return aggs, nil
+}
+
 func buildElasticFilter(frag engine.ConditionFragment, variables map[string]interface{}) (*types.Query, error) {
 	var query = types.NewQuery()
 
@@ -229,6 +403,19 @@ func buildElasticFilter(frag engine.ConditionFragment, variables map[string]inte
 			}
 		}
 
+	case *engine.NestedFragment:
+		subQuery, err := buildElasticFilter(f.Fragment, variables)
+		if err != nil {
+			return nil, err
+		}
+		if subQuery == nil {
+			return nil, nil
+		}
+		query.Nested = &types.NestedQuery{
+			Path:  f.Path,
+			Query: *subQuery,
+		}
+
 	case *engine.LeafConditionFragment:
 		switch f.Operator {
 		case engine.Exists:
@@ -260,7 +447,7 @@ func buildElasticFilter(frag engine.ConditionFragment, variables map[string]inte
 				f.Field: createRangeQuery(f.Field, f.Value, f.Value2, f.TimeZone),
 			}
 		case engine.OptionalFor:
-			if f.Field == "" || isEmptyValue(f.Value) {
+			if f.Field == "" || engine.IsEmptyValue(f.Value) {
 				return nil, nil
 			}
 			if reflect.ValueOf(f.Value).Kind() == reflect.Slice {
@@ -302,6 +489,21 @@ func buildElasticFilter(frag engine.ConditionFragment, variables map[string]inte
 					f.Field: {Value: &value},
 				}
 			}
+		case engine.GeoDistance:
+			distance, err := geoDistance(f.Value2)
+			if err != nil {
+				return nil, err
+			}
+			query.GeoDistance = &types.GeoDistanceQuery{
+				Distance:         distance,
+				GeoDistanceQuery: map[string]types.GeoLocation{f.Field: f.Value},
+			}
+		case engine.GeoBoundingBox:
+			query.GeoBoundingBox = &types.GeoBoundingBoxQuery{
+				GeoBoundingBoxQuery: map[string]types.GeoBounds{
+					f.Field: types.TopLeftBottomRightGeoBounds{TopLeft: f.Value, BottomRight: f.Value2},
+				},
+			}
 
 		default:
 			return nil, errors.New("Invalid filter kind: " + f.Operator.String())
@@ -310,33 +512,15 @@ func buildElasticFilter(frag engine.ConditionFragment, variables map[string]inte
 	return query, nil
 }
 
-// isEmptyValue checks if a value is empty regardless of its type
-// Warning: This function is suitable for non-intensive usage due to reflection cost
-func isEmptyValue(v interface{}) bool {
-	if v == nil {
-		return true
+// geoDistance converts a distance to the elasticsearch format, numbers are meters
+func geoDistance(value interface{}) (string, error) {
+	if distance, ok := value.(string); ok && distance != "" {
+		return distance, nil
 	}
-
-	value := reflect.ValueOf(v)
-	switch value.Kind() {
-	case reflect.String:
-		return value.String() == ""
-	case reflect.Array, reflect.Slice, reflect.Map:
-		return value.Len() == 0
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return value.Int() == 0
-	case reflect.Float32, reflect.Float64:
-		return value.Float() == 0
-	case reflect.Bool:
-		return !value.Bool()
-	case reflect.Ptr, reflect.Interface:
-		if value.IsNil() {
-			return true
-		}
-		return isEmptyValue(value.Elem().Interface())
+	if distance, ok := convertValueToESFloat64(value); ok {
+		return fmt.Sprintf("%vm", float64(distance)), nil
 	}
-
-	return false
+	return "", fmt.Errorf("invalid geo distance %v", value)
 }
 
 func convertValueToESFloat64(value interface{}) (types.Float64, bool) {
@@ -345,6 +529,8 @@ func convertValueToESFloat64(value interface{}) (types.Float64, bool) {
 	}
 
 	switch v := value.(type) {
+	case int:
+		return types.Float64(v), true
 	case int64:
 		return types.Float64(v), true
 	case int32:
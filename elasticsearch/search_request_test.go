@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
 	"github.com/myrteametrics/myrtea-sdk/v5/engine"
 )
 
@@ -86,7 +87,7 @@ func TestBuildAgg(t *testing.T) {
 	// t.Log(string(b))
 	// t.Fail()
 
-	name2, agg2, err := buildElasticBucket(name, agg, f.Dimensions)
+	name2, agg2, err := buildElasticBucket(name, agg, f.Dimensions, nil)
 	if err != nil {
 		t.Error(err)
 	}
@@ -425,3 +426,222 @@ func TestBuildElasticFilterWithWildCard(t *testing.T) {
 		t.Errorf("Wildcard query for 'monChamp' not found")
 	}
 }
+
+func TestBuildElasticAggStatistics(t *testing.T) {
+	_, agg, err := buildElasticAgg(&engine.IntentFragment{Operator: engine.Percentiles, Term: "delay", Percents: []float64{95, 99}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agg.Percentiles == nil || len(agg.Percentiles.Percents) != 2 || agg.Percentiles.Percents[0] != 95 {
+		t.Errorf("invalid percentiles aggregation %+v", agg.Percentiles)
+	}
+
+	_, agg, err = buildElasticAgg(&engine.IntentFragment{Operator: engine.Median, Term: "delay"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agg.Percentiles == nil || len(agg.Percentiles.Percents) != 1 || agg.Percentiles.Percents[0] != 50 {
+		t.Errorf("invalid median aggregation %+v", agg.Percentiles)
+	}
+
+	_, agg, err = buildElasticAgg(&engine.IntentFragment{Operator: engine.ExtendedStats, Term: "delay"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agg.ExtendedStats == nil {
+		t.Error("missing extended_stats aggregation")
+	}
+
+	_, agg, err = buildElasticAgg(&engine.IntentFragment{Operator: engine.ValueCount, Term: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agg.ValueCount == nil || agg.Cardinality != nil {
+		t.Error("valuecount intent must be a value_count aggregation")
+	}
+
+	_, agg, err = buildElasticAgg(&engine.IntentFragment{Operator: engine.DistinctCount, Term: "id", PrecisionThreshold: 3000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agg.Cardinality == nil || agg.Cardinality.PrecisionThreshold == nil || *agg.Cardinality.PrecisionThreshold != 3000 {
+		t.Errorf("invalid cardinality aggregation %+v", agg.Cardinality)
+	}
+}
+
+func TestBuildElasticBucketRanges(t *testing.T) {
+	minDocCount := 0
+	dimensions := []*engine.DimensionFragment{
+		{
+			Operator:       engine.By,
+			Term:           "status",
+			Missing:        "unknown",
+			MinDocCount:    &minDocCount,
+			OrderBy:        "_key",
+			OrderDirection: "asc",
+		},
+		{
+			Name:     "delay",
+			Operator: engine.Range,
+			Term:     "delay_days",
+			Ranges: []engine.DimensionRange{
+				{Key: "0-2 days", To: 2.0},
+				{Key: "2-5 days", From: 2.0, To: 5},
+				{Key: ">5 days", From: 5.0},
+			},
+		},
+		{
+			Name:     "age",
+			Operator: engine.DateRange,
+			Term:     "created",
+			TimeZone: "Europe/Paris",
+			Ranges: []engine.DimensionRange{
+				{Key: "recent", From: "now-2d/d"},
+				{Key: "old", To: "now-2d/d"},
+			},
+		},
+	}
+
+	name, agg, err := buildElasticBucket("count_id", types.Aggregations{}, dimensions, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "age" {
+		t.Errorf("unexpected aggregation name %s", name)
+	}
+	if agg.DateRange == nil || len(agg.DateRange.Ranges) != 2 || *agg.DateRange.Ranges[0].Key != "recent" || *agg.DateRange.TimeZone != "Europe/Paris" {
+		t.Fatalf("invalid date_range aggregation %+v", agg.DateRange)
+	}
+
+	rangeAgg := agg.Aggregations["delay"]
+	if rangeAgg.Range == nil || len(rangeAgg.Range.Ranges) != 3 {
+		t.Fatalf("invalid range aggregation %+v", rangeAgg.Range)
+	}
+	if rangeAgg.Range.Ranges[0].From != nil || *rangeAgg.Range.Ranges[0].To != 2 {
+		t.Errorf("invalid first range %+v", rangeAgg.Range.Ranges[0])
+	}
+	if *rangeAgg.Range.Ranges[1].From != 2 || *rangeAgg.Range.Ranges[1].To != 5 {
+		t.Errorf("invalid second range %+v", rangeAgg.Range.Ranges[1])
+	}
+
+	termsAgg := rangeAgg.Aggregations["by_status"]
+	if termsAgg.Terms == nil {
+		t.Fatal("missing terms aggregation")
+	}
+	if termsAgg.Terms.Missing != "unknown" || *termsAgg.Terms.MinDocCount != 0 {
+		t.Errorf("invalid terms aggregation %+v", termsAgg.Terms)
+	}
+	b, _ := json.Marshal(termsAgg.Terms.Order)
+	if string(b) != `{"_key":"asc"}` {
+		t.Errorf("invalid terms order %s", string(b))
+	}
+}
+
+func TestBuildElasticFilterWithNested(t *testing.T) {
+	condition := &engine.NestedFragment{
+		Operator: engine.Nested,
+		Path:     "events",
+		Fragment: &engine.BooleanFragment{
+			Operator: engine.And,
+			Fragments: []engine.ConditionFragment{
+				&engine.LeafConditionFragment{Operator: engine.For, Field: "events.status", Value: "delivered"},
+				&engine.LeafConditionFragment{Operator: engine.OptionalFor, Field: "events.site", Value: ""},
+			},
+		},
+	}
+
+	query, err := buildElasticFilter(condition, make(map[string]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Nested == nil {
+		t.Fatal("nested query not found")
+	}
+	if query.Nested.Path != "events" {
+		t.Errorf("Expected nested path 'events', got '%s'", query.Nested.Path)
+	}
+	if query.Nested.Query.Bool == nil || len(query.Nested.Query.Bool.Must) != 1 {
+		t.Errorf("invalid nested inner query %+v", query.Nested.Query)
+	}
+
+	condition.Fragment = &engine.LeafConditionFragment{Operator: engine.OptionalFor, Field: "events.site", Value: ""}
+	query, err = buildElasticFilter(condition, make(map[string]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != nil {
+		t.Error("nested query with an empty optional condition should be skipped")
+	}
+}
+
+func TestConvertFactWithPipelines(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Name: "late", Operator: engine.Sum, Term: "is_late"},
+		Pipelines: []*engine.PipelineFragment{
+			{Name: "ratio", Operator: engine.BucketScript, Script: "params.late / params.total", Variables: map[string]string{"late": "late", "total": "_count"}},
+			{Name: "cumul", Operator: engine.CumulativeSum, Intent: "late"},
+			{Name: "trend", Operator: engine.Derivative, Intent: "ratio"},
+			{Name: "avg", Operator: engine.MovingAvg, Intent: "ratio", Window: 7},
+		},
+		Dimensions: []*engine.DimensionFragment{
+			{Name: "day", Operator: engine.DateHistogram, Term: "date", DateInterval: "day"},
+			{Name: "site", Operator: engine.By, Term: "site"},
+		},
+	}
+
+	request, err := ConvertFactToSearchRequestV8(f, time.Now(), map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(request.Aggregations["site"].Aggregations["day"].Aggregations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"avg":{"moving_fn":{"buckets_path":"ratio","script":"MovingFunctions.unweightedAvg(values)","window":7}},` +
+		`"cumul":{"cumulative_sum":{"buckets_path":"late"}},` +
+		`"late":{"sum":{"field":"is_late"}},` +
+		`"ratio":{"bucket_script":{"buckets_path":{"late":"late","total":"_count"},"script":{"source":"params.late / params.total"}}},` +
+		`"trend":{"derivative":{"buckets_path":"ratio"}}}`
+	if string(b) != expected {
+		t.Errorf("invalid pipelines aggregations\nexpected: %s\ngot:      %s", expected, string(b))
+	}
+}
+
+func TestBuildElasticGeo(t *testing.T) {
+	condition := &engine.BooleanFragment{
+		Operator: engine.And,
+		Fragments: []engine.ConditionFragment{
+			&engine.LeafConditionFragment{Operator: engine.GeoDistance, Field: "location", Value: map[string]interface{}{"lat": 48.85, "lon": 2.35}, Value2: "5km"},
+			&engine.LeafConditionFragment{Operator: engine.GeoBoundingBox, Field: "location", Value: "49.0,2.0", Value2: "48.0,3.0"},
+		},
+	}
+	query, err := buildElasticFilter(condition, make(map[string]interface{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(query.Bool.Must)
+	expected := `[{"geo_distance":{"distance":"5km","location":{"lat":48.85,"lon":2.35}}},{"geo_bounding_box":{"location":{"bottom_right":"48.0,3.0","top_left":"49.0,2.0"}}}]`
+	if string(b) != expected {
+		t.Errorf("invalid geo queries\nexpected: %s\ngot:      %s", expected, string(b))
+	}
+
+	_, err = buildElasticFilter(&engine.LeafConditionFragment{Operator: engine.GeoDistance, Field: "location", Value: "48.85,2.35", Value2: 500}, make(map[string]interface{}))
+	if err != nil {
+		t.Error(err)
+	}
+
+	precision := 10
+	dimensions := []*engine.DimensionFragment{
+		{Name: "tile", Operator: engine.GeoTileGrid, Term: "location", Precision: &precision},
+		{Name: "hash", Operator: engine.GeoHashGrid, Term: "location"},
+	}
+	_, agg, err := buildElasticBucket("count_id", types.Aggregations{}, dimensions, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(agg)
+	expected = `{"aggregations":{"tile":{"aggregations":{"count_id":{}},"geotile_grid":{"field":"location","precision":10,"size":100}}},"geohash_grid":{"field":"location","precision":5,"size":100}}`
+	if string(b) != expected {
+		t.Errorf("invalid geo aggregations\nexpected: %s\ngot:      %s", expected, string(b))
+	}
+}
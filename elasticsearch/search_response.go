@@ -0,0 +1,321 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+	"go.uber.org/zap"
+)
+
+// decodeSearchResponse decodes a search response, with the numeric sort values of its hits as json.Number
+// (the typed response decodes them as float64, which loses the precision of the values above 2^53)
+func decodeSearchResponse(body io.Reader) (*search.Response, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	response := search.NewResponse()
+	if err := json.Unmarshal(data, response); err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		Hits struct {
+			Hits []struct {
+				Sort []types.FieldValue `json:"sort"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	for i := range response.Hits.Hits {
+		if i < len(raw.Hits.Hits) && len(raw.Hits.Hits[i].Sort) > 0 {
+			response.Hits.Hits[i].Sort = raw.Hits.Hits[i].Sort
+		}
+	}
+	return response, nil
+}
+
+// ProcessSearchResponseV8 parses the search response of a fact and applies the fact restitution steps
+// The search response must have been built with ConvertFactToSearchRequestV8
+func ProcessSearchResponseV8(f engine.Fact, ti time.Time, response *search.Response) (*engine.FactResult, error) {
+	result, err := ParseSearchResponseV8(f, response)
+	if err != nil {
+		zap.L().Warn("ParseSearchResponseV8", zap.Error(err))
+		return nil, err
+	}
+	if err := f.Restitute(&result.Item, ti); err != nil {
+		zap.L().Warn("Restitute", zap.Error(err))
+		return nil, err
+	}
+	if result.Comparison != nil {
+		if err := f.Restitute(&result.Comparison.PreviousItem, ti); err != nil {
+			zap.L().Warn("Restitute", zap.Error(err))
+			return nil, err
+		}
+	}
+	if len(f.Dimensions) == 0 && f.Intent != nil {
+		result.Value, _ = result.GetValue(f.Intent.AggregationName())
+	}
+	return result, nil
+}
+
+// ParseSearchResponseV8 converts the search response of a fact to a structured fact result
+// The search response must have been built with ConvertFactToSearchRequestV8
+func ParseSearchResponseV8(f engine.Fact, response *search.Response) (*engine.FactResult, error) {
+	if response == nil {
+		return nil, errors.New("no search response")
+	}
+
+	result := &engine.FactResult{}
+	if response.Hits.Total != nil {
+		result.Total = response.Hits.Total.Value
+		result.SetValue(engine.DocCountAgg, response.Hits.Total.Value)
+	}
+
+	if f.Intent == nil || f.Intent.Operator == engine.Delete {
+		return result, nil
+	}
+
+	if f.Intent.Operator == engine.Select {
+		hits, err := parseHits(response.Hits.Hits)
+		if err != nil {
+			return nil, err
+		}
+		result.Hits = hits
+		return result, nil
+	}
+
+	// Typed and untyped aggregates are both marshalled back to the standard elasticsearch format
+	b, err := json.Marshal(response.Aggregations)
+	if err != nil {
+		return nil, err
+	}
+	var aggs map[string]interface{}
+	if err := json.Unmarshal(b, &aggs); err != nil {
+		return nil, err
+	}
+
+	if f.Composite {
+		if err := parseCompositeAggregation(result, aggs, f.Intent, f.Pipelines, f.Dimensions); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	// The last dimension is the outermost aggregation
+	dimensions := make([]*engine.DimensionFragment, 0, len(f.Dimensions))
+	for i := len(f.Dimensions) - 1; i >= 0; i-- {
+		dimensions = append(dimensions, f.Dimensions[i])
+	}
+
+	if f.Comparison != nil {
+		if err := parseComparisonAggregation(result, aggs, f, dimensions); err != nil {
+			return nil, err
+		}
+	} else if err := parseAggregations(&result.Item, aggs, f.Intent, f.Pipelines, dimensions); err != nil {
+		return nil, err
+	}
+	if len(f.Dimensions) == 0 {
+		result.Value, _ = result.GetValue(f.Intent.AggregationName())
+	}
+	return result, nil
+}
+
+func parseHits(rawHits []types.Hit) ([]engine.Hit, error) {
+	hits := make([]engine.Hit, 0, len(rawHits))
+	for _, rawHit := range rawHits {
+		hit := engine.Hit{Index: rawHit.Index_}
+		if rawHit.Id_ != nil {
+			hit.ID = *rawHit.Id_
+		}
+		if len(rawHit.Source_) > 0 {
+			if err := json.Unmarshal(rawHit.Source_, &hit.Source); err != nil {
+				return nil, err
+			}
+		}
+		for _, sort := range rawHit.Sort {
+			hit.Sort = append(hit.Sort, sort)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+func parseAggregations(item *engine.Item, aggs map[string]interface{}, intent *engine.IntentFragment, pipelines []*engine.PipelineFragment, dimensions []*engine.DimensionFragment) error {
+	if len(dimensions) == 0 {
+		name := intent.AggregationName()
+		raw, ok := aggs[name].(map[string]interface{})
+		if !ok {
+			return errors.New("aggregation " + name + " not found")
+		}
+		value, err := parseMetricValue(intent, raw)
+		if err != nil {
+			return err
+		}
+		item.SetValue(name, value)
+		parsePipelines(item, aggs, pipelines)
+		return nil
+	}
+
+	name := dimensions[0].AggregationName()
+	raw, ok := aggs[name].(map[string]interface{})
+	if !ok {
+		return errors.New("aggregation " + name + " not found")
+	}
+	rawBuckets, ok := raw["buckets"].([]interface{})
+	if !ok {
+		return errors.New("aggregation " + name + " has no buckets")
+	}
+
+	items := make([]*engine.Item, 0, len(rawBuckets))
+	for _, rawBucket := range rawBuckets {
+		bucket, ok := rawBucket.(map[string]interface{})
+		if !ok {
+			return errors.New("invalid bucket in aggregation " + name)
+		}
+		subItem := &engine.Item{Key: formatBucketKey(bucket["key"])}
+		if keyAsString, ok := bucket["key_as_string"].(string); ok {
+			subItem.KeyAsString = keyAsString
+		}
+		if dimensions[0].Operator == engine.Range || dimensions[0].Operator == engine.DateRange {
+			subItem.From = bucket["from"]
+			subItem.To = bucket["to"]
+		}
+		if docCount, ok := bucket["doc_count"].(float64); ok {
+			subItem.SetValue(engine.DocCountAgg, int64(docCount))
+		}
+		if err := parseAggregations(subItem, bucket, intent, pipelines, dimensions[1:]); err != nil {
+			return err
+		}
+		items = append(items, subItem)
+	}
+	item.Buckets = map[string][]*engine.Item{name: items}
+	return nil
+}
+
+// parsePipelines sets the value of the secondary intents of a bucket
+// Pipelines without value in a bucket (as the derivative of the first bucket) are omitted
+func parsePipelines(item *engine.Item, aggs map[string]interface{}, pipelines []*engine.PipelineFragment) {
+	for _, pipeline := range pipelines {
+		if raw, ok := aggs[pipeline.Name].(map[string]interface{}); ok {
+			item.SetValue(pipeline.Name, parseNumber(raw["value"]))
+		}
+	}
+}
+
+func parseMetricValue(intent *engine.IntentFragment, raw map[string]interface{}) (interface{}, error) {
+	switch intent.Operator {
+	case engine.Percentiles:
+		return parsePercentiles(raw["values"]), nil
+
+	case engine.Median:
+		if value, ok := parsePercentiles(raw["values"])["50.0"]; ok {
+			return value, nil
+		}
+		return nil, nil
+
+	case engine.ExtendedStats:
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		stats := types.NewExtendedStatsAggregate()
+		if err := json.Unmarshal(b, stats); err != nil {
+			return nil, err
+		}
+		return engine.ExtendedStatsValue{
+			Count:        stats.Count,
+			Sum:          float64(stats.Sum),
+			Min:          toFloat64Pointer(stats.Min),
+			Max:          toFloat64Pointer(stats.Max),
+			Avg:          toFloat64Pointer(stats.Avg),
+			SumOfSquares: toFloat64Pointer(stats.SumOfSquares),
+			Variance:     toFloat64Pointer(stats.Variance),
+			StdDeviation: toFloat64Pointer(stats.StdDeviation),
+		}, nil
+
+	case engine.Count, engine.Sum, engine.Avg, engine.Min, engine.Max, engine.ValueCount, engine.DistinctCount:
+		return parseNumber(raw["value"]), nil
+
+	default:
+		return nil, errors.New("Invalid intent kind: " + intent.Operator.String())
+	}
+}
+
+// parsePercentiles supports both keyed ({"95.0": 12}) and non keyed ([{"key": 95, "value": 12}]) percentiles
+// Percents without value (no document matched) are omitted
+func parsePercentiles(raw interface{}) engine.PercentilesValue {
+	percentiles := make(engine.PercentilesValue)
+	switch values := raw.(type) {
+	case map[string]interface{}:
+		for percent, value := range values {
+			if v, ok := parseNumber(value).(float64); ok {
+				percentiles[percent] = v
+			}
+		}
+	case []interface{}:
+		for _, rawValue := range values {
+			entry, ok := rawValue.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			percent, okPercent := entry["key"].(float64)
+			value, okValue := parseNumber(entry["value"]).(float64)
+			if okPercent && okValue {
+				key := strconv.FormatFloat(percent, 'f', -1, 64)
+				if !strings.Contains(key, ".") {
+					key += ".0"
+				}
+				percentiles[key] = value
+			}
+		}
+	}
+	return percentiles
+}
+
+// parseNumber converts numbers serialized as strings by the typed client to float64
+func parseNumber(value interface{}) interface{} {
+	if s, ok := value.(string); ok {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+		return nil
+	}
+	return value
+}
+
+func toFloat64Pointer(value *types.Float64) *float64 {
+	if value == nil {
+		return nil
+	}
+	v := float64(*value)
+	return &v
+}
+
+func formatBucketKey(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case float64:
+		return strconv.FormatFloat(k, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(k)
+	case nil:
+		return ""
+	default:
+		b, _ := json.Marshal(k)
+		return string(b)
+	}
+}
@@ -0,0 +1,245 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/core/search"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+)
+
+// newSearchResponse parses a raw JSON search response
+func newSearchResponse(t *testing.T, raw string) *search.Response {
+	t.Helper()
+	response := search.NewResponse()
+	if err := json.Unmarshal([]byte(raw), response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// fakeSearch returns a SearchFunc answering every search request with a raw JSON search response
+func fakeSearch(t *testing.T, raw string) SearchFunc {
+	return func(ctx context.Context, request *search.Request) (*search.Response, error) {
+		return newSearchResponse(t, raw), nil
+	}
+}
+
+func TestProcessSearchResponseV8(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Name: "delay", Operator: engine.Avg, Term: "delay"},
+		Dimensions: []*engine.DimensionFragment{
+			{Name: "status", Operator: engine.By, Term: "status"},
+			{Name: "day", Operator: engine.DateHistogram, Term: "date", DateInterval: "day"},
+		},
+		Restitution: []engine.Restitution{
+			{Operator: engine.Rename, Dimension: "status", Labels: map[string]string{"L": "Late"}},
+		},
+	}
+
+	responses := map[string]string{
+		"untyped": `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+			"hits":{"total":{"value":3,"relation":"eq"},"hits":[]},
+			"aggregations":{"day":{"buckets":[
+				{"key_as_string":"2024-01-01T00:00:00.000Z","key":1704067200000,"doc_count":3,
+				"status":{"doc_count_error_upper_bound":0,"sum_other_doc_count":0,"buckets":[
+					{"key":"L","doc_count":2,"delay":{"value":12.5}},
+					{"key":"D","doc_count":1,"delay":{"value":null}}
+				]}}
+			]}}}`,
+		"typed": `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+			"hits":{"total":{"value":3,"relation":"eq"},"hits":[]},
+			"aggregations":{"date_histogram#day":{"buckets":[
+				{"key_as_string":"2024-01-01T00:00:00.000Z","key":1704067200000,"doc_count":3,
+				"sterms#status":{"doc_count_error_upper_bound":0,"sum_other_doc_count":0,"buckets":[
+					{"key":"L","doc_count":2,"avg#delay":{"value":12.5}},
+					{"key":"D","doc_count":1,"avg#delay":{"value":null}}
+				]}}
+			]}}}`,
+	}
+
+	for name, raw := range responses {
+		item, err := ProcessSearchResponseV8(f, time.Now(), newSearchResponse(t, raw))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if v, _ := item.GetValue(engine.DocCountAgg); v != int64(3) {
+			t.Errorf("%s: invalid total doc count %v", name, v)
+		}
+		days := item.Buckets["day"]
+		if len(days) != 1 || days[0].Key != "1704067200000" || days[0].KeyAsString != "2024-01-01T00:00:00.000Z" {
+			t.Fatalf("%s: invalid day buckets %+v", name, days)
+		}
+		statuses := days[0].Buckets["status"]
+		if len(statuses) != 2 || statuses[0].Key != "Late" || statuses[1].Key != "D" {
+			t.Fatalf("%s: invalid status buckets %+v", name, statuses)
+		}
+		if v, _ := statuses[0].GetValue("delay"); v != 12.5 {
+			t.Errorf("%s: invalid delay %v", name, v)
+		}
+		if v, _ := statuses[0].GetValue(engine.DocCountAgg); v != int64(2) {
+			t.Errorf("%s: invalid doc count %v", name, v)
+		}
+	}
+}
+
+func TestParseSearchResponseV8Intents(t *testing.T) {
+	cases := []struct {
+		intent   engine.IntentFragment
+		response string
+		check    func(value interface{}) bool
+	}{
+		{
+			engine.IntentFragment{Name: "v", Operator: engine.Count, Term: "id"},
+			`{"v":{"value":12}}`,
+			func(v interface{}) bool { return v == 12.0 },
+		},
+		{
+			engine.IntentFragment{Name: "v", Operator: engine.Avg, Term: "delay"},
+			`{"avg#v":{"value":null}}`,
+			func(v interface{}) bool { return v == nil },
+		},
+		{
+			engine.IntentFragment{Name: "v", Operator: engine.ValueCount, Term: "id"},
+			`{"value_count#v":{"value":7}}`,
+			func(v interface{}) bool { return v == 7.0 },
+		},
+		{
+			engine.IntentFragment{Name: "v", Operator: engine.DistinctCount, Term: "id"},
+			`{"cardinality#v":{"value":5}}`,
+			func(v interface{}) bool { return v == 5.0 },
+		},
+		{
+			engine.IntentFragment{Name: "v", Operator: engine.Median, Term: "delay"},
+			`{"tdigest_percentiles#v":{"values":{"50.0":3.5}}}`,
+			func(v interface{}) bool { return v == 3.5 },
+		},
+		{
+			engine.IntentFragment{Name: "v", Operator: engine.Percentiles, Term: "delay"},
+			`{"v":{"values":{"95.0":10.0,"99.0":null}}}`,
+			func(v interface{}) bool {
+				p, ok := v.(engine.PercentilesValue)
+				return ok && len(p) == 1 && p["95.0"] == 10
+			},
+		},
+		{
+			engine.IntentFragment{Name: "v", Operator: engine.Percentiles, Term: "delay"},
+			`{"tdigest_percentiles#v":{"values":{"95.0":"10.0"}}}`,
+			func(v interface{}) bool {
+				p, ok := v.(engine.PercentilesValue)
+				return ok && p["95.0"] == 10
+			},
+		},
+		{
+			engine.IntentFragment{Name: "v", Operator: engine.ExtendedStats, Term: "delay"},
+			`{"extended_stats#v":{"count":2,"min":1.0,"max":3.0,"avg":2.0,"sum":4.0,"sum_of_squares":10.0,"variance":1.0,"std_deviation":1.0}}`,
+			func(v interface{}) bool {
+				s, ok := v.(engine.ExtendedStatsValue)
+				return ok && s.Count == 2 && s.Sum == 4 && *s.Min == 1 && *s.Max == 3 && *s.StdDeviation == 1
+			},
+		},
+	}
+
+	for _, c := range cases {
+		raw := `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+			"hits":{"total":{"value":2,"relation":"eq"},"hits":[]},"aggregations":` + c.response + `}`
+		intent := c.intent
+		result, err := ParseSearchResponseV8(engine.Fact{Intent: &intent}, newSearchResponse(t, raw))
+		if err != nil {
+			t.Fatalf("%s: %s", c.intent.Operator, err)
+		}
+		if result.Total != 2 {
+			t.Errorf("%s: invalid total %d", c.intent.Operator, result.Total)
+		}
+		if !c.check(result.Value) {
+			t.Errorf("%s: invalid value %#v", c.intent.Operator, result.Value)
+		}
+	}
+}
+
+func TestParseSearchResponseV8Ranges(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Name: "count", Operator: engine.Count, Term: "id"},
+		Dimensions: []*engine.DimensionFragment{
+			{Name: "delay", Operator: engine.Range, Term: "delay", Ranges: []engine.DimensionRange{{Key: "0-2 days", To: 2}, {Key: ">2 days", From: 2}}},
+		},
+	}
+	raw := `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+		"hits":{"total":{"value":3,"relation":"eq"},"hits":[]},
+		"aggregations":{"range#delay":{"buckets":[
+			{"key":"0-2 days","to":2.0,"doc_count":1,"cardinality#count":{"value":1}},
+			{"key":">2 days","from":2.0,"doc_count":2,"cardinality#count":{"value":2}}
+		]}}}`
+	result, err := ParseSearchResponseV8(f, newSearchResponse(t, raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Value != nil {
+		t.Errorf("a fact with dimensions must not have a scalar value, got %v", result.Value)
+	}
+	items := result.Buckets["delay"]
+	if len(items) != 2 || items[0].Key != "0-2 days" || items[0].To != 2.0 || items[0].From != nil || items[1].From != 2.0 {
+		t.Fatalf("invalid range items %+v", items)
+	}
+	if v, _ := items[1].GetValue("count"); v != 2.0 {
+		t.Errorf("invalid value %v", v)
+	}
+}
+
+func TestParseSearchResponseV8Select(t *testing.T) {
+	f := engine.Fact{Intent: &engine.IntentFragment{Operator: engine.Select, Term: "parcel"}}
+	raw := `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+		"hits":{"total":{"value":1,"relation":"eq"},"hits":[
+			{"_index":"parcel-1","_id":"abc","_source":{"status":"late"},"sort":[1704067200000,"abc"]}
+		]}}`
+	result, err := ParseSearchResponseV8(f, newSearchResponse(t, raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(result.Hits))
+	}
+	hit := result.Hits[0]
+	if hit.ID != "abc" || hit.Index != "parcel-1" || hit.Source["status"] != "late" || len(hit.Sort) != 2 {
+		t.Errorf("invalid hit %+v", hit)
+	}
+}
+
+func TestParseSearchResponseV8Pipelines(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Name: "late", Operator: engine.Sum, Term: "is_late"},
+		Pipelines: []*engine.PipelineFragment{
+			{Name: "ratio", Operator: engine.BucketScript, Script: "params.late / params.total", Variables: map[string]string{"late": "late", "total": "_count"}},
+			{Name: "trend", Operator: engine.Derivative, Intent: "ratio"},
+		},
+		Dimensions: []*engine.DimensionFragment{
+			{Name: "day", Operator: engine.DateHistogram, Term: "date", DateInterval: "day"},
+		},
+	}
+
+	raw := `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},
+		"hits":{"total":{"value":6,"relation":"eq"},"hits":[]},
+		"aggregations":{"day":{"buckets":[
+			{"key_as_string":"2024-01-01T00:00:00.000Z","key":1704067200000,"doc_count":4,"late":{"value":1},"ratio":{"value":0.25}},
+			{"key_as_string":"2024-01-02T00:00:00.000Z","key":1704153600000,"doc_count":2,"late":{"value":1},"ratio":{"value":0.5},"trend":{"value":0.25}}
+		]}}}`
+	result, err := ParseSearchResponseV8(f, newSearchResponse(t, raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	days := result.Buckets["day"]
+	if len(days) != 2 {
+		t.Fatalf("invalid days %+v", days)
+	}
+	if ratio, _ := days[0].GetValue("ratio"); ratio != 0.25 {
+		t.Errorf("invalid first ratio %v", ratio)
+	}
+	if _, ok := days[0].GetValue("trend"); ok {
+		t.Error("first derivative should be omitted")
+	}
+	if trend, _ := days[1].GetValue("trend"); trend != 0.25 {
+		t.Errorf("invalid second derivative %v", trend)
+	}
+}
@@ -74,6 +74,9 @@ func fieldToPropertyV8(rawField modeler.Field) (string, types.Property) {
 
 		case modeler.DateTime:
 			property = types.NewDateProperty()
+
+		case modeler.GeoPoint:
+			property = types.NewGeoPointProperty()
 		}
 
 		return field.Name, property
@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the comparison windows, used as the filters aggregation buckets keys
+const (
+	ComparisonCurrent  = "current"
+	ComparisonPrevious = "previous"
+)
+
+// Suffixes of the aggregations set on the items of a comparison fact result, after the intent name
+const (
+	ComparisonPreviousSuffix      = "_previous"
+	ComparisonDeltaSuffix         = "_delta"
+	ComparisonRelativeDeltaSuffix = "_relative_delta"
+)
+
+var comparisonShiftRegex = regexp.MustCompile(`^[0-9]+[yMwdhHms]$`)
+
+// ComparisonFragment defines a period-over-period comparison
+// The fact is computed on its condition (current window) and on a copy of its condition in which the range conditions
+// on Field are shifted back by Shift (previous window), Shift being an elasticsearch date math duration (1d, 1w, 1M...)
+type ComparisonFragment struct {
+	Field string `json:"field"`
+	Shift string `json:"shift"`
+}
+
+// IsValid checks if a comparison fragment is valid and has no missing mandatory fields
+// * Field must not be empty
+// * Shift must be a date math duration (1d, 2w, 1M, 1y...)
+func (frag *ComparisonFragment) IsValid() (bool, error) {
+	if frag.Field == "" {
+		return false, errors.New("Missing Field")
+	}
+	if !comparisonShiftRegex.MatchString(frag.Shift) {
+		return false, errors.New("Invalid Shift " + frag.Shift)
+	}
+	return true, nil
+}
+
+// ShiftCondition returns a copy of a contextualized condition, in which the From, To and Between conditions
+// on the comparison field are shifted back with date math (2024-03-15T00:00:00.000||-1w, now/d-1w)
+func (frag *ComparisonFragment) ShiftCondition(condition ConditionFragment) (ConditionFragment, error) {
+	if condition == nil {
+		return nil, errors.New("no range condition on comparison field " + frag.Field)
+	}
+	b, err := json.Marshal(condition)
+	if err != nil {
+		return nil, err
+	}
+	shifted, err := UnmarshalConditionFragment(b)
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	var walk func(condition ConditionFragment) error
+	walk = func(condition ConditionFragment) error {
+		switch c := condition.(type) {
+		case *BooleanFragment:
+			for _, fragment := range c.Fragments {
+				if err := walk(fragment); err != nil {
+					return err
+				}
+			}
+		case *NestedFragment:
+			return walk(c.Fragment)
+		case *LeafConditionFragment:
+			if c.Field != frag.Field || (c.Operator != From && c.Operator != To && c.Operator != Between) {
+				return nil
+			}
+			count++
+			if c.Value, err = frag.shiftDate(c.Value); err != nil {
+				return err
+			}
+			if c.Operator == Between {
+				if c.Value2, err = frag.shiftDate(c.Value2); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(shifted); err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, errors.New("no range condition on comparison field " + frag.Field)
+	}
+	return shifted, nil
+}
+
+func (frag *ComparisonFragment) shiftDate(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil, errors.New("cannot shift an empty date")
+		}
+		if strings.HasPrefix(v, "now") || strings.Contains(v, "||") {
+			return v + "-" + frag.Shift, nil
+		}
+		return v + "||-" + frag.Shift, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano) + "||-" + frag.Shift, nil
+	}
+	return nil, fmt.Errorf("cannot shift the date %v of comparison field %s", value, frag.Field)
+}
+
+// ComparisonResult is the result of a period-over-period comparison
+// * Current and Previous are the intent values of both windows, for a fact without dimension
+// * Delta is Current - Previous and RelativeDelta is Delta / Previous (nil if they cannot be computed)
+// * PreviousItem is the result tree of the previous window
+type ComparisonResult struct {
+	Current       interface{} `json:"current,omitempty"`
+	Previous      interface{} `json:"previous,omitempty"`
+	Delta         *float64    `json:"delta,omitempty"`
+	RelativeDelta *float64    `json:"relativeDelta,omitempty"`
+	PreviousItem  Item        `json:"previousItem"`
+}
+
+// Compare compares the result of a comparison fact with the result tree of its previous window
+// The previous value, the delta and the relative delta of the intent are set on every current item which exists
+// in the previous tree (same keys path), with the aggregation names intent_previous, intent_delta and intent_relative_delta
+// The keys of a DateHistogram dimension on the comparison field are shifted forward by Shift before being matched
+func (r *FactResult) Compare(f *Fact, previous Item) {
+	intentName := f.Intent.AggregationName()
+	comparison := &ComparisonResult{PreviousItem: previous}
+	comparison.Current, _ = r.GetValue(intentName)
+	comparison.Previous, _ = previous.GetValue(intentName)
+	comparison.Delta, comparison.RelativeDelta = computeDeltas(comparison.Current, comparison.Previous)
+	compareItems(f, &r.Item, &previous, intentName)
+	r.Comparison = comparison
+}
+
+func compareItems(f *Fact, current *Item, previous *Item, intentName string) {
+	if value, ok := previous.GetValue(intentName); ok {
+		current.SetValue(intentName+ComparisonPreviousSuffix, value)
+		currentValue, _ := current.GetValue(intentName)
+		delta, relativeDelta := computeDeltas(currentValue, value)
+		if delta != nil {
+			current.SetValue(intentName+ComparisonDeltaSuffix, *delta)
+		}
+		if relativeDelta != nil {
+			current.SetValue(intentName+ComparisonRelativeDeltaSuffix, *relativeDelta)
+		}
+	}
+	for dimension, items := range current.Buckets {
+		previousItems := make(map[string]*Item, len(previous.Buckets[dimension]))
+		for _, item := range previous.Buckets[dimension] {
+			previousItems[f.Comparison.shiftKey(f.getDimension(dimension), item.Key)] = item
+		}
+		for _, item := range items {
+			if previousItem, ok := previousItems[item.Key]; ok {
+				compareItems(f, item, previousItem, intentName)
+			}
+		}
+	}
+}
+
+// shiftKey shifts forward by Shift the key (epoch milliseconds) of a DateHistogram dimension on the comparison field,
+// to match the previous window bucket with the current window bucket. Other keys are returned as is
+func (frag *ComparisonFragment) shiftKey(dimension *DimensionFragment, key string) string {
+	if frag == nil || dimension == nil || dimension.Operator != DateHistogram || dimension.Term != frag.Field {
+		return key
+	}
+	millis, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return key
+	}
+	n, _ := strconv.Atoi(frag.Shift[:len(frag.Shift)-1])
+	t := addDate(time.UnixMilli(millis).In(loadLocation(dimension.TimeZone)), dateMathUnits[frag.Shift[len(frag.Shift)-1]], n)
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func computeDeltas(current interface{}, previous interface{}) (*float64, *float64) {
+	c, okCurrent := comparableValue(current)
+	p, okPrevious := comparableValue(previous)
+	if !okCurrent || !okPrevious {
+		return nil, nil
+	}
+	delta := c - p
+	if p == 0 {
+		return &delta, nil
+	}
+	relativeDelta := delta / p
+	return &delta, &relativeDelta
+}
+
+func comparableValue(value interface{}) (float64, bool) {
+	if v, ok := value.(*float64); ok {
+		if v == nil {
+			return 0, false
+		}
+		return *v, true
+	}
+	return toFloat64(value)
+}
@@ -0,0 +1,161 @@
+package engine
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestShiftCondition(t *testing.T) {
+	comparison := &ComparisonFragment{Field: "date", Shift: "1w"}
+	condition := &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+		&LeafConditionFragment{Operator: For, Field: "status", Value: "late"},
+		&LeafConditionFragment{Operator: Between, Field: "date", Value: "now/d", Value2: "2024-03-15T00:00:00.000"},
+		&LeafConditionFragment{Operator: From, Field: "date", Value: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		&LeafConditionFragment{Operator: To, Field: "created", Value: "now"},
+	}}
+
+	shifted, err := comparison.ShiftCondition(condition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragments := shifted.(*BooleanFragment).Fragments
+	between := fragments[1].(*LeafConditionFragment)
+	if between.Value != "now/d-1w" || between.Value2 != "2024-03-15T00:00:00.000||-1w" {
+		t.Errorf("invalid shifted between %v - %v", between.Value, between.Value2)
+	}
+	if value := fragments[2].(*LeafConditionFragment).Value; value != "2024-03-01T00:00:00Z||-1w" {
+		t.Errorf("invalid shifted from %v", value)
+	}
+	if value := fragments[3].(*LeafConditionFragment).Value; value != "now" {
+		t.Errorf("condition on another field should not be shifted, got %v", value)
+	}
+	if value := condition.Fragments[1].(*LeafConditionFragment).Value; value != "now/d" {
+		t.Errorf("original condition should not be modified, got %v", value)
+	}
+
+	if _, err := comparison.ShiftCondition(&LeafConditionFragment{Operator: For, Field: "status", Value: "late"}); err == nil {
+		t.Error("expected an error without range condition on the comparison field")
+	}
+}
+
+func TestComparisonIsValid(t *testing.T) {
+	fragments := []ComparisonFragment{
+		{Shift: "1d"},
+		{Field: "date"},
+		{Field: "date", Shift: "1 day"},
+		{Field: "date", Shift: "-1d"},
+	}
+	for _, fragment := range fragments {
+		if ok, _ := fragment.IsValid(); ok {
+			t.Errorf("%+v should be invalid", fragment)
+		}
+	}
+
+	f := Fact{
+		Name:       "test",
+		Model:      "parcel",
+		Intent:     &IntentFragment{Operator: Select},
+		Condition:  &LeafConditionFragment{Operator: From, Field: "date", Value: "now-1d"},
+		Comparison: &ComparisonFragment{Field: "date", Shift: "1d"},
+	}
+	if ok, _ := f.IsValid(); ok {
+		t.Error("comparison of a select fact should be invalid")
+	}
+}
+
+func TestEvaluateFactComparison(t *testing.T) {
+	condition := `"condition":{"operator":"between","term":"created","value":"2024-01-03T00:00:00.000","value2":"2024-01-05T00:00:00.000","timezone":"UTC"},
+		"comparison":{"field":"created","shift":"2d"}`
+
+	result := evaluateFactJSON(t, `{"name":"test","model":"parcel",
+		"intent":{"name":"parcels","operator":"count","term":"status"},`+condition+`}`)
+	if result.Comparison == nil {
+		t.Fatalf("missing comparison %+v", result)
+	}
+	if result.Comparison.Current != 1.0 || result.Comparison.Previous != 2.0 {
+		t.Errorf("invalid values %v - %v", result.Comparison.Current, result.Comparison.Previous)
+	}
+	if result.Comparison.Delta == nil || *result.Comparison.Delta != -1 {
+		t.Errorf("invalid delta %v", result.Comparison.Delta)
+	}
+	if result.Comparison.RelativeDelta == nil || *result.Comparison.RelativeDelta != -0.5 {
+		t.Errorf("invalid relative delta %v", result.Comparison.RelativeDelta)
+	}
+
+	result = evaluateFactJSON(t, `{"name":"test","model":"parcel",
+		"intent":{"name":"parcels","operator":"count","term":"status"},
+		"dimensions":[{"name":"country","operator":"by","term":"country"}],`+condition+`}`)
+	if result.Total != 2 || result.Comparison == nil {
+		t.Fatalf("invalid result %+v", result)
+	}
+	if docCount, _ := result.Comparison.PreviousItem.GetValue(DocCountAgg); docCount != int64(2) {
+		t.Errorf("invalid previous documents count %v", docCount)
+	}
+
+	countries := result.Buckets["country"]
+	if len(countries) != 1 || countries[0].Key != "FR" {
+		t.Fatalf("invalid countries %+v", countries)
+	}
+	if previous, _ := countries[0].GetValue("parcels_previous"); previous != 1.0 {
+		t.Errorf("invalid previous value %v", previous)
+	}
+	if delta, _ := countries[0].GetValue("parcels_delta"); delta != 0.0 {
+		t.Errorf("invalid delta %v", delta)
+	}
+	if relativeDelta, _ := countries[0].GetValue("parcels_relative_delta"); relativeDelta != 0.0 {
+		t.Errorf("invalid relative delta %v", relativeDelta)
+	}
+}
+
+func TestCompareDateHistogram(t *testing.T) {
+	f := Fact{
+		Intent: &IntentFragment{Name: "parcels", Operator: Count, Term: "id"},
+		Dimensions: []*DimensionFragment{
+			{Name: "hour", Operator: DateHistogram, Term: "date", DateInterval: "hour", TimeZone: "Europe/Paris"},
+		},
+		Comparison: &ComparisonFragment{Field: "date", Shift: "1w"},
+	}
+	hour := func(day int, h int) string {
+		return strconv.FormatInt(time.Date(2024, 3, day, h, 0, 0, 0, time.UTC).UnixMilli(), 10)
+	}
+	newItem := func(key string, value float64) *Item {
+		item := &Item{Key: key}
+		item.SetValue("parcels", value)
+		return item
+	}
+	result := &FactResult{Item: Item{Buckets: map[string][]*Item{
+		"hour": {newItem(hour(15, 8), 10), newItem(hour(15, 9), 4)},
+	}}}
+	previous := Item{Buckets: map[string][]*Item{
+		"hour": {newItem(hour(8, 8), 5), newItem(hour(8, 10), 1)},
+	}}
+
+	result.Compare(&f, previous)
+	hours := result.Buckets["hour"]
+	if value, _ := hours[0].GetValue("parcels_previous"); value != 5.0 {
+		t.Errorf("the previous bucket of the same hour last week should be matched, got %v", value)
+	}
+	if delta, _ := hours[0].GetValue("parcels_delta"); delta != 5.0 {
+		t.Errorf("invalid delta %v", delta)
+	}
+	if _, ok := hours[1].GetValue("parcels_previous"); ok {
+		t.Error("the 9h bucket has no previous bucket")
+	}
+}
+
+func TestComparisonIsValidDateRange(t *testing.T) {
+	f := Fact{
+		Name:      "test",
+		Model:     "parcel",
+		Intent:    &IntentFragment{Operator: Count, Term: "id"},
+		Condition: &LeafConditionFragment{Operator: From, Field: "date", Value: "now-1d"},
+		Dimensions: []*DimensionFragment{
+			{Operator: DateRange, Term: "date", Ranges: []DimensionRange{{From: "now-1d/d", To: "now/d"}}},
+		},
+		Comparison: &ComparisonFragment{Field: "date", Shift: "1d"},
+	}
+	if ok, err := f.IsValid(); ok || err.Error() != "comparison is not supported with a daterange dimension on the comparison field" {
+		t.Errorf("comparison with a daterange dimension on the comparison field should be invalid, got %v", err)
+	}
+}
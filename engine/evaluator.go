@@ -0,0 +1,738 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/expression"
+	"github.com/myrteametrics/myrtea-sdk/v5/models"
+	"github.com/myrteametrics/myrtea-sdk/v5/utils"
+)
+
+// DefaultSelectSize is the number of hits returned by a Select intent, as the elasticsearch default search size
+const DefaultSelectSize = 10
+
+// fieldLookup returns every value of a field in a document (multi-valued fields and arrays of objects are flattened)
+type fieldLookup func(field string) []interface{}
+
+// factEvaluator computes a fact on a list of documents, following the elasticsearch translation semantics
+type factEvaluator struct {
+	fact      Fact
+	ti        time.Time
+	variables map[string]interface{}
+	documents []models.Document
+}
+
+// EvaluateFact computes a contextualized fact on a list of documents in memory, without elasticsearch
+// The conditions, intents and dimensions follow the semantics of the elasticsearch translation,
+// and the result tree is the same as the one parsed from an elasticsearch search response.
+// Restitution steps are not applied (see Fact.Restitute)
+func EvaluateFact(f Fact, ti time.Time, documents []models.Document, parameters map[string]interface{}) (*FactResult, error) {
+	if f.Intent == nil {
+		return nil, errors.New("no intent fragment")
+	}
+	if len(f.Pipelines) > 0 {
+		return nil, errors.New("secondary intents are not supported by the in-memory evaluator")
+	}
+	if f.Comparison != nil {
+		return evaluateComparison(f, ti, documents, parameters)
+	}
+
+	variables := make(map[string]interface{})
+	for k, v := range parameters {
+		variables[k] = v
+	}
+	for k, v := range expression.GetDateKeywords(ti) {
+		variables[k] = v
+	}
+
+	e := &factEvaluator{fact: f, ti: ti, variables: variables, documents: documents}
+
+	condition := f.Condition
+	if !conditionApplies(condition) {
+		condition = nil
+	}
+
+	matched := make([]models.Document, 0)
+	for _, document := range documents {
+		ok, err := e.matchCondition(condition, sourceLookup(document.Source))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matched = append(matched, document)
+		}
+	}
+
+	result := &FactResult{Total: int64(len(matched))}
+	result.SetValue(DocCountAgg, result.Total)
+
+	switch f.Intent.Operator {
+	case Delete:
+		return result, nil
+	case Select:
+		hits, err := selectHits(matched, f.Sort)
+		if err != nil {
+			return nil, err
+		}
+		result.Hits = hits
+		return result, nil
+	}
+
+	// The last dimension is the outermost aggregation
+	dimensions := make([]*DimensionFragment, 0, len(f.Dimensions))
+	for i := len(f.Dimensions) - 1; i >= 0; i-- {
+		dimensions = append(dimensions, f.Dimensions[i])
+	}
+
+	if err := e.aggregate(&result.Item, matched, dimensions); err != nil {
+		return nil, err
+	}
+	if len(f.Dimensions) == 0 {
+		result.Value, _ = result.GetValue(f.Intent.AggregationName())
+	}
+	return result, nil
+}
+
+// evaluateComparison evaluates a comparison fact on its current and previous windows
+func evaluateComparison(f Fact, ti time.Time, documents []models.Document, parameters map[string]interface{}) (*FactResult, error) {
+	shifted, err := f.Comparison.ShiftCondition(f.Condition)
+	if err != nil {
+		return nil, err
+	}
+	comparison := f
+	f.Comparison = nil
+	result, err := EvaluateFact(f, ti, documents, parameters)
+	if err != nil {
+		return nil, err
+	}
+	f.Condition = shifted
+	previous, err := EvaluateFact(f, ti, documents, parameters)
+	if err != nil {
+		return nil, err
+	}
+	result.Compare(&comparison, previous.Item)
+	return result, nil
+}
+
+func (e *factEvaluator) matchCondition(condition ConditionFragment, lookup fieldLookup) (bool, error) {
+	switch c := condition.(type) {
+	case nil:
+		return true, nil
+
+	case *BooleanFragment:
+		if c.Operator == If {
+			val, err := expression.Process(expression.LangEval, c.Expression, e.variables)
+			if err != nil {
+				return false, fmt.Errorf("expression evaluation failed : %s", err)
+			}
+			if valIf, ok := val.(bool); !ok || !valIf {
+				return true, nil
+			}
+		}
+
+		results := make([]bool, 0, len(c.Fragments))
+		for _, subFrag := range c.Fragments {
+			if !conditionApplies(subFrag) {
+				continue
+			}
+			ok, err := e.matchCondition(subFrag, lookup)
+			if err != nil {
+				return false, err
+			}
+			results = append(results, ok)
+		}
+		return matchBoolean(c, results)
+
+	case *NestedFragment:
+		if !conditionApplies(c.Fragment) {
+			return true, nil
+		}
+		for _, value := range lookup(c.Path) {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			ok, err := e.matchCondition(c.Fragment, nestedLookup(c.Path, object))
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case *LeafConditionFragment:
+		return e.matchLeaf(c, lookup)
+
+	default:
+		return false, errors.New("invalid condition fragment")
+	}
+}
+
+// conditionApplies returns false for optional conditions without value, which are ignored by the elasticsearch translation
+func conditionApplies(condition ConditionFragment) bool {
+	switch c := condition.(type) {
+	case *NestedFragment:
+		return conditionApplies(c.Fragment)
+	case *LeafConditionFragment:
+		switch c.Operator {
+		case OptionalFor:
+			return c.Field != "" && !IsEmptyValue(c.Value)
+		case OptionalRegexp, OptionalWildcard:
+			return c.Field != "" && c.Value != ""
+		}
+	}
+	return true
+}
+
+// matchBoolean combines the results of the sub-conditions of a boolean fragment
+// A boolean fragment without sub-condition matches every document
+func matchBoolean(c *BooleanFragment, results []bool) (bool, error) {
+	if len(results) == 0 {
+		return true, nil
+	}
+	count := 0
+	for _, ok := range results {
+		if ok {
+			count++
+		}
+	}
+	switch c.Operator {
+	case And, If:
+		return count == len(results), nil
+	case Or:
+		minimum, err := MinimumShouldMatch(c.MinimumShouldMatch, len(results))
+		if err != nil {
+			return false, err
+		}
+		return count >= minimum, nil
+	case Not:
+		return count == 0, nil
+	default:
+		return false, errors.New("Invalid boolean kind: " + c.Operator.String())
+	}
+}
+
+// MinimumShouldMatch returns the number of should clauses among total which must match
+// It supports integers and percentages, positive or negative, as elasticsearch does
+func MinimumShouldMatch(value interface{}, total int) (int, error) {
+	var minimum int
+	switch v := value.(type) {
+	case nil:
+		return 1, nil
+	case int:
+		minimum = v
+	case float64:
+		minimum = int(v)
+	case string:
+		if v == "" {
+			return 1, nil
+		}
+		if strings.HasSuffix(v, "%") {
+			percent, err := strconv.Atoi(strings.TrimSuffix(v, "%"))
+			if err != nil {
+				return 0, errors.New("unsupported minimumShouldMatch " + v)
+			}
+			minimum = total * percent / 100
+		} else {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return 0, errors.New("unsupported minimumShouldMatch " + v)
+			}
+			minimum = i
+		}
+	default:
+		return 1, nil
+	}
+	if minimum < 0 {
+		minimum = total + minimum
+	}
+	return minimum, nil
+}
+
+func (e *factEvaluator) matchLeaf(c *LeafConditionFragment, lookup fieldLookup) (bool, error) {
+	values := lookup(c.Field)
+
+	switch c.Operator {
+	case Exists:
+		return len(values) > 0, nil
+
+	case For, OptionalFor:
+		expected := flattenValues(c.Value)
+		for _, value := range values {
+			for _, exp := range expected {
+				if termKey(value) == termKey(exp) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+
+	case From:
+		return e.matchRange(values, c.Value, nil, c.TimeZone)
+	case To:
+		return e.matchRange(values, nil, c.Value, c.TimeZone)
+	case Between:
+		return e.matchRange(values, c.Value, c.Value2, c.TimeZone)
+
+	case Regexp, OptionalRegexp:
+		pattern, ok := c.Value.(string)
+		if !ok {
+			return false, errors.New("regexp value must be a string")
+		}
+		// Lucene regular expressions are always anchored
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return false, err
+		}
+		return matchStrings(values, re), nil
+
+	case Wildcard, OptionalWildcard:
+		pattern, ok := c.Value.(string)
+		if !ok {
+			return false, errors.New("wildcard value must be a string")
+		}
+		re, err := regexp.Compile(wildcardToRegexp(pattern))
+		if err != nil {
+			return false, err
+		}
+		return matchStrings(values, re), nil
+
+	case GeoDistance:
+		return matchGeoDistance(values, c.Value, c.Value2)
+	case GeoBoundingBox:
+		return matchGeoBoundingBox(values, c.Value, c.Value2)
+
+	default:
+		return false, errors.New("Invalid filter kind: " + c.Operator.String())
+	}
+}
+
+// matchRange checks if a value is in [from, to[
+// As in the elasticsearch translation, the range is numeric if its first bound is a number and a date range if it is a string
+func (e *factEvaluator) matchRange(values []interface{}, from interface{}, to interface{}, timeZone string) (bool, error) {
+	first := from
+	if first == nil {
+		first = to
+	}
+
+	if _, ok := toFloat64(first); ok {
+		lower, hasLower := toFloat64(from)
+		upper, hasUpper := toFloat64(to)
+		for _, value := range values {
+			v, ok := numericValue(value)
+			if ok && (!hasLower || v >= lower) && (!hasUpper || v < upper) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if _, ok := first.(string); ok {
+		location := loadLocation(timeZone)
+		var lower, upper *time.Time
+		if s, ok := from.(string); ok {
+			bound, err := parseDate(s, e.ti, location)
+			if err != nil {
+				return false, err
+			}
+			lower = &bound
+		}
+		if s, ok := to.(string); ok && (from == nil || lower != nil) {
+			bound, err := parseDate(s, e.ti, location)
+			if err != nil {
+				return false, err
+			}
+			upper = &bound
+		}
+		for _, value := range values {
+			v, ok := dateValue(value)
+			if ok && (lower == nil || !v.Before(*lower)) && (upper == nil || v.Before(*upper)) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unsupported range value %v", first)
+}
+
+func matchStrings(values []interface{}, re *regexp.Regexp) bool {
+	for _, value := range values {
+		if s, ok := value.(string); ok && re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardToRegexp converts a wildcard pattern (* and ?) to an anchored regular expression
+func wildcardToRegexp(pattern string) string {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			builder.WriteString(".*")
+		case '?':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	builder.WriteString("$")
+	return builder.String()
+}
+
+// sourceLookup returns the values of a field in a document source, using either dotted keys or sub-objects
+func sourceLookup(source map[string]interface{}) fieldLookup {
+	return func(field string) []interface{} {
+		return lookupValues(source, field)
+	}
+}
+
+// nestedLookup returns the values of a field in a single nested object
+// Fields outside the nested path do not exist in a nested document
+func nestedLookup(path string, object map[string]interface{}) fieldLookup {
+	return func(field string) []interface{} {
+		if !strings.HasPrefix(field, path+".") {
+			return nil
+		}
+		return lookupValues(object, strings.TrimPrefix(field, path+"."))
+	}
+}
+
+func lookupValues(value interface{}, path string) []interface{} {
+	if path == "" {
+		return flattenValues(value)
+	}
+
+	values := make([]interface{}, 0)
+	if object, ok := value.(map[string]interface{}); ok {
+		if sub, ok := object[path]; ok {
+			values = append(values, flattenValues(sub)...)
+		}
+		for i := 0; i < len(path); i++ {
+			if path[i] != '.' {
+				continue
+			}
+			if sub, ok := object[path[:i]]; ok {
+				values = append(values, lookupValues(sub, path[i+1:])...)
+			}
+		}
+		return values
+	}
+
+	for _, item := range flattenValues(value) {
+		if _, ok := item.(map[string]interface{}); ok {
+			values = append(values, lookupValues(item, path)...)
+		}
+	}
+	return values
+}
+
+// flattenValues returns every non-null values of a (possibly multi-valued) field
+func flattenValues(value interface{}) []interface{} {
+	if value == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{value}
+	}
+	if _, ok := value.([]byte); ok {
+		return []interface{}{value}
+	}
+	values := make([]interface{}, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		values = append(values, flattenValues(rv.Index(i).Interface())...)
+	}
+	return values
+}
+
+// termKey returns the canonical representation of a term, used to compare and group values
+func termKey(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return formatNumber(f)
+		}
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	if f, ok := numericValue(value); ok {
+		return formatNumber(f)
+	}
+	return fmt.Sprint(value)
+}
+
+// numericValue converts numbers, numeric strings and dates (to epoch milliseconds) to float64
+func numericValue(value interface{}) (float64, bool) {
+	if f, ok := toFloat64(value); ok {
+		return f, true
+	}
+	switch v := value.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+		if t, err := parseAbsoluteDate(v, time.UTC); err == nil {
+			return float64(t.UnixMilli()), true
+		}
+	}
+	return 0, false
+}
+
+// dateValue converts a document date (string or epoch milliseconds) to a time, dates without time zone are UTC
+func dateValue(value interface{}) (time.Time, bool) {
+	if s, ok := value.(string); ok {
+		t, err := parseAbsoluteDate(s, time.UTC)
+		return t, err == nil
+	}
+	if f, ok := numericValue(value); ok {
+		return time.UnixMilli(int64(f)), true
+	}
+	return time.Time{}, false
+}
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	utils.TimeLayout,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func parseAbsoluteDate(value string, location *time.Location) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("unsupported date " + value)
+}
+
+var dateMathUnits = map[byte]string{
+	'y': "year",
+	'M': "month",
+	'w': "week",
+	'd': "day",
+	'h': "hour",
+	'H': "hour",
+	'm': "minute",
+	's': "second",
+}
+
+// ParseDateMath parses an absolute date or an elasticsearch date math expression in a time zone (default to UTC)
+func ParseDateMath(value string, now time.Time, timeZone string) (time.Time, error) {
+	return parseDate(value, now, loadLocation(timeZone))
+}
+
+// parseDate parses an absolute date or an elasticsearch date math expression (now-1d/d, 2024-01-01||+1M)
+// Rounding always rounds down, as for the gte and lt bounds used by the elasticsearch translation
+func parseDate(value string, now time.Time, location *time.Location) (time.Time, error) {
+	var anchor time.Time
+	var math string
+	switch {
+	case strings.HasPrefix(value, "now"):
+		anchor = now.In(location)
+		math = strings.TrimPrefix(value, "now")
+	case strings.Contains(value, "||"):
+		parts := strings.SplitN(value, "||", 2)
+		t, err := parseAbsoluteDate(parts[0], location)
+		if err != nil {
+			return time.Time{}, err
+		}
+		anchor = t
+		math = parts[1]
+	default:
+		return parseAbsoluteDate(value, location)
+	}
+
+	for len(math) > 0 {
+		op := math[0]
+		math = math[1:]
+		switch op {
+		case '/':
+			if len(math) == 0 {
+				return time.Time{}, errors.New("invalid date math " + value)
+			}
+			unit, ok := dateMathUnits[math[0]]
+			if !ok {
+				return time.Time{}, errors.New("invalid date math unit in " + value)
+			}
+			anchor = truncateDate(anchor, &DimensionFragment{DateInterval: unit})
+			math = math[1:]
+		case '+', '-':
+			i := 0
+			for i < len(math) && math[i] >= '0' && math[i] <= '9' {
+				i++
+			}
+			n := 1
+			if i > 0 {
+				n, _ = strconv.Atoi(math[:i])
+			}
+			if i >= len(math) {
+				return time.Time{}, errors.New("invalid date math " + value)
+			}
+			unit, ok := dateMathUnits[math[i]]
+			if !ok {
+				return time.Time{}, errors.New("invalid date math unit in " + value)
+			}
+			if op == '-' {
+				n = -n
+			}
+			anchor = addDate(anchor, unit, n)
+			math = math[i+1:]
+		default:
+			return time.Time{}, errors.New("invalid date math " + value)
+		}
+	}
+	return anchor, nil
+}
+
+func addDate(t time.Time, unit string, n int) time.Time {
+	switch unit {
+	case "year":
+		return t.AddDate(n, 0, 0)
+	case "month":
+		return t.AddDate(0, n, 0)
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "day":
+		return t.AddDate(0, 0, n)
+	case "hour":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "minute":
+		return t.Add(time.Duration(n) * time.Minute)
+	default:
+		return t.Add(time.Duration(n) * time.Second)
+	}
+}
+
+// SortField is a field of a select fact sort, in ascending or descending order
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort converts the sort of a select fact to its fields, in order
+func ParseSort(sorts []types.SortCombinations) ([]SortField, error) {
+	fields := make([]SortField, 0)
+	for _, s := range sorts {
+		switch v := s.(type) {
+		case string:
+			fields = append(fields, SortField{Field: v})
+		case map[string]interface{}:
+			for field, spec := range v {
+				fields = append(fields, SortField{Field: field, Desc: sortSpecIsDesc(spec)})
+			}
+		case types.SortOptions:
+			for field, spec := range v.SortOptions {
+				fields = append(fields, SortField{Field: field, Desc: spec.Order != nil && spec.Order.Name == "desc"})
+			}
+		case *types.SortOptions:
+			for field, spec := range v.SortOptions {
+				fields = append(fields, SortField{Field: field, Desc: spec.Order != nil && spec.Order.Name == "desc"})
+			}
+		default:
+			return nil, fmt.Errorf("unsupported sort %v", s)
+		}
+	}
+	return fields, nil
+}
+
+// selectHits sorts the matching documents and returns the first ones
+// Missing values are sorted last, as in elasticsearch
+func selectHits(documents []models.Document, sorts []types.SortCombinations) ([]Hit, error) {
+	fields, err := ParseSort(sorts)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, 0, len(documents))
+	for _, document := range documents {
+		hit := Hit{ID: document.ID, Index: document.Index, Source: document.Source}
+		for _, field := range fields {
+			var value interface{}
+			if values := lookupValues(document.Source, field.Field); len(values) > 0 {
+				value = values[0]
+			}
+			hit.Sort = append(hit.Sort, value)
+		}
+		hits = append(hits, hit)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		for k, field := range fields {
+			a, b := hits[i].Sort[k], hits[j].Sort[k]
+			if a == nil || b == nil {
+				if (a == nil) != (b == nil) {
+					return b == nil
+				}
+				continue
+			}
+			c := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+			if field.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	if len(fields) == 0 {
+		for i := range hits {
+			hits[i].Sort = nil
+		}
+	}
+	if len(hits) > DefaultSelectSize {
+		hits = hits[:DefaultSelectSize]
+	}
+	return hits, nil
+}
+
+func sortSpecIsDesc(spec interface{}) bool {
+	switch v := spec.(type) {
+	case string:
+		return v == "desc"
+	case map[string]interface{}:
+		order, _ := v["order"].(string)
+		return order == "desc"
+	}
+	return false
+}
+
+// compareValues compares two values numerically if possible, otherwise as strings
+func compareValues(a interface{}, b interface{}) int {
+	fa, okA := numericValue(a)
+	fb, okB := numericValue(b)
+	if okA && okB {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
@@ -0,0 +1,529 @@
+package engine
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/models"
+)
+
+// defaultPercents are the percents computed by elasticsearch when none is set
+var defaultPercents = []float64{1, 5, 25, 50, 75, 95, 99}
+
+type evaluatorBucket struct {
+	item      *Item
+	documents []models.Document
+}
+
+func (e *factEvaluator) aggregate(item *Item, documents []models.Document, dimensions []*DimensionFragment) error {
+	if len(dimensions) == 0 {
+		value, err := intentValue(e.fact.Intent, documents)
+		if err != nil {
+			return err
+		}
+		item.SetValue(e.fact.Intent.AggregationName(), value)
+		return nil
+	}
+
+	dimension := dimensions[0]
+	var buckets []*evaluatorBucket
+	var err error
+	switch dimension.Operator {
+	case By:
+		buckets = e.termsBuckets(dimension, documents)
+	case Histogram:
+		buckets = histogramBuckets(dimension, documents)
+	case DateHistogram:
+		buckets, err = dateHistogramBuckets(dimension, documents)
+	case Range:
+		buckets = rangeBuckets(dimension, documents)
+	case DateRange:
+		buckets, err = e.dateRangeBuckets(dimension, documents)
+	case GeoHashGrid, GeoTileGrid:
+		buckets, err = geoGridBuckets(dimension, documents)
+	default:
+		err = errors.New("Invalid dimension kind: " + dimension.Operator.String())
+	}
+	if err != nil {
+		return err
+	}
+
+	items := make([]*Item, 0, len(buckets))
+	for _, bucket := range buckets {
+		bucket.item.SetValue(DocCountAgg, int64(len(bucket.documents)))
+		if err := e.aggregate(bucket.item, bucket.documents, dimensions[1:]); err != nil {
+			return err
+		}
+		items = append(items, bucket.item)
+	}
+
+	if dimension.Operator == By {
+		if e.fact.Composite {
+			items = orderCompositeTerms(items, dimension)
+		} else {
+			items = orderTerms(items, dimension)
+		}
+	}
+
+	item.Buckets = map[string][]*Item{dimension.AggregationName(): items}
+	return nil
+}
+
+// termsBuckets groups documents by term, a document with multiple values belongs to multiple buckets
+// With a MinDocCount of 0, the terms of every documents are returned, even if they do not match the condition
+func (e *factEvaluator) termsBuckets(dimension *DimensionFragment, documents []models.Document) []*evaluatorBucket {
+	index := make(map[string]*evaluatorBucket)
+	buckets := make([]*evaluatorBucket, 0)
+	getBucket := func(value interface{}) *evaluatorBucket {
+		key := termKey(value)
+		if bucket, ok := index[key]; ok {
+			return bucket
+		}
+		item := &Item{Key: key}
+		if b, ok := value.(bool); ok {
+			// elasticsearch boolean terms keys are 1 and 0
+			item.Key = "0"
+			if b {
+				item.Key = "1"
+			}
+			item.KeyAsString = key
+		}
+		bucket := &evaluatorBucket{item: item, documents: make([]models.Document, 0)}
+		index[key] = bucket
+		buckets = append(buckets, bucket)
+		return bucket
+	}
+
+	termValues := func(document models.Document) []interface{} {
+		values := lookupValues(document.Source, dimension.Term)
+		if len(values) == 0 && dimension.Missing != "" {
+			values = []interface{}{dimension.Missing}
+		}
+		return values
+	}
+
+	for _, document := range documents {
+		seen := make(map[*evaluatorBucket]bool)
+		for _, value := range termValues(document) {
+			bucket := getBucket(value)
+			if !seen[bucket] {
+				seen[bucket] = true
+				bucket.documents = append(bucket.documents, document)
+			}
+		}
+	}
+
+	minDocCount := 1
+	if dimension.MinDocCount != nil {
+		minDocCount = *dimension.MinDocCount
+	}
+	if minDocCount == 0 {
+		for _, document := range e.documents {
+			for _, value := range termValues(document) {
+				getBucket(value)
+			}
+		}
+	}
+
+	filtered := make([]*evaluatorBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		if len(bucket.documents) >= minDocCount {
+			filtered = append(filtered, bucket)
+		}
+	}
+	return filtered
+}
+
+// orderTerms sorts terms items by count (default), key or sub-aggregation value and keeps the Size first ones
+func orderTerms(items []*Item, dimension *DimensionFragment) []*Item {
+	orderBy := dimension.OrderBy
+	if orderBy == "" {
+		orderBy = "_count"
+	}
+	desc := dimension.OrderDirection != "asc"
+	if dimension.OrderBy == "" {
+		desc = true
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		var c int
+		switch orderBy {
+		case "_key", "_term":
+			c = compareValues(items[i].Key, items[j].Key)
+		default:
+			name := orderBy
+			if name == "_count" {
+				name = DocCountAgg
+			}
+			a, _ := items[i].GetValue(name)
+			b, _ := items[j].GetValue(name)
+			c = compareValues(a, b)
+		}
+		if c == 0 {
+			return compareValues(items[i].Key, items[j].Key) < 0
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	size := dimension.Size
+	if size == 0 {
+		size = DefaultDimensionSize
+	}
+	if len(items) > size {
+		items = items[:size]
+	}
+	return items
+}
+
+// orderCompositeTerms sorts terms items by key, as a composite aggregation source, without truncation
+func orderCompositeTerms(items []*Item, dimension *DimensionFragment) []*Item {
+	desc := dimension.OrderDirection == "desc"
+	sort.SliceStable(items, func(i, j int) bool {
+		c := compareValues(items[i].Key, items[j].Key)
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return items
+}
+
+// histogramBuckets groups documents by numeric interval, empty buckets between the first and the last one are returned
+func histogramBuckets(dimension *DimensionFragment, documents []models.Document) []*evaluatorBucket {
+	interval := dimension.Interval
+	if interval == 0 {
+		interval = DefaultHistogramInterval
+	}
+
+	index := make(map[float64]*evaluatorBucket)
+	for _, document := range documents {
+		seen := make(map[float64]bool)
+		for _, value := range lookupValues(document.Source, dimension.Term) {
+			v, ok := numericValue(value)
+			if !ok {
+				continue
+			}
+			key := math.Floor(v/interval) * interval
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			bucket, ok := index[key]
+			if !ok {
+				bucket = &evaluatorBucket{item: &Item{Key: formatNumber(key)}}
+				index[key] = bucket
+			}
+			bucket.documents = append(bucket.documents, document)
+		}
+	}
+	if len(index) == 0 {
+		return nil
+	}
+
+	keys := make([]float64, 0, len(index))
+	for key := range index {
+		keys = append(keys, key)
+	}
+	sort.Float64s(keys)
+
+	buckets := make([]*evaluatorBucket, 0)
+	for i := 0; keys[0]+float64(i)*interval <= keys[len(keys)-1]; i++ {
+		key := keys[0] + float64(i)*interval
+		bucket, ok := index[key]
+		if !ok {
+			bucket = &evaluatorBucket{item: &Item{Key: formatNumber(key)}}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+// dateHistogramBuckets groups documents by date interval, empty buckets between the first and the last one are returned
+func dateHistogramBuckets(dimension *DimensionFragment, documents []models.Document) ([]*evaluatorBucket, error) {
+	if dimension.CalendarFixed && dimension.DateInterval != "" {
+		if _, err := time.ParseDuration(dimension.DateInterval); err != nil {
+			return nil, err
+		}
+	}
+	location := loadLocation(dimension.TimeZone)
+
+	index := make(map[int64]*evaluatorBucket)
+	var start, end time.Time
+	for _, document := range documents {
+		seen := make(map[int64]bool)
+		for _, value := range lookupValues(document.Source, dimension.Term) {
+			v, ok := dateValue(value)
+			if !ok {
+				continue
+			}
+			key := truncateDate(v.In(location), dimension)
+			if seen[key.UnixMilli()] {
+				continue
+			}
+			seen[key.UnixMilli()] = true
+			bucket, ok := index[key.UnixMilli()]
+			if !ok {
+				bucket = &evaluatorBucket{item: dateHistogramItem(key)}
+				index[key.UnixMilli()] = bucket
+			}
+			bucket.documents = append(bucket.documents, document)
+			if start.IsZero() || key.Before(start) {
+				start = key
+			}
+			if end.IsZero() || key.After(end) {
+				end = key
+			}
+		}
+	}
+	if len(index) == 0 {
+		return nil, nil
+	}
+
+	buckets := make([]*evaluatorBucket, 0)
+	for current := start; !current.After(end); current = nextDate(current, dimension) {
+		bucket, ok := index[current.UnixMilli()]
+		if !ok {
+			bucket = &evaluatorBucket{item: dateHistogramItem(current)}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+func dateHistogramItem(key time.Time) *Item {
+	return &Item{
+		Key:         strconv.FormatInt(key.UnixMilli(), 10),
+		KeyAsString: key.Format("2006-01-02T15:04:05.000Z07:00"),
+	}
+}
+
+// rangeBuckets groups documents by numeric range [From, To[, every range is returned even if empty
+func rangeBuckets(dimension *DimensionFragment, documents []models.Document) []*evaluatorBucket {
+	buckets := make([]*evaluatorBucket, 0, len(dimension.Ranges))
+	for _, r := range dimension.Ranges {
+		from, hasFrom := toFloat64(r.From)
+		to, hasTo := toFloat64(r.To)
+
+		item := &Item{Key: r.Key}
+		fromKey, toKey := "*", "*"
+		if hasFrom {
+			item.From = from
+			fromKey = formatDouble(from)
+		}
+		if hasTo {
+			item.To = to
+			toKey = formatDouble(to)
+		}
+		if item.Key == "" {
+			item.Key = fromKey + "-" + toKey
+		}
+
+		bucket := &evaluatorBucket{item: item, documents: make([]models.Document, 0)}
+		for _, document := range documents {
+			for _, value := range lookupValues(document.Source, dimension.Term) {
+				v, ok := numericValue(value)
+				if ok && (!hasFrom || v >= from) && (!hasTo || v < to) {
+					bucket.documents = append(bucket.documents, document)
+					break
+				}
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+// dateRangeBuckets groups documents by date range [From, To[, every range is returned even if empty
+// Range bounds can be dates, date math expressions or epoch milliseconds
+func (e *factEvaluator) dateRangeBuckets(dimension *DimensionFragment, documents []models.Document) ([]*evaluatorBucket, error) {
+	location := loadLocation(dimension.TimeZone)
+
+	bound := func(value interface{}) (*time.Time, error) {
+		switch v := value.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			t, err := parseDate(v, e.ti, location)
+			if err != nil {
+				return nil, err
+			}
+			return &t, nil
+		default:
+			f, ok := toFloat64(v)
+			if !ok {
+				return nil, errors.New("date range values must be strings")
+			}
+			t := time.UnixMilli(int64(f)).In(location)
+			return &t, nil
+		}
+	}
+
+	buckets := make([]*evaluatorBucket, 0, len(dimension.Ranges))
+	for _, r := range dimension.Ranges {
+		from, err := bound(r.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := bound(r.To)
+		if err != nil {
+			return nil, err
+		}
+
+		item := &Item{Key: r.Key}
+		fromKey, toKey := "*", "*"
+		if from != nil {
+			item.From = float64(from.UnixMilli())
+			fromKey = from.Format("2006-01-02T15:04:05.000Z07:00")
+		}
+		if to != nil {
+			item.To = float64(to.UnixMilli())
+			toKey = to.Format("2006-01-02T15:04:05.000Z07:00")
+		}
+		if item.Key == "" {
+			item.Key = fromKey + "-" + toKey
+		}
+
+		bucket := &evaluatorBucket{item: item, documents: make([]models.Document, 0)}
+		for _, document := range documents {
+			for _, value := range lookupValues(document.Source, dimension.Term) {
+				v, ok := dateValue(value)
+				if ok && (from == nil || !v.Before(*from)) && (to == nil || v.Before(*to)) {
+					bucket.documents = append(bucket.documents, document)
+					break
+				}
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
+
+// intentValue computes an intent on a list of documents, with the same value types as the parsed elasticsearch response
+func intentValue(intent *IntentFragment, documents []models.Document) (interface{}, error) {
+	values := make([]interface{}, 0)
+	for _, document := range documents {
+		values = append(values, lookupValues(document.Source, intent.Term)...)
+	}
+	numbers := make([]float64, 0, len(values))
+	for _, value := range values {
+		if v, ok := numericValue(value); ok {
+			numbers = append(numbers, v)
+		}
+	}
+
+	switch intent.Operator {
+	case Count, DistinctCount:
+		distinct := make(map[string]bool)
+		for _, value := range values {
+			distinct[termKey(value)] = true
+		}
+		return float64(len(distinct)), nil
+
+	case ValueCount:
+		return float64(len(values)), nil
+
+	case Sum:
+		sum := 0.0
+		for _, v := range numbers {
+			sum += v
+		}
+		return sum, nil
+
+	case Avg:
+		if len(numbers) == 0 {
+			return nil, nil
+		}
+		sum := 0.0
+		for _, v := range numbers {
+			sum += v
+		}
+		return sum / float64(len(numbers)), nil
+
+	case Min, Max:
+		if len(numbers) == 0 {
+			return nil, nil
+		}
+		result := numbers[0]
+		for _, v := range numbers[1:] {
+			if (intent.Operator == Min && v < result) || (intent.Operator == Max && v > result) {
+				result = v
+			}
+		}
+		return result, nil
+
+	case Percentiles:
+		percents := intent.Percents
+		if len(percents) == 0 {
+			percents = defaultPercents
+		}
+		result := make(PercentilesValue)
+		if len(numbers) == 0 {
+			return result, nil
+		}
+		sort.Float64s(numbers)
+		for _, percent := range percents {
+			result[formatDouble(percent)] = percentile(numbers, percent)
+		}
+		return result, nil
+
+	case Median:
+		if len(numbers) == 0 {
+			return nil, nil
+		}
+		sort.Float64s(numbers)
+		return percentile(numbers, 50), nil
+
+	case ExtendedStats:
+		stats := ExtendedStatsValue{Count: int64(len(numbers))}
+		if len(numbers) == 0 {
+			return stats, nil
+		}
+		min, max, sumOfSquares := numbers[0], numbers[0], 0.0
+		for _, v := range numbers {
+			stats.Sum += v
+			sumOfSquares += v * v
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+		}
+		avg := stats.Sum / float64(len(numbers))
+		variance := math.Max(sumOfSquares/float64(len(numbers))-avg*avg, 0)
+		stdDeviation := math.Sqrt(variance)
+		stats.Min, stats.Max, stats.Avg = &min, &max, &avg
+		stats.SumOfSquares, stats.Variance, stats.StdDeviation = &sumOfSquares, &variance, &stdDeviation
+		return stats, nil
+
+	default:
+		return nil, errors.New("Invalid intent kind: " + intent.Operator.String())
+	}
+}
+
+// percentile computes a percentile on sorted values with linear interpolation between the closest ranks
+func percentile(sorted []float64, percent float64) float64 {
+	rank := percent / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower == upper {
+		return sorted[lower]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[upper]-sorted[lower])
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatDouble formats a number as elasticsearch does for double keys ("95.0")
+func formatDouble(f float64) string {
+	s := formatNumber(f)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
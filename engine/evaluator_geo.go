@@ -0,0 +1,291 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/models"
+)
+
+// earthRadius is the mean earth radius in meters used by elasticsearch
+const earthRadius = 6371008.7714
+
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+type geoPoint struct {
+	lat float64
+	lon float64
+}
+
+// distanceUnits are the elasticsearch distance units in meters
+var distanceUnits = []struct {
+	suffix string
+	meters float64
+}{
+	{"nmi", 1852}, {"NM", 1852}, {"km", 1000}, {"mi", 1609.344}, {"yd", 0.9144}, {"ft", 0.3048},
+	{"in", 0.0254}, {"cm", 0.01}, {"mm", 0.001}, {"m", 1},
+}
+
+func matchGeoDistance(values []interface{}, center interface{}, distance interface{}) (bool, error) {
+	origin, ok := parseGeoPoint(center)
+	if !ok {
+		return false, fmt.Errorf("invalid geo point %v", center)
+	}
+	meters, err := parseDistance(distance)
+	if err != nil {
+		return false, err
+	}
+	for _, point := range geoPoints(values) {
+		if haversine(origin, point) <= meters {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchGeoBoundingBox(values []interface{}, topLeft interface{}, bottomRight interface{}) (bool, error) {
+	tl, ok := parseGeoPoint(topLeft)
+	if !ok {
+		return false, fmt.Errorf("invalid geo point %v", topLeft)
+	}
+	br, ok := parseGeoPoint(bottomRight)
+	if !ok {
+		return false, fmt.Errorf("invalid geo point %v", bottomRight)
+	}
+	for _, point := range geoPoints(values) {
+		if point.lat > tl.lat || point.lat < br.lat {
+			continue
+		}
+		// The box crosses the dateline when its left longitude is greater than its right one
+		if tl.lon <= br.lon && (point.lon < tl.lon || point.lon > br.lon) {
+			continue
+		}
+		if tl.lon > br.lon && point.lon < tl.lon && point.lon > br.lon {
+			continue
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// geoPoints converts the values of a geo_point field, arrays [lon, lat] being flattened as consecutive numbers
+func geoPoints(values []interface{}) []geoPoint {
+	points := make([]geoPoint, 0, len(values))
+	for i := 0; i < len(values); i++ {
+		if lon, ok := toFloat64(values[i]); ok {
+			if i+1 < len(values) {
+				if lat, ok := toFloat64(values[i+1]); ok {
+					points = append(points, geoPoint{lat: lat, lon: lon})
+					i++
+				}
+			}
+			continue
+		}
+		if point, ok := parseGeoPoint(values[i]); ok {
+			points = append(points, point)
+		}
+	}
+	return points
+}
+
+// parseGeoPoint supports the elasticsearch geo point formats: {"lat": 1, "lon": 2}, "1,2", a geohash and [2, 1]
+func parseGeoPoint(value interface{}) (geoPoint, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		lat, okLat := numericValue(v["lat"])
+		lon, okLon := numericValue(v["lon"])
+		return geoPoint{lat: lat, lon: lon}, okLat && okLon
+	case map[string]float64:
+		lat, okLat := v["lat"]
+		lon, okLon := v["lon"]
+		return geoPoint{lat: lat, lon: lon}, okLat && okLon
+	case types.LatLonGeoLocation:
+		return geoPoint{lat: float64(v.Lat), lon: float64(v.Lon)}, true
+	case *types.LatLonGeoLocation:
+		return geoPoint{lat: float64(v.Lat), lon: float64(v.Lon)}, true
+	case string:
+		if parts := strings.Split(v, ","); len(parts) == 2 {
+			lat, errLat := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+			lon, errLon := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+			return geoPoint{lat: lat, lon: lon}, errLat == nil && errLon == nil
+		}
+		return decodeGeohash(v)
+	case []interface{}:
+		if points := geoPoints(v); len(points) == 1 {
+			return points[0], true
+		}
+	case []float64:
+		if len(v) == 2 {
+			return geoPoint{lat: v[1], lon: v[0]}, true
+		}
+	}
+	return geoPoint{}, false
+}
+
+// parseDistance converts a distance (5km, 100m, 2mi...) to meters, numbers are meters
+func parseDistance(value interface{}) (float64, error) {
+	if meters, ok := toFloat64(value); ok {
+		return meters, nil
+	}
+	distance, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid geo distance %v", value)
+	}
+	distance = strings.TrimSpace(distance)
+	for _, unit := range distanceUnits {
+		if strings.HasSuffix(distance, unit.suffix) {
+			number, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(distance, unit.suffix)), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid geo distance %v", value)
+			}
+			return number * unit.meters, nil
+		}
+	}
+	number, err := strconv.ParseFloat(distance, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid geo distance %v", value)
+	}
+	return number, nil
+}
+
+// haversine returns the arc distance between two points in meters
+func haversine(a geoPoint, b geoPoint) float64 {
+	lat1, lat2 := a.lat*math.Pi/180, b.lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.lon - a.lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+func encodeGeohash(point geoPoint, precision int) string {
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+	var builder strings.Builder
+	bit, ch, even := 0, 0, true
+	for builder.Len() < precision {
+		if even {
+			mid := (minLon + maxLon) / 2
+			if point.lon >= mid {
+				ch |= 1 << (4 - bit)
+				minLon = mid
+			} else {
+				maxLon = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if point.lat >= mid {
+				ch |= 1 << (4 - bit)
+				minLat = mid
+			} else {
+				maxLat = mid
+			}
+		}
+		even = !even
+		if bit < 4 {
+			bit++
+		} else {
+			builder.WriteByte(geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return builder.String()
+}
+
+// decodeGeohash returns the center of a geohash cell
+func decodeGeohash(geohash string) (geoPoint, bool) {
+	if geohash == "" {
+		return geoPoint{}, false
+	}
+	minLat, maxLat := -90.0, 90.0
+	minLon, maxLon := -180.0, 180.0
+	even := true
+	for _, c := range strings.ToLower(geohash) {
+		index := strings.IndexRune(geohashBase32, c)
+		if index < 0 {
+			return geoPoint{}, false
+		}
+		for bit := 4; bit >= 0; bit-- {
+			set := index&(1<<bit) != 0
+			if even {
+				mid := (minLon + maxLon) / 2
+				if set {
+					minLon = mid
+				} else {
+					maxLon = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if set {
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return geoPoint{lat: (minLat + maxLat) / 2, lon: (minLon + maxLon) / 2}, true
+}
+
+// encodeGeotile returns the "zoom/x/y" key of the map tile containing a point
+func encodeGeotile(point geoPoint, zoom int) string {
+	tiles := math.Exp2(float64(zoom))
+	x := math.Floor((point.lon + 180) / 360 * tiles)
+	lat := math.Max(math.Min(point.lat, 85.0511287798066), -85.0511287798066) * math.Pi / 180
+	y := math.Floor((1 - math.Log(math.Tan(lat)+1/math.Cos(lat))/math.Pi) / 2 * tiles)
+	x = math.Max(0, math.Min(x, tiles-1))
+	y = math.Max(0, math.Min(y, tiles-1))
+	return fmt.Sprintf("%d/%d/%d", zoom, int64(x), int64(y))
+}
+
+// geoGridBuckets groups documents by geohash or geotile cell, ordered by documents count
+func geoGridBuckets(dimension *DimensionFragment, documents []models.Document) ([]*evaluatorBucket, error) {
+	precision := dimension.GeoPrecision()
+	encode := func(point geoPoint) string { return encodeGeohash(point, precision) }
+	if dimension.Operator == GeoTileGrid {
+		encode = func(point geoPoint) string { return encodeGeotile(point, precision) }
+	} else if precision < 1 || precision > 12 {
+		return nil, errors.New("geohash precision must be between 1 and 12")
+	}
+
+	index := make(map[string]*evaluatorBucket)
+	buckets := make([]*evaluatorBucket, 0)
+	for _, document := range documents {
+		seen := make(map[string]bool)
+		for _, point := range geoPoints(lookupValues(document.Source, dimension.Term)) {
+			key := encode(point)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			bucket, ok := index[key]
+			if !ok {
+				bucket = &evaluatorBucket{item: &Item{Key: key}}
+				index[key] = bucket
+				buckets = append(buckets, bucket)
+			}
+			bucket.documents = append(bucket.documents, document)
+		}
+	}
+
+	sort.SliceStable(buckets, func(i, j int) bool {
+		if len(buckets[i].documents) != len(buckets[j].documents) {
+			return len(buckets[i].documents) > len(buckets[j].documents)
+		}
+		return buckets[i].item.Key < buckets[j].item.Key
+	})
+
+	size := dimension.Size
+	if size == 0 {
+		size = DefaultDimensionSize
+	}
+	if len(buckets) > size {
+		buckets = buckets[:size]
+	}
+	return buckets, nil
+}
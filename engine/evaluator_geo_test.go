@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"time"
+
+	"testing"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/models"
+)
+
+func TestGeohash(t *testing.T) {
+	point := geoPoint{lat: 57.64911, lon: 10.40744}
+	if geohash := encodeGeohash(point, 11); geohash != "u4pruydqqvj" {
+		t.Errorf("invalid geohash %s", geohash)
+	}
+	decoded, ok := decodeGeohash("u4pruydqqvj")
+	if !ok || haversine(point, decoded) > 1 {
+		t.Errorf("invalid decoded geohash %+v", decoded)
+	}
+	if tile := encodeGeotile(geoPoint{lat: 10, lon: 10}, 1); tile != "1/1/0" {
+		t.Errorf("invalid geotile %s", tile)
+	}
+}
+
+func TestParseDistance(t *testing.T) {
+	cases := map[interface{}]float64{"5km": 5000, "100m": 100, "1.5mi": 2414.016, "2nmi": 3704, 250: 250}
+	for distance, expected := range cases {
+		if meters, err := parseDistance(distance); err != nil || meters != expected {
+			t.Errorf("distance %v: expected %f, got %f (%v)", distance, expected, meters, err)
+		}
+	}
+	if _, err := parseDistance("far"); err == nil {
+		t.Error("invalid distance should return an error")
+	}
+}
+
+func TestEvaluateFactGeo(t *testing.T) {
+	documents := []models.Document{
+		{ID: "1", Source: map[string]interface{}{"location": map[string]interface{}{"lat": 48.8584, "lon": 2.2945}}}, // Eiffel tower
+		{ID: "2", Source: map[string]interface{}{"location": "48.8606,2.3376"}},                                      // Louvre
+		{ID: "3", Source: map[string]interface{}{"location": []interface{}{4.8357, 45.7640}}},                        // Lyon
+	}
+
+	precision := 3
+	f := Fact{
+		Intent: &IntentFragment{Operator: Count, Term: "location"},
+		Condition: &LeafConditionFragment{Operator: GeoDistance, Field: "location",
+			Value: map[string]interface{}{"lat": 48.8566, "lon": 2.3522}, Value2: "5km"},
+		Dimensions: []*DimensionFragment{{Operator: GeoHashGrid, Term: "location", Precision: &precision}},
+	}
+	result, err := EvaluateFact(f, time.Now(), documents, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 2 {
+		t.Errorf("expected 2 documents within 5km, got %d", result.Total)
+	}
+	cells := result.Buckets["geohashgrid_location"]
+	if len(cells) != 1 || cells[0].Key != "u09" {
+		t.Errorf("invalid geohash cells %+v", cells)
+	}
+
+	f.Condition = &LeafConditionFragment{Operator: GeoBoundingBox, Field: "location", Value: "49,2", Value2: "45,5"}
+	f.Dimensions = nil
+	result, err = EvaluateFact(f, time.Now(), documents, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 3 {
+		t.Errorf("expected 3 documents in bounding box, got %d", result.Total)
+	}
+}
@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/models"
+)
+
+func evaluatorDocuments() []models.Document {
+	return []models.Document{
+		{ID: "1", Index: "parcel", Source: map[string]interface{}{
+			"status": "delivered", "weight": 1.5, "country": "FR", "created": "2024-01-01T10:00:00.000Z",
+			"events": []interface{}{map[string]interface{}{"status": "out", "date": "2024-01-01T08:00:00.000Z"}},
+		}},
+		{ID: "2", Index: "parcel", Source: map[string]interface{}{
+			"status": "delivered", "weight": 3.0, "country": "FR", "created": "2024-01-03T10:00:00.000Z",
+			"events": []interface{}{map[string]interface{}{"status": "lost", "date": "2024-01-03T08:00:00.000Z"}},
+		}},
+		{ID: "3", Index: "parcel", Source: map[string]interface{}{
+			"status": "pending", "weight": 10.0, "country": "DE", "created": "2024-01-01T12:00:00.000Z",
+		}},
+		{ID: "4", Index: "parcel", Source: map[string]interface{}{
+			"status": "delivered", "weight": 5.5, "created": "2024-01-03T23:00:00.000Z",
+			"events": []interface{}{
+				map[string]interface{}{"status": "out", "date": "2024-01-02T08:00:00.000Z"},
+				map[string]interface{}{"status": "delivered", "date": "2024-01-03T08:00:00.000Z"},
+			},
+		}},
+	}
+}
+
+func evaluateFactJSON(t *testing.T, b string) *FactResult {
+	t.Helper()
+	var f Fact
+	if err := json.Unmarshal([]byte(b), &f); err != nil {
+		t.Fatal(err)
+	}
+	ti := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	result, err := EvaluateFact(f, ti, evaluatorDocuments(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestEvaluateFactConditions(t *testing.T) {
+	cases := []struct {
+		condition string
+		expected  int64
+	}{
+		{`{"operator":"for","term":"status","value":"delivered"}`, 3},
+		{`{"operator":"for","term":"status","value":["pending","unknown"]}`, 1},
+		{`{"operator":"exists","term":"country"}`, 3},
+		{`{"operator":"from","term":"weight","value":3}`, 3},
+		{`{"operator":"to","term":"weight","value":3}`, 1},
+		{`{"operator":"between","term":"weight","value":3,"value2":10}`, 2},
+		{`{"operator":"between","term":"created","value":"2024-01-01T00:00:00.000","value2":"2024-01-02T00:00:00.000","timezone":"UTC"}`, 2},
+		{`{"operator":"from","term":"created","value":"now-2d/d"}`, 2},
+		{`{"operator":"regexp","term":"status","value":"deliv.*"}`, 3},
+		{`{"operator":"regexp","term":"status","value":"deliv"}`, 0},
+		{`{"operator":"wildcard","term":"status","value":"pend?ng"}`, 1},
+		{`{"operator":"optionalfor","term":"status","value":""}`, 4},
+		{`{"operator":"not","fragments":[{"operator":"for","term":"country","value":"FR"}]}`, 2},
+		{`{"operator":"or","fragments":[{"operator":"for","term":"country","value":"DE"},{"operator":"from","term":"weight","value":5}]}`, 2},
+		{`{"operator":"or","minimumShouldMatch":2,"fragments":[{"operator":"for","term":"country","value":"DE"},{"operator":"from","term":"weight","value":5}]}`, 1},
+		{`{"operator":"if","expression":"1 > 2","fragments":[{"operator":"for","term":"country","value":"DE"}]}`, 4},
+		{`{"operator":"nested","path":"events","fragment":{"operator":"and","fragments":[
+			{"operator":"for","term":"events.status","value":"out"},
+			{"operator":"from","term":"events.date","value":"2024-01-02T00:00:00.000"}
+		]}}`, 1},
+	}
+
+	for i, c := range cases {
+		result := evaluateFactJSON(t, `{"name":"test","model":"parcel","intent":{"operator":"count","term":"id"},"condition":`+c.condition+`}`)
+		if result.Total != c.expected {
+			t.Errorf("case %d: expected %d documents, got %d", i, c.expected, result.Total)
+		}
+	}
+}
+
+func TestEvaluateFactIntents(t *testing.T) {
+	cases := []struct {
+		intent   string
+		expected interface{}
+	}{
+		{`{"operator":"count","term":"country"}`, 2.0},
+		{`{"operator":"valuecount","term":"country"}`, 3.0},
+		{`{"operator":"sum","term":"weight"}`, 20.0},
+		{`{"operator":"avg","term":"weight"}`, 5.0},
+		{`{"operator":"min","term":"weight"}`, 1.5},
+		{`{"operator":"max","term":"weight"}`, 10.0},
+		{`{"operator":"median","term":"weight"}`, 4.25},
+		{`{"operator":"max","term":"unknown"}`, nil},
+	}
+
+	for _, c := range cases {
+		result := evaluateFactJSON(t, `{"name":"test","model":"parcel","intent":`+c.intent+`}`)
+		if result.Value != c.expected {
+			t.Errorf("intent %s: expected %v, got %v", c.intent, c.expected, result.Value)
+		}
+	}
+
+	result := evaluateFactJSON(t, `{"name":"test","model":"parcel","intent":{"operator":"percentiles","term":"weight","percents":[0,100]}}`)
+	percentiles, ok := result.Value.(PercentilesValue)
+	if !ok || percentiles["0.0"] != 1.5 || percentiles["100.0"] != 10 {
+		t.Errorf("invalid percentiles %v", result.Value)
+	}
+
+	result = evaluateFactJSON(t, `{"name":"test","model":"parcel","intent":{"operator":"extendedstats","term":"weight"}}`)
+	stats, ok := result.Value.(ExtendedStatsValue)
+	if !ok || stats.Count != 4 || stats.Sum != 20 || *stats.Min != 1.5 || *stats.Max != 10 || *stats.Avg != 5 {
+		t.Errorf("invalid extended stats %+v", result.Value)
+	}
+}
+
+func TestEvaluateFactDimensions(t *testing.T) {
+	result := evaluateFactJSON(t, `{"name":"test","model":"parcel","intent":{"operator":"sum","term":"weight"},
+		"dimensions":[{"operator":"by","term":"country","missing":"none"},{"operator":"datehistogram","term":"created","dateinterval":"day","timezone":"UTC"}]}`)
+
+	days := result.Buckets["datehistogram_created"]
+	if len(days) != 3 {
+		t.Fatalf("expected 3 days (with an empty one), got %d", len(days))
+	}
+	if days[0].Key != "1704067200000" || days[0].KeyAsString != "2024-01-01T00:00:00.000Z" {
+		t.Errorf("invalid first day %+v", days[0])
+	}
+	if docCount, _ := days[1].GetValue(DocCountAgg); docCount != int64(0) {
+		t.Errorf("expected an empty second day, got %v", docCount)
+	}
+	countries := days[2].Buckets["by_country"]
+	if len(countries) != 2 || countries[0].Key != "FR" || countries[1].Key != "none" {
+		t.Fatalf("invalid countries %+v", countries)
+	}
+	if value, _ := countries[1].GetValue("sum_weight"); value != 5.5 {
+		t.Errorf("expected 5.5, got %v", value)
+	}
+
+	result = evaluateFactJSON(t, `{"name":"test","model":"parcel","intent":{"operator":"count","term":"id"},
+		"dimensions":[{"operator":"range","term":"weight","ranges":[{"to":3},{"key":"heavy","from":3}]}]}`)
+	ranges := result.Buckets["range_weight"]
+	if len(ranges) != 2 || ranges[0].Key != "*-3.0" || ranges[1].Key != "heavy" || ranges[1].From != 3.0 {
+		t.Fatalf("invalid ranges %+v", ranges)
+	}
+	if docCount, _ := ranges[1].GetValue(DocCountAgg); docCount != int64(3) {
+		t.Errorf("expected 3 heavy documents, got %v", docCount)
+	}
+
+	result = evaluateFactJSON(t, `{"name":"test","model":"parcel","intent":{"operator":"count","term":"id"},
+		"dimensions":[{"operator":"histogram","term":"weight","interval":5}]}`)
+	histogram := result.Buckets["histogram_weight"]
+	if len(histogram) != 3 || histogram[0].Key != "0" || histogram[2].Key != "10" {
+		t.Errorf("invalid histogram %+v", histogram)
+	}
+}
+
+func TestEvaluateFactSelect(t *testing.T) {
+	result := evaluateFactJSON(t, `{"name":"test","model":"parcel","intent":{"operator":"select","term":"parcel"},
+		"condition":{"operator":"for","term":"status","value":"delivered"},
+		"sort":[{"weight":{"order":"desc"}}]}`)
+	if result.Total != 3 || len(result.Hits) != 3 {
+		t.Fatalf("invalid hits %+v", result.Hits)
+	}
+	if result.Hits[0].ID != "4" || result.Hits[2].ID != "1" {
+		t.Errorf("invalid hits order %+v", result.Hits)
+	}
+}
@@ -18,34 +18,42 @@ type ConditionsAlias struct {
 	Comment   string            `json:"comment"`
 }
 
-// Restitution ...
-type Restitution struct{}
-
 // Fact is the main structure used to for the full fact definition
 type Fact struct {
-	ID               int64                    `json:"id"`
-	Name             string                   `json:"name"`
-	Description      string                   `json:"description"`
-	IsObject         bool                     `json:"isObject"`
-	Model            string                   `json:"model"`
-	CalculationDepth int64                    `json:"calculationDepth,omitempty"`
-	Intent           *IntentFragment          `json:"intent,omitempty"`
-	Dimensions       []*DimensionFragment     `json:"dimensions,omitempty"`
-	Condition        ConditionFragment        `json:"condition,omitempty"`
-	Sort             []types.SortCombinations `json:"sort,omitempty"`
-	Restitution      []Restitution            `json:"restitution,omitempty"`
-	Comment          string                   `json:"comment"`
-	AdvancedSource   string                   `json:"source,omitempty"`
-	IsTemplate       bool                     `json:"isTemplate"`
-	Variables        []string                 `json:"variables,omitempty"`
+	ID                int64                    `json:"id"`
+	Name              string                   `json:"name"`
+	Description       string                   `json:"description"`
+	IsObject          bool                     `json:"isObject"`
+	Model             string                   `json:"model"`
+	CalculationDepth  int64                    `json:"calculationDepth,omitempty"`
+	Intent            *IntentFragment          `json:"intent,omitempty"`
+	Pipelines         []*PipelineFragment      `json:"secondaryIntents,omitempty"`
+	Dimensions        []*DimensionFragment     `json:"dimensions,omitempty"`
+	Composite         bool                     `json:"composite,omitempty"`
+	CompositeSize     int                      `json:"compositeSize,omitempty"`
+	Comparison        *ComparisonFragment      `json:"comparison,omitempty"`
+	Condition         ConditionFragment        `json:"condition,omitempty"`
+	Sort              []types.SortCombinations `json:"sort,omitempty"`
+	Restitution       []Restitution            `json:"restitution,omitempty"`
+	Comment           string                   `json:"comment"`
+	AdvancedSource    string                   `json:"source,omitempty"`
+	IsTemplate        bool                     `json:"isTemplate"`
+	Variables         []string                 `json:"variables,omitempty"`
+	TemplateVariables []TemplateVariable       `json:"templateVariables,omitempty"`
 }
 
 // IsValid checks if a fact definition is valid and has no missing mandatory fields
 // * Name must not be empty
 // * CalculationDepth must not be less than 0
 // * Intent must be valid
+// * Secondary intents (pipelines) must be valid
 // * Dimensions must be valid
-// * Condition must be valid
+// * Condition must be valid, and is mandatory with a delete intent
+// * Composite mode requires dimensions supported by the composite aggregation (By, Histogram, DateHistogram)
+// * Comparison must be valid, and requires an aggregation intent without composite mode nor DateRange dimension on its field
+// * Restitution steps must be valid
+// * Template variables must be valid and unique
+// * Global guardrails limits must be respected (see ReplaceGlobalGuardrails)
 func (f *Fact) IsValid() (bool, error) {
 	if f.Name == "" {
 		return false, errors.New("Missing Name")
@@ -53,6 +61,9 @@ func (f *Fact) IsValid() (bool, error) {
 	if f.CalculationDepth < 0 {
 		return false, errors.New("Missing CalculationDepth")
 	}
+	if ok, err := f.isValidTemplateVariables(); !ok {
+		return false, errors.New("Invalid Template Variable:" + err.Error())
+	}
 
 	if !f.IsObject && f.AdvancedSource == "" {
 		if f.Model == "" {
@@ -64,6 +75,9 @@ func (f *Fact) IsValid() (bool, error) {
 		if ok, err := f.Intent.IsValid(); !ok {
 			return false, errors.New("Invalid Intent:" + err.Error())
 		}
+		if ok, err := f.isValidPipelines(); !ok {
+			return false, errors.New("Invalid Secondary Intent:" + err.Error())
+		}
 		if f.Dimensions != nil {
 			for _, dimension := range f.Dimensions {
 				if ok, err := dimension.IsValid(); !ok {
@@ -71,11 +85,54 @@ func (f *Fact) IsValid() (bool, error) {
 				}
 			}
 		}
+		if f.CompositeSize < 0 {
+			return false, errors.New("compositeSize is lower than 0")
+		}
+		if f.Composite {
+			if len(f.Dimensions) == 0 {
+				return false, errors.New("Missing Dimensions with composite mode")
+			}
+			for _, dimension := range f.Dimensions {
+				if dimension.Operator != By && dimension.Operator != Histogram && dimension.Operator != DateHistogram {
+					return false, errors.New("dimension " + dimension.Operator.String() + " is not supported in composite mode")
+				}
+			}
+		}
+		if f.Comparison != nil {
+			if ok, err := f.Comparison.IsValid(); !ok {
+				return false, errors.New("Invalid Comparison:" + err.Error())
+			}
+			if f.Composite {
+				return false, errors.New("comparison is not supported in composite mode")
+			}
+			if f.Intent.Operator == Select || f.Intent.Operator == Delete {
+				return false, errors.New("comparison is not supported with intent " + f.Intent.Operator.String())
+			}
+			for _, dimension := range f.Dimensions {
+				// the ranges are not shifted with the previous window, which would only fill other buckets
+				if dimension.Operator == DateRange && dimension.Term == f.Comparison.Field {
+					return false, errors.New("comparison is not supported with a daterange dimension on the comparison field")
+				}
+			}
+		}
+		if f.Condition == nil && f.Intent.Operator == Delete {
+			return false, errors.New("Missing Condition with intent delete")
+		}
 		if f.Condition != nil {
 			if ok, err := f.Condition.IsValid(); !ok {
 				return false, errors.New("Invalid Condition:" + err.Error())
 			}
 		}
+		for _, restitution := range f.Restitution {
+			if ok, err := restitution.IsValid(); !ok {
+				return false, errors.New("Invalid Restitution:" + err.Error())
+			}
+		}
+		if g := GlobalGuardrails(); g != nil {
+			if err := g.Validate(f); err != nil {
+				return false, err
+			}
+		}
 	}
 	return true, nil
 }
@@ -126,7 +183,7 @@ func (f *Fact) IsExecutable() bool {
 // ContextualizeDimensions contextualize fact dimensions placeholders (standard or custom) and set the right timezone if needed
 func (f *Fact) ContextualizeDimensions(t time.Time) {
 	for _, dim := range f.Dimensions {
-		if dim.Operator == DateHistogram && dim.TimeZone == "" {
+		if (dim.Operator == DateHistogram || dim.Operator == DateRange) && dim.TimeZone == "" {
 			dim.TimeZone = utils.GetTimeZone(t)
 		}
 	}
@@ -151,6 +208,11 @@ func contextualizeCondition(condition ConditionFragment, t time.Time, placeholde
 				return err
 			}
 		}
+	case *NestedFragment:
+		err := contextualizeCondition(c.Fragment, t, placeholders)
+		if err != nil {
+			return err
+		}
 	case *LeafConditionFragment:
 		if c.Value != nil && reflect.TypeOf(c.Value).Kind() == reflect.String {
 			exp := c.Value.(string)
@@ -159,6 +221,9 @@ func contextualizeCondition(condition ConditionFragment, t time.Time, placeholde
 				if c.Operator == OptionalFor || c.Operator == OptionalRegexp || c.Operator == OptionalWildcard {
 					c.Field = ""
 					c.Value = ""
+				} else if c.Operator == GeoDistance || c.Operator == GeoBoundingBox {
+					// Geo points can be literals (48.85,2.35 or a geohash)
+					result = nil
 				} else {
 					zap.L().Warn("Expression evaluation failed", zap.String("exp", c.Value.(string)), zap.Error(err))
 					return err
@@ -172,8 +237,13 @@ func contextualizeCondition(condition ConditionFragment, t time.Time, placeholde
 			exp := c.Value2.(string)
 			result, err := expression.Process(expression.LangEval, exp, placeholders)
 			if err != nil {
-				zap.L().Warn("Expression evaluation failed", zap.String("exp", c.Value2.(string)), zap.Error(err))
-				return err
+				if c.Operator == GeoDistance || c.Operator == GeoBoundingBox {
+					// Geo points and distances can be literals (48.85,2.35 or 5km)
+					result = nil
+				} else {
+					zap.L().Warn("Expression evaluation failed", zap.String("exp", c.Value2.(string)), zap.Error(err))
+					return err
+				}
 			}
 			if result != nil {
 				c.Value2 = result
@@ -0,0 +1,372 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DescriptionTemplates contains the templates of a language used to describe a fact in plain text
+// The templates use the placeholders {term}, {value}, {value2}, {interval}, {ranges}, {precision}, {percents},
+// {conditions}, {expression} and {path}
+type DescriptionTemplates struct {
+	Intents    map[IntentToken]string
+	Dimensions map[DimensionToken]string
+	Conditions map[ConditionToken]string
+	Booleans   map[BooleanToken]string
+	Intervals  map[string]string
+	Where      string
+	And        string
+	Or         string
+	Separator  string
+}
+
+var (
+	descriptionMutex     sync.RWMutex
+	descriptionTemplates = map[string]DescriptionTemplates{
+		"en": englishDescriptionTemplates,
+		"fr": frenchDescriptionTemplates,
+	}
+)
+
+var englishDescriptionTemplates = DescriptionTemplates{
+	Intents: map[IntentToken]string{
+		Count:         "Count of distinct {term}",
+		Sum:           "Sum of {term}",
+		Avg:           "Average of {term}",
+		Min:           "Minimum of {term}",
+		Max:           "Maximum of {term}",
+		Select:        "List of {term}",
+		Delete:        "Deletion of {term}",
+		Percentiles:   "Percentiles {percents} of {term}",
+		ExtendedStats: "Statistics of {term}",
+		ValueCount:    "Count of values of {term}",
+		DistinctCount: "Count of distinct {term}",
+		Median:        "Median of {term}",
+	},
+	Dimensions: map[DimensionToken]string{
+		By:            "by {term}",
+		Histogram:     "by {term} per interval of {interval}",
+		DateHistogram: "by {term} per {interval}",
+		Range:         "by {term} range ({ranges})",
+		DateRange:     "by {term} period ({ranges})",
+		GeoHashGrid:   "by {term} geohash cell (precision {precision})",
+		GeoTileGrid:   "by {term} map tile (zoom {precision})",
+	},
+	Conditions: map[ConditionToken]string{
+		For:              "{term} is {value}",
+		From:             "{term} is from {value}",
+		To:               "{term} is before {value}",
+		Between:          "{term} is between {value} and {value2}",
+		Exists:           "{term} exists",
+		Script:           "the script {value} matches",
+		OptionalFor:      "{term} is {value} (if set)",
+		Regexp:           "{term} matches the pattern {value}",
+		OptionalRegexp:   "{term} matches the pattern {value} (if set)",
+		Wildcard:         "{term} is like {value}",
+		OptionalWildcard: "{term} is like {value} (if set)",
+		GeoDistance:      "{term} is within {value2} of {value}",
+		GeoBoundingBox:   "{term} is in the area from {value} to {value2}",
+	},
+	Booleans: map[BooleanToken]string{
+		Not:    "not ({conditions})",
+		If:     "if {expression}: {conditions}",
+		Nested: "for a same {path}: {conditions}",
+	},
+	Intervals: map[string]string{},
+	Where:     "where",
+	And:       "and",
+	Or:        "or",
+	Separator: ", ",
+}
+
+var frenchDescriptionTemplates = DescriptionTemplates{
+	Intents: map[IntentToken]string{
+		Count:         "Nombre de {term} distincts",
+		Sum:           "Somme de {term}",
+		Avg:           "Moyenne de {term}",
+		Min:           "Minimum de {term}",
+		Max:           "Maximum de {term}",
+		Select:        "Liste des {term}",
+		Delete:        "Suppression des {term}",
+		Percentiles:   "Percentiles {percents} de {term}",
+		ExtendedStats: "Statistiques de {term}",
+		ValueCount:    "Nombre de valeurs de {term}",
+		DistinctCount: "Nombre de {term} distincts",
+		Median:        "Médiane de {term}",
+	},
+	Dimensions: map[DimensionToken]string{
+		By:            "par {term}",
+		Histogram:     "par {term} par intervalle de {interval}",
+		DateHistogram: "par {term} par {interval}",
+		Range:         "par tranche de {term} ({ranges})",
+		DateRange:     "par période de {term} ({ranges})",
+		GeoHashGrid:   "par cellule geohash de {term} (précision {precision})",
+		GeoTileGrid:   "par tuile de carte de {term} (zoom {precision})",
+	},
+	Conditions: map[ConditionToken]string{
+		For:              "{term} vaut {value}",
+		From:             "{term} est à partir de {value}",
+		To:               "{term} est avant {value}",
+		Between:          "{term} est entre {value} et {value2}",
+		Exists:           "{term} est renseigné",
+		Script:           "le script {value} est vérifié",
+		OptionalFor:      "{term} vaut {value} (si renseigné)",
+		Regexp:           "{term} correspond à l'expression {value}",
+		OptionalRegexp:   "{term} correspond à l'expression {value} (si renseignée)",
+		Wildcard:         "{term} ressemble à {value}",
+		OptionalWildcard: "{term} ressemble à {value} (si renseigné)",
+		GeoDistance:      "{term} est à moins de {value2} de {value}",
+		GeoBoundingBox:   "{term} est dans la zone de {value} à {value2}",
+	},
+	Booleans: map[BooleanToken]string{
+		Not:    "non ({conditions})",
+		If:     "si {expression} : {conditions}",
+		Nested: "pour un même {path} : {conditions}",
+	},
+	Intervals: map[string]string{
+		"second":  "seconde",
+		"minute":  "minute",
+		"hour":    "heure",
+		"day":     "jour",
+		"week":    "semaine",
+		"month":   "mois",
+		"quarter": "trimestre",
+		"year":    "année",
+	},
+	Where:     "où",
+	And:       "et",
+	Or:        "ou",
+	Separator: ", ",
+}
+
+// RegisterDescriptionTemplates adds (or replaces) the description templates of a language
+func RegisterDescriptionTemplates(language string, templates DescriptionTemplates) {
+	descriptionMutex.Lock()
+	defer descriptionMutex.Unlock()
+	descriptionTemplates[strings.ToLower(language)] = templates
+}
+
+// GetDescriptionTemplates returns the description templates of a language (fr, en, fr-FR...)
+func GetDescriptionTemplates(language string) (DescriptionTemplates, bool) {
+	descriptionMutex.RLock()
+	defer descriptionMutex.RUnlock()
+	language = strings.ToLower(language)
+	if templates, ok := descriptionTemplates[language]; ok {
+		return templates, true
+	}
+	if i := strings.IndexAny(language, "-_"); i > 0 {
+		templates, ok := descriptionTemplates[language[:i]]
+		return templates, ok
+	}
+	return DescriptionTemplates{}, false
+}
+
+// Describe returns a plain text description of the fact in a language
+// The values are described as defined in the fact, before any contextualization
+func (f *Fact) Describe(language string) (string, error) {
+	templates, ok := GetDescriptionTemplates(language)
+	if !ok {
+		return "", errors.New("no description templates for language " + language)
+	}
+	if f.Intent == nil {
+		return "", errors.New("no intent fragment")
+	}
+
+	parts := []string{templates.describeIntent(f.Intent)}
+	dimensions := make([]string, 0, len(f.Dimensions))
+	for _, dimension := range f.Dimensions {
+		dimensions = append(dimensions, templates.describeDimension(dimension))
+	}
+	if len(dimensions) > 0 {
+		parts = append(parts, strings.Join(dimensions, templates.Separator))
+	}
+	if f.Condition != nil {
+		condition, err := templates.describeCondition(f.Condition, false)
+		if err != nil {
+			return "", err
+		}
+		if condition != "" {
+			parts = append(parts, templates.Where, condition)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+func (t DescriptionTemplates) describeIntent(intent *IntentFragment) string {
+	percents := make([]string, 0, len(intent.Percents))
+	for _, percent := range intent.Percents {
+		percents = append(percents, describeNumber(percent))
+	}
+	return fillDescription(t.template(t.Intents[intent.Operator], intent.Operator.String()+" {term}"), map[string]string{
+		"term":     intent.Term,
+		"percents": strings.Join(percents, t.Separator),
+	})
+}
+
+func (t DescriptionTemplates) describeDimension(dimension *DimensionFragment) string {
+	var interval string
+	switch dimension.Operator {
+	case Histogram:
+		interval = describeNumber(dimension.Interval)
+		if dimension.Interval == 0 {
+			interval = describeNumber(DefaultHistogramInterval)
+		}
+	case DateHistogram:
+		interval = dimension.DateInterval
+		if interval == "" {
+			interval = "1d"
+			if !dimension.CalendarFixed {
+				interval = "month"
+			}
+		}
+		if name, ok := t.Intervals[interval]; ok {
+			interval = name
+		}
+	}
+
+	ranges := make([]string, 0, len(dimension.Ranges))
+	for _, r := range dimension.Ranges {
+		if r.Key != "" {
+			ranges = append(ranges, r.Key)
+			continue
+		}
+		from, to := "*", "*"
+		if r.From != nil {
+			from = describeValue(r.From)
+		}
+		if r.To != nil {
+			to = describeValue(r.To)
+		}
+		ranges = append(ranges, from+" - "+to)
+	}
+
+	return fillDescription(t.template(t.Dimensions[dimension.Operator], dimension.Operator.String()+" {term}"), map[string]string{
+		"term":      dimension.Term,
+		"interval":  interval,
+		"ranges":    strings.Join(ranges, t.Separator),
+		"precision": strconv.Itoa(dimension.GeoPrecision()),
+	})
+}
+
+// describeCondition describes a condition, the boolean conditions being wrapped in parentheses when they are not at the top level
+func (t DescriptionTemplates) describeCondition(fragment ConditionFragment, wrap bool) (string, error) {
+	switch f := fragment.(type) {
+	case *BooleanFragment:
+		parts := make([]string, 0, len(f.Fragments))
+		for _, subFrag := range f.Fragments {
+			part, err := t.describeCondition(subFrag, len(f.Fragments) > 1)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		switch f.Operator {
+		case And:
+			return wrapDescription(strings.Join(parts, " "+t.And+" "), wrap && len(parts) > 1), nil
+		case Or:
+			return wrapDescription(strings.Join(parts, " "+t.Or+" "), wrap && len(parts) > 1), nil
+		case Not:
+			return fillDescription(t.template(t.Booleans[Not], "not ({conditions})"), map[string]string{
+				"conditions": strings.Join(parts, " "+t.Or+" "),
+			}), nil
+		case If:
+			return wrapDescription(fillDescription(t.template(t.Booleans[If], "if {expression}: {conditions}"), map[string]string{
+				"expression": f.Expression,
+				"conditions": strings.Join(parts, " "+t.And+" "),
+			}), wrap), nil
+		}
+		return "", errors.New("unsupported boolean operator " + f.Operator.String())
+
+	case *NestedFragment:
+		condition, err := t.describeCondition(f.Fragment, false)
+		if err != nil {
+			return "", err
+		}
+		return wrapDescription(fillDescription(t.template(t.Booleans[Nested], "nested {path}: {conditions}"), map[string]string{
+			"path":       f.Path,
+			"conditions": condition,
+		}), wrap), nil
+
+	case *LeafConditionFragment:
+		value := describeValue(f.Value)
+		switch f.Operator {
+		case For, OptionalFor, Regexp, OptionalRegexp, Wildcard, OptionalWildcard:
+			value = t.describeTerms(f.Value)
+		}
+		return fillDescription(t.template(t.Conditions[f.Operator], "{term} "+f.Operator.String()+" {value}"), map[string]string{
+			"term":   f.Field,
+			"value":  value,
+			"value2": describeValue(f.Value2),
+		}), nil
+	}
+	return "", fmt.Errorf("unsupported condition fragment %T", fragment)
+}
+
+// describeTerms quotes the string terms, a list of terms being joined as "'a', 'b' or 'c'"
+func (t DescriptionTemplates) describeTerms(value interface{}) string {
+	quote := func(v interface{}) string {
+		if s, ok := v.(string); ok {
+			return "'" + s + "'"
+		}
+		return describeValue(v)
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		return quote(value)
+	}
+	terms := make([]string, 0, len(values))
+	for _, v := range values {
+		terms = append(terms, quote(v))
+	}
+	if len(terms) < 2 {
+		return strings.Join(terms, "")
+	}
+	return strings.Join(terms[:len(terms)-1], t.Separator) + " " + t.Or + " " + terms[len(terms)-1]
+}
+
+func (t DescriptionTemplates) template(template string, fallback string) string {
+	if template == "" {
+		return fallback
+	}
+	return template
+}
+
+func describeValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return describeNumber(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, describeValue(item))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	}
+	return fmt.Sprint(value)
+}
+
+func describeNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func wrapDescription(description string, wrap bool) string {
+	if wrap {
+		return "(" + description + ")"
+	}
+	return description
+}
+
+func fillDescription(template string, values map[string]string) string {
+	replacements := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		replacements = append(replacements, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(replacements...).Replace(template)
+}
@@ -0,0 +1,92 @@
+package engine
+
+import "testing"
+
+func TestDescribe(t *testing.T) {
+	f := Fact{
+		Name:   "late_orders",
+		Intent: &IntentFragment{Operator: Count, Term: "orders"},
+		Dimensions: []*DimensionFragment{
+			{Operator: By, Term: "country"},
+			{Operator: DateHistogram, Term: "date", DateInterval: "day"},
+		},
+		Condition: &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: For, Field: "status", Value: "late"},
+			&LeafConditionFragment{Operator: Between, Field: "date", Value: "{start}", Value2: "{end}"},
+			&BooleanFragment{Operator: Not, Fragments: []ConditionFragment{
+				&LeafConditionFragment{Operator: For, Field: "carrier", Value: []interface{}{"a", "b", "c"}},
+				&LeafConditionFragment{Operator: Exists, Field: "cancelled"},
+			}},
+			&BooleanFragment{Operator: If, Expression: "withReturns == true", Fragments: []ConditionFragment{
+				&LeafConditionFragment{Operator: From, Field: "returns", Value: 1.0},
+			}},
+		}},
+	}
+
+	descriptions := map[string]string{
+		"en": "Count of distinct orders by country, by date per day where status is 'late' and date is between {start} and {end}" +
+			" and not (carrier is 'a', 'b' or 'c' or cancelled exists) and (if withReturns == true: returns is from 1)",
+		"fr-FR": "Nombre de orders distincts par country, par date par jour où status vaut 'late' et date est entre {start} et {end}" +
+			" et non (carrier vaut 'a', 'b' ou 'c' ou cancelled est renseigné) et (si withReturns == true : returns est à partir de 1)",
+	}
+	for language, expected := range descriptions {
+		description, err := f.Describe(language)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if description != expected {
+			t.Errorf("invalid %s description\nexpected: %s\nactual:   %s", language, expected, description)
+		}
+	}
+
+	if _, err := f.Describe("de"); err == nil {
+		t.Error("expected an error for an unknown language")
+	}
+}
+
+func TestDescribeTokens(t *testing.T) {
+	for language := range descriptionTemplates {
+		templates, _ := GetDescriptionTemplates(language)
+		for _, token := range append(IntentTokens, Delete) {
+			if templates.Intents[token] == "" {
+				t.Errorf("%s: missing intent template %s", language, token)
+			}
+		}
+		for _, token := range DimensionTokens {
+			if templates.Dimensions[token] == "" {
+				t.Errorf("%s: missing dimension template %s", language, token)
+			}
+		}
+		for _, token := range ConditionTokens {
+			if templates.Conditions[token] == "" {
+				t.Errorf("%s: missing condition template %s", language, token)
+			}
+		}
+		for _, token := range []BooleanToken{Not, If, Nested} {
+			if templates.Booleans[token] == "" {
+				t.Errorf("%s: missing boolean template %s", language, token)
+			}
+		}
+	}
+}
+
+func TestRegisterDescriptionTemplates(t *testing.T) {
+	templates, _ := GetDescriptionTemplates("en")
+	custom := templates
+	custom.Intents = map[IntentToken]string{Count: "Number of {term}"}
+	RegisterDescriptionTemplates("en-GB", custom)
+	defer func() {
+		descriptionMutex.Lock()
+		delete(descriptionTemplates, "en-gb")
+		descriptionMutex.Unlock()
+	}()
+
+	f := Fact{Intent: &IntentFragment{Operator: Count, Term: "parcels"}, Dimensions: []*DimensionFragment{{Operator: Histogram, Term: "weight", Interval: 5}}}
+	description, err := f.Describe("en-GB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Number of parcels by weight per interval of 5"; description != expected {
+		t.Errorf("invalid description\nexpected: %s\nactual:   %s", expected, description)
+	}
+}
@@ -0,0 +1,244 @@
+package engine
+
+import "strings"
+
+// JSONSchemaDialect is the JSON Schema dialect of the generated fact schema (also used by OpenAPI 3.1)
+const JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+const (
+	schemaDefsRef       = "#/$defs/"
+	openAPIComponentRef = "#/components/schemas/"
+)
+
+// FactJSONSchema returns the JSON Schema of a fact definition
+// The operators enumerations are generated from the token lists, and the polymorphic condition fragments
+// (leaf, boolean and nested) are modeled with a oneOf discriminated by their operator
+func FactJSONSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"$schema": JSONSchemaDialect,
+		"title":   "Fact",
+		"$ref":    schemaDefsRef + "Fact",
+		"$defs":   factSchemaDefinitions(),
+	}
+}
+
+// FactOpenAPIComponents returns the fact definition schemas as OpenAPI 3.1 components ("components.schemas")
+func FactOpenAPIComponents() map[string]interface{} {
+	return map[string]interface{}{
+		"schemas": rewriteSchemaRefs(factSchemaDefinitions(), schemaDefsRef, openAPIComponentRef),
+	}
+}
+
+func factSchemaDefinitions() map[string]interface{} {
+	intentOperators := make([]string, 0, len(IntentTokens)+1)
+	for _, token := range IntentTokens {
+		intentOperators = append(intentOperators, token.String())
+	}
+	intentOperators = append(intentOperators, Delete.String())
+	booleanOperators := make([]string, 0, len(BooleanTokens)+1)
+	for _, token := range BooleanTokens {
+		booleanOperators = append(booleanOperators, token.String())
+	}
+	booleanOperators = append(booleanOperators, If.String())
+	dimensionOperators := make([]string, 0, len(DimensionTokens))
+	for _, token := range DimensionTokens {
+		dimensionOperators = append(dimensionOperators, token.String())
+	}
+	conditionOperators := make([]string, 0, len(ConditionTokens))
+	for _, token := range ConditionTokens {
+		conditionOperators = append(conditionOperators, token.String())
+	}
+	pipelineOperators := make([]string, 0, len(PipelineTokens))
+	for _, token := range PipelineTokens {
+		pipelineOperators = append(pipelineOperators, token.String())
+	}
+	restitutionOperators := make([]string, 0, len(RestitutionTokens))
+	for _, token := range RestitutionTokens {
+		restitutionOperators = append(restitutionOperators, token.String())
+	}
+	variableTypes := make([]string, 0, len(VariableTokens))
+	for _, token := range VariableTokens {
+		variableTypes = append(variableTypes, token.String())
+	}
+	calendars := make([]string, 0, len(calendarIntervalsOrder))
+	for _, calendar := range calendarIntervalsOrder {
+		calendars = append(calendars, calendar.name)
+	}
+
+	return map[string]interface{}{
+		"Fact": schemaObject([]string{"name"}, map[string]interface{}{
+			"id":                schemaType("integer"),
+			"name":              schemaType("string"),
+			"description":       schemaType("string"),
+			"isObject":          schemaType("boolean"),
+			"model":             schemaType("string"),
+			"calculationDepth":  schemaMinimum("integer", 0),
+			"intent":            schemaRef("Intent"),
+			"secondaryIntents":  schemaArray(schemaRef("SecondaryIntent")),
+			"dimensions":        schemaArray(schemaRef("Dimension")),
+			"composite":         schemaType("boolean"),
+			"compositeSize":     schemaMinimum("integer", 0),
+			"comparison":        schemaRef("Comparison"),
+			"condition":         schemaRef("Condition"),
+			"sort":              schemaArray(map[string]interface{}{"type": []string{"string", "object"}}),
+			"restitution":       schemaArray(schemaRef("Restitution")),
+			"comment":           schemaType("string"),
+			"source":            schemaType("string"),
+			"isTemplate":        schemaType("boolean"),
+			"variables":         schemaArray(schemaType("string")),
+			"templateVariables": schemaArray(schemaRef("TemplateVariable")),
+		}),
+		"Intent": schemaObject([]string{"operator"}, map[string]interface{}{
+			"name":               schemaType("string"),
+			"operator":           schemaRef("IntentOperator"),
+			"term":               schemaType("string"),
+			"script":             schemaType("boolean"),
+			"percents":           schemaArray(schemaType("number")),
+			"precisionThreshold": schemaMinimum("integer", 0),
+		}),
+		"SecondaryIntent": schemaObject([]string{"name", "operator"}, map[string]interface{}{
+			"name":      schemaType("string"),
+			"operator":  schemaRef("SecondaryIntentOperator"),
+			"intent":    schemaType("string"),
+			"variables": map[string]interface{}{"type": "object", "additionalProperties": schemaType("string")},
+			"script":    schemaType("string"),
+			"window":    schemaMinimum("integer", 0),
+		}),
+		"Dimension": schemaObject([]string{"operator", "term"}, map[string]interface{}{
+			"name":           schemaType("string"),
+			"operator":       schemaRef("DimensionOperator"),
+			"term":           schemaType("string"),
+			"size":           schemaMinimum("integer", 0),
+			"interval":       schemaMinimum("number", 0),
+			"dateinterval":   map[string]interface{}{"type": "string", "examples": calendars},
+			"calendarfixed":  schemaType("boolean"),
+			"timezone":       schemaType("string"),
+			"ranges":         schemaArray(schemaRef("DimensionRange")),
+			"missing":        schemaType("string"),
+			"mindoccount":    schemaMinimum("integer", 0),
+			"orderby":        schemaType("string"),
+			"orderdirection": schemaEnum([]string{"asc", "desc"}),
+			"precision":      schemaMinimum("integer", 0),
+		}),
+		"DimensionRange": schemaObject(nil, map[string]interface{}{
+			"key":  schemaType("string"),
+			"from": map[string]interface{}{"type": []string{"number", "string"}},
+			"to":   map[string]interface{}{"type": []string{"number", "string"}},
+		}),
+		"Comparison": schemaObject([]string{"field", "shift"}, map[string]interface{}{
+			"field": schemaType("string"),
+			"shift": map[string]interface{}{"type": "string", "pattern": comparisonShiftRegex.String()},
+		}),
+		"Condition": map[string]interface{}{
+			"oneOf": []interface{}{schemaRef("LeafCondition"), schemaRef("BooleanCondition"), schemaRef("NestedCondition")},
+		},
+		"LeafCondition": schemaObject([]string{"operator", "term"}, map[string]interface{}{
+			"operator": schemaRef("ConditionOperator"),
+			"term":     schemaType("string"),
+			"value":    map[string]interface{}{},
+			"value2":   map[string]interface{}{},
+			"timezone": schemaType("string"),
+		}),
+		"BooleanCondition": schemaObject([]string{"operator", "fragments"}, map[string]interface{}{
+			"operator":           schemaRef("BooleanOperator"),
+			"expression":         schemaType("string"),
+			"fragments":          schemaArray(schemaRef("Condition")),
+			"minimumShouldMatch": map[string]interface{}{"type": []string{"integer", "string"}},
+		}),
+		"NestedCondition": schemaObject([]string{"operator", "path", "fragment"}, map[string]interface{}{
+			"operator": map[string]interface{}{"const": Nested.String()},
+			"path":     schemaType("string"),
+			"fragment": schemaRef("Condition"),
+		}),
+		"Restitution": schemaObject([]string{"operator"}, map[string]interface{}{
+			"operator":    schemaRef("RestitutionOperator"),
+			"dimension":   schemaType("string"),
+			"intent":      schemaType("string"),
+			"name":        schemaType("string"),
+			"labels":      map[string]interface{}{"type": "object", "additionalProperties": schemaType("string")},
+			"numerator":   schemaType("string"),
+			"denominator": schemaType("string"),
+			"from":        schemaType("string"),
+			"to":          schemaType("string"),
+			"value":       map[string]interface{}{},
+			"size":        schemaMinimum("integer", 0),
+			"others":      schemaType("string"),
+			"unit":        schemaType("string"),
+			"factor":      schemaType("number"),
+			"precision":   schemaMinimum("integer", 0),
+		}),
+		"TemplateVariable": schemaObject([]string{"name", "type"}, map[string]interface{}{
+			"name":          map[string]interface{}{"type": "string", "pattern": variableNameRegex.String()},
+			"type":          schemaRef("TemplateVariableType"),
+			"default":       map[string]interface{}{},
+			"allowedValues": schemaArray(map[string]interface{}{}),
+			"required":      schemaType("boolean"),
+		}),
+		"IntentOperator":          schemaEnum(intentOperators),
+		"SecondaryIntentOperator": schemaEnum(pipelineOperators),
+		"DimensionOperator":       schemaEnum(dimensionOperators),
+		"ConditionOperator":       schemaEnum(conditionOperators),
+		"BooleanOperator":         schemaEnum(booleanOperators),
+		"RestitutionOperator":     schemaEnum(restitutionOperators),
+		"TemplateVariableType":    schemaEnum(variableTypes),
+	}
+}
+
+func schemaType(t string) map[string]interface{} {
+	return map[string]interface{}{"type": t}
+}
+
+func schemaMinimum(t string, minimum int) map[string]interface{} {
+	return map[string]interface{}{"type": t, "minimum": minimum}
+}
+
+func schemaEnum(values []string) map[string]interface{} {
+	return map[string]interface{}{"type": "string", "enum": values}
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": schemaDefsRef + name}
+}
+
+func schemaArray(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "array", "items": items}
+}
+
+func schemaObject(required []string, properties map[string]interface{}) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// rewriteSchemaRefs returns a copy of a schema with the $ref prefixes replaced
+func rewriteSchemaRefs(schema interface{}, from string, to string) map[string]interface{} {
+	var rewrite func(value interface{}) interface{}
+	rewrite = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			copied := make(map[string]interface{}, len(v))
+			for key, sub := range v {
+				if ref, ok := sub.(string); ok && key == "$ref" && strings.HasPrefix(ref, from) {
+					copied[key] = to + strings.TrimPrefix(ref, from)
+					continue
+				}
+				copied[key] = rewrite(sub)
+			}
+			return copied
+		case []interface{}:
+			copied := make([]interface{}, 0, len(v))
+			for _, sub := range v {
+				copied = append(copied, rewrite(sub))
+			}
+			return copied
+		}
+		return value
+	}
+	return rewrite(schema).(map[string]interface{})
+}
@@ -0,0 +1,89 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestFactJSONSchemaProperties checks that the schema properties are in sync with the JSON fields of the structures
+func TestFactJSONSchemaProperties(t *testing.T) {
+	defs := FactJSONSchema()["$defs"].(map[string]interface{})
+	structures := map[string]interface{}{
+		"Fact":             Fact{},
+		"Intent":           IntentFragment{},
+		"SecondaryIntent":  PipelineFragment{},
+		"Dimension":        DimensionFragment{},
+		"DimensionRange":   DimensionRange{},
+		"Comparison":       ComparisonFragment{},
+		"LeafCondition":    LeafConditionFragment{},
+		"BooleanCondition": BooleanFragment{},
+		"NestedCondition":  NestedFragment{},
+		"Restitution":      Restitution{},
+		"TemplateVariable": TemplateVariable{},
+	}
+	for name, structure := range structures {
+		properties := defs[name].(map[string]interface{})["properties"].(map[string]interface{})
+		fields := make(map[string]bool)
+		rt := reflect.TypeOf(structure)
+		for i := 0; i < rt.NumField(); i++ {
+			tag := strings.Split(rt.Field(i).Tag.Get("json"), ",")[0]
+			if tag == "" || tag == "-" {
+				continue
+			}
+			fields[tag] = true
+			if _, ok := properties[tag]; !ok {
+				t.Errorf("%s: missing property %s", name, tag)
+			}
+		}
+		for property := range properties {
+			if !fields[property] {
+				t.Errorf("%s: unknown property %s", name, property)
+			}
+		}
+	}
+}
+
+func TestFactJSONSchemaOperators(t *testing.T) {
+	defs := FactJSONSchema()["$defs"].(map[string]interface{})
+	enum := func(name string) []string {
+		return defs[name].(map[string]interface{})["enum"].([]string)
+	}
+	if values := enum("ConditionOperator"); len(values) != len(ConditionTokens) || values[0] != "for" {
+		t.Errorf("invalid condition operators %v", values)
+	}
+	if values := enum("IntentOperator"); values[len(values)-1] != "delete" {
+		t.Errorf("invalid intent operators %v", values)
+	}
+	if values := enum("BooleanOperator"); !reflect.DeepEqual(values, []string{"and", "or", "not", "if"}) {
+		t.Errorf("invalid boolean operators %v", values)
+	}
+}
+
+func TestFactJSONSchemaKeepsTokens(t *testing.T) {
+	// with spare capacity, appending to the token lists would write to their backing arrays
+	tokens := BooleanTokens
+	defer func() { BooleanTokens = tokens }()
+	backing := make([]BooleanToken, len(tokens), len(tokens)+1)
+	copy(backing, tokens)
+	BooleanTokens = backing
+
+	FactJSONSchema()
+	if extended := BooleanTokens[:cap(BooleanTokens)]; extended[len(tokens)] != 0 {
+		t.Errorf("the schema generation should not modify the boolean tokens, got %v", extended)
+	}
+}
+
+func TestFactOpenAPIComponents(t *testing.T) {
+	b, err := json.Marshal(FactOpenAPIComponents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "#/$defs/") {
+		t.Error("OpenAPI components should not reference $defs")
+	}
+	if !strings.Contains(string(b), `"oneOf":[{"$ref":"#/components/schemas/LeafCondition"},{"$ref":"#/components/schemas/BooleanCondition"},{"$ref":"#/components/schemas/NestedCondition"}]`) {
+		t.Errorf("invalid condition component %s", b)
+	}
+}
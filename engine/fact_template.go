@@ -0,0 +1,399 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/expression"
+	"github.com/myrteametrics/myrtea-sdk/v5/utils"
+)
+
+var variableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// TemplateVariable is a typed variable declaration of a fact template
+type TemplateVariable struct {
+	Name          string        `json:"name"`
+	Type          VariableToken `json:"type"`
+	Default       interface{}   `json:"default,omitempty"`
+	AllowedValues []interface{} `json:"allowedValues,omitempty"`
+	Required      bool          `json:"required,omitempty"`
+}
+
+// IsValid checks if a template variable is valid and has no missing mandatory fields
+// * Name must be a valid expression identifier
+// * Type must not be empty (or 0 value)
+// * Default and AllowedValues must be of the variable type
+func (v *TemplateVariable) IsValid() (bool, error) {
+	if !variableNameRegex.MatchString(v.Name) {
+		return false, errors.New("Invalid Name " + v.Name)
+	}
+	if v.Type == 0 {
+		return false, errors.New("Missing Type")
+	}
+	for _, allowed := range v.AllowedValues {
+		if _, err := normalizeVariableValue(v.Type, allowed, true); err != nil {
+			return false, fmt.Errorf("Invalid AllowedValues: %s", err)
+		}
+	}
+	if v.Default != nil {
+		if _, err := v.Validate(v.Default); err != nil {
+			return false, fmt.Errorf("Invalid Default: %s", err)
+		}
+	}
+	return true, nil
+}
+
+// Validate checks that a value has the variable type and is allowed, and returns its normalized value
+// Numbers are converted to float64, dates to strings and lists to []interface{}
+func (v *TemplateVariable) Validate(value interface{}) (interface{}, error) {
+	normalized, err := normalizeVariableValue(v.Type, value, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(v.AllowedValues) == 0 {
+		return normalized, nil
+	}
+	values := []interface{}{normalized}
+	if list, ok := normalized.([]interface{}); ok {
+		values = list
+	}
+	for _, value := range values {
+		if !isAllowedValue(value, v.AllowedValues) {
+			return nil, fmt.Errorf("value %v is not allowed", value)
+		}
+	}
+	return normalized, nil
+}
+
+func isAllowedValue(value interface{}, allowed []interface{}) bool {
+	for _, a := range allowed {
+		if compareValues(value, a) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeVariableValue checks the type of a value, a list element being checked instead of a list if asElement is true
+func normalizeVariableValue(variableType VariableToken, value interface{}, asElement bool) (interface{}, error) {
+	if value == nil {
+		return nil, errors.New("value is nil")
+	}
+	switch variableType {
+	case VariableString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case VariableNumber:
+		if n, ok := toFloat64(value); ok {
+			return n, nil
+		}
+		if n, ok := value.(json.Number); ok {
+			if f, err := n.Float64(); err == nil {
+				return f, nil
+			}
+		}
+	case VariableBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case VariableDate:
+		switch d := value.(type) {
+		case time.Time:
+			return d.Format(utils.TimeLayout), nil
+		case string:
+			if _, err := ParseDateMath(d, time.Now(), ""); err == nil {
+				return d, nil
+			}
+		}
+	case VariableList:
+		if asElement {
+			return normalizeListElement(value)
+		}
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			break
+		}
+		list := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			item, err := normalizeListElement(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	default:
+		return nil, errors.New("unsupported variable type " + variableType.String())
+	}
+	return nil, fmt.Errorf("value %v is not a %s", value, variableType.String())
+}
+
+func normalizeListElement(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string, bool:
+		return v, nil
+	}
+	if n, ok := toFloat64(value); ok {
+		return n, nil
+	}
+	return nil, fmt.Errorf("value %v is not a valid list element", value)
+}
+
+// TemplateReport lists the inconsistencies between the placeholders of a fact template and its declared variables
+// Unused variables are declared but never referenced, undeclared placeholders are referenced but never declared
+type TemplateReport struct {
+	Unused     []string `json:"unused"`
+	Undeclared []string `json:"undeclared"`
+}
+
+// IsEmpty returns true if the report does not contain any inconsistency
+func (r TemplateReport) IsEmpty() bool {
+	return len(r.Unused) == 0 && len(r.Undeclared) == 0
+}
+
+// DeclaredVariables returns the names of the variables declared by a fact, typed or not (Variables)
+func (f *Fact) DeclaredVariables() []string {
+	names := make([]string, 0, len(f.TemplateVariables)+len(f.Variables))
+	seen := make(map[string]bool)
+	for _, variable := range f.TemplateVariables {
+		if !seen[variable.Name] {
+			seen[variable.Name] = true
+			names = append(names, variable.Name)
+		}
+	}
+	for _, name := range f.Variables {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Placeholders returns the sorted names of the placeholders referenced by the fact condition expressions
+// The standard date keywords (now, begin...) and the global variables (global_*) are not placeholders
+func (f *Fact) Placeholders() []string {
+	placeholders := make(map[string]bool)
+	walkConditionExpressions(f.Condition, func(exp *string) {
+		for _, identifier := range expression.Identifiers(*exp) {
+			placeholders[identifier.Name] = true
+		}
+	})
+
+	builtins := expression.GetDateKeywords(time.Now())
+	names := make([]string, 0, len(placeholders))
+	for name := range placeholders {
+		if _, ok := builtins[name]; ok || strings.HasPrefix(name, "global_") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TemplateReport returns the unused variables and the undeclared placeholders of a fact template
+func (f *Fact) TemplateReport() TemplateReport {
+	report := TemplateReport{Unused: make([]string, 0), Undeclared: make([]string, 0)}
+	placeholders := f.Placeholders()
+
+	declared := make(map[string]bool)
+	for _, name := range f.DeclaredVariables() {
+		declared[name] = true
+	}
+	referenced := make(map[string]bool)
+	for _, name := range placeholders {
+		referenced[name] = true
+		if !declared[name] {
+			report.Undeclared = append(report.Undeclared, name)
+		}
+	}
+	for _, name := range f.DeclaredVariables() {
+		if !referenced[name] {
+			report.Unused = append(report.Unused, name)
+		}
+	}
+	sort.Strings(report.Unused)
+	return report
+}
+
+// isValidTemplateVariables checks the declared variables of a fact template, which must be valid and unique
+func (f *Fact) isValidTemplateVariables() (bool, error) {
+	names := make(map[string]bool)
+	for _, variable := range f.TemplateVariables {
+		if ok, err := variable.IsValid(); !ok {
+			return false, err
+		}
+		if names[variable.Name] {
+			return false, errors.New("duplicated variable " + variable.Name)
+		}
+		names[variable.Name] = true
+	}
+	return true, nil
+}
+
+// Instantiate validates some values against the variables of a fact template and returns a concrete fact,
+// in which the placeholders of the variables are replaced by the values (or the variables default values)
+// The placeholders of the variables without value (and without default) are kept, to be contextualized later
+// Instantiate fails if a value is missing for a required variable, if a value is invalid or unknown,
+// or if the template references an undeclared placeholder
+func Instantiate(template Fact, values map[string]interface{}) (Fact, error) {
+	if !template.IsTemplate {
+		return Fact{}, errors.New("fact " + template.Name + " is not a template")
+	}
+	if ok, err := template.isValidTemplateVariables(); !ok {
+		return Fact{}, errors.New("Invalid Template Variable:" + err.Error())
+	}
+	if report := template.TemplateReport(); len(report.Undeclared) > 0 {
+		return Fact{}, errors.New("undeclared placeholders: " + strings.Join(report.Undeclared, ", "))
+	}
+
+	declared := make(map[string]bool)
+	for _, name := range template.DeclaredVariables() {
+		declared[name] = true
+	}
+	for name := range values {
+		if !declared[name] {
+			return Fact{}, errors.New("unknown variable " + name)
+		}
+	}
+
+	literals := make(map[string]string)
+	typed := make(map[string]bool)
+	for _, variable := range template.TemplateVariables {
+		typed[variable.Name] = true
+		value, ok := values[variable.Name]
+		if !ok || value == nil {
+			value = variable.Default
+		}
+		if value == nil {
+			if variable.Required {
+				return Fact{}, errors.New("missing required variable " + variable.Name)
+			}
+			continue
+		}
+		normalized, err := variable.Validate(value)
+		if err != nil {
+			return Fact{}, fmt.Errorf("invalid variable %s: %s", variable.Name, err)
+		}
+		literal, err := expressionLiteral(normalized)
+		if err != nil {
+			return Fact{}, fmt.Errorf("invalid variable %s: %s", variable.Name, err)
+		}
+		literals[variable.Name] = literal
+	}
+	for _, name := range template.Variables {
+		if value, ok := values[name]; ok && !typed[name] {
+			literal, err := expressionLiteral(value)
+			if err != nil {
+				return Fact{}, fmt.Errorf("invalid variable %s: %s", name, err)
+			}
+			literals[name] = literal
+		}
+	}
+
+	b, err := json.Marshal(template)
+	if err != nil {
+		return Fact{}, err
+	}
+	var f Fact
+	if err := json.Unmarshal(b, &f); err != nil {
+		return Fact{}, err
+	}
+	f.IsTemplate = false
+	f.TemplateVariables = nil
+	f.Variables = nil
+
+	walkConditionExpressions(f.Condition, func(exp *string) {
+		*exp = substituteExpression(*exp, literals)
+	})
+	return f, nil
+}
+
+// walkConditionExpressions calls fn with every expression of a condition tree (values, time zones and if expressions)
+// The literal geo points and distances are not expressions, except the unquoted geohashes which look like placeholders
+func walkConditionExpressions(condition ConditionFragment, fn func(exp *string)) {
+	switch c := condition.(type) {
+	case *BooleanFragment:
+		if c.Operator == If {
+			fn(&c.Expression)
+		}
+		for _, fragment := range c.Fragments {
+			walkConditionExpressions(fragment, fn)
+		}
+	case *NestedFragment:
+		walkConditionExpressions(c.Fragment, fn)
+	case *LeafConditionFragment:
+		for i, value := range []*interface{}{&c.Value, &c.Value2} {
+			exp, ok := (*value).(string)
+			if !ok || exp == "" {
+				continue
+			}
+			if (c.Operator == GeoDistance || c.Operator == GeoBoundingBox) && !variableNameRegex.MatchString(exp) {
+				if _, ok := parseGeoPoint(exp); ok {
+					continue
+				}
+				if _, err := parseDistance(exp); i == 1 && err == nil {
+					continue
+				}
+			}
+			fn(&exp)
+			*value = exp
+		}
+		if c.TimeZone != "" {
+			fn(&c.TimeZone)
+		}
+	}
+}
+
+// substituteExpression replaces the variables of an expression by their literal values
+func substituteExpression(exp string, literals map[string]string) string {
+	var builder strings.Builder
+	last := 0
+	for _, identifier := range expression.Identifiers(exp) {
+		literal, ok := literals[identifier.Name]
+		if !ok {
+			continue
+		}
+		builder.WriteString(exp[last:identifier.Offset])
+		builder.WriteString(literal)
+		last = identifier.Offset + len(identifier.Name)
+	}
+	builder.WriteString(exp[last:])
+	return builder.String()
+}
+
+// expressionLiteral formats a value as a literal of the expression language
+func expressionLiteral(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			literal, err := expressionLiteral(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, literal)
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	}
+	if n, ok := toFloat64(value); ok {
+		if n < 0 {
+			return "(" + strconv.FormatFloat(n, 'f', -1, 64) + ")", nil
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", value)
+}
@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTemplateReport(t *testing.T) {
+	f := Fact{
+		Name:       "late_parcels",
+		Model:      "parcel",
+		IsTemplate: true,
+		Intent:     &IntentFragment{Operator: Count, Term: "id"},
+		Condition: &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: For, Field: "status", Value: "status"},
+			&LeafConditionFragment{Operator: OptionalFor, Field: "carrier", Value: "carriers"},
+			&LeafConditionFragment{Operator: From, Field: "weight", Value: "minWeight * 1000"},
+			&LeafConditionFragment{Operator: Between, Field: "date", Value: `calendar_add(begin, "-24h")`, Value2: "now"},
+			&BooleanFragment{Operator: If, Expression: "withReturns == true", Fragments: []ConditionFragment{
+				&LeafConditionFragment{Operator: Exists, Field: "return"},
+			}},
+		}},
+		TemplateVariables: []TemplateVariable{
+			{Name: "status", Type: VariableString, AllowedValues: []interface{}{"late", "lost"}, Required: true},
+			{Name: "carriers", Type: VariableList},
+			{Name: "minWeight", Type: VariableNumber, Default: 2},
+			{Name: "withReturns", Type: VariableBoolean, Default: false},
+		},
+	}
+	report := f.TemplateReport()
+	if !report.IsEmpty() {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	f.TemplateVariables = append(f.TemplateVariables, TemplateVariable{Name: "unused", Type: VariableString})
+	f.Condition.(*BooleanFragment).Fragments = append(f.Condition.(*BooleanFragment).Fragments,
+		&LeafConditionFragment{Operator: OptionalFor, Field: "customer", Value: "custommer"},
+		&LeafConditionFragment{Operator: GeoDistance, Field: "location", Value: "48.85,2.35", Value2: "5km"},
+		&LeafConditionFragment{Operator: For, Field: "zone", Value: `global_zone + "-" + suffix.value`},
+	)
+	report = f.TemplateReport()
+	expected := TemplateReport{Unused: []string{"unused"}, Undeclared: []string{"custommer", "suffix"}}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("invalid report\nexpected: %+v\nactual:   %+v", expected, report)
+	}
+}
+
+func TestInstantiate(t *testing.T) {
+	template := Fact{
+		Name:       "late_parcels",
+		Model:      "parcel",
+		IsTemplate: true,
+		Intent:     &IntentFragment{Operator: Count, Term: "id"},
+		Condition: &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: For, Field: "status", Value: "status"},
+			&LeafConditionFragment{Operator: OptionalFor, Field: "carrier", Value: "carriers"},
+			&LeafConditionFragment{Operator: From, Field: "weight", Value: "minWeight * 1000"},
+			&LeafConditionFragment{Operator: Between, Field: "date", Value: `calendar_add(begin, "-24h")`, Value2: "now"},
+			&BooleanFragment{Operator: If, Expression: "withReturns == true", Fragments: []ConditionFragment{
+				&LeafConditionFragment{Operator: Exists, Field: "return"},
+			}},
+		}},
+		TemplateVariables: []TemplateVariable{
+			{Name: "status", Type: VariableString, AllowedValues: []interface{}{"late", "lost"}, Required: true},
+			{Name: "carriers", Type: VariableList},
+			{Name: "minWeight", Type: VariableNumber, Default: 2},
+			{Name: "withReturns", Type: VariableBoolean, Default: false},
+		},
+	}
+	f, err := Instantiate(template, map[string]interface{}{"status": "late", "carriers": []string{"dhl", "ups"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.IsTemplate || f.TemplateVariables != nil {
+		t.Error("instantiated fact should not be a template")
+	}
+	fragments := f.Condition.(*BooleanFragment).Fragments
+	values := []interface{}{
+		fragments[0].(*LeafConditionFragment).Value,
+		fragments[1].(*LeafConditionFragment).Value,
+		fragments[2].(*LeafConditionFragment).Value,
+		fragments[3].(*LeafConditionFragment).Value,
+		fragments[4].(*BooleanFragment).Expression,
+	}
+	expected := []interface{}{`"late"`, `["dhl", "ups"]`, "2 * 1000", `calendar_add(begin, "-24h")`, "false == true"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("invalid values\nexpected: %v\nactual:   %v", expected, values)
+	}
+	if template.Condition.(*BooleanFragment).Fragments[0].(*LeafConditionFragment).Value != "status" {
+		t.Error("template should not be modified")
+	}
+
+	ts := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	if err := f.ContextualizeCondition(ts, map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if value := fragments[2].(*LeafConditionFragment).Value; value != 2000.0 {
+		t.Errorf("invalid contextualized value %v", value)
+	}
+	if value := f.Condition.(*BooleanFragment).Fragments[1].(*LeafConditionFragment).Value; !reflect.DeepEqual(value, []interface{}{"dhl", "ups"}) {
+		t.Errorf("invalid contextualized value %v", value)
+	}
+}
+
+func TestInstantiateErrors(t *testing.T) {
+	template := Fact{
+		Name:       "late_parcels",
+		Model:      "parcel",
+		IsTemplate: true,
+		Intent:     &IntentFragment{Operator: Count, Term: "id"},
+		Condition: &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: For, Field: "status", Value: "status"},
+			&LeafConditionFragment{Operator: OptionalFor, Field: "carrier", Value: "carriers"},
+			&LeafConditionFragment{Operator: From, Field: "weight", Value: "minWeight * 1000"},
+			&LeafConditionFragment{Operator: Between, Field: "date", Value: `calendar_add(begin, "-24h")`, Value2: "now"},
+			&BooleanFragment{Operator: If, Expression: "withReturns == true", Fragments: []ConditionFragment{
+				&LeafConditionFragment{Operator: Exists, Field: "return"},
+			}},
+		}},
+		TemplateVariables: []TemplateVariable{
+			{Name: "status", Type: VariableString, AllowedValues: []interface{}{"late", "lost"}, Required: true},
+			{Name: "carriers", Type: VariableList},
+			{Name: "minWeight", Type: VariableNumber, Default: 2},
+			{Name: "withReturns", Type: VariableBoolean, Default: false},
+		},
+	}
+	values := []map[string]interface{}{
+		{},
+		{"status": "unknown"},
+		{"status": 12},
+		{"status": "late", "minWeight": "heavy"},
+		{"status": "late", "carriers": []interface{}{map[string]interface{}{}}},
+		{"status": "late", "other": 1},
+	}
+	for _, v := range values {
+		if _, err := Instantiate(template, v); err == nil {
+			t.Errorf("%v: expected an error", v)
+		}
+	}
+
+	f := Fact{
+		Name:              "late_parcels",
+		Model:             "parcel",
+		IsTemplate:        true,
+		Intent:            &IntentFragment{Operator: Count, Term: "id"},
+		Condition:         &LeafConditionFragment{Operator: For, Field: "status", Value: "statsu"},
+		TemplateVariables: []TemplateVariable{{Name: "status", Type: VariableString, Required: true}},
+	}
+	if _, err := Instantiate(f, map[string]interface{}{"status": "late"}); err == nil || err.Error() != "undeclared placeholders: statsu" {
+		t.Errorf("expected an undeclared placeholder error, got %v", err)
+	}
+
+	f.Condition = &LeafConditionFragment{Operator: For, Field: "status", Value: "status"}
+	f.IsTemplate = false
+	if _, err := Instantiate(f, map[string]interface{}{"status": "late"}); err == nil {
+		t.Error("expected an error for a fact which is not a template")
+	}
+}
+
+func TestTemplateVariableIsValid(t *testing.T) {
+	variables := []TemplateVariable{
+		{Name: "", Type: VariableString},
+		{Name: "my-var", Type: VariableString},
+		{Name: "v"},
+		{Name: "v", Type: VariableNumber, Default: "a"},
+		{Name: "v", Type: VariableDate, Default: "not a date"},
+		{Name: "v", Type: VariableString, Default: "c", AllowedValues: []interface{}{"a", "b"}},
+		{Name: "v", Type: VariableList, AllowedValues: []interface{}{[]interface{}{"a"}}},
+	}
+	for _, variable := range variables {
+		if ok, _ := variable.IsValid(); ok {
+			t.Errorf("%+v should be invalid", variable)
+		}
+	}
+
+	valid := TemplateVariable{Name: "since", Type: VariableDate, Default: "now-1d/d"}
+	if ok, err := valid.IsValid(); !ok {
+		t.Error(err)
+	}
+
+	f := Fact{
+		Name:       "late_parcels",
+		Model:      "parcel",
+		IsTemplate: true,
+		Intent:     &IntentFragment{Operator: Count, Term: "id"},
+		Condition:  &LeafConditionFragment{Operator: For, Field: "status", Value: "status"},
+		TemplateVariables: []TemplateVariable{
+			{Name: "status", Type: VariableString, Required: true},
+			{Name: "status", Type: VariableString},
+		},
+	}
+	if ok, _ := f.IsValid(); ok {
+		t.Error("fact with duplicated variables should be invalid")
+	}
+}
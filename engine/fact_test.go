@@ -382,3 +382,43 @@ func TestContextualizeWildCard(t *testing.T) {
 		t.Error("Fragment 2 Value should have not been removed (Wildcard)")
 	}
 }
+
+func TestIsValidComposite(t *testing.T) {
+	f := Fact{
+		Name:       "1",
+		Model:      "model",
+		Intent:     &IntentFragment{Operator: Count, Term: "myintent"},
+		Dimensions: []*DimensionFragment{{Operator: By, Term: "customer"}, {Operator: DateHistogram, Term: "date"}},
+		Composite:  true,
+	}
+	if ok, err := f.IsValid(); !ok {
+		t.Error(err)
+	}
+
+	f.Dimensions = append(f.Dimensions, &DimensionFragment{Operator: Range, Term: "weight", Ranges: []DimensionRange{{To: 10}}})
+	if ok, _ := f.IsValid(); ok {
+		t.Error("Fact with a range dimension should be invalid in composite mode")
+	}
+
+	f.Dimensions = nil
+	if ok, _ := f.IsValid(); ok {
+		t.Error("Fact without dimension should be invalid in composite mode")
+	}
+}
+
+func TestIsValidDelete(t *testing.T) {
+	f := Fact{
+		Name:      "1",
+		Model:     "model",
+		Intent:    &IntentFragment{Operator: Delete, Term: "parcel"},
+		Condition: &LeafConditionFragment{Operator: For, Field: "status", Value: "lost"},
+	}
+	if ok, err := f.IsValid(); !ok {
+		t.Error(err)
+	}
+
+	f.Condition = nil
+	if ok, _ := f.IsValid(); ok {
+		t.Error("Fact with a delete intent should be invalid without condition")
+	}
+}
@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/modeler"
+)
+
+// ValidationError is a fact validation error located by its JSON path in the fact definition
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors is the list of every validation error of a fact
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+var numericTypes = []modeler.FieldType{modeler.Int, modeler.Float}
+var numericOrDateTypes = []modeler.FieldType{modeler.Int, modeler.Float, modeler.DateTime}
+var dateTypes = []modeler.FieldType{modeler.DateTime}
+var stringTypes = []modeler.FieldType{modeler.String}
+var geoTypes = []modeler.FieldType{modeler.GeoPoint}
+
+// intentFieldTypes lists the field types allowed by each intent (nil means every type)
+var intentFieldTypes = map[IntentToken][]modeler.FieldType{
+	Sum:           numericTypes,
+	ExtendedStats: numericTypes,
+	Avg:           numericOrDateTypes,
+	Min:           numericOrDateTypes,
+	Max:           numericOrDateTypes,
+	Percentiles:   numericOrDateTypes,
+	Median:        numericOrDateTypes,
+}
+
+// dimensionFieldTypes lists the field types allowed by each dimension (nil means every type)
+var dimensionFieldTypes = map[DimensionToken][]modeler.FieldType{
+	Histogram:     numericTypes,
+	Range:         numericTypes,
+	DateHistogram: dateTypes,
+	DateRange:     dateTypes,
+	GeoHashGrid:   geoTypes,
+	GeoTileGrid:   geoTypes,
+}
+
+// conditionFieldTypes lists the field types allowed by each condition (nil means every type)
+var conditionFieldTypes = map[ConditionToken][]modeler.FieldType{
+	From:             numericOrDateTypes,
+	To:               numericOrDateTypes,
+	Between:          numericOrDateTypes,
+	Regexp:           stringTypes,
+	OptionalRegexp:   stringTypes,
+	Wildcard:         stringTypes,
+	OptionalWildcard: stringTypes,
+	GeoDistance:      geoTypes,
+	GeoBoundingBox:   geoTypes,
+}
+
+// IsValidForModel checks if every field used by the fact exists in the model, with a type compatible with its operator
+// The returned error is a ValidationErrors containing every error found with its JSON path
+func (f *Fact) IsValidForModel(model modeler.Model) (bool, error) {
+	errs := make(ValidationErrors, 0)
+
+	if f.IsObject || f.AdvancedSource != "" {
+		return true, nil
+	}
+
+	if f.Model != model.Name {
+		errs = append(errs, ValidationError{Path: "model", Message: fmt.Sprintf("fact model %s does not match model %s", f.Model, model.Name)})
+	}
+
+	if f.Intent != nil && !f.Intent.Script && f.Intent.Operator != Select && f.Intent.Operator != Delete {
+		errs = append(errs, validateField(model, "intent.term", f.Intent.Term, f.Intent.Operator.String(), intentFieldTypes[f.Intent.Operator])...)
+	}
+
+	for i, dimension := range f.Dimensions {
+		path := fmt.Sprintf("dimensions[%d].term", i)
+		errs = append(errs, validateField(model, path, dimension.Term, dimension.Operator.String(), dimensionFieldTypes[dimension.Operator])...)
+	}
+
+	if f.Condition != nil {
+		errs = append(errs, validateCondition(model, "condition", f.Condition)...)
+	}
+
+	for i, sort := range f.Sort {
+		path := fmt.Sprintf("sort[%d]", i)
+		fields, err := ParseSort([]types.SortCombinations{sort})
+		if err != nil {
+			errs = append(errs, ValidationError{Path: path, Message: err.Error()})
+			continue
+		}
+		for _, field := range fields {
+			// the metadata fields (_score, _doc, _shard_doc...) are not part of the model
+			if strings.HasPrefix(field.Field, "_") {
+				continue
+			}
+			errs = append(errs, validateField(model, path, field.Field, "sort", nil)...)
+		}
+	}
+
+	if f.Comparison != nil {
+		errs = append(errs, validateField(model, "comparison.field", f.Comparison.Field, "comparison", dateTypes)...)
+	}
+
+	if len(errs) > 0 {
+		return false, errs
+	}
+	return true, nil
+}
+
+func validateCondition(model modeler.Model, path string, condition ConditionFragment) ValidationErrors {
+	errs := make(ValidationErrors, 0)
+	switch c := condition.(type) {
+	case *BooleanFragment:
+		for i, subFrag := range c.Fragments {
+			errs = append(errs, validateCondition(model, fmt.Sprintf("%s.fragments[%d]", path, i), subFrag)...)
+		}
+
+	case *NestedFragment:
+		if err := c.validatePath(model); err != nil {
+			errs = append(errs, ValidationError{Path: path + ".path", Message: err.Error()})
+		}
+		for _, field := range c.outOfPathFields() {
+			errs = append(errs, ValidationError{Path: path + ".fragment", Message: fmt.Sprintf("field %s is not in nested path %s", field, c.Path)})
+		}
+		errs = append(errs, validateCondition(model, path+".fragment", c.Fragment)...)
+
+	case *LeafConditionFragment:
+		if c.Operator == Script {
+			break
+		}
+		errs = append(errs, validateField(model, path+".term", c.Field, c.Operator.String(), conditionFieldTypes[c.Operator])...)
+	}
+	return errs
+}
+
+func validateField(model modeler.Model, path string, field string, operator string, allowed []modeler.FieldType) ValidationErrors {
+	if field == "" {
+		return ValidationErrors{{Path: path, Message: "missing field"}}
+	}
+	leaf := modeler.GetFieldLeaf(field, "", model.Fields)
+	if leaf == nil {
+		message := fmt.Sprintf("field %s does not exist in model %s", field, model.Name)
+		if fullPath := modeler.BuildFieldPath(field, model.Fields); fullPath != "" && fullPath != field {
+			message += fmt.Sprintf(" (did you mean %s ?)", fullPath)
+		}
+		return ValidationErrors{{Path: path, Message: message}}
+	}
+	if allowed == nil {
+		return nil
+	}
+	for _, fieldType := range allowed {
+		if leaf.Ftype == fieldType {
+			return nil
+		}
+	}
+	return ValidationErrors{{Path: path, Message: fmt.Sprintf("field %s of type %s cannot be used with operator %s", field, leaf.Ftype.String(), operator)}}
+}
@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/modeler"
+)
+
+var validationModel = modeler.Model{
+	Name: "parcel",
+	Fields: []modeler.Field{
+		&modeler.FieldLeaf{Name: "id", Ftype: modeler.String},
+		&modeler.FieldLeaf{Name: "weight", Ftype: modeler.Float},
+		&modeler.FieldLeaf{Name: "created", Ftype: modeler.DateTime},
+		&modeler.FieldObject{Name: "events", Ftype: modeler.Object, KeepObjectSeparation: true, Fields: []modeler.Field{
+			&modeler.FieldLeaf{Name: "status", Ftype: modeler.String},
+			&modeler.FieldLeaf{Name: "date", Ftype: modeler.DateTime},
+		}},
+		&modeler.FieldObject{Name: "sender", Ftype: modeler.Object, Fields: []modeler.Field{
+			&modeler.FieldLeaf{Name: "country", Ftype: modeler.String},
+		}},
+	},
+}
+
+func TestFactIsValidForModel(t *testing.T) {
+	b := []byte(`{"name":"test","model":"parcel",
+		"intent":{"operator":"sum","term":"weight"},
+		"dimensions":[{"operator":"by","term":"sender.country"},{"operator":"datehistogram","term":"created","dateinterval":"day"}],
+		"condition":{"operator":"and","fragments":[
+			{"operator":"from","term":"created","value":"begin"},
+			{"operator":"nested","path":"events","fragment":{"operator":"for","term":"events.status","value":"delivered"}}
+		]},
+		"sort":[{"created":"desc"},"_score"],
+		"comparison":{"field":"created","shift":"1w"}}`)
+	var f Fact
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := f.IsValidForModel(validationModel); !ok {
+		t.Error(err)
+	}
+}
+
+func TestFactIsValidForModelErrors(t *testing.T) {
+	b := []byte(`{"name":"test","model":"other",
+		"intent":{"operator":"sum","term":"id"},
+		"dimensions":[{"operator":"by","term":"country"},{"operator":"datehistogram","term":"weight","dateinterval":"day"}],
+		"condition":{"operator":"and","fragments":[
+			{"operator":"regexp","term":"weight","value":".*"},
+			{"operator":"nested","path":"sender","fragment":{"operator":"for","term":"events.status","value":"delivered"}}
+		]},
+		"sort":["weight",{"unknown":"asc"}],
+		"comparison":{"field":"weight","shift":"1w"}}`)
+	var f Fact
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := f.IsValidForModel(validationModel)
+	if ok {
+		t.Fatal("fact should be invalid")
+	}
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error is not a ValidationErrors %T", err)
+	}
+
+	expected := map[string]string{
+		"model":                           "fact model other does not match model parcel",
+		"intent.term":                     "field id of type string cannot be used with operator sum",
+		"dimensions[0].term":              "field country does not exist in model parcel (did you mean sender.country ?)",
+		"dimensions[1].term":              "field weight of type float cannot be used with operator datehistogram",
+		"condition.fragments[0].term":     "field weight of type float cannot be used with operator regexp",
+		"condition.fragments[1].path":     "path sender is not a nested object of model parcel",
+		"condition.fragments[1].fragment": "field events.status is not in nested path sender",
+		"sort[1]":                         "field unknown does not exist in model parcel",
+		"comparison.field":                "field weight of type float cannot be used with operator comparison",
+	}
+	if len(errs) != len(expected) {
+		t.Errorf("expected %d errors, got %d: %s", len(expected), len(errs), errs.Error())
+	}
+	for _, e := range errs {
+		if msg, found := expected[e.Path]; !found || msg != e.Message {
+			t.Errorf("unexpected error %s", e.Error())
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// TimeWindow is the time window of the date range conditions on a field, resolved at a time (nil bounds are open)
+type TimeWindow struct {
+	Field string     `json:"field"`
+	From  *time.Time `json:"from,omitempty"`
+	To    *time.Time `json:"to,omitempty"`
+}
+
+// TimeWindows returns the time windows of a contextualized fact, sorted by field
+// The windows are the intersection of the date range conditions combined with And or If
+func (f *Fact) TimeWindows(t time.Time) []TimeWindow {
+	bounds := collectBounds(f.Condition, t)
+	windows := make([]TimeWindow, 0)
+	for field, b := range bounds {
+		if !b.date {
+			continue
+		}
+		window := TimeWindow{Field: field}
+		if b.hasLower {
+			from := secondsToTime(b.lower)
+			window.From = &from
+		}
+		if b.hasUpper {
+			to := secondsToTime(b.upper)
+			window.To = &to
+		}
+		windows = append(windows, window)
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Field < windows[j].Field })
+	return windows
+}
+
+// IsClosedWindow returns true if a contextualized fact only targets the past at a time
+// (at least one of its time windows ends before t), in which case its result is immutable
+func (f *Fact) IsClosedWindow(t time.Time) bool {
+	for _, window := range f.TimeWindows(t) {
+		if window.To != nil && window.To.Before(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func secondsToTime(seconds float64) time.Time {
+	s, frac := math.Modf(seconds)
+	return time.Unix(int64(s), int64(math.Round(frac*1e9))).UTC()
+}
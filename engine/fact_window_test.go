@@ -0,0 +1,36 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeWindows(t *testing.T) {
+	ti := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	f := Fact{Condition: &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+		&LeafConditionFragment{Operator: Between, Field: "date", Value: "now-7d/d", Value2: "now/d"},
+		&LeafConditionFragment{Operator: From, Field: "date", Value: "2024-03-10T00:00:00.000"},
+		&LeafConditionFragment{Operator: To, Field: "weight", Value: 10.0},
+		&BooleanFragment{Operator: Or, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: From, Field: "created", Value: "now-1d"},
+		}},
+	}}}
+
+	windows := f.TimeWindows(ti)
+	if len(windows) != 1 || windows[0].Field != "date" {
+		t.Fatalf("invalid windows %+v", windows)
+	}
+	if from := windows[0].From; from == nil || !from.Equal(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("invalid from %v", from)
+	}
+	if to := windows[0].To; to == nil || !to.Equal(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("invalid to %v", to)
+	}
+	if !f.IsClosedWindow(ti) {
+		t.Error("window should be closed")
+	}
+	f.Condition.(*BooleanFragment).Fragments[0].(*LeafConditionFragment).Value2 = "2024-03-15T00:00:00.000"
+	if f.IsClosedWindow(time.Date(2024, 3, 14, 10, 0, 0, 0, time.UTC)) {
+		t.Error("window should not be closed the day before")
+	}
+}
@@ -9,6 +9,12 @@ type ConditionFragment interface {
 	IsValid() (bool, error)
 }
 
+// UnmarshalConditionFragment unmarshals the JSON definition of a condition fragment (boolean, nested or leaf)
+func UnmarshalConditionFragment(data []byte) (ConditionFragment, error) {
+	raw := json.RawMessage(data)
+	return unmarshalConditionFragment(&raw)
+}
+
 func unmarshalConditionFragment(raw *json.RawMessage) (ConditionFragment, error) {
 	if raw == nil {
 		return nil, nil
@@ -54,6 +60,25 @@ func unmarshalConditionFragment(raw *json.RawMessage) (ConditionFragment, error)
 
 		return aux.BooleanFragment, nil
 
+	case Nested.String():
+		aux := struct {
+			*NestedFragment
+			Fragment *json.RawMessage `json:"fragment"`
+		}{
+			NestedFragment: &NestedFragment{},
+		}
+		if err := json.Unmarshal(*raw, &aux); err != nil {
+			return nil, err
+		}
+
+		subFrag, err := unmarshalConditionFragment(aux.Fragment)
+		if err != nil {
+			return nil, err
+		}
+		aux.NestedFragment.Fragment = subFrag
+
+		return aux.NestedFragment, nil
+
 	default:
 		var frag *LeafConditionFragment
 		err := json.Unmarshal(*raw, &frag)
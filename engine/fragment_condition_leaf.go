@@ -2,10 +2,13 @@ package engine
 
 import (
 	"errors"
+	"reflect"
 	"strings"
 )
 
 // LeafConditionFragment is a fragment containing a single terminal condition
+// GeoDistance uses Value as the center point and Value2 as the distance (5km, or meters if it is a number)
+// GeoBoundingBox uses Value as the top left point and Value2 as the bottom right point
 type LeafConditionFragment struct {
 	Operator ConditionToken `json:"operator"`
 	Field    string         `json:"term"`
@@ -66,6 +69,20 @@ func (frag *LeafConditionFragment) IsValid() (bool, error) {
 		if frag.Value == nil {
 			return false, errors.New("Missing Value")
 		}
+	case GeoDistance:
+		if frag.Value == nil {
+			return false, errors.New("Missing Value")
+		}
+		if frag.Value2 == nil {
+			return false, errors.New("Missing Value2")
+		}
+	case GeoBoundingBox:
+		if frag.Value == nil {
+			return false, errors.New("Missing Value")
+		}
+		if frag.Value2 == nil {
+			return false, errors.New("Missing Value2")
+		}
 	}
 	return true, nil
 }
@@ -104,6 +121,12 @@ var leafConditionMap = map[ConditionToken]func() *LeafConditionFragment{
 	Wildcard: func() *LeafConditionFragment {
 		return &LeafConditionFragment{Wildcard, "", nil, nil, ""}
 	},
+	GeoDistance: func() *LeafConditionFragment {
+		return &LeafConditionFragment{GeoDistance, "", nil, nil, ""}
+	},
+	GeoBoundingBox: func() *LeafConditionFragment {
+		return &LeafConditionFragment{GeoBoundingBox, "", nil, nil, ""}
+	},
 }
 
 // GetLeafConditionFragment search and return a leaf condition fragment by it's name
@@ -118,3 +141,32 @@ func GetLeafConditionFragment(name string) (*LeafConditionFragment, error) {
 	}
 	return nil, errors.New("no fragment with name " + name)
 }
+
+// IsEmptyValue checks if a value is empty regardless of its type, an optional condition on an empty value being ignored
+// Warning: This function is suitable for non-intensive usage due to reflection cost
+func IsEmptyValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.String:
+		return value.String() == ""
+	case reflect.Array, reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return true
+		}
+		return IsEmptyValue(value.Elem().Interface())
+	}
+
+	return false
+}
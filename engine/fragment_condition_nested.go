@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/modeler"
+)
+
+// NestedFragment is a fragment type applying its inner condition to a single nested object
+// Every field used in the inner condition must be prefixed by the nested path
+type NestedFragment struct {
+	Operator BooleanToken      `json:"operator"`
+	Path     string            `json:"path"`
+	Fragment ConditionFragment `json:"fragment"`
+}
+
+// IsValid checks if a nested fragment is valid and has no missing mandatory fields
+// * Operator must be Nested
+// * Path must not be empty
+// * Fragment must not be nil and must be valid
+// * Fragment fields must be prefixed by the nested path
+func (frag *NestedFragment) IsValid() (bool, error) {
+	if frag.Operator != Nested {
+		return false, errors.New("Missing Operator")
+	}
+	if frag.Path == "" {
+		return false, errors.New("Missing Path")
+	}
+	if frag.Fragment == nil {
+		return false, errors.New("Missing Fragment")
+	}
+	if ok, err := frag.Fragment.IsValid(); !ok {
+		return false, errors.New("Invalid Fragment:" + err.Error())
+	}
+	if fields := frag.outOfPathFields(); len(fields) > 0 {
+		return false, errors.New("field " + fields[0] + " is not in nested path " + frag.Path)
+	}
+	return true, nil
+}
+
+// IsValidForModel checks if the nested path is a nested object of the model
+// and if every field used in the inner condition exists in the model
+func (frag *NestedFragment) IsValidForModel(model modeler.Model) (bool, error) {
+	if ok, err := frag.IsValid(); !ok {
+		return false, err
+	}
+	if err := frag.validatePath(model); err != nil {
+		return false, err
+	}
+	for _, field := range conditionFields(frag.Fragment) {
+		if !modeler.FindFieldLeaf(field, "", model.Fields) {
+			return false, errors.New("field " + field + " does not exist in model " + model.Name)
+		}
+	}
+	return true, nil
+}
+
+// validatePath checks if the nested path is a nested object of the model
+func (frag *NestedFragment) validatePath(model modeler.Model) error {
+	object := modeler.FindFieldObject(frag.Path, "", model.Fields)
+	if object == nil {
+		return errors.New("path " + frag.Path + " is not an object of model " + model.Name)
+	}
+	if !object.KeepObjectSeparation {
+		return errors.New("path " + frag.Path + " is not a nested object of model " + model.Name)
+	}
+	return nil
+}
+
+// outOfPathFields returns the fields of the inner condition which are not prefixed by the nested path
+func (frag *NestedFragment) outOfPathFields() []string {
+	fields := make([]string, 0)
+	for _, field := range conditionFields(frag.Fragment) {
+		if !strings.HasPrefix(field, frag.Path+".") {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// conditionFields returns every field used in a condition tree (script conditions excluded)
+func conditionFields(condition ConditionFragment) []string {
+	fields := make([]string, 0)
+	switch c := condition.(type) {
+	case *BooleanFragment:
+		for _, subFrag := range c.Fragments {
+			fields = append(fields, conditionFields(subFrag)...)
+		}
+	case *NestedFragment:
+		fields = append(fields, conditionFields(c.Fragment)...)
+	case *LeafConditionFragment:
+		if c.Operator != Script && c.Field != "" {
+			fields = append(fields, c.Field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/modeler"
+)
+
+var nestedModel = modeler.Model{
+	Name: "parcel",
+	Fields: []modeler.Field{
+		&modeler.FieldLeaf{Name: "id", Ftype: modeler.String},
+		&modeler.FieldObject{Name: "events", Ftype: modeler.Object, KeepObjectSeparation: true, Fields: []modeler.Field{
+			&modeler.FieldLeaf{Name: "status", Ftype: modeler.String},
+			&modeler.FieldLeaf{Name: "date", Ftype: modeler.DateTime},
+		}},
+		&modeler.FieldObject{Name: "sender", Ftype: modeler.Object, KeepObjectSeparation: false, Fields: []modeler.Field{
+			&modeler.FieldLeaf{Name: "country", Ftype: modeler.String},
+		}},
+	},
+}
+
+func TestNestedFragmentUnmarshalJSON(t *testing.T) {
+	b := []byte(`{"name":"test","condition":{"operator":"and","fragments":[
+		{"operator":"nested","path":"events","fragment":{"operator":"and","fragments":[
+			{"operator":"for","term":"events.status","value":"delivered"},
+			{"operator":"from","term":"events.date","value":"begin"}
+		]}}
+	]}}`)
+	var f Fact
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+	boolFrag, ok := f.Condition.(*BooleanFragment)
+	if !ok || len(boolFrag.Fragments) != 1 {
+		t.Fatalf("invalid condition %+v", f.Condition)
+	}
+	nested, ok := boolFrag.Fragments[0].(*NestedFragment)
+	if !ok {
+		t.Fatalf("fragment is not a nested fragment %T", boolFrag.Fragments[0])
+	}
+	if nested.Operator != Nested || nested.Path != "events" {
+		t.Errorf("invalid nested fragment %+v", nested)
+	}
+	inner, ok := nested.Fragment.(*BooleanFragment)
+	if !ok || len(inner.Fragments) != 2 {
+		t.Errorf("invalid nested inner fragment %+v", nested.Fragment)
+	}
+	if ok, err := f.Condition.IsValid(); !ok {
+		t.Error(err)
+	}
+}
+
+func TestNestedFragmentIsValid(t *testing.T) {
+	cases := []struct {
+		frag     NestedFragment
+		expected bool
+		errMsg   string
+	}{
+		{NestedFragment{Operator: Nested, Path: "events", Fragment: &LeafConditionFragment{Operator: For, Field: "events.status", Value: "late"}}, true, ""},
+		{NestedFragment{Operator: 0, Path: "events", Fragment: &LeafConditionFragment{Operator: For, Field: "events.status", Value: "late"}}, false, "Missing Operator"},
+		{NestedFragment{Operator: Nested, Path: "", Fragment: &LeafConditionFragment{Operator: For, Field: "events.status", Value: "late"}}, false, "Missing Path"},
+		{NestedFragment{Operator: Nested, Path: "events"}, false, "Missing Fragment"},
+		{NestedFragment{Operator: Nested, Path: "events", Fragment: &LeafConditionFragment{Operator: For, Field: "status", Value: "late"}}, false, "field status is not in nested path events"},
+		{NestedFragment{Operator: Nested, Path: "events", Fragment: &LeafConditionFragment{Operator: For, Field: "events.status"}}, false, "Invalid Fragment:Missing Value"},
+	}
+
+	for _, c := range cases {
+		valid, err := c.frag.IsValid()
+		if valid != c.expected {
+			t.Errorf("expected %v, got %v", c.expected, valid)
+		}
+		if err != nil && err.Error() != c.errMsg {
+			t.Errorf("expected error %v, got %v", c.errMsg, err)
+		}
+	}
+}
+
+func TestNestedFragmentIsValidForModel(t *testing.T) {
+	cases := []struct {
+		frag     NestedFragment
+		expected bool
+		errMsg   string
+	}{
+		{NestedFragment{Operator: Nested, Path: "events", Fragment: &LeafConditionFragment{Operator: For, Field: "events.status", Value: "late"}}, true, ""},
+		{NestedFragment{Operator: Nested, Path: "events", Fragment: &LeafConditionFragment{Operator: For, Field: "events.unknown", Value: "late"}}, false, "field events.unknown does not exist in model parcel"},
+		{NestedFragment{Operator: Nested, Path: "sender", Fragment: &LeafConditionFragment{Operator: For, Field: "sender.country", Value: "FR"}}, false, "path sender is not a nested object of model parcel"},
+		{NestedFragment{Operator: Nested, Path: "parcels", Fragment: &LeafConditionFragment{Operator: For, Field: "parcels.status", Value: "late"}}, false, "path parcels is not an object of model parcel"},
+	}
+
+	for _, c := range cases {
+		valid, err := c.frag.IsValidForModel(nestedModel)
+		if valid != c.expected {
+			t.Errorf("expected %v, got %v", c.expected, valid)
+		}
+		if err != nil && err.Error() != c.errMsg {
+			t.Errorf("expected error %v, got %v", c.errMsg, err)
+		}
+	}
+}
@@ -2,20 +2,52 @@ package engine
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
 
 // DimensionFragment is a fragment type which contains a single dimension definition
 type DimensionFragment struct {
-	Name          string         `json:"name,omitempty"`
-	Operator      DimensionToken `json:"operator"`
-	Term          string         `json:"term"`
-	Size          int            `json:"size,omitempty"`
-	Interval      float64        `json:"interval,omitempty"`
-	DateInterval  string         `json:"dateinterval,omitempty"`
-	CalendarFixed bool           `json:"calendarfixed,omitempty"`
-	TimeZone      string         `json:"timezone,omitempty"`
+	Name           string           `json:"name,omitempty"`
+	Operator       DimensionToken   `json:"operator"`
+	Term           string           `json:"term"`
+	Size           int              `json:"size,omitempty"`
+	Interval       float64          `json:"interval,omitempty"`
+	DateInterval   string           `json:"dateinterval,omitempty"`
+	CalendarFixed  bool             `json:"calendarfixed,omitempty"`
+	TimeZone       string           `json:"timezone,omitempty"`
+	Ranges         []DimensionRange `json:"ranges,omitempty"`
+	Missing        string           `json:"missing,omitempty"`
+	MinDocCount    *int             `json:"mindoccount,omitempty"`
+	OrderBy        string           `json:"orderby,omitempty"`
+	OrderDirection string           `json:"orderdirection,omitempty"`
+	Precision      *int             `json:"precision,omitempty"`
+}
+
+// Default precisions of the geo grid dimensions
+const (
+	DefaultGeoHashPrecision = 5
+	DefaultGeoTilePrecision = 7
+)
+
+// GeoPrecision returns the precision of a geo grid dimension, or its default value if it is not set
+func (frag *DimensionFragment) GeoPrecision() int {
+	if frag.Precision != nil {
+		return *frag.Precision
+	}
+	if frag.Operator == GeoTileGrid {
+		return DefaultGeoTilePrecision
+	}
+	return DefaultGeoHashPrecision
+}
+
+// DimensionRange is a named bucket used by the Range and DateRange dimensions
+// From is included and To is excluded from the bucket
+type DimensionRange struct {
+	Key  string      `json:"key,omitempty"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
 }
 
 var calendarIntervals = map[string]bool{
@@ -34,6 +66,10 @@ var calendarIntervals = map[string]bool{
 // * Term must not be empty
 // * Size must not be lesser than 0
 // * Interval must not be lesser than 0
+// * MinDocCount must not be lesser than 0
+// * OrderDirection must be empty, "asc" or "desc"
+// * Ranges must not be empty with Range and DateRange operators
+// * Precision must be between 1 and 12 with GeoHashGrid, and between 0 and 29 with GeoTileGrid
 func (frag *DimensionFragment) IsValid() (bool, error) {
 	if frag.Operator == 0 {
 		return false, errors.New("missing Operator")
@@ -47,6 +83,12 @@ func (frag *DimensionFragment) IsValid() (bool, error) {
 	if frag.Interval < 0 {
 		return false, errors.New("interval is lower than 0")
 	}
+	if frag.MinDocCount != nil && *frag.MinDocCount < 0 {
+		return false, errors.New("mindoccount is lower than 0")
+	}
+	if frag.OrderDirection != "" && frag.OrderDirection != "asc" && frag.OrderDirection != "desc" {
+		return false, errors.New("invalid order direction")
+	}
 
 	// If the operator is a date histogram, check if the date interval is valid
 	if frag.Operator == DateHistogram && frag.DateInterval != "" { // DateInterval can be empty, since we have a default value
@@ -63,18 +105,83 @@ func (frag *DimensionFragment) IsValid() (bool, error) {
 		}
 	}
 
+	if frag.Operator == GeoHashGrid && frag.Precision != nil && (*frag.Precision < 1 || *frag.Precision > 12) {
+		return false, errors.New("geohash precision must be between 1 and 12")
+	}
+	if frag.Operator == GeoTileGrid && frag.Precision != nil && (*frag.Precision < 0 || *frag.Precision > 29) {
+		return false, errors.New("geotile precision must be between 0 and 29")
+	}
+
+	if frag.Operator == Range || frag.Operator == DateRange {
+		if len(frag.Ranges) == 0 {
+			return false, errors.New("missing Ranges")
+		}
+		for _, r := range frag.Ranges {
+			if r.From == nil && r.To == nil {
+				return false, errors.New("range must have at least a from or a to value")
+			}
+			for _, v := range []interface{}{r.From, r.To} {
+				if v == nil {
+					continue
+				}
+				if _, ok := v.(string); frag.Operator == DateRange && !ok {
+					return false, errors.New("date range values must be strings")
+				}
+				if frag.Operator == Range && !isNumber(v) {
+					return false, errors.New("range values must be numbers")
+				}
+			}
+		}
+	}
+
 	return true, nil
 }
 
+// AggregationName returns the name of the aggregation built from the dimension
+func (frag *DimensionFragment) AggregationName() string {
+	if frag.Name != "" {
+		return frag.Name
+	}
+	return fmt.Sprintf("%s_%s", frag.Operator.String(), frag.Term)
+}
+
+// calendarInterval returns the date histogram calendar interval (default to month)
+func (frag *DimensionFragment) calendarInterval() string {
+	if frag.DateInterval == "" {
+		return "month"
+	}
+	return frag.DateInterval
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int32, int64, float32, float64:
+		return true
+	}
+	return false
+}
+
 var dimensionMap = map[DimensionToken]func() *DimensionFragment{
 	By: func() *DimensionFragment {
-		return &DimensionFragment{"", By, "", 0, 0, "", false, ""}
+		return &DimensionFragment{"", By, "", 0, 0, "", false, "", nil, "", nil, "", "", nil}
 	},
 	Histogram: func() *DimensionFragment {
-		return &DimensionFragment{"", Histogram, "", 0, 0, "", false, ""}
+		return &DimensionFragment{"", Histogram, "", 0, 0, "", false, "", nil, "", nil, "", "", nil}
 	},
 	DateHistogram: func() *DimensionFragment {
-		return &DimensionFragment{"", DateHistogram, "", 0, 0, "", false, ""}
+		return &DimensionFragment{"", DateHistogram, "", 0, 0, "", false, "", nil, "", nil, "", "", nil}
+	},
+	Range: func() *DimensionFragment {
+		return &DimensionFragment{"", Range, "", 0, 0, "", false, "", nil, "", nil, "", "", nil}
+	},
+	DateRange: func() *DimensionFragment {
+		return &DimensionFragment{"", DateRange, "", 0, 0, "", false, "", nil, "", nil, "", "", nil}
+	},
+	GeoHashGrid: func() *DimensionFragment {
+		return &DimensionFragment{"", GeoHashGrid, "", 0, 0, "", false, "", nil, "", nil, "", "", nil}
+	},
+	GeoTileGrid: func() *DimensionFragment {
+		return &DimensionFragment{"", GeoTileGrid, "", 0, 0, "", false, "", nil, "", nil, "", "", nil}
 	},
 }
 
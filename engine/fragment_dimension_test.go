@@ -24,6 +24,8 @@ func TestGetDimensionFragmentInvalid(t *testing.T) {
 }
 
 func TestDimensionFragmentIsValid(t *testing.T) {
+	minDocCount := 0
+	invalidMinDocCount := -1
 	cases := []struct {
 		frag     DimensionFragment
 		expected bool
@@ -37,6 +39,15 @@ func TestDimensionFragmentIsValid(t *testing.T) {
 		{DimensionFragment{Operator: DateHistogram, Term: "term", Size: 1, Interval: 1, DateInterval: "invalid", CalendarFixed: true}, false, "invalid date interval"},
 		{DimensionFragment{Operator: DateHistogram, Term: "term", Size: 1, Interval: 1, DateInterval: "invalid", CalendarFixed: false}, false, "invalid date interval"},
 		{DimensionFragment{Operator: DateHistogram, Term: "term", Size: 1, Interval: 1, DateInterval: "second", CalendarFixed: false}, true, ""},
+		{DimensionFragment{Operator: By, Term: "term", MinDocCount: &minDocCount, OrderBy: "_key", OrderDirection: "asc", Missing: "N/A"}, true, ""},
+		{DimensionFragment{Operator: By, Term: "term", MinDocCount: &invalidMinDocCount}, false, "mindoccount is lower than 0"},
+		{DimensionFragment{Operator: By, Term: "term", OrderBy: "_count", OrderDirection: "up"}, false, "invalid order direction"},
+		{DimensionFragment{Operator: Range, Term: "term"}, false, "missing Ranges"},
+		{DimensionFragment{Operator: Range, Term: "term", Ranges: []DimensionRange{{Key: "empty"}}}, false, "range must have at least a from or a to value"},
+		{DimensionFragment{Operator: Range, Term: "term", Ranges: []DimensionRange{{Key: "0-2 days", To: 2.0}, {Key: "2-5 days", From: 2, To: 5}, {Key: ">5 days", From: 5.0}}}, true, ""},
+		{DimensionFragment{Operator: Range, Term: "term", Ranges: []DimensionRange{{From: "now-2d"}}}, false, "range values must be numbers"},
+		{DimensionFragment{Operator: DateRange, Term: "term", Ranges: []DimensionRange{{Key: "last 2 days", From: "now-2d/d"}, {Key: "older", To: "now-2d/d"}}}, true, ""},
+		{DimensionFragment{Operator: DateRange, Term: "term", Ranges: []DimensionRange{{From: 2.0}}}, false, "date range values must be strings"},
 	}
 
 	for _, c := range cases {
@@ -50,6 +61,26 @@ func TestDimensionFragmentIsValid(t *testing.T) {
 	}
 }
 
+func TestDimensionFragmentGeoPrecision(t *testing.T) {
+	zero := 0
+	tile := DimensionFragment{Operator: GeoTileGrid, Term: "location", Precision: &zero}
+	if ok, err := tile.IsValid(); !ok {
+		t.Error(err)
+	}
+	if precision := tile.GeoPrecision(); precision != 0 {
+		t.Errorf("geotile precision 0 should be kept, got %d", precision)
+	}
+
+	hash := DimensionFragment{Operator: GeoHashGrid, Term: "location", Precision: &zero}
+	if ok, _ := hash.IsValid(); ok {
+		t.Error("geohash precision 0 should be invalid")
+	}
+	hash.Precision = nil
+	if precision := hash.GeoPrecision(); precision != DefaultGeoHashPrecision {
+		t.Errorf("expected the default geohash precision, got %d", precision)
+	}
+}
+
 func TestGetDimensionFragmentByName(t *testing.T) {
 	cases := []struct {
 		name     string
@@ -59,6 +90,8 @@ func TestGetDimensionFragmentByName(t *testing.T) {
 		{"by", By, ""},
 		{"histogram", Histogram, ""},
 		{"datehistogram", DateHistogram, ""},
+		{"range", Range, ""},
+		{"daterange", DateRange, ""},
 		{"invalid", 0, "no token with name invalid"},
 	}
 
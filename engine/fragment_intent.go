@@ -2,20 +2,25 @@ package engine
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 )
 
 // IntentFragment is a fragment type which contains a single intent definition
 type IntentFragment struct {
-	Name     string      `json:"name,omitempty"`
-	Operator IntentToken `json:"operator"`
-	Term     string      `json:"term"`
-	Script   bool        `json:"script,omitempty"`
+	Name               string      `json:"name,omitempty"`
+	Operator           IntentToken `json:"operator"`
+	Term               string      `json:"term"`
+	Script             bool        `json:"script,omitempty"`
+	Percents           []float64   `json:"percents,omitempty"`
+	PrecisionThreshold int         `json:"precisionThreshold,omitempty"`
 }
 
 // IsValid checks if an intent fragment is valid and has no missing mandatory fields
 // * Operator must not be empty (or 0 value)
 // * Term must not be empty
+// * Percents must be between 0 and 100
+// * PrecisionThreshold must not be lesser than 0
 func (frag *IntentFragment) IsValid() (bool, error) {
 	if frag.Operator == 0 {
 		return false, errors.New("Missing Operator")
@@ -23,29 +28,60 @@ func (frag *IntentFragment) IsValid() (bool, error) {
 	if frag.Term == "" {
 		return false, errors.New("Missing Term")
 	}
+	for _, percent := range frag.Percents {
+		if percent < 0 || percent > 100 {
+			return false, errors.New("percent must be between 0 and 100")
+		}
+	}
+	if frag.PrecisionThreshold < 0 {
+		return false, errors.New("precisionThreshold is lower than 0")
+	}
 	return true, nil
 }
 
+// AggregationName returns the name of the aggregation built from the intent
+func (frag *IntentFragment) AggregationName() string {
+	if frag.Name != "" {
+		return frag.Name
+	}
+	return fmt.Sprintf("%s_%s", frag.Operator.String(), frag.Term)
+}
+
 var intentMap = map[IntentToken]func() *IntentFragment{
 	Count: func() *IntentFragment {
-		return &IntentFragment{"", Count, "", false}
+		return &IntentFragment{"", Count, "", false, nil, 0}
 	},
 	Sum: func() *IntentFragment {
-		return &IntentFragment{"", Sum, "", false}
+		return &IntentFragment{"", Sum, "", false, nil, 0}
 	},
 	Avg: func() *IntentFragment {
-		return &IntentFragment{"", Avg, "", false}
+		return &IntentFragment{"", Avg, "", false, nil, 0}
 	},
 	Min: func() *IntentFragment {
-		return &IntentFragment{"", Min, "", false}
+		return &IntentFragment{"", Min, "", false, nil, 0}
 	},
 	Max: func() *IntentFragment {
-		return &IntentFragment{"", Max, "", false}
+		return &IntentFragment{"", Max, "", false, nil, 0}
 	},
 	Select: func() *IntentFragment {
-		return &IntentFragment{"", Select, "", false}
+		return &IntentFragment{"", Select, "", false, nil, 0}
+	},
+	Delete: func() *IntentFragment { return &IntentFragment{"", Delete, "", false, nil, 0} },
+	Percentiles: func() *IntentFragment {
+		return &IntentFragment{"", Percentiles, "", false, nil, 0}
+	},
+	ExtendedStats: func() *IntentFragment {
+		return &IntentFragment{"", ExtendedStats, "", false, nil, 0}
+	},
+	ValueCount: func() *IntentFragment {
+		return &IntentFragment{"", ValueCount, "", false, nil, 0}
+	},
+	DistinctCount: func() *IntentFragment {
+		return &IntentFragment{"", DistinctCount, "", false, nil, 0}
+	},
+	Median: func() *IntentFragment {
+		return &IntentFragment{"", Median, "", false, nil, 0}
 	},
-	Delete: func() *IntentFragment { return &IntentFragment{"", Delete, "", false} },
 }
 
 // GetIntentFragment search and return an intent fragment by it's name
@@ -22,3 +22,29 @@ func TestGetIntentFragmentInvalid(t *testing.T) {
 		t.Error("Fragment not_a_fragment should not exists")
 	}
 }
+
+func TestIntentFragmentIsValid(t *testing.T) {
+	cases := []struct {
+		frag     IntentFragment
+		expected bool
+		errMsg   string
+	}{
+		{IntentFragment{Operator: Percentiles, Term: "term", Percents: []float64{50, 95, 99.9}}, true, ""},
+		{IntentFragment{Operator: Percentiles, Term: "term", Percents: []float64{101}}, false, "percent must be between 0 and 100"},
+		{IntentFragment{Operator: Percentiles, Term: "term", Percents: []float64{-1}}, false, "percent must be between 0 and 100"},
+		{IntentFragment{Operator: DistinctCount, Term: "term", PrecisionThreshold: 1000}, true, ""},
+		{IntentFragment{Operator: DistinctCount, Term: "term", PrecisionThreshold: -1}, false, "precisionThreshold is lower than 0"},
+		{IntentFragment{Operator: 0, Term: "term"}, false, "Missing Operator"},
+		{IntentFragment{Operator: Median, Term: ""}, false, "Missing Term"},
+	}
+
+	for _, c := range cases {
+		valid, err := c.frag.IsValid()
+		if valid != c.expected {
+			t.Errorf("expected %v, got %v", c.expected, valid)
+		}
+		if err != nil && err.Error() != c.errMsg {
+			t.Errorf("expected error %v, got %v", c.errMsg, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"errors"
+)
+
+// DocCountPath is the bucket path of the documents count of a bucket
+const DocCountPath = "_count"
+
+// PipelineFragment is a secondary intent, computed by elasticsearch from the other intents of each bucket
+// * BucketScript computes Script per bucket, with Variables mapping script params to intent names (or bucket paths)
+// * CumulativeSum, Derivative and MovingAvg (on a Window of buckets) are computed from Intent over a histogram dimension
+type PipelineFragment struct {
+	Name      string            `json:"name"`
+	Operator  PipelineToken     `json:"operator"`
+	Intent    string            `json:"intent,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+	Script    string            `json:"script,omitempty"`
+	Window    int               `json:"window,omitempty"`
+}
+
+// IsValid checks if a pipeline fragment is valid and has no missing mandatory fields
+// * Name must not be empty
+// * Operator must not be empty (or 0 value)
+// * BucketScript requires a Script and some Variables
+// * CumulativeSum, Derivative and MovingAvg require an Intent
+// * MovingAvg requires a Window greater than 0
+func (frag *PipelineFragment) IsValid() (bool, error) {
+	if frag.Name == "" {
+		return false, errors.New("Missing Name")
+	}
+	if frag.Operator == 0 {
+		return false, errors.New("Missing Operator")
+	}
+	switch frag.Operator {
+	case BucketScript:
+		if frag.Script == "" {
+			return false, errors.New("Missing Script")
+		}
+		if len(frag.Variables) == 0 {
+			return false, errors.New("Missing Variables")
+		}
+	case CumulativeSum, Derivative:
+		if frag.Intent == "" {
+			return false, errors.New("Missing Intent")
+		}
+	case MovingAvg:
+		if frag.Intent == "" {
+			return false, errors.New("Missing Intent")
+		}
+		if frag.Window <= 0 {
+			return false, errors.New("window must be greater than 0")
+		}
+	}
+	return true, nil
+}
+
+// references returns the intents names used by a pipeline fragment
+func (frag *PipelineFragment) references() []string {
+	if frag.Operator == BucketScript {
+		references := make([]string, 0, len(frag.Variables))
+		for _, path := range frag.Variables {
+			references = append(references, path)
+		}
+		return references
+	}
+	return []string{frag.Intent}
+}
+
+// isValidPipelines checks the pipelines of a fact
+// * Names must be unique and different from the primary intent name
+// * Referenced intents must be the primary intent, the documents count or a previous pipeline
+// * Every pipeline requires a dimension, and CumulativeSum, Derivative and MovingAvg require the first dimension to be a histogram
+func (f *Fact) isValidPipelines() (bool, error) {
+	if len(f.Pipelines) == 0 {
+		return true, nil
+	}
+	if len(f.Dimensions) == 0 {
+		return false, errors.New("pipelines require at least one dimension")
+	}
+
+	known := map[string]bool{DocCountPath: true}
+	if f.Intent != nil {
+		known[f.Intent.AggregationName()] = true
+	}
+	for _, pipeline := range f.Pipelines {
+		if ok, err := pipeline.IsValid(); !ok {
+			return false, err
+		}
+		if known[pipeline.Name] {
+			return false, errors.New("duplicated intent name " + pipeline.Name)
+		}
+		for _, reference := range pipeline.references() {
+			if !known[referenceIntent(reference)] {
+				return false, errors.New("unknown intent " + reference + " in pipeline " + pipeline.Name)
+			}
+		}
+		if pipeline.Operator != BucketScript {
+			if f.Composite {
+				return false, errors.New("pipeline " + pipeline.Operator.String() + " is not supported in composite mode")
+			}
+			if operator := f.Dimensions[0].Operator; operator != Histogram && operator != DateHistogram {
+				return false, errors.New("pipeline " + pipeline.Operator.String() + " requires a histogram as first dimension")
+			}
+		}
+		known[pipeline.Name] = true
+	}
+	return true, nil
+}
+
+// referenceIntent returns the intent name of a bucket path (percentiles[95.0] or stats.avg)
+func referenceIntent(path string) string {
+	for i, c := range path {
+		if c == '[' || c == '.' {
+			return path[:i]
+		}
+	}
+	return path
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPipelineFragmentIsValid(t *testing.T) {
+	cases := []struct {
+		frag     PipelineFragment
+		expected bool
+	}{
+		{PipelineFragment{Name: "ratio", Operator: BucketScript, Script: "params.late / params.total", Variables: map[string]string{"late": "late", "total": "_count"}}, true},
+		{PipelineFragment{Name: "ratio", Operator: BucketScript, Variables: map[string]string{"late": "late"}}, false},
+		{PipelineFragment{Name: "ratio", Operator: BucketScript, Script: "params.late"}, false},
+		{PipelineFragment{Name: "cumul", Operator: CumulativeSum, Intent: "late"}, true},
+		{PipelineFragment{Name: "cumul", Operator: Derivative}, false},
+		{PipelineFragment{Name: "avg", Operator: MovingAvg, Intent: "late", Window: 7}, true},
+		{PipelineFragment{Name: "avg", Operator: MovingAvg, Intent: "late"}, false},
+		{PipelineFragment{Operator: CumulativeSum, Intent: "late"}, false},
+		{PipelineFragment{Name: "cumul", Intent: "late"}, false},
+	}
+	for i, c := range cases {
+		if ok, err := c.frag.IsValid(); ok != c.expected {
+			t.Errorf("case %d: expected %t, got %t (%v)", i, c.expected, ok, err)
+		}
+	}
+}
+
+func TestFactIsValidPipelines(t *testing.T) {
+	b := []byte(`{"name":"late_ratio","model":"parcel",
+		"intent":{"name":"late","operator":"sum","term":"is_late"},
+		"secondaryIntents":[
+			{"name":"ratio","operator":"bucketscript","script":"params.late / params.total","variables":{"late":"late","total":"_count"}},
+			{"name":"ratio_trend","operator":"movingavg","intent":"ratio","window":7}
+		],
+		"dimensions":[{"operator":"datehistogram","term":"date","dateinterval":"day"}]}`)
+	var f Fact
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := f.IsValid(); !ok {
+		t.Error(err)
+	}
+
+	f.Pipelines[1].Intent = "unknown"
+	if ok, _ := f.IsValid(); ok {
+		t.Error("fact with an unknown pipeline intent should be invalid")
+	}
+	f.Pipelines[1].Intent = "ratio"
+
+	f.Dimensions[0].Operator = By
+	if ok, _ := f.IsValid(); ok {
+		t.Error("moving average without histogram dimension should be invalid")
+	}
+
+	f.Dimensions = nil
+	if ok, _ := f.IsValid(); ok {
+		t.Error("pipelines without dimension should be invalid")
+	}
+}
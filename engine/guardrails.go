@@ -0,0 +1,484 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDimensionSize is the number of buckets of a By or geo grid dimension without size (as in the elasticsearch translation)
+const DefaultDimensionSize = 100
+
+// DefaultHistogramInterval is the interval of a Histogram dimension without interval (as in the elasticsearch translation)
+const DefaultHistogramInterval = 100
+
+// Names of the guardrail limits, used in the guardrail errors
+const (
+	GuardrailMaxBuckets           = "maxBuckets"
+	GuardrailMaxDimensionSize     = "maxDimensionSize"
+	GuardrailMinHistogramInterval = "minHistogramInterval"
+	GuardrailMinDateInterval      = "minDateInterval"
+	GuardrailMaxTimeSpan          = "maxTimeSpan"
+	GuardrailUnbounded            = "unbounded"
+)
+
+var (
+	_guardrailsMu sync.RWMutex
+	_guardrails   *Guardrails
+)
+
+// GlobalGuardrails returns the global guardrails applied by Fact.IsValid and Fact.ContextualizeGuardrails (nil if disabled)
+func GlobalGuardrails() *Guardrails {
+	_guardrailsMu.RLock()
+	g := _guardrails
+	_guardrailsMu.RUnlock()
+	return g
+}
+
+// ReplaceGlobalGuardrails replace the global guardrails with the provided ones (nil disables them)
+func ReplaceGlobalGuardrails(guardrails *Guardrails) func() {
+	_guardrailsMu.Lock()
+	prev := _guardrails
+	_guardrails = guardrails
+	_guardrailsMu.Unlock()
+	return func() { ReplaceGlobalGuardrails(prev) }
+}
+
+// Guardrails defines the limits a fact must respect before being executed (a zero value disables a limit)
+// * MaxBuckets is the worst case number of buckets of the whole dimensions tree
+// * MaxDimensionSize is the maximum size of a By or geo grid dimension
+// * MinHistogramInterval and MinDateInterval are the finest resolutions of the Histogram and DateHistogram dimensions
+// * MaxTimeSpan is the maximum time span of the date range conditions
+// * RejectUnbounded rejects the histograms which bucket count cannot be bounded by the fact condition
+// * DownScale reduces the sizes and resolutions of the dimensions to the limits instead of rejecting the fact
+type Guardrails struct {
+	MaxBuckets           int64         `json:"maxBuckets,omitempty"`
+	MaxDimensionSize     int           `json:"maxDimensionSize,omitempty"`
+	MinHistogramInterval float64       `json:"minHistogramInterval,omitempty"`
+	MinDateInterval      time.Duration `json:"minDateInterval,omitempty"`
+	MaxTimeSpan          time.Duration `json:"maxTimeSpan,omitempty"`
+	RejectUnbounded      bool          `json:"rejectUnbounded,omitempty"`
+	DownScale            bool          `json:"downScale,omitempty"`
+}
+
+// GuardrailError is a guardrail limit exceeded by a fact, located by its JSON path in the fact definition
+// Durations are expressed in seconds in Threshold and Value
+type GuardrailError struct {
+	Path      string  `json:"path"`
+	Limit     string  `json:"limit"`
+	Threshold float64 `json:"threshold"`
+	Value     float64 `json:"value"`
+	Message   string  `json:"message"`
+}
+
+func (e GuardrailError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// GuardrailErrors is the list of every guardrail limit exceeded by a fact
+type GuardrailErrors []GuardrailError
+
+func (e GuardrailErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// FactCost is the worst case cost estimation of a fact
+// * Buckets is the product of the bounded dimensions buckets (doubled for a comparison)
+// * Dimensions contains the worst case buckets of each dimension (0 if unbounded)
+// * Unbounded contains the paths of the dimensions which bucket count cannot be bounded by the fact condition
+// * TimeSpans contains the time span of every field restricted by date range conditions
+type FactCost struct {
+	Buckets    int64                    `json:"buckets"`
+	Dimensions []int64                  `json:"dimensions,omitempty"`
+	Unbounded  []string                 `json:"unbounded,omitempty"`
+	TimeSpans  map[string]time.Duration `json:"timeSpans,omitempty"`
+}
+
+// EstimateCost estimates the worst case cost of a contextualized fact
+// The bounds of the histograms and the time spans are computed from the range conditions combined with And or If
+func (f *Fact) EstimateCost(t time.Time) FactCost {
+	return f.estimateCost(collectBounds(f.Condition, t))
+}
+
+func (f *Fact) estimateCost(bounds map[string]*fieldBounds) FactCost {
+	cost := FactCost{Buckets: 1, Dimensions: make([]int64, 0, len(f.Dimensions)), TimeSpans: make(map[string]time.Duration)}
+	for field, b := range bounds {
+		if b.date && b.hasLower && b.hasUpper {
+			cost.TimeSpans[field] = time.Duration((b.upper - b.lower) * float64(time.Second))
+		}
+	}
+	for i, dimension := range f.Dimensions {
+		buckets, ok := dimension.worstCaseBuckets(bounds[dimension.Term])
+		if !ok {
+			cost.Dimensions = append(cost.Dimensions, 0)
+			cost.Unbounded = append(cost.Unbounded, fmt.Sprintf("dimensions[%d]", i))
+			continue
+		}
+		cost.Dimensions = append(cost.Dimensions, buckets)
+		cost.Buckets = saturatedProduct(cost.Buckets, buckets)
+	}
+	if f.Comparison != nil {
+		cost.Buckets = saturatedProduct(cost.Buckets, 2)
+	}
+	return cost
+}
+
+// Validate checks the limits which do not depend on the execution time (sizes, resolutions and bounded buckets)
+// Limits which can be down-scaled are not checked if DownScale is enabled
+func (g *Guardrails) Validate(f *Fact) error {
+	if g.DownScale {
+		return nil
+	}
+	errs := g.checkDimensions(f)
+	errs = append(errs, g.checkBuckets(f.estimateCost(nil))...)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Apply checks every limit on a contextualized fact and returns its cost estimation
+// If DownScale is enabled, the dimensions are first down-scaled to respect the limits (the fact is modified)
+func (g *Guardrails) Apply(f *Fact, t time.Time) (FactCost, error) {
+	bounds := collectBounds(f.Condition, t)
+	if g.DownScale {
+		g.downScale(f, bounds)
+	}
+	cost := f.estimateCost(bounds)
+
+	errs := g.checkDimensions(f)
+	errs = append(errs, g.checkBuckets(cost)...)
+	if g.RejectUnbounded {
+		for _, path := range cost.Unbounded {
+			errs = append(errs, GuardrailError{Path: path, Limit: GuardrailUnbounded, Message: "bucket count cannot be bounded by the fact condition"})
+		}
+	}
+	if g.MaxTimeSpan > 0 {
+		fields := make([]string, 0, len(cost.TimeSpans))
+		for field := range cost.TimeSpans {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			if span := cost.TimeSpans[field]; span > g.MaxTimeSpan {
+				errs = append(errs, GuardrailError{
+					Path: "condition", Limit: GuardrailMaxTimeSpan, Threshold: g.MaxTimeSpan.Seconds(), Value: span.Seconds(),
+					Message: fmt.Sprintf("time span %s of field %s exceeds %s %s", span, field, GuardrailMaxTimeSpan, g.MaxTimeSpan),
+				})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return cost, errs
+	}
+	return cost, nil
+}
+
+// ContextualizeGuardrails applies the global guardrails to a contextualized fact (see ReplaceGlobalGuardrails)
+// It must be called after ContextualizeCondition, and only estimates the fact cost if no global guardrails are set
+func (f *Fact) ContextualizeGuardrails(t time.Time) (FactCost, error) {
+	g := GlobalGuardrails()
+	if g == nil {
+		return f.EstimateCost(t), nil
+	}
+	return g.Apply(f, t)
+}
+
+func (g *Guardrails) checkDimensions(f *Fact) GuardrailErrors {
+	errs := make(GuardrailErrors, 0)
+	for i, dimension := range f.Dimensions {
+		switch dimension.Operator {
+		case By, GeoHashGrid, GeoTileGrid:
+			if size := dimension.size(); g.MaxDimensionSize > 0 && size > g.MaxDimensionSize {
+				errs = append(errs, GuardrailError{
+					Path: fmt.Sprintf("dimensions[%d].size", i), Limit: GuardrailMaxDimensionSize, Threshold: float64(g.MaxDimensionSize), Value: float64(size),
+					Message: fmt.Sprintf("size %d exceeds %s %d", size, GuardrailMaxDimensionSize, g.MaxDimensionSize),
+				})
+			}
+		case Histogram:
+			if interval := dimension.interval(); g.MinHistogramInterval > 0 && interval < g.MinHistogramInterval {
+				errs = append(errs, GuardrailError{
+					Path: fmt.Sprintf("dimensions[%d].interval", i), Limit: GuardrailMinHistogramInterval, Threshold: g.MinHistogramInterval, Value: interval,
+					Message: fmt.Sprintf("interval %v is below %s %v", interval, GuardrailMinHistogramInterval, g.MinHistogramInterval),
+				})
+			}
+		case DateHistogram:
+			interval, err := dimension.dateIntervalDuration()
+			if err == nil && g.MinDateInterval > 0 && interval < g.MinDateInterval {
+				errs = append(errs, GuardrailError{
+					Path: fmt.Sprintf("dimensions[%d].dateinterval", i), Limit: GuardrailMinDateInterval, Threshold: g.MinDateInterval.Seconds(), Value: interval.Seconds(),
+					Message: fmt.Sprintf("date interval %s is below %s %s", interval, GuardrailMinDateInterval, g.MinDateInterval),
+				})
+			}
+		}
+	}
+	return errs
+}
+
+func (g *Guardrails) checkBuckets(cost FactCost) GuardrailErrors {
+	if g.MaxBuckets <= 0 || cost.Buckets <= g.MaxBuckets {
+		return nil
+	}
+	return GuardrailErrors{{
+		Path: "dimensions", Limit: GuardrailMaxBuckets, Threshold: float64(g.MaxBuckets), Value: float64(cost.Buckets),
+		Message: fmt.Sprintf("worst case bucket count %d exceeds %s %d", cost.Buckets, GuardrailMaxBuckets, g.MaxBuckets),
+	}}
+}
+
+// downScale reduces the dimensions sizes and resolutions to the limits
+// While the worst case bucket count exceeds the limit, the largest date histogram is coarsened,
+// or the sizes of the By and geo grid dimensions are reduced proportionally
+func (g *Guardrails) downScale(f *Fact, bounds map[string]*fieldBounds) {
+	for _, dimension := range f.Dimensions {
+		switch dimension.Operator {
+		case By, GeoHashGrid, GeoTileGrid:
+			if g.MaxDimensionSize > 0 && dimension.size() > g.MaxDimensionSize {
+				dimension.Size = g.MaxDimensionSize
+			}
+		case Histogram:
+			if g.MinHistogramInterval > 0 && dimension.interval() < g.MinHistogramInterval {
+				dimension.Interval = g.MinHistogramInterval
+			}
+		case DateHistogram:
+			for g.MinDateInterval > 0 {
+				interval, err := dimension.dateIntervalDuration()
+				if err != nil || interval >= g.MinDateInterval || !dimension.coarsenDateInterval(g.MinDateInterval) {
+					break
+				}
+			}
+		}
+	}
+
+	if g.MaxBuckets <= 0 {
+		return
+	}
+	for i := 0; i < 64; i++ {
+		cost := f.estimateCost(bounds)
+		if cost.Buckets <= g.MaxBuckets {
+			return
+		}
+
+		// The date histogram is coarsened only if it is the dimension with the most buckets
+		var largest *DimensionFragment
+		var largestBuckets int64
+		for j, dimension := range f.Dimensions {
+			if cost.Dimensions[j] > largestBuckets {
+				largest, largestBuckets = dimension, cost.Dimensions[j]
+			}
+		}
+		if largest != nil && largest.Operator == DateHistogram {
+			interval, _ := largest.dateIntervalDuration()
+			if largest.coarsenDateInterval(2 * interval) {
+				continue
+			}
+		}
+
+		scalable := make([]*DimensionFragment, 0)
+		for _, dimension := range f.Dimensions {
+			if (dimension.Operator == By || dimension.Operator == GeoHashGrid || dimension.Operator == GeoTileGrid) && dimension.size() > 1 {
+				scalable = append(scalable, dimension)
+			}
+		}
+		if len(scalable) == 0 {
+			return
+		}
+		factor := math.Pow(float64(g.MaxBuckets)/float64(cost.Buckets), 1/float64(len(scalable)))
+		for _, dimension := range scalable {
+			size := int(math.Floor(float64(dimension.size()) * factor))
+			if size >= dimension.size() {
+				size = dimension.size() - 1
+			}
+			dimension.Size = int(math.Max(1, float64(size)))
+		}
+	}
+}
+
+// worstCaseBuckets returns the maximum number of buckets of a dimension, and false if it cannot be bounded
+func (frag *DimensionFragment) worstCaseBuckets(bounds *fieldBounds) (int64, bool) {
+	switch frag.Operator {
+	case By, GeoHashGrid, GeoTileGrid:
+		return int64(frag.size()), true
+	case Range, DateRange:
+		return int64(len(frag.Ranges)), true
+	case Histogram:
+		if bounds == nil || bounds.date || !bounds.hasLower || !bounds.hasUpper {
+			return 0, false
+		}
+		return int64(math.Floor((bounds.upper-bounds.lower)/frag.interval())) + 1, true
+	case DateHistogram:
+		interval, err := frag.dateIntervalDuration()
+		if err != nil || bounds == nil || !bounds.date || !bounds.hasLower || !bounds.hasUpper {
+			return 0, false
+		}
+		return int64(math.Floor((bounds.upper-bounds.lower)/interval.Seconds())) + 1, true
+	}
+	return 0, false
+}
+
+func (frag *DimensionFragment) size() int {
+	if frag.Size == 0 {
+		return DefaultDimensionSize
+	}
+	return frag.Size
+}
+
+func (frag *DimensionFragment) interval() float64 {
+	if frag.Interval == 0 {
+		return DefaultHistogramInterval
+	}
+	return frag.Interval
+}
+
+// calendarIntervalsOrder lists the calendar intervals with their shortest duration (worst case)
+var calendarIntervalsOrder = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"second", time.Second},
+	{"minute", time.Minute},
+	{"hour", time.Hour},
+	{"day", 24 * time.Hour},
+	{"week", 7 * 24 * time.Hour},
+	{"month", 28 * 24 * time.Hour},
+	{"quarter", 89 * 24 * time.Hour},
+	{"year", 365 * 24 * time.Hour},
+}
+
+// dateIntervalDuration returns the shortest duration of a date histogram interval
+func (frag *DimensionFragment) dateIntervalDuration() (time.Duration, error) {
+	if frag.CalendarFixed {
+		if frag.DateInterval == "" {
+			return 24 * time.Hour, nil
+		}
+		return time.ParseDuration(frag.DateInterval)
+	}
+	interval := frag.calendarInterval()
+	for _, calendar := range calendarIntervalsOrder {
+		if calendar.name == interval {
+			return calendar.duration, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid date interval %s", interval)
+}
+
+// coarsenDateInterval sets the date histogram interval to the finest interval at least as long as min
+// It returns false if the interval cannot be coarsened (already a year)
+func (frag *DimensionFragment) coarsenDateInterval(min time.Duration) bool {
+	if frag.CalendarFixed {
+		frag.DateInterval = min.String()
+		return true
+	}
+	current, err := frag.dateIntervalDuration()
+	if err != nil {
+		return false
+	}
+	for _, calendar := range calendarIntervalsOrder {
+		if calendar.duration > current && calendar.duration >= min {
+			frag.DateInterval = calendar.name
+			return true
+		}
+	}
+	if last := calendarIntervalsOrder[len(calendarIntervalsOrder)-1]; current < last.duration {
+		frag.DateInterval = last.name
+		return true
+	}
+	return false
+}
+
+// fieldBounds is the intersection of the range conditions on a field (dates are in seconds since epoch)
+type fieldBounds struct {
+	date     bool
+	hasLower bool
+	hasUpper bool
+	lower    float64
+	upper    float64
+}
+
+// collectBounds collects the bounds of the From, To and Between conditions combined with And or If
+// Bounds which cannot be resolved (expressions, nested or disjunctive conditions) are ignored
+func collectBounds(condition ConditionFragment, t time.Time) map[string]*fieldBounds {
+	bounds := make(map[string]*fieldBounds)
+	var walk func(condition ConditionFragment)
+	walk = func(condition ConditionFragment) {
+		switch c := condition.(type) {
+		case *BooleanFragment:
+			if c.Operator == And || c.Operator == If {
+				for _, fragment := range c.Fragments {
+					walk(fragment)
+				}
+			}
+		case *LeafConditionFragment:
+			var lower, upper interface{}
+			switch c.Operator {
+			case From:
+				lower = c.Value
+			case To:
+				upper = c.Value
+			case Between:
+				lower, upper = c.Value, c.Value2
+			default:
+				return
+			}
+			if lower != nil {
+				if v, date, ok := boundValue(lower, t, c.TimeZone); ok {
+					b := fieldBoundsOf(bounds, c.Field, date)
+					if !b.hasLower || v > b.lower {
+						b.lower, b.hasLower = v, true
+					}
+				}
+			}
+			if upper != nil {
+				if v, date, ok := boundValue(upper, t, c.TimeZone); ok {
+					b := fieldBoundsOf(bounds, c.Field, date)
+					if !b.hasUpper || v < b.upper {
+						b.upper, b.hasUpper = v, true
+					}
+				}
+			}
+		}
+	}
+	walk(condition)
+	return bounds
+}
+
+func fieldBoundsOf(bounds map[string]*fieldBounds, field string, date bool) *fieldBounds {
+	b, ok := bounds[field]
+	if !ok {
+		b = &fieldBounds{date: date}
+		bounds[field] = b
+	}
+	return b
+}
+
+// boundValue converts a range condition value to a number, or to seconds since epoch for a date
+func boundValue(value interface{}, t time.Time, timeZone string) (float64, bool, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return float64(v.UnixNano()) / float64(time.Second), true, true
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, false, true
+		}
+		if d, err := ParseDateMath(v, t, timeZone); err == nil {
+			return float64(d.UnixNano()) / float64(time.Second), true, true
+		}
+		return 0, false, false
+	}
+	f, ok := toFloat64(value)
+	return f, false, ok
+}
+
+func saturatedProduct(a int64, b int64) int64 {
+	if a != 0 && b > math.MaxInt64/a {
+		return math.MaxInt64
+	}
+	return a * b
+}
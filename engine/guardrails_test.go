@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEstimateCost(t *testing.T) {
+	f := Fact{
+		Name:   "test",
+		Model:  "parcel",
+		Intent: &IntentFragment{Operator: Count, Term: "id"},
+		Dimensions: []*DimensionFragment{
+			{Operator: By, Term: "carrier", Size: 10000},
+			{Operator: By, Term: "country", Size: 10000},
+			{Operator: DateHistogram, Term: "date", DateInterval: "hour"},
+			{Operator: Histogram, Term: "weight", Interval: 0.5},
+		},
+		Condition: &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: Between, Field: "date", Value: "now-7d/d", Value2: "now/d"},
+			&LeafConditionFragment{Operator: To, Field: "weight", Value: 10.0},
+		}},
+	}
+	cost := f.EstimateCost(time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC))
+
+	expected := FactCost{
+		Buckets:    10000 * 10000 * 169,
+		Dimensions: []int64{10000, 10000, 169, 0},
+		Unbounded:  []string{"dimensions[3]"},
+		TimeSpans:  map[string]time.Duration{"date": 7 * 24 * time.Hour},
+	}
+	if !reflect.DeepEqual(cost, expected) {
+		t.Errorf("invalid cost\nexpected: %+v\nactual:   %+v", expected, cost)
+	}
+
+	f.Condition.(*BooleanFragment).Fragments = append(f.Condition.(*BooleanFragment).Fragments,
+		&LeafConditionFragment{Operator: From, Field: "weight", Value: 2.0})
+	f.Comparison = &ComparisonFragment{Field: "date", Shift: "1w"}
+	cost = f.EstimateCost(time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC))
+	if cost.Dimensions[3] != 17 || cost.Buckets != 10000*10000*169*17*2 || len(cost.Unbounded) != 0 {
+		t.Errorf("invalid cost %+v", cost)
+	}
+}
+
+func TestGuardrailsApply(t *testing.T) {
+	g := &Guardrails{MaxBuckets: 100000, MaxDimensionSize: 1000, MinHistogramInterval: 1, MinDateInterval: time.Hour, MaxTimeSpan: 31 * 24 * time.Hour, RejectUnbounded: true}
+	ti := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	f := Fact{
+		Name:   "test",
+		Model:  "parcel",
+		Intent: &IntentFragment{Operator: Count, Term: "id"},
+		Dimensions: []*DimensionFragment{
+			{Operator: By, Term: "carrier", Size: 10000},
+			{Operator: By, Term: "country", Size: 10000},
+			{Operator: DateHistogram, Term: "date", DateInterval: "hour"},
+			{Operator: Histogram, Term: "weight", Interval: 0.5},
+		},
+		Condition: &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: Between, Field: "date", Value: "now-7d/d", Value2: "now/d"},
+			&LeafConditionFragment{Operator: To, Field: "weight", Value: 10.0},
+		}},
+	}
+	_, err := g.Apply(&f, ti)
+	var errs GuardrailErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected guardrail errors, got %v", err)
+	}
+	limits := make([]string, 0)
+	for _, e := range errs {
+		limits = append(limits, e.Path+" "+e.Limit)
+	}
+	expected := []string{
+		"dimensions[0].size maxDimensionSize",
+		"dimensions[1].size maxDimensionSize",
+		"dimensions[3].interval minHistogramInterval",
+		"dimensions maxBuckets",
+		"dimensions[3] unbounded",
+	}
+	if !reflect.DeepEqual(limits, expected) {
+		t.Errorf("invalid errors\nexpected: %v\nactual:   %v", expected, limits)
+	}
+
+	f = Fact{
+		Intent:    &IntentFragment{Operator: Count, Term: "id"},
+		Condition: &LeafConditionFragment{Operator: Between, Field: "date", Value: "now-1y/d", Value2: "now/d"},
+	}
+	g = &Guardrails{MaxTimeSpan: 31 * 24 * time.Hour}
+	if _, err := g.Apply(&f, ti); err == nil || err.Error() != "condition: time span 8784h0m0s of field date exceeds maxTimeSpan 744h0m0s" {
+		t.Errorf("expected a time span error, got %v", err)
+	}
+}
+
+func TestGuardrailsDownScale(t *testing.T) {
+	g := &Guardrails{MaxBuckets: 10000, MaxDimensionSize: 1000, MinHistogramInterval: 1, MinDateInterval: 2 * time.Hour, DownScale: true}
+	ti := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	f := Fact{
+		Name:   "test",
+		Model:  "parcel",
+		Intent: &IntentFragment{Operator: Count, Term: "id"},
+		Dimensions: []*DimensionFragment{
+			{Operator: By, Term: "carrier", Size: 10000},
+			{Operator: By, Term: "country", Size: 10000},
+			{Operator: DateHistogram, Term: "date", DateInterval: "hour"},
+			{Operator: Histogram, Term: "weight", Interval: 0.5},
+		},
+		Condition: &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: Between, Field: "date", Value: "now-7d/d", Value2: "now/d"},
+			&LeafConditionFragment{Operator: To, Field: "weight", Value: 10.0},
+		}},
+	}
+	f.Condition.(*BooleanFragment).Fragments = append(f.Condition.(*BooleanFragment).Fragments,
+		&LeafConditionFragment{Operator: From, Field: "weight", Value: 0.0})
+	cost, err := g.Apply(&f, ti)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost.Buckets > g.MaxBuckets {
+		t.Errorf("buckets %d exceed the limit", cost.Buckets)
+	}
+	if f.Dimensions[2].DateInterval != "day" || f.Dimensions[3].Interval != 1 {
+		t.Errorf("invalid resolutions %s %v", f.Dimensions[2].DateInterval, f.Dimensions[3].Interval)
+	}
+	if f.Dimensions[0].Size >= 1000 || f.Dimensions[0].Size != f.Dimensions[1].Size {
+		t.Errorf("invalid sizes %d %d", f.Dimensions[0].Size, f.Dimensions[1].Size)
+	}
+}
+
+func TestGuardrailsIsValid(t *testing.T) {
+	f := Fact{
+		Name:       "test",
+		Model:      "parcel",
+		Intent:     &IntentFragment{Operator: Count, Term: "id"},
+		Dimensions: []*DimensionFragment{{Operator: By, Term: "carrier", Size: 10000}},
+	}
+	if ok, err := f.IsValid(); !ok {
+		t.Fatal(err)
+	}
+
+	defer ReplaceGlobalGuardrails(&Guardrails{MaxDimensionSize: 1000})()
+	if ok, err := f.IsValid(); ok {
+		t.Error("fact should exceed the guardrails")
+	} else if _, isGuardrail := err.(GuardrailErrors); !isGuardrail {
+		t.Errorf("expected guardrail errors, got %v", err)
+	}
+
+	ReplaceGlobalGuardrails(&Guardrails{MaxDimensionSize: 1000, DownScale: true})
+	if ok, err := f.IsValid(); !ok {
+		t.Error(err)
+	}
+	if _, err := f.ContextualizeGuardrails(time.Now()); err != nil {
+		t.Error(err)
+	}
+	if f.Dimensions[0].Size != 1000 {
+		t.Errorf("dimension should be down-scaled, got size %d", f.Dimensions[0].Size)
+	}
+}
@@ -0,0 +1,88 @@
+package engine
+
+// DocCountAgg is the name of the aggregation holding the documents count of an item
+const DocCountAgg = "doc_count"
+
+// Item is a node of a fact result tree
+// The root item holds the global aggregations and every sub-items are grouped by dimension name
+// From and To are only set on Range and DateRange dimension items
+type Item struct {
+	Key         string              `json:"key,omitempty"`
+	KeyAsString string              `json:"keyAsString,omitempty"`
+	From        interface{}         `json:"from,omitempty"`
+	To          interface{}         `json:"to,omitempty"`
+	Aggs        map[string]*ItemAgg `json:"aggs,omitempty"`
+	Buckets     map[string][]*Item  `json:"buckets,omitempty"`
+}
+
+// ItemAgg is a single aggregation value of an item
+type ItemAgg struct {
+	Value interface{} `json:"value"`
+}
+
+// GetValue returns the value of an item aggregation and if it exists
+func (item *Item) GetValue(name string) (interface{}, bool) {
+	if item.Aggs == nil {
+		return nil, false
+	}
+	agg, ok := item.Aggs[name]
+	if !ok || agg == nil {
+		return nil, false
+	}
+	return agg.Value, true
+}
+
+// SetValue sets the value of an item aggregation
+func (item *Item) SetValue(name string, value interface{}) {
+	if item.Aggs == nil {
+		item.Aggs = make(map[string]*ItemAgg)
+	}
+	item.Aggs[name] = &ItemAgg{Value: value}
+}
+
+// walkItems calls fn on an item and every of its sub-items
+func walkItems(item *Item, fn func(item *Item)) {
+	fn(item)
+	for _, items := range item.Buckets {
+		for _, subItem := range items {
+			walkItems(subItem, fn)
+		}
+	}
+}
+
+// walkDimension replaces every sub-items list of a dimension in a result tree by the result of fn
+func walkDimension(item *Item, dimension string, fn func(items []*Item) ([]*Item, error)) error {
+	for name, items := range item.Buckets {
+		if name == dimension {
+			newItems, err := fn(items)
+			if err != nil {
+				return err
+			}
+			item.Buckets[name] = newItems
+			items = newItems
+		}
+		for _, subItem := range items {
+			if err := walkDimension(subItem, dimension, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
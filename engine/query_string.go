@@ -0,0 +1,620 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query strings support a KQL / Lucene subset:
+//   - field:value, field:"quoted value", field:(a OR b) (for), field:te?t* (wildcard), field:/regexp/ (regexp)
+//   - field:* and _exists_:field (exists)
+//   - field >= value (from), field < value (to), field:[a TO b} (between), field:[a TO *] and field:[* TO b}
+//   - path:{ condition } (nested, with fields relative to the path)
+//   - AND, OR, NOT (case insensitive) and parentheses, NOT having the highest precedence and OR the lowest
+//
+// Ranges are always inclusive of their lower bound and exclusive of their upper bound, as the range conditions
+
+type queryTokenKind int
+
+const (
+	tokenEOF queryTokenKind = iota
+	tokenWord
+	tokenQuoted
+	tokenRegexp
+	tokenColon
+	tokenCompare
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenLBrace
+	tokenRBrace
+)
+
+type queryToken struct {
+	kind     queryTokenKind
+	value    string
+	pattern  string // wildcard pattern, with escaped wildcards
+	wildcard bool
+	pos      int
+}
+
+func (t queryToken) String() string {
+	if t.kind == tokenEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.value)
+}
+
+func (t queryToken) isKeyword(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.value, keyword)
+}
+
+const queryStringDelimiters = `():<>={}[]"`
+
+func tokenizeQueryString(query string) ([]queryToken, error) {
+	tokens := make([]queryToken, 0)
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, value: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, value: ")", pos: i})
+			i++
+		case r == '[':
+			tokens = append(tokens, queryToken{kind: tokenLBracket, value: "[", pos: i})
+			i++
+		case r == ']':
+			tokens = append(tokens, queryToken{kind: tokenRBracket, value: "]", pos: i})
+			i++
+		case r == '{':
+			tokens = append(tokens, queryToken{kind: tokenLBrace, value: "{", pos: i})
+			i++
+		case r == '}':
+			tokens = append(tokens, queryToken{kind: tokenRBrace, value: "}", pos: i})
+			i++
+		case r == ':':
+			tokens = append(tokens, queryToken{kind: tokenColon, value: ":", pos: i})
+			i++
+		case r == '<' || r == '>' || r == '=':
+			start := i
+			i++
+			if i < len(runes) && runes[i] == '=' && r != '=' {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: tokenCompare, value: string(runes[start:i]), pos: start})
+		case r == '"' || r == '/':
+			start := i
+			var value strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					if r == '/' && runes[i] != '/' {
+						value.WriteRune('\\')
+					}
+				}
+				value.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated %c at position %d", r, start)
+			}
+			i++
+			kind := tokenQuoted
+			if r == '/' {
+				kind = tokenRegexp
+			}
+			tokens = append(tokens, queryToken{kind: kind, value: value.String(), pos: start})
+		default:
+			start := i
+			var value, pattern strings.Builder
+			wildcard := false
+			for ; i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(queryStringDelimiters, runes[i]); i++ {
+				if runes[i] == '\\' {
+					if i+1 >= len(runes) {
+						return nil, fmt.Errorf("unterminated escape at position %d", i)
+					}
+					i++
+					// escaped wildcards are kept escaped in the pattern, as in the elasticsearch wildcard syntax
+					if runes[i] == '*' || runes[i] == '?' || runes[i] == '\\' {
+						pattern.WriteRune('\\')
+					}
+					value.WriteRune(runes[i])
+					pattern.WriteRune(runes[i])
+					continue
+				}
+				if runes[i] == '*' || runes[i] == '?' {
+					wildcard = true
+				}
+				value.WriteRune(runes[i])
+				pattern.WriteRune(runes[i])
+			}
+			tokens = append(tokens, queryToken{kind: tokenWord, value: value.String(), pattern: pattern.String(), wildcard: wildcard, pos: start})
+		}
+	}
+	return append(tokens, queryToken{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+type queryStringParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+// ParseQueryString parses a KQL / Lucene query string to a condition fragment
+func ParseQueryString(query string) (ConditionFragment, error) {
+	tokens, err := tokenizeQueryString(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryStringParser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, errors.New("empty query")
+	}
+	fragment, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != tokenEOF {
+		return nil, p.unexpected(token)
+	}
+	return fragment, nil
+}
+
+func (p *queryStringParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryStringParser) next() queryToken {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+func (p *queryStringParser) expect(kind queryTokenKind, value string) error {
+	if token := p.next(); token.kind != kind {
+		return fmt.Errorf("expected %q at position %d, got %s", value, token.pos, token)
+	}
+	return nil
+}
+
+func (p *queryStringParser) unexpected(token queryToken) error {
+	if token.kind == tokenEOF {
+		return errors.New("unexpected end of query")
+	}
+	return fmt.Errorf("unexpected %s at position %d", token, token.pos)
+}
+
+func (p *queryStringParser) parseOr(path string) (ConditionFragment, error) {
+	return p.parseBinary(path, "OR", Or, p.parseAnd)
+}
+
+func (p *queryStringParser) parseAnd(path string) (ConditionFragment, error) {
+	return p.parseBinary(path, "AND", And, p.parseNot)
+}
+
+func (p *queryStringParser) parseBinary(path string, keyword string, operator BooleanToken, operand func(string) (ConditionFragment, error)) (ConditionFragment, error) {
+	first, err := operand(path)
+	if err != nil {
+		return nil, err
+	}
+	fragments := []ConditionFragment{first}
+	for p.peek().isKeyword(keyword) {
+		p.next()
+		fragment, err := operand(path)
+		if err != nil {
+			return nil, err
+		}
+		fragments = append(fragments, fragment)
+	}
+	if len(fragments) == 1 {
+		return first, nil
+	}
+	return &BooleanFragment{Operator: operator, Fragments: fragments}, nil
+}
+
+func (p *queryStringParser) parseNot(path string) (ConditionFragment, error) {
+	if !p.peek().isKeyword("NOT") {
+		return p.parsePrimary(path)
+	}
+	p.next()
+	fragment, err := p.parseNot(path)
+	if err != nil {
+		return nil, err
+	}
+	// NOT (a OR b) is a single not fragment, which matches none of its fragments
+	if or, ok := fragment.(*BooleanFragment); ok && or.Operator == Or && or.MinimumShouldMatch == nil {
+		return &BooleanFragment{Operator: Not, Fragments: or.Fragments}, nil
+	}
+	return &BooleanFragment{Operator: Not, Fragments: []ConditionFragment{fragment}}, nil
+}
+
+func (p *queryStringParser) parsePrimary(path string) (ConditionFragment, error) {
+	token := p.next()
+	switch {
+	case token.kind == tokenLParen:
+		fragment, err := p.parseOr(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		return fragment, nil
+
+	case token.kind == tokenWord && !token.wildcard && !token.isKeyword("AND") && !token.isKeyword("OR"):
+		field := token.value
+		if path != "" {
+			field = path + "." + field
+		}
+		switch operator := p.next(); operator.kind {
+		case tokenColon:
+			if token.value == "_exists_" {
+				name := p.next()
+				if name.kind != tokenWord || name.wildcard {
+					return nil, p.unexpected(name)
+				}
+				if path != "" {
+					return &LeafConditionFragment{Operator: Exists, Field: path + "." + name.value}, nil
+				}
+				return &LeafConditionFragment{Operator: Exists, Field: name.value}, nil
+			}
+			return p.parseFieldValue(field)
+		case tokenCompare:
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			switch operator.value {
+			case ">=":
+				return &LeafConditionFragment{Operator: From, Field: field, Value: value}, nil
+			case "<":
+				return &LeafConditionFragment{Operator: To, Field: field, Value: value}, nil
+			}
+			return nil, fmt.Errorf("unsupported comparison %s at position %d, only >= and < are supported", operator.value, operator.pos)
+		default:
+			return nil, p.unexpected(operator)
+		}
+	}
+	return nil, p.unexpected(token)
+}
+
+func (p *queryStringParser) parseFieldValue(field string) (ConditionFragment, error) {
+	token := p.peek()
+	switch token.kind {
+	case tokenLParen:
+		p.next()
+		values := make([]interface{}, 0)
+		for {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if !p.peek().isKeyword("OR") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(tokenRParen, ")"); err != nil {
+			return nil, err
+		}
+		if len(values) == 1 {
+			return &LeafConditionFragment{Operator: For, Field: field, Value: values[0]}, nil
+		}
+		return &LeafConditionFragment{Operator: For, Field: field, Value: values}, nil
+
+	case tokenLBracket:
+		p.next()
+		return p.parseRange(field)
+
+	case tokenLBrace:
+		p.next()
+		fragment, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRBrace, "}"); err != nil {
+			return nil, err
+		}
+		return &NestedFragment{Operator: Nested, Path: field, Fragment: fragment}, nil
+
+	case tokenRegexp:
+		p.next()
+		return &LeafConditionFragment{Operator: Regexp, Field: field, Value: token.value}, nil
+
+	case tokenWord:
+		if token.value == "*" {
+			p.next()
+			return &LeafConditionFragment{Operator: Exists, Field: field}, nil
+		}
+		if token.wildcard {
+			p.next()
+			return &LeafConditionFragment{Operator: Wildcard, Field: field, Value: token.pattern}, nil
+		}
+	}
+
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &LeafConditionFragment{Operator: For, Field: field, Value: value}, nil
+}
+
+// parseRange parses a Lucene range after its opening bracket, the lower bound being inclusive and the upper one exclusive
+func (p *queryStringParser) parseRange(field string) (ConditionFragment, error) {
+	var from, to interface{}
+	var err error
+	if token := p.peek(); token.kind == tokenWord && token.value == "*" {
+		p.next()
+	} else if from, err = p.parseValue(); err != nil {
+		return nil, err
+	}
+	if token := p.next(); !token.isKeyword("TO") {
+		return nil, fmt.Errorf("expected \"TO\" at position %d, got %s", token.pos, token)
+	}
+	if token := p.peek(); token.kind == tokenWord && token.value == "*" {
+		p.next()
+	} else if to, err = p.parseValue(); err != nil {
+		return nil, err
+	}
+
+	closing := p.next()
+	switch {
+	case closing.kind == tokenRBrace:
+	case closing.kind == tokenRBracket && to == nil:
+	case closing.kind == tokenRBracket:
+		return nil, fmt.Errorf("unsupported inclusive upper bound at position %d, use } instead", closing.pos)
+	default:
+		return nil, p.unexpected(closing)
+	}
+
+	switch {
+	case from != nil && to != nil:
+		return &LeafConditionFragment{Operator: Between, Field: field, Value: from, Value2: to}, nil
+	case from != nil:
+		return &LeafConditionFragment{Operator: From, Field: field, Value: from}, nil
+	case to != nil:
+		return &LeafConditionFragment{Operator: To, Field: field, Value: to}, nil
+	}
+	return &LeafConditionFragment{Operator: Exists, Field: field}, nil
+}
+
+// parseValue parses a single value, unquoted numbers and booleans being converted as in the JSON format
+func (p *queryStringParser) parseValue() (interface{}, error) {
+	token := p.next()
+	switch token.kind {
+	case tokenQuoted:
+		return token.value, nil
+	case tokenWord:
+		if token.wildcard || token.isKeyword("AND") || token.isKeyword("OR") || token.isKeyword("NOT") || token.isKeyword("TO") {
+			return nil, p.unexpected(token)
+		}
+		switch token.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		if number, err := strconv.ParseFloat(token.value, 64); err == nil {
+			return number, nil
+		}
+		return token.value, nil
+	}
+	return nil, p.unexpected(token)
+}
+
+// RenderQueryString renders a condition fragment to a KQL / Lucene query string which can be parsed with ParseQueryString
+func RenderQueryString(fragment ConditionFragment) (string, error) {
+	return renderQueryString(fragment, "", false)
+}
+
+func renderQueryString(fragment ConditionFragment, path string, nested bool) (string, error) {
+	switch f := fragment.(type) {
+	case *BooleanFragment:
+		if f.Operator == If {
+			return "", errors.New("operator if cannot be rendered as a query string")
+		}
+		if f.MinimumShouldMatch != nil {
+			return "", errors.New("minimumShouldMatch cannot be rendered as a query string")
+		}
+		if len(f.Fragments) == 0 {
+			return "", errors.New("missing fragments")
+		}
+		parts := make([]string, 0, len(f.Fragments))
+		for _, subFrag := range f.Fragments {
+			part, err := renderQueryString(subFrag, path, true)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		switch f.Operator {
+		case And:
+			return wrapQueryString(strings.Join(parts, " AND "), nested && len(parts) > 1), nil
+		case Or:
+			return wrapQueryString(strings.Join(parts, " OR "), nested && len(parts) > 1), nil
+		case Not:
+			if len(parts) == 1 {
+				return "NOT " + parts[0], nil
+			}
+			return "NOT (" + strings.Join(parts, " OR ") + ")", nil
+		}
+		return "", errors.New("operator " + f.Operator.String() + " cannot be rendered as a query string")
+
+	case *NestedFragment:
+		field, err := relativeQueryField(f.Path, path)
+		if err != nil {
+			return "", err
+		}
+		inner, err := renderQueryString(f.Fragment, f.Path, false)
+		if err != nil {
+			return "", err
+		}
+		return field + ":{ " + inner + " }", nil
+
+	case *LeafConditionFragment:
+		if f.TimeZone != "" {
+			return "", errors.New("timezone cannot be rendered as a query string")
+		}
+		field, err := relativeQueryField(f.Field, path)
+		if err != nil {
+			return "", err
+		}
+		switch f.Operator {
+		case Exists:
+			return field + ":*", nil
+		case For:
+			if values, ok := f.Value.([]interface{}); ok {
+				if len(values) == 0 {
+					return "", errors.New("empty values cannot be rendered as a query string")
+				}
+				parts := make([]string, 0, len(values))
+				for _, value := range values {
+					part, err := renderQueryValue(value)
+					if err != nil {
+						return "", err
+					}
+					parts = append(parts, part)
+				}
+				return field + ":(" + strings.Join(parts, " OR ") + ")", nil
+			}
+			value, err := renderQueryValue(f.Value)
+			if err != nil {
+				return "", err
+			}
+			return field + ":" + value, nil
+		case From, To:
+			value, err := renderQueryValue(f.Value)
+			if err != nil {
+				return "", err
+			}
+			if f.Operator == From {
+				return field + " >= " + value, nil
+			}
+			return field + " < " + value, nil
+		case Between:
+			from, err := renderQueryValue(f.Value)
+			if err != nil {
+				return "", err
+			}
+			to, err := renderQueryValue(f.Value2)
+			if err != nil {
+				return "", err
+			}
+			return field + ":[" + from + " TO " + to + "}", nil
+		case Wildcard:
+			value, ok := f.Value.(string)
+			if !ok || value == "" {
+				return "", fmt.Errorf("invalid wildcard value %v", f.Value)
+			}
+			return field + ":" + renderQueryWildcard(value), nil
+		case Regexp:
+			value, ok := f.Value.(string)
+			if !ok {
+				return "", fmt.Errorf("invalid regexp value %v", f.Value)
+			}
+			return field + ":/" + strings.ReplaceAll(value, "/", `\/`) + "/", nil
+		}
+		return "", errors.New("operator " + f.Operator.String() + " cannot be rendered as a query string")
+	}
+	return "", fmt.Errorf("unsupported condition fragment %T", fragment)
+}
+
+func wrapQueryString(query string, wrap bool) string {
+	if wrap {
+		return "(" + query + ")"
+	}
+	return query
+}
+
+// relativeQueryField returns a field relative to the path of its nested fragment
+func relativeQueryField(field string, path string) (string, error) {
+	if field == "" {
+		return "", errors.New("missing field")
+	}
+	if path != "" {
+		if !strings.HasPrefix(field, path+".") {
+			return "", errors.New("field " + field + " is not in nested path " + path)
+		}
+		field = strings.TrimPrefix(field, path+".")
+	}
+	if !isBareQueryWord(field) {
+		return "", errors.New("field " + field + " cannot be rendered as a query string")
+	}
+	return field, nil
+}
+
+func renderQueryValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		if isBareQueryWord(v) {
+			if _, err := strconv.ParseFloat(v, 64); err != nil && v != "true" && v != "false" {
+				return v, nil
+			}
+		}
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	}
+	return "", fmt.Errorf("value %v cannot be rendered as a query string", value)
+}
+
+// renderQueryWildcard escapes the special characters of a wildcard value, except its wildcards
+func renderQueryWildcard(value string) string {
+	var builder strings.Builder
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes):
+			builder.WriteRune('\\')
+			builder.WriteRune(runes[i+1])
+			i++
+		case unicode.IsSpace(r) || r == '\\' || r == '/' || strings.ContainsRune(queryStringDelimiters, r):
+			builder.WriteRune('\\')
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// isBareQueryWord checks if a string can be rendered without quotes
+func isBareQueryWord(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, keyword := range []string{"AND", "OR", "NOT", "TO"} {
+		if strings.EqualFold(value, keyword) {
+			return false
+		}
+	}
+	if strings.HasPrefix(value, "/") {
+		return false
+	}
+	for _, r := range value {
+		if unicode.IsSpace(r) || r == '*' || r == '?' || r == '\\' || strings.ContainsRune(queryStringDelimiters, r) {
+			return false
+		}
+	}
+	return true
+}
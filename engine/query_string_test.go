@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseQueryString(t *testing.T) {
+	queries := map[string]ConditionFragment{
+		`status:delivered`:         &LeafConditionFragment{Operator: For, Field: "status", Value: "delivered"},
+		`status:"in transit"`:      &LeafConditionFragment{Operator: For, Field: "status", Value: "in transit"},
+		`weight:12.5`:              &LeafConditionFragment{Operator: For, Field: "weight", Value: 12.5},
+		`active:true`:              &LeafConditionFragment{Operator: For, Field: "active", Value: true},
+		`status:(a OR "b c" OR 3)`: &LeafConditionFragment{Operator: For, Field: "status", Value: []interface{}{"a", "b c", 3.0}},
+		`code:ab?d*`:               &LeafConditionFragment{Operator: Wildcard, Field: "code", Value: "ab?d*"},
+		`code:ab\*d*`:              &LeafConditionFragment{Operator: Wildcard, Field: "code", Value: `ab\*d*`},
+		`code:/ab.*\/c/`:           &LeafConditionFragment{Operator: Regexp, Field: "code", Value: `ab.*/c`},
+		`code:*`:                   &LeafConditionFragment{Operator: Exists, Field: "code"},
+		`_exists_:code`:            &LeafConditionFragment{Operator: Exists, Field: "code"},
+		`weight >= 3`:              &LeafConditionFragment{Operator: From, Field: "weight", Value: 3.0},
+		`date < "now-1d/d"`:        &LeafConditionFragment{Operator: To, Field: "date", Value: "now-1d/d"},
+		`weight:[1 TO 3}`:          &LeafConditionFragment{Operator: Between, Field: "weight", Value: 1.0, Value2: 3.0},
+		`weight:[1 TO *]`:          &LeafConditionFragment{Operator: From, Field: "weight", Value: 1.0},
+		`weight:[* TO 3}`:          &LeafConditionFragment{Operator: To, Field: "weight", Value: 3.0},
+		`a:1 or b:2 and not c:3`: &BooleanFragment{Operator: Or, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: For, Field: "a", Value: 1.0},
+			&BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+				&LeafConditionFragment{Operator: For, Field: "b", Value: 2.0},
+				&BooleanFragment{Operator: Not, Fragments: []ConditionFragment{&LeafConditionFragment{Operator: For, Field: "c", Value: 3.0}}},
+			}},
+		}},
+		`NOT (a:1 OR b:2)`: &BooleanFragment{Operator: Not, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: For, Field: "a", Value: 1.0},
+			&LeafConditionFragment{Operator: For, Field: "b", Value: 2.0},
+		}},
+		`items:{ id:1 AND qty >= 2 }`: &NestedFragment{Operator: Nested, Path: "items", Fragment: &BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: For, Field: "items.id", Value: 1.0},
+			&LeafConditionFragment{Operator: From, Field: "items.qty", Value: 2.0},
+		}}},
+	}
+	for query, expected := range queries {
+		fragment, err := ParseQueryString(query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+			continue
+		}
+		if !reflect.DeepEqual(fragment, expected) {
+			t.Errorf("%s: invalid fragment\nexpected: %+v\nactual:   %+v", query, expected, fragment)
+		}
+	}
+}
+
+func TestParseQueryStringErrors(t *testing.T) {
+	queries := []string{
+		``,
+		`status`,
+		`status:`,
+		`a:1 b:2`,
+		`(a:1`,
+		`a:"b`,
+		`weight > 3`,
+		`weight:[1 TO 3]`,
+		`a:1 AND`,
+		`items:{ id:1`,
+		`a:*\`,
+	}
+	for _, query := range queries {
+		if _, err := ParseQueryString(query); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestRenderQueryStringRoundTrip(t *testing.T) {
+	definitions := []string{
+		`{"operator":"for","term":"status","value":"delivered"}`,
+		`{"operator":"for","term":"status","value":"in \"transit\""}`,
+		`{"operator":"for","term":"code","value":"12"}`,
+		`{"operator":"for","term":"status","value":["a","b c",3]}`,
+		`{"operator":"wildcard","term":"code","value":"ab c\\*d*"}`,
+		`{"operator":"wildcard","term":"code","value":"a*\\\\"}`,
+		`{"operator":"for","term":"code","value":"a\\"}`,
+		`{"operator":"regexp","term":"code","value":"a/b.*"}`,
+		`{"operator":"exists","term":"code"}`,
+		`{"operator":"between","term":"date","value":"2024-01-01T00:00:00","value2":"now/d"}`,
+		`{"operator":"and","fragments":[` +
+			`{"operator":"or","fragments":[{"operator":"for","term":"a","value":1},{"operator":"to","term":"b","value":2.5}]},` +
+			`{"operator":"not","fragments":[{"operator":"for","term":"c","value":true},{"operator":"from","term":"d","value":0}]},` +
+			`{"operator":"nested","path":"items","fragment":{"operator":"not","fragments":[{"operator":"exists","term":"items.id"}]}}` +
+			`]}`,
+	}
+	for _, definition := range definitions {
+		fragment, err := UnmarshalConditionFragment([]byte(definition))
+		if err != nil {
+			t.Fatal(err)
+		}
+		query, err := RenderQueryString(fragment)
+		if err != nil {
+			t.Errorf("%s: %v", definition, err)
+			continue
+		}
+		parsed, err := ParseQueryString(query)
+		if err != nil {
+			t.Errorf("%s: %v", query, err)
+			continue
+		}
+		b, err := json.Marshal(parsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != definition {
+			t.Errorf("invalid round trip of %s\nquery:  %s\nresult: %s", definition, query, b)
+		}
+	}
+}
+
+func TestRenderQueryString(t *testing.T) {
+	fragment := &BooleanFragment{Operator: Or, Fragments: []ConditionFragment{
+		&BooleanFragment{Operator: And, Fragments: []ConditionFragment{
+			&LeafConditionFragment{Operator: For, Field: "a", Value: "x y"},
+			&LeafConditionFragment{Operator: Between, Field: "b", Value: 1, Value2: 2},
+		}},
+		&LeafConditionFragment{Operator: Wildcard, Field: "c", Value: "x*"},
+	}}
+	query, err := RenderQueryString(fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `(a:"x y" AND b:[1 TO 2}) OR c:x*`; query != expected {
+		t.Errorf("invalid query\nexpected: %s\nactual:   %s", expected, query)
+	}
+
+	unsupported := []ConditionFragment{
+		&BooleanFragment{Operator: If, Expression: "true", Fragments: []ConditionFragment{&LeafConditionFragment{Operator: Exists, Field: "a"}}},
+		&BooleanFragment{Operator: Or, MinimumShouldMatch: 2, Fragments: []ConditionFragment{&LeafConditionFragment{Operator: Exists, Field: "a"}}},
+		&LeafConditionFragment{Operator: OptionalFor, Field: "a", Value: "b"},
+		&LeafConditionFragment{Operator: From, Field: "a", Value: "now", TimeZone: "Europe/Paris"},
+		&NestedFragment{Operator: Nested, Path: "items", Fragment: &LeafConditionFragment{Operator: Exists, Field: "other.id"}},
+	}
+	for _, fragment := range unsupported {
+		if _, err := RenderQueryString(fragment); err == nil {
+			t.Errorf("%+v: expected an error", fragment)
+		}
+	}
+}
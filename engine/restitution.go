@@ -0,0 +1,459 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/expression"
+	"github.com/myrteametrics/myrtea-sdk/v5/utils"
+)
+
+const defaultOthersKey = "others"
+
+// Restitution is a post-processing step applied on a fact result tree
+// * Rename replaces the keys of a dimension items using Labels
+// * Ratio computes Numerator / Denominator in a new aggregation Name on every item
+// * FillGaps adds the missing items of a date histogram dimension (extended to From and To if set), with the intent Value
+// * TopN keeps the Size first items of a dimension ordered by Intent, the other ones are merged in an Others item
+// * Unit multiplies an Intent by Factor, rounds it to Precision decimals and formats it with Unit in a new aggregation Name
+type Restitution struct {
+	Operator    RestitutionToken  `json:"operator"`
+	Dimension   string            `json:"dimension,omitempty"`
+	Intent      string            `json:"intent,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Numerator   string            `json:"numerator,omitempty"`
+	Denominator string            `json:"denominator,omitempty"`
+	From        string            `json:"from,omitempty"`
+	To          string            `json:"to,omitempty"`
+	Value       interface{}       `json:"value,omitempty"`
+	Size        int               `json:"size,omitempty"`
+	Others      string            `json:"others,omitempty"`
+	Unit        string            `json:"unit,omitempty"`
+	Factor      float64           `json:"factor,omitempty"`
+	Precision   int               `json:"precision,omitempty"`
+}
+
+// IsValid checks if a restitution step is valid and has no missing mandatory fields
+// * Operator must not be empty (or 0 value)
+// * Rename requires a Dimension and some Labels
+// * Ratio requires a Name, a Numerator and a Denominator
+// * FillGaps requires a Dimension
+// * TopN requires a Dimension and a Size greater than 0
+// * Precision must not be lesser than 0
+func (r *Restitution) IsValid() (bool, error) {
+	switch r.Operator {
+	case 0:
+		return false, errors.New("missing Operator")
+	case Rename:
+		if r.Dimension == "" {
+			return false, errors.New("missing Dimension")
+		}
+		if len(r.Labels) == 0 {
+			return false, errors.New("missing Labels")
+		}
+	case Ratio:
+		if r.Name == "" {
+			return false, errors.New("missing Name")
+		}
+		if r.Numerator == "" {
+			return false, errors.New("missing Numerator")
+		}
+		if r.Denominator == "" {
+			return false, errors.New("missing Denominator")
+		}
+	case FillGaps:
+		if r.Dimension == "" {
+			return false, errors.New("missing Dimension")
+		}
+	case TopN:
+		if r.Dimension == "" {
+			return false, errors.New("missing Dimension")
+		}
+		if r.Size <= 0 {
+			return false, errors.New("size must be greater than 0")
+		}
+	case Unit:
+		if r.Precision < 0 {
+			return false, errors.New("precision is lower than 0")
+		}
+	}
+	return true, nil
+}
+
+// Restitute applies every restitution step of the fact, in order, on a fact result tree
+// t is used to resolve the date keywords of the FillGaps bounds
+func (f *Fact) Restitute(item *Item, t time.Time) error {
+	if item == nil {
+		return errors.New("no result item")
+	}
+	for i, r := range f.Restitution {
+		if ok, err := r.IsValid(); !ok {
+			return fmt.Errorf("invalid restitution %d: %s", i, err.Error())
+		}
+		var err error
+		switch r.Operator {
+		case Rename:
+			err = r.rename(item)
+		case Ratio:
+			r.ratio(item)
+		case FillGaps:
+			err = r.fillGaps(f, item, t)
+		case TopN:
+			err = r.topN(f, item)
+		case Unit:
+			r.unit(f, item)
+		}
+		if err != nil {
+			return fmt.Errorf("restitution %d (%s) failed: %s", i, r.Operator.String(), err.Error())
+		}
+	}
+	return nil
+}
+
+func (r *Restitution) rename(root *Item) error {
+	return walkDimension(root, r.Dimension, func(items []*Item) ([]*Item, error) {
+		for _, item := range items {
+			label, ok := r.Labels[item.Key]
+			if !ok && item.KeyAsString != "" {
+				label, ok = r.Labels[item.KeyAsString]
+			}
+			if !ok {
+				continue
+			}
+			item.Key = label
+			if item.KeyAsString != "" {
+				item.KeyAsString = label
+			}
+		}
+		return items, nil
+	})
+}
+
+func (r *Restitution) ratio(root *Item) {
+	walkItems(root, func(item *Item) {
+		numValue, numFound := item.GetValue(r.Numerator)
+		denValue, denFound := item.GetValue(r.Denominator)
+		if !numFound && !denFound {
+			return
+		}
+		num, okNum := toFloat64(numValue)
+		den, okDen := toFloat64(denValue)
+		if !okNum || !okDen || den == 0 {
+			item.SetValue(r.Name, nil)
+			return
+		}
+		item.SetValue(r.Name, num/den)
+	})
+}
+
+func (r *Restitution) fillGaps(f *Fact, root *Item, t time.Time) error {
+	dimension := f.getDimension(r.Dimension)
+	if dimension == nil {
+		return errors.New("dimension " + r.Dimension + " not found")
+	}
+	if dimension.Operator != DateHistogram {
+		return errors.New("dimension " + r.Dimension + " is not a date histogram")
+	}
+	location := loadLocation(dimension.TimeZone)
+
+	from, err := resolveBound(r.From, t, location)
+	if err != nil {
+		return err
+	}
+	to, err := resolveBound(r.To, t, location)
+	if err != nil {
+		return err
+	}
+
+	intentName := ""
+	if f.Intent != nil {
+		intentName = f.Intent.AggregationName()
+	}
+
+	return walkDimension(root, r.Dimension, func(items []*Item) ([]*Item, error) {
+		existing := make(map[int64]*Item)
+		var start, end time.Time
+		for _, item := range items {
+			millis, err := strconv.ParseFloat(item.Key, 64)
+			if err != nil {
+				return nil, errors.New("invalid date histogram key " + item.Key)
+			}
+			key := time.UnixMilli(int64(millis)).In(location)
+			existing[key.UnixMilli()] = item
+			if start.IsZero() || key.Before(start) {
+				start = key
+			}
+			if end.IsZero() || key.After(end) {
+				end = key
+			}
+		}
+		if from != nil {
+			if bound := truncateDate(*from, dimension); start.IsZero() || bound.Before(start) {
+				start = bound
+			}
+		}
+		if to != nil {
+			if bound := to.Add(-time.Millisecond); end.IsZero() || bound.After(end) {
+				end = bound
+			}
+		}
+		if start.IsZero() || end.IsZero() {
+			return items, nil
+		}
+
+		filled := make([]*Item, 0)
+		for current := truncateDate(start, dimension); !current.After(end); current = nextDate(current, dimension) {
+			if item, ok := existing[current.UnixMilli()]; ok {
+				filled = append(filled, item)
+				continue
+			}
+			item := &Item{
+				Key:         strconv.FormatInt(current.UnixMilli(), 10),
+				KeyAsString: current.Format("2006-01-02T15:04:05.000Z07:00"),
+			}
+			item.SetValue(DocCountAgg, int64(0))
+			if intentName != "" {
+				item.SetValue(intentName, r.Value)
+			}
+			filled = append(filled, item)
+		}
+		return filled, nil
+	})
+}
+
+func (r *Restitution) topN(f *Fact, root *Item) error {
+	if f.getDimension(r.Dimension) == nil {
+		return errors.New("dimension " + r.Dimension + " not found")
+	}
+	intentName := r.Intent
+	if intentName == "" && f.Intent != nil {
+		intentName = f.Intent.AggregationName()
+	}
+	othersKey := r.Others
+	if othersKey == "" {
+		othersKey = defaultOthersKey
+	}
+
+	return walkDimension(root, r.Dimension, func(items []*Item) ([]*Item, error) {
+		if len(items) <= r.Size {
+			return items, nil
+		}
+		sorted := make([]*Item, len(items))
+		copy(sorted, items)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			vi, _ := sorted[i].GetValue(intentName)
+			vj, _ := sorted[j].GetValue(intentName)
+			fi, oki := toFloat64(vi)
+			fj, okj := toFloat64(vj)
+			if !okj {
+				return oki
+			}
+			return oki && fi > fj
+		})
+
+		others := &Item{Key: othersKey}
+		for _, item := range sorted[r.Size:] {
+			for name, agg := range item.Aggs {
+				if agg == nil {
+					continue
+				}
+				mergeOthers(others, name, agg.Value, f.mergeOperator(name))
+			}
+		}
+		return append(sorted[:r.Size], others), nil
+	})
+}
+
+// mergeOthers merges a value in the "others" item, only additive, min and max aggregations can be merged
+func mergeOthers(others *Item, name string, value interface{}, operator IntentToken) {
+	v, ok := toFloat64(value)
+	if !ok {
+		return
+	}
+	current, exists := others.GetValue(name)
+	c, okCurrent := toFloat64(current)
+	switch operator {
+	case Sum, ValueCount:
+		others.SetValue(name, c+v)
+	case Min:
+		if !exists || !okCurrent || v < c {
+			others.SetValue(name, v)
+		}
+	case Max:
+		if !exists || !okCurrent || v > c {
+			others.SetValue(name, v)
+		}
+	default:
+		if !exists {
+			others.SetValue(name, nil)
+		}
+	}
+}
+
+func (r *Restitution) unit(f *Fact, root *Item) {
+	intentName := r.Intent
+	if intentName == "" && f.Intent != nil {
+		intentName = f.Intent.AggregationName()
+	}
+	name := r.Name
+	if name == "" {
+		name = intentName + "_formatted"
+	}
+	factor := r.Factor
+	if factor == 0 {
+		factor = 1
+	}
+	pow := math.Pow(10, float64(r.Precision))
+
+	walkItems(root, func(item *Item) {
+		value, found := item.GetValue(intentName)
+		if !found {
+			return
+		}
+		v, ok := toFloat64(value)
+		if !ok {
+			item.SetValue(name, nil)
+			return
+		}
+		v = math.Round(v*factor*pow) / pow
+		formatted := strconv.FormatFloat(v, 'f', r.Precision, 64)
+		if r.Unit != "" {
+			formatted = formatted + " " + r.Unit
+		}
+		item.SetValue(name, formatted)
+	})
+}
+
+// mergeOperator returns the intent operator used to merge an aggregation of the fact result
+func (f *Fact) mergeOperator(name string) IntentToken {
+	if name == DocCountAgg {
+		return ValueCount
+	}
+	if f.Intent != nil && f.Intent.AggregationName() == name {
+		return f.Intent.Operator
+	}
+	return 0
+}
+
+func (f *Fact) getDimension(name string) *DimensionFragment {
+	for _, dimension := range f.Dimensions {
+		if dimension.AggregationName() == name {
+			return dimension
+		}
+	}
+	return nil
+}
+
+func resolveBound(exp string, t time.Time, location *time.Location) (*time.Time, error) {
+	if exp == "" {
+		return nil, nil
+	}
+	result, err := expression.Process(expression.LangEval, exp, expression.GetDateKeywords(t))
+	if err != nil {
+		return nil, err
+	}
+	str, ok := result.(string)
+	if !ok {
+		return nil, errors.New("expression result is not a string")
+	}
+	bound, err := time.ParseInLocation(utils.TimeLayout, str, location)
+	if err != nil {
+		return nil, err
+	}
+	return &bound, nil
+}
+
+// loadLocation returns the location of an IANA time zone name or an UTC offset (+02:00), default to UTC
+func loadLocation(timeZone string) *time.Location {
+	if timeZone == "" {
+		return time.UTC
+	}
+	if location, err := time.LoadLocation(timeZone); err == nil {
+		return location
+	}
+	sign := 1
+	offset := timeZone
+	if strings.HasPrefix(offset, "-") {
+		sign = -1
+	}
+	offset = strings.TrimLeft(offset, "+-")
+	parts := strings.Split(offset, ":")
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return time.UTC
+	}
+	minutes := 0
+	if len(parts) > 1 {
+		minutes, _ = strconv.Atoi(parts[1])
+	}
+	return time.FixedZone(timeZone, sign*(hours*3600+minutes*60))
+}
+
+// truncateDate returns the beginning of the date histogram bucket containing t
+func truncateDate(t time.Time, dimension *DimensionFragment) time.Time {
+	if dimension.CalendarFixed {
+		duration := dimensionDuration(dimension)
+		_, offset := t.Zone()
+		shift := time.Duration(offset) * time.Second
+		return t.Add(shift).Truncate(duration).Add(-shift)
+	}
+	year, month, day := t.Date()
+	switch dimension.calendarInterval() {
+	case "second":
+		return t.Truncate(time.Second)
+	case "minute":
+		return time.Date(year, month, day, t.Hour(), t.Minute(), 0, 0, t.Location())
+	case "hour":
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case "day":
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case "week":
+		weekday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-weekday, 0, 0, 0, 0, t.Location())
+	case "quarter":
+		return time.Date(year, month-(month-1)%3, 1, 0, 0, 0, 0, t.Location())
+	case "year":
+		return time.Date(year, 1, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// nextDate returns the beginning of the date histogram bucket following the one starting at t
+func nextDate(t time.Time, dimension *DimensionFragment) time.Time {
+	if dimension.CalendarFixed {
+		return t.Add(dimensionDuration(dimension))
+	}
+	switch dimension.calendarInterval() {
+	case "second":
+		return t.Add(time.Second)
+	case "minute":
+		return t.Add(time.Minute)
+	case "hour":
+		return t.Add(time.Hour)
+	case "day":
+		return t.AddDate(0, 0, 1)
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "quarter":
+		return t.AddDate(0, 3, 0)
+	case "year":
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+func dimensionDuration(dimension *DimensionFragment) time.Duration {
+	duration, err := time.ParseDuration(dimension.DateInterval)
+	if err != nil || duration <= 0 {
+		return 24 * time.Hour
+	}
+	return duration
+}
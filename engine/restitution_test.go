@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestItem(key string, docCount int64, value interface{}) *Item {
+	item := &Item{Key: key}
+	item.SetValue(DocCountAgg, docCount)
+	item.SetValue("total", value)
+	return item
+}
+
+func TestRestitutionIsValid(t *testing.T) {
+	cases := []struct {
+		restitution Restitution
+		expected    bool
+		errMsg      string
+	}{
+		{Restitution{}, false, "missing Operator"},
+		{Restitution{Operator: Rename, Labels: map[string]string{"a": "b"}}, false, "missing Dimension"},
+		{Restitution{Operator: Rename, Dimension: "dim"}, false, "missing Labels"},
+		{Restitution{Operator: Rename, Dimension: "dim", Labels: map[string]string{"a": "b"}}, true, ""},
+		{Restitution{Operator: Ratio, Numerator: "a", Denominator: "b"}, false, "missing Name"},
+		{Restitution{Operator: Ratio, Name: "r", Denominator: "b"}, false, "missing Numerator"},
+		{Restitution{Operator: Ratio, Name: "r", Numerator: "a"}, false, "missing Denominator"},
+		{Restitution{Operator: FillGaps}, false, "missing Dimension"},
+		{Restitution{Operator: TopN, Dimension: "dim"}, false, "size must be greater than 0"},
+		{Restitution{Operator: TopN, Dimension: "dim", Size: 3}, true, ""},
+		{Restitution{Operator: Unit, Precision: -1}, false, "precision is lower than 0"},
+	}
+
+	for _, c := range cases {
+		valid, err := c.restitution.IsValid()
+		if valid != c.expected {
+			t.Errorf("expected %v, got %v", c.expected, valid)
+		}
+		if err != nil && err.Error() != c.errMsg {
+			t.Errorf("expected error %v, got %v", c.errMsg, err)
+		}
+	}
+}
+
+func TestRestitutionUnmarshalJSON(t *testing.T) {
+	b := []byte(`{"name":"test","restitution":[{"operator":"topn","dimension":"by_country","size":2,"others":"Other countries"}]}`)
+	var f Fact
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Restitution) != 1 || f.Restitution[0].Operator != TopN || f.Restitution[0].Size != 2 || f.Restitution[0].Others != "Other countries" {
+		t.Errorf("invalid restitution %+v", f.Restitution)
+	}
+}
+
+func TestRestituteRenameRatioUnit(t *testing.T) {
+	f := Fact{
+		Intent:     &IntentFragment{Name: "total", Operator: Sum, Term: "amount"},
+		Dimensions: []*DimensionFragment{{Operator: By, Term: "status"}},
+		Restitution: []Restitution{
+			{Operator: Rename, Dimension: "by_status", Labels: map[string]string{"L": "Late", "D": "Delivered"}},
+			{Operator: Ratio, Name: "avg_amount", Numerator: "total", Denominator: DocCountAgg},
+			{Operator: Unit, Factor: 0.001, Precision: 1, Unit: "k€"},
+		},
+	}
+	root := &Item{Buckets: map[string][]*Item{
+		"by_status": {newTestItem("L", 4, 10000.0), newTestItem("D", 0, 0.0), newTestItem("X", 2, 1250.0)},
+	}}
+
+	if err := f.Restitute(root, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	items := root.Buckets["by_status"]
+	if items[0].Key != "Late" || items[1].Key != "Delivered" || items[2].Key != "X" {
+		t.Errorf("invalid renamed keys %s %s %s", items[0].Key, items[1].Key, items[2].Key)
+	}
+	if v, _ := items[0].GetValue("avg_amount"); v != 2500.0 {
+		t.Errorf("invalid ratio %v", v)
+	}
+	if v, found := items[1].GetValue("avg_amount"); !found || v != nil {
+		t.Errorf("ratio with a zero denominator must be nil, got %v", v)
+	}
+	if v, _ := items[2].GetValue("total"); v != 1250.0 {
+		t.Errorf("the raw value must be kept, got %v", v)
+	}
+	if v, _ := items[2].GetValue("total_formatted"); v != "1.3 k€" {
+		t.Errorf("invalid converted value %v", v)
+	}
+	if v, _ := items[0].GetValue("total_formatted"); v != "10.0 k€" {
+		t.Errorf("invalid formatted value %v", v)
+	}
+}
+
+func TestRestituteTopN(t *testing.T) {
+	f := Fact{
+		Intent:      &IntentFragment{Name: "total", Operator: Sum, Term: "amount"},
+		Dimensions:  []*DimensionFragment{{Name: "country", Operator: By, Term: "country"}},
+		Restitution: []Restitution{{Operator: TopN, Dimension: "country", Size: 2}},
+	}
+	root := &Item{Buckets: map[string][]*Item{
+		"country": {newTestItem("FR", 1, 10.0), newTestItem("DE", 1, 30.0), newTestItem("ES", 2, 5.0), newTestItem("IT", 3, 20.0)},
+	}}
+
+	if err := f.Restitute(root, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	items := root.Buckets["country"]
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(items))
+	}
+	if items[0].Key != "DE" || items[1].Key != "IT" || items[2].Key != "others" {
+		t.Errorf("invalid top items %s %s %s", items[0].Key, items[1].Key, items[2].Key)
+	}
+	if v, _ := items[2].GetValue("total"); v != 15.0 {
+		t.Errorf("invalid others total %v", v)
+	}
+	if v, _ := items[2].GetValue(DocCountAgg); v != 3.0 {
+		t.Errorf("invalid others doc count %v", v)
+	}
+}
+
+func TestRestituteFillGaps(t *testing.T) {
+	f := Fact{
+		Intent:      &IntentFragment{Name: "total", Operator: Count, Term: "id"},
+		Dimensions:  []*DimensionFragment{{Name: "day", Operator: DateHistogram, Term: "date", DateInterval: "day", TimeZone: "UTC"}},
+		Restitution: []Restitution{{Operator: FillGaps, Dimension: "day", From: `"2024-01-01T00:00:00.000"`, To: `"2024-01-05T00:00:00.000"`, Value: 0}},
+	}
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	key := func(d int) string {
+		return strconv.FormatInt(day(d).UnixMilli(), 10)
+	}
+	root := &Item{Buckets: map[string][]*Item{
+		"day": {newTestItem(key(2), 3, 3), newTestItem(key(4), 1, 1)},
+	}}
+
+	if err := f.Restitute(root, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	items := root.Buckets["day"]
+	if len(items) != 4 {
+		t.Fatalf("expected 4 items, got %d", len(items))
+	}
+	for i, item := range items {
+		if item.Key != key(i+1) {
+			t.Errorf("invalid key at %d: %s", i, item.Key)
+		}
+	}
+	if items[0].KeyAsString != day(1).Format("2006-01-02T15:04:05.000Z07:00") {
+		t.Errorf("invalid key as string %s", items[0].KeyAsString)
+	}
+	if v, _ := items[2].GetValue("total"); v != 0 {
+		t.Errorf("invalid filled value %v", v)
+	}
+	if v, _ := items[2].GetValue(DocCountAgg); v != int64(0) {
+		t.Errorf("invalid filled doc count %v (%T)", v, v)
+	}
+	if v, _ := items[1].GetValue("total"); v != 3 {
+		t.Errorf("existing item must be kept, got %v", v)
+	}
+}
@@ -0,0 +1,41 @@
+package engine
+
+// FactResult is the structured result of a fact calculation
+// * Total is the number of documents matching the fact condition
+// * Value is the intent value of a fact without dimension
+// * Hits are the documents returned by a Select intent
+// * Aggs and Buckets hold the result tree, with sub-items grouped by dimension name
+// * AfterKey is the key of the last composite bucket, used to fetch the next page of a composite fact
+// * Comparison holds the previous window values of a comparison fact
+type FactResult struct {
+	Item
+	Total      int64                  `json:"total"`
+	Value      interface{}            `json:"value,omitempty"`
+	Hits       []Hit                  `json:"hits,omitempty"`
+	AfterKey   map[string]interface{} `json:"afterKey,omitempty"`
+	Comparison *ComparisonResult      `json:"comparison,omitempty"`
+}
+
+// Hit is a single document returned by a Select intent
+type Hit struct {
+	ID     string                 `json:"id"`
+	Index  string                 `json:"index"`
+	Source map[string]interface{} `json:"source,omitempty"`
+	Sort   []interface{}          `json:"sort,omitempty"`
+}
+
+// PercentilesValue is the value of the Percentiles intent, indexed by percent ("95.0")
+type PercentilesValue map[string]float64
+
+// ExtendedStatsValue is the value of the ExtendedStats intent
+// Every optional statistic is nil when no document matched
+type ExtendedStatsValue struct {
+	Count        int64    `json:"count"`
+	Sum          float64  `json:"sum"`
+	Min          *float64 `json:"min"`
+	Max          *float64 `json:"max"`
+	Avg          *float64 `json:"avg"`
+	SumOfSquares *float64 `json:"sumOfSquares"`
+	Variance     *float64 `json:"variance"`
+	StdDeviation *float64 `json:"stdDeviation"`
+}
@@ -17,6 +17,8 @@ const (
 	Not
 	// If boolean token
 	If
+	// Nested boolean token
+	Nested
 )
 
 func (s BooleanToken) String() string {
@@ -27,17 +29,19 @@ func (s BooleanToken) String() string {
 var BooleanTokens = []BooleanToken{And, Or, Not}
 
 var booleanToString = map[BooleanToken]string{
-	And: "and",
-	Or:  "or",
-	Not: "not",
-	If:  "if",
+	And:    "and",
+	Or:     "or",
+	Not:    "not",
+	If:     "if",
+	Nested: "nested",
 }
 
 var booleanToID = map[string]BooleanToken{
-	"and": And,
-	"or":  Or,
-	"not": Not,
-	"if":  If,
+	"and":    And,
+	"or":     Or,
+	"not":    Not,
+	"if":     If,
+	"nested": Nested,
 }
 
 // GetBooleanToken search and return a boolean token from the standard supported operator list
@@ -21,6 +21,9 @@ func TestGetTokenBoolean(t *testing.T) {
 	if If != *GetBooleanToken("if") {
 		t.Error("Invalid get boolean token if")
 	}
+	if Nested != *GetBooleanToken("nested") {
+		t.Error("Invalid get boolean token nested")
+	}
 }
 
 func TestGetTokenBooleanInvalid(t *testing.T) {
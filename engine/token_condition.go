@@ -31,6 +31,10 @@ const (
 	Wildcard
 	// OptionalWildcard condition token
 	OptionalWildcard
+	// GeoDistance condition token
+	GeoDistance
+	// GeoBoundingBox condition token
+	GeoBoundingBox
 )
 
 func (s ConditionToken) String() string {
@@ -38,7 +42,7 @@ func (s ConditionToken) String() string {
 }
 
 // ConditionTokens list every supported condition token
-var ConditionTokens = []ConditionToken{For, From, To, Between, Exists, Script, OptionalFor, Regexp, OptionalRegexp, Wildcard, OptionalWildcard}
+var ConditionTokens = []ConditionToken{For, From, To, Between, Exists, Script, OptionalFor, Regexp, OptionalRegexp, Wildcard, OptionalWildcard, GeoDistance, GeoBoundingBox}
 
 var conditionToString = map[ConditionToken]string{
 	For:              "for",
@@ -52,6 +56,8 @@ var conditionToString = map[ConditionToken]string{
 	OptionalRegexp:   "optionalregexp",
 	Wildcard:         "wildcard",
 	OptionalWildcard: "optionalwildcard",
+	GeoDistance:      "geodistance",
+	GeoBoundingBox:   "geoboundingbox",
 }
 
 var conditionToID = map[string]ConditionToken{
@@ -66,6 +72,8 @@ var conditionToID = map[string]ConditionToken{
 	"optionalregexp":   OptionalRegexp,
 	"wildcard":         Wildcard,
 	"optionalwildcard": OptionalWildcard,
+	"geodistance":      GeoDistance,
+	"geoboundingbox":   GeoBoundingBox,
 }
 
 // GetConditionToken search and return a condition token from the standard supported operator list
@@ -24,6 +24,12 @@ func TestGetTokenCondition(t *testing.T) {
 	if Exists != *GetConditionToken("exists") {
 		t.Error("Invalid get condition token exists")
 	}
+	if GeoDistance != *GetConditionToken("geodistance") {
+		t.Error("Invalid get condition token geodistance")
+	}
+	if GeoBoundingBox != *GetConditionToken("geoboundingbox") {
+		t.Error("Invalid get condition token geoboundingbox")
+	}
 	if Script != *GetConditionToken("script") {
 		t.Error("Invalid get condition token script")
 	}
@@ -15,6 +15,14 @@ const (
 	Histogram
 	// DateHistogram dimension token
 	DateHistogram
+	// Range dimension token
+	Range
+	// DateRange dimension token
+	DateRange
+	// GeoHashGrid dimension token
+	GeoHashGrid
+	// GeoTileGrid dimension token
+	GeoTileGrid
 )
 
 func (s DimensionToken) String() string {
@@ -22,18 +30,26 @@ func (s DimensionToken) String() string {
 }
 
 // DimensionTokens list every supported dimension token
-var DimensionTokens = []DimensionToken{By, Histogram, DateHistogram}
+var DimensionTokens = []DimensionToken{By, Histogram, DateHistogram, Range, DateRange, GeoHashGrid, GeoTileGrid}
 
 var dimensionToString = map[DimensionToken]string{
 	By:            "by",
 	Histogram:     "histogram",
 	DateHistogram: "datehistogram",
+	Range:         "range",
+	DateRange:     "daterange",
+	GeoHashGrid:   "geohashgrid",
+	GeoTileGrid:   "geotilegrid",
 }
 
 var dimensionToID = map[string]DimensionToken{
 	"by":            By,
 	"histogram":     Histogram,
 	"datehistogram": DateHistogram,
+	"range":         Range,
+	"daterange":     DateRange,
+	"geohashgrid":   GeoHashGrid,
+	"geotilegrid":   GeoTileGrid,
 }
 
 // GetDimensionToken search and return a dimension token from the standard supported operator list
@@ -18,6 +18,12 @@ func TestGetTokenDimension(t *testing.T) {
 	if DateHistogram != *GetDimensionToken("datehistogram") {
 		t.Error("Invalid get dimension token datehistogram")
 	}
+	if GeoHashGrid != *GetDimensionToken("geohashgrid") {
+		t.Error("Invalid get dimension token geohashgrid")
+	}
+	if GeoTileGrid != *GetDimensionToken("geotilegrid") {
+		t.Error("Invalid get dimension token geotilegrid")
+	}
 }
 
 func TestGetTokenDimensionInvalid(t *testing.T) {
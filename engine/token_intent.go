@@ -23,6 +23,16 @@ const (
 	Select
 	// Delete
 	Delete
+	// Percentiles intent token
+	Percentiles
+	// ExtendedStats intent token
+	ExtendedStats
+	// ValueCount intent token
+	ValueCount
+	// DistinctCount intent token
+	DistinctCount
+	// Median intent token
+	Median
 )
 
 func (s IntentToken) String() string {
@@ -30,26 +40,36 @@ func (s IntentToken) String() string {
 }
 
 // IntentTokens list every supported intent token
-var IntentTokens = []IntentToken{Count, Sum, Avg, Min, Max, Select}
+var IntentTokens = []IntentToken{Count, Sum, Avg, Min, Max, Select, Percentiles, ExtendedStats, ValueCount, DistinctCount, Median}
 
 var intentToString = map[IntentToken]string{
-	Count:  "count",
-	Sum:    "sum",
-	Avg:    "avg",
-	Min:    "min",
-	Max:    "max",
-	Select: "select",
-	Delete: "delete",
+	Count:         "count",
+	Sum:           "sum",
+	Avg:           "avg",
+	Min:           "min",
+	Max:           "max",
+	Select:        "select",
+	Delete:        "delete",
+	Percentiles:   "percentiles",
+	ExtendedStats: "extendedstats",
+	ValueCount:    "valuecount",
+	DistinctCount: "distinctcount",
+	Median:        "median",
 }
 
 var intentToID = map[string]IntentToken{
-	"count":  Count,
-	"sum":    Sum,
-	"avg":    Avg,
-	"min":    Min,
-	"max":    Max,
-	"select": Select,
-	"delete": Delete,
+	"count":         Count,
+	"sum":           Sum,
+	"avg":           Avg,
+	"min":           Min,
+	"max":           Max,
+	"select":        Select,
+	"delete":        Delete,
+	"percentiles":   Percentiles,
+	"extendedstats": ExtendedStats,
+	"valuecount":    ValueCount,
+	"distinctcount": DistinctCount,
+	"median":        Median,
 }
 
 // GetIntentToken search and return an intent token from the standard supported operator list
@@ -24,6 +24,21 @@ func TestGetTokenIntent(t *testing.T) {
 	if Max != *GetIntentToken("max") {
 		t.Error("Invalid get intent token max")
 	}
+	if Percentiles != *GetIntentToken("percentiles") {
+		t.Error("Invalid get intent token percentiles")
+	}
+	if ExtendedStats != *GetIntentToken("extendedstats") {
+		t.Error("Invalid get intent token extendedstats")
+	}
+	if ValueCount != *GetIntentToken("valuecount") {
+		t.Error("Invalid get intent token valuecount")
+	}
+	if DistinctCount != *GetIntentToken("distinctcount") {
+		t.Error("Invalid get intent token distinctcount")
+	}
+	if Median != *GetIntentToken("median") {
+		t.Error("Invalid get intent token median")
+	}
 }
 
 func TestGetTokenIntentInvalid(t *testing.T) {
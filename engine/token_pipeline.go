@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// PipelineToken enumeration for pipeline (secondary intent) tokens
+type PipelineToken int
+
+const (
+	// BucketScript pipeline token
+	BucketScript PipelineToken = iota + 1
+	// CumulativeSum pipeline token
+	CumulativeSum
+	// Derivative pipeline token
+	Derivative
+	// MovingAvg pipeline token
+	MovingAvg
+)
+
+func (s PipelineToken) String() string {
+	return pipelineToString[s]
+}
+
+// PipelineTokens list every supported pipeline token
+var PipelineTokens = []PipelineToken{BucketScript, CumulativeSum, Derivative, MovingAvg}
+
+var pipelineToString = map[PipelineToken]string{
+	BucketScript:  "bucketscript",
+	CumulativeSum: "cumulativesum",
+	Derivative:    "derivative",
+	MovingAvg:     "movingavg",
+}
+
+var pipelineToID = map[string]PipelineToken{
+	"bucketscript":  BucketScript,
+	"cumulativesum": CumulativeSum,
+	"derivative":    Derivative,
+	"movingavg":     MovingAvg,
+}
+
+// GetPipelineToken search and return a pipeline token from the standard supported operator list
+func GetPipelineToken(name string) *PipelineToken {
+	if value, exists := pipelineToID[name]; exists {
+		return &value
+	}
+	return nil
+}
+
+// MarshalJSON marshals the enum as a quoted json string
+func (s PipelineToken) MarshalJSON() ([]byte, error) {
+	buffer := bytes.NewBufferString(`"`)
+	buffer.WriteString(pipelineToString[s])
+	buffer.WriteString(`"`)
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalJSON unmashals a quoted json string to the enum value
+func (s *PipelineToken) UnmarshalJSON(b []byte) error {
+	var j string
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	// Note that if the string cannot be found then it will be set to the zero value
+	*s = pipelineToID[j]
+	return nil
+}
@@ -0,0 +1,36 @@
+package engine
+
+import "testing"
+
+func TestTokenPipelineString(t *testing.T) {
+	if MovingAvg.String() != "movingavg" {
+		t.Error("Invalid string")
+	}
+}
+
+func TestGetTokenPipeline(t *testing.T) {
+	for _, token := range PipelineTokens {
+		if token != *GetPipelineToken(token.String()) {
+			t.Errorf("Invalid get pipeline token %s", token.String())
+		}
+	}
+	if GetPipelineToken("not_a_token") != nil {
+		t.Error("Token not_a_token should ne exists")
+	}
+}
+
+func TestTokenPipelineMarshalJSON(t *testing.T) {
+	b, _ := BucketScript.MarshalJSON()
+	if string(b) != "\"bucketscript\"" {
+		t.Error("wrong marshal token")
+		t.Log(string(b))
+	}
+	var bt PipelineToken
+	if err := bt.UnmarshalJSON(b); err != nil {
+		t.Error(err)
+	}
+	if bt != BucketScript {
+		t.Error("wrong unmarshal token")
+		t.Log(bt)
+	}
+}
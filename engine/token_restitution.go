@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// RestitutionToken enumeration for restitution tokens
+type RestitutionToken int
+
+const (
+	// Rename restitution token
+	Rename RestitutionToken = iota + 1
+	// Ratio restitution token
+	Ratio
+	// FillGaps restitution token
+	FillGaps
+	// TopN restitution token
+	TopN
+	// Unit restitution token
+	Unit
+)
+
+func (s RestitutionToken) String() string {
+	return restitutionToString[s]
+}
+
+// RestitutionTokens list every supported restitution token
+var RestitutionTokens = []RestitutionToken{Rename, Ratio, FillGaps, TopN, Unit}
+
+var restitutionToString = map[RestitutionToken]string{
+	Rename:   "rename",
+	Ratio:    "ratio",
+	FillGaps: "fillgaps",
+	TopN:     "topn",
+	Unit:     "unit",
+}
+
+var restitutionToID = map[string]RestitutionToken{
+	"rename":   Rename,
+	"ratio":    Ratio,
+	"fillgaps": FillGaps,
+	"topn":     TopN,
+	"unit":     Unit,
+}
+
+// GetRestitutionToken search and return a restitution token from the standard supported operator list
+func GetRestitutionToken(name string) *RestitutionToken {
+	if value, exists := restitutionToID[name]; exists {
+		return &value
+	}
+	return nil
+}
+
+// MarshalJSON marshals the enum as a quoted json string
+func (s RestitutionToken) MarshalJSON() ([]byte, error) {
+	buffer := bytes.NewBufferString(`"`)
+	buffer.WriteString(restitutionToString[s])
+	buffer.WriteString(`"`)
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalJSON unmashals a quoted json string to the enum value
+func (s *RestitutionToken) UnmarshalJSON(b []byte) error {
+	var j string
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	// Note that if the string cannot be found then it will be set to the zero value
+	*s = restitutionToID[j]
+	return nil
+}
@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// VariableToken enumeration for template variable type tokens
+type VariableToken int
+
+const (
+	// VariableString template variable type token
+	VariableString VariableToken = iota + 1
+	// VariableNumber template variable type token
+	VariableNumber
+	// VariableBoolean template variable type token
+	VariableBoolean
+	// VariableDate template variable type token
+	VariableDate
+	// VariableList template variable type token
+	VariableList
+)
+
+func (s VariableToken) String() string {
+	return variableToString[s]
+}
+
+// VariableTokens list every supported template variable type token
+var VariableTokens = []VariableToken{VariableString, VariableNumber, VariableBoolean, VariableDate, VariableList}
+
+var variableToString = map[VariableToken]string{
+	VariableString:  "string",
+	VariableNumber:  "number",
+	VariableBoolean: "boolean",
+	VariableDate:    "date",
+	VariableList:    "list",
+}
+
+var variableToID = map[string]VariableToken{
+	"string":  VariableString,
+	"number":  VariableNumber,
+	"boolean": VariableBoolean,
+	"date":    VariableDate,
+	"list":    VariableList,
+}
+
+// GetVariableToken search and return a template variable type token from the standard supported type list
+func GetVariableToken(name string) *VariableToken {
+	if value, exists := variableToID[name]; exists {
+		return &value
+	}
+	return nil
+}
+
+// MarshalJSON marshals the enum as a quoted json string
+func (s VariableToken) MarshalJSON() ([]byte, error) {
+	buffer := bytes.NewBufferString(`"`)
+	buffer.WriteString(variableToString[s])
+	buffer.WriteString(`"`)
+	return buffer.Bytes(), nil
+}
+
+// UnmarshalJSON unmashals a quoted json string to the enum value
+func (s *VariableToken) UnmarshalJSON(b []byte) error {
+	var j string
+	err := json.Unmarshal(b, &j)
+	if err != nil {
+		return err
+	}
+	// Note that if the string cannot be found then it will be set to the zero value
+	*s = variableToID[j]
+	return nil
+}
@@ -0,0 +1,36 @@
+package engine
+
+import "testing"
+
+func TestTokenVariableString(t *testing.T) {
+	if VariableDate.String() != "date" {
+		t.Error("Invalid string")
+	}
+}
+
+func TestGetTokenVariable(t *testing.T) {
+	for _, token := range VariableTokens {
+		if token != *GetVariableToken(token.String()) {
+			t.Errorf("Invalid get variable token %s", token.String())
+		}
+	}
+	if GetVariableToken("not_a_token") != nil {
+		t.Error("Token not_a_token should ne exists")
+	}
+}
+
+func TestTokenVariableMarshalJSON(t *testing.T) {
+	b, _ := VariableList.MarshalJSON()
+	if string(b) != "\"list\"" {
+		t.Error("wrong marshal token")
+		t.Log(string(b))
+	}
+	var bt VariableToken
+	if err := bt.UnmarshalJSON(b); err != nil {
+		t.Error(err)
+	}
+	if bt != VariableList {
+		t.Error("wrong unmarshal token")
+		t.Log(bt)
+	}
+}
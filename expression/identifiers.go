@@ -0,0 +1,59 @@
+package expression
+
+import (
+	"strings"
+	"text/scanner"
+)
+
+// keywords are the identifiers of the expression language which are not variables
+var keywords = map[string]bool{"true": true, "false": true, "nil": true, "in": true}
+
+// Identifier is a variable referenced by an expression
+// * Name is the root variable name (the a of a.b.c)
+// * Path is the variable with its selectors (a.b.c)
+// * Offset is the byte offset of the variable name in the expression
+type Identifier struct {
+	Name   string
+	Path   string
+	Offset int
+}
+
+// Identifiers returns the variables referenced by an expression, in order of appearance
+// The functions, the keywords and the string literals are excluded
+func Identifiers(exp string) []Identifier {
+	type token struct {
+		kind   rune
+		text   string
+		offset int
+	}
+	var s scanner.Scanner
+	s.Init(strings.NewReader(exp))
+	s.Mode = scanner.ScanIdents | scanner.ScanFloats | scanner.ScanChars | scanner.ScanStrings | scanner.ScanRawStrings
+	s.Error = func(*scanner.Scanner, string) {}
+	tokens := make([]token, 0)
+	for kind := s.Scan(); kind != scanner.EOF; kind = s.Scan() {
+		tokens = append(tokens, token{kind: kind, text: s.TokenText(), offset: s.Position.Offset})
+	}
+
+	identifiers := make([]Identifier, 0)
+	for i, t := range tokens {
+		if t.kind != scanner.Ident || keywords[t.text] {
+			continue
+		}
+		if i > 0 && tokens[i-1].kind == '.' {
+			continue
+		}
+		if i+1 < len(tokens) && tokens[i+1].kind == '(' {
+			continue
+		}
+		path := t.text
+		for j := i + 1; j+1 < len(tokens) && tokens[j].kind == '.' && tokens[j+1].kind == scanner.Ident; j += 2 {
+			if j+2 < len(tokens) && tokens[j+2].kind == '(' {
+				break
+			}
+			path += "." + tokens[j+1].text
+		}
+		identifiers = append(identifiers, Identifier{Name: t.text, Path: path, Offset: t.offset})
+	}
+	return identifiers
+}
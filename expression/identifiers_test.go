@@ -0,0 +1,40 @@
+package expression
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIdentifiers(t *testing.T) {
+
+	testCases := []struct {
+		name string
+		exp  string
+		want []Identifier
+	}{
+		{"simple variable", "a > 1", []Identifier{{Name: "a", Path: "a", Offset: 0}}},
+		{"selectors", "fact.aggs.doc_count.value >= b", []Identifier{
+			{Name: "fact", Path: "fact.aggs.doc_count.value", Offset: 0},
+			{Name: "b", Path: "b", Offset: 29},
+		}},
+		{"keywords and strings", `a == true && b != "c.d" && e in ["f"]`, []Identifier{
+			{Name: "a", Path: "a", Offset: 0},
+			{Name: "b", Path: "b", Offset: 13},
+			{Name: "e", Path: "e", Offset: 27},
+		}},
+		{"functions", "length(a.b) > max(c, 2)", []Identifier{
+			{Name: "a", Path: "a.b", Offset: 7},
+			{Name: "c", Path: "c", Offset: 18},
+		}},
+		{"no variable", `"a" == "b"`, []Identifier{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Identifiers(tc.exp)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Identifiers(%q) returned %+v, want %+v", tc.exp, got, tc.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
 	"github.com/myrteametrics/myrtea-sdk/v5/handlers/render"
 )
 
@@ -59,3 +60,27 @@ func FuncGetLogLevel() {}
 // @Failure 400 "Status Bad Request"
 // @Router /log_level [put]
 func FuncSetLogLevel() {}
+
+// GetFactJSONSchema godoc
+// @Summary Get the fact JSON Schema
+// @Description Get the JSON Schema (draft 2020-12) of a fact definition, to validate facts and offer autocomplete in editors
+// @Tags Facts
+// @Produce json
+// @Security Bearer
+// @Success 200 "Status OK"
+// @Router /engine/facts/schema [get]
+func GetFactJSONSchema(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, engine.FactJSONSchema())
+}
+
+// GetFactOpenAPIComponents godoc
+// @Summary Get the fact OpenAPI components
+// @Description Get the OpenAPI 3.1 components (components.schemas) of a fact definition
+// @Tags Facts
+// @Produce json
+// @Security Bearer
+// @Success 200 "Status OK"
+// @Router /engine/facts/schema/openapi [get]
+func GetFactOpenAPIComponents(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, engine.FactOpenAPIComponents())
+}
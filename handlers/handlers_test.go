@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -41,3 +43,48 @@ func TestNotImplemented(t *testing.T) {
 		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+func TestGetFactJSONSchema(t *testing.T) {
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(GetFactJSONSchema).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if schema["$ref"] != "#/$defs/Fact" {
+		t.Errorf("handler returned unexpected schema: got %v", schema["$ref"])
+	}
+}
+
+func TestGetFactOpenAPIComponents(t *testing.T) {
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(GetFactOpenAPIComponents).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var components map[string]map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &components); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := components["schemas"]["Fact"]; !ok {
+		t.Errorf("handler returned unexpected components: got %v", rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "#/$defs/") {
+		t.Error("handler returned JSON Schema references instead of OpenAPI component references")
+	}
+}
@@ -59,6 +59,11 @@ func (field *FieldLeaf) Source() (string, map[string]interface{}) {
 		fieldContent = map[string]interface{}{
 			"type": "date",
 		}
+
+	case GeoPoint:
+		fieldContent = map[string]interface{}{
+			"type": "geo_point",
+		}
 	}
 
 	return field.Name, fieldContent
@@ -21,6 +21,8 @@ const (
 	Boolean
 	// Object is elasticsearch object or nested datatype (based on some other attributes)
 	Object
+	// GeoPoint is elasticsearch geo_point datatype
+	GeoPoint
 )
 
 // String returns the string version of FieldType
@@ -35,6 +37,7 @@ var toString = map[FieldType]string{
 	DateTime: "datetime",
 	Boolean:  "boolean",
 	Object:   "object",
+	GeoPoint: "geopoint",
 }
 
 var toID = map[string]FieldType{
@@ -44,6 +47,7 @@ var toID = map[string]FieldType{
 	"datetime": DateTime,
 	"boolean":  Boolean,
 	"object":   Object,
+	"geopoint": GeoPoint,
 }
 
 // MarshalJSON marshals the enum as a quoted json string
@@ -17,6 +17,7 @@ var model = Model{
 		&FieldLeaf{Name: "f2", Ftype: String, Synonyms: []string{"f2", "f2other"}},
 		&FieldLeaf{Name: "f3", Ftype: DateTime, Synonyms: []string{"f3", "f3other"}},
 		&FieldLeaf{Name: "f4", Ftype: Boolean, Synonyms: []string{"f4", "f4other"}},
+		&FieldLeaf{Name: "f7", Ftype: GeoPoint, Synonyms: []string{"f7", "f7other"}},
 		&FieldObject{Name: "f5", Ftype: Object, KeepObjectSeparation: false, Fields: []Field{
 			&FieldLeaf{Name: "a", Ftype: Int, Synonyms: []string{"a", "aother"}},
 			&FieldLeaf{Name: "b", Ftype: String, Synonyms: []string{"b", "bother"}},
@@ -42,7 +43,7 @@ var model = Model{
 
 var expectedModel = strings.ReplaceAll(`{"id":1,"name":"model-1","synonyms":["model","other"],"fields":[{"name":"f1","type":"int","semantic":false,"synonyms":["f1","f1other"]},
 {"name":"f2","type":"string","semantic":false,"synonyms":["f2","f2other"]},{"name":"f3","type":"datetime","semantic":false,"synonyms":["f3","f3other"]},
-{"name":"f4","type":"boolean","semantic":false,"synonyms":["f4","f4other"]},{"name":"f5","type":"object","keepObjectSeparation":false,
+{"name":"f4","type":"boolean","semantic":false,"synonyms":["f4","f4other"]},{"name":"f7","type":"geopoint","semantic":false,"synonyms":["f7","f7other"]},{"name":"f5","type":"object","keepObjectSeparation":false,
 "fields":[{"name":"a","type":"int","semantic":false,"synonyms":["a","aother"]},{"name":"b","type":"string","semantic":false,"synonyms":["b","bother"]}]},
 {"name":"f6","type":"object","keepObjectSeparation":true,"fields":[{"name":"a","type":"int","semantic":false,"synonyms":["a","aother"]},
 {"name":"b","type":"string","semantic":false,"synonyms":["b","bother"]}]}],"elasticsearchOptions":{"rollmode":{"type":"cron"},"rollcron":"0 0 * * *",
@@ -137,6 +138,11 @@ func TestSource(t *testing.T) {
 				t.Error("expected boolean")
 			}
 			break
+		case GeoPoint:
+			if name != "geo_point" {
+				t.Error("expected geo_point")
+			}
+			break
 		}
 
 	}
@@ -160,3 +166,18 @@ func TestElasticsearchOptions_IsValid(t *testing.T) {
 
 	expression.AssertEqual(t, valid, false, "Rollcron should be invalid, since its interval is less than every day")
 }
+
+func TestFindField(t *testing.T) {
+	if !FindFieldLeaf("f5.a", "", model.Fields) || FindFieldLeaf("f5", "", model.Fields) || FindFieldLeaf("a", "", model.Fields) {
+		t.Error("FindFieldLeaf should only find the leaves by their full path")
+	}
+	if leaf := GetFieldLeaf("f6.b", "", model.Fields); leaf == nil || leaf.Ftype != String {
+		t.Errorf("invalid leaf %+v", leaf)
+	}
+	if object := FindFieldObject("f6", "", model.Fields); object == nil || !object.KeepObjectSeparation {
+		t.Errorf("invalid object %+v", object)
+	}
+	if FindFieldObject("f6.a", "", model.Fields) != nil {
+		t.Error("FindFieldObject should not find a leaf")
+	}
+}
@@ -4,27 +4,7 @@ import "fmt"
 
 // FindFieldLeaf returns if a field name exists in a fields tree
 func FindFieldLeaf(search string, parent string, fields []Field) bool {
-	for _, field := range fields {
-		switch v := field.(type) {
-		case *FieldLeaf:
-			name := v.Name
-			if parent != "" {
-				name = fmt.Sprintf("%s.%s", parent, v.Name)
-			}
-			if search == name {
-				return true
-			}
-		case *FieldObject:
-			name := v.Name
-			if parent != "" {
-				name = fmt.Sprintf("%s.%s", parent, v.Name)
-			}
-			if FindFieldLeaf(search, name, v.Fields) {
-				return true
-			}
-		}
-	}
-	return false
+	return GetFieldLeaf(search, parent, fields) != nil
 }
 
 // BuildFieldPath returns the full fields tree path to a field
@@ -44,3 +24,44 @@ func BuildFieldPath(name string, fields []Field) string {
 	}
 	return ""
 }
+
+// FindFieldObject returns the object field matching a full path in a fields tree, or nil if it does not exist
+func FindFieldObject(search string, parent string, fields []Field) *FieldObject {
+	object, _ := findField(search, parent, fields).(*FieldObject)
+	return object
+}
+
+// GetFieldLeaf returns the leaf field matching a full path in a fields tree, or nil if it does not exist
+func GetFieldLeaf(search string, parent string, fields []Field) *FieldLeaf {
+	leaf, _ := findField(search, parent, fields).(*FieldLeaf)
+	return leaf
+}
+
+// findField returns the field (leaf or object) matching a full path in a fields tree, or nil if it does not exist
+func findField(search string, parent string, fields []Field) Field {
+	for _, field := range fields {
+		var name string
+		var children []Field
+		switch v := field.(type) {
+		case *FieldLeaf:
+			name = v.Name
+		case *FieldObject:
+			name = v.Name
+			children = v.Fields
+		default:
+			continue
+		}
+		if parent != "" {
+			name = fmt.Sprintf("%s.%s", parent, name)
+		}
+		if search == name {
+			return field
+		}
+		if children != nil {
+			if found := findField(search, name, children); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
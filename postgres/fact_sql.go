@@ -0,0 +1,531 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+	"github.com/myrteametrics/myrtea-sdk/v5/expression"
+)
+
+// DocCountColumn is the name of the column containing the rows count of each group of a fact SQL query
+const DocCountColumn = engine.DocCountAgg
+
+var calendarUnits = map[string]string{
+	"second": "second", "1s": "second",
+	"minute": "minute", "1m": "minute",
+	"hour": "hour", "1h": "hour",
+	"day": "day", "1d": "day",
+	"week": "week", "1w": "week",
+	"month": "month", "1M": "month",
+	"quarter": "quarter", "1q": "quarter",
+	"year": "year", "1y": "year",
+}
+
+var defaultPercents = []float64{1, 5, 25, 50, 75, 95, 99}
+
+// ConvertFactToSQL translates a contextualized fact to a parameterized SQL query on a table (or a view)
+// The intent is translated to aggregate functions, the dimensions to GROUP BY expressions and the condition to a WHERE clause
+// The columns are named as the elasticsearch aggregations, a dotted term is translated to a qualified column (table.column)
+// Unlike the elasticsearch terms aggregation, the groups are never truncated to the dimension size
+func ConvertFactToSQL(f engine.Fact, ti time.Time, table string, parameters map[string]interface{}) (string, []interface{}, error) {
+	if f.Intent == nil {
+		return "", nil, errors.New("no intent fragment")
+	}
+	if len(f.Pipelines) > 0 {
+		return "", nil, errors.New("secondary intents are not supported in SQL")
+	}
+	if f.Comparison != nil {
+		return "", nil, errors.New("comparison is not supported in SQL")
+	}
+
+	variables := make(map[string]interface{}, len(parameters))
+	for k, v := range parameters {
+		variables[k] = v
+	}
+	for k, v := range expression.GetDateKeywords(ti) {
+		variables[k] = v
+	}
+
+	builder := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).Select().From(quoteIdentifier(table))
+
+	where, err := buildSQLCondition(f.Condition, ti, variables)
+	if err != nil {
+		return "", nil, err
+	}
+	if where != nil {
+		builder = builder.Where(where)
+	}
+
+	if f.Intent.Operator == engine.Select {
+		builder = builder.Column("*")
+		sorts, err := engine.ParseSort(f.Sort)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, s := range sorts {
+			direction := "ASC"
+			if s.Desc {
+				direction = "DESC"
+			}
+			builder = builder.OrderBy(quoteIdentifier(s.Field) + " " + direction + " NULLS LAST")
+		}
+		return builder.Limit(engine.DefaultSelectSize).ToSql()
+	}
+
+	aliases := make(map[string]bool)
+	for i, frag := range f.Dimensions {
+		column, err := buildSQLDimension(frag, ti)
+		if err != nil {
+			return "", nil, err
+		}
+		builder = builder.Column(column).GroupBy(strconv.Itoa(i + 1))
+		aliases[frag.AggregationName()] = true
+		if frag.Missing == "" {
+			// the elasticsearch bucket aggregations drop the documents without the field, unless a terms missing value is set
+			builder = builder.Where(quoteIdentifier(frag.Term) + " IS NOT NULL")
+		}
+		if frag.MinDocCount != nil && *frag.MinDocCount > 1 {
+			// the groups are only counted on every dimension, which matches the elasticsearch buckets of the innermost dimension
+			if i < len(f.Dimensions)-1 {
+				return "", nil, errors.New("minDocCount is only supported on the innermost dimension in SQL")
+			}
+			builder = builder.Having("COUNT(*) >= ?", *frag.MinDocCount)
+		}
+	}
+
+	intents, err := buildSQLIntent(f.Intent)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, intent := range intents {
+		builder = builder.Column(intent.expr + " AS " + quoteAlias(intent.alias))
+		aliases[intent.alias] = true
+	}
+	builder = builder.Column("COUNT(*) AS " + quoteIdentifier(DocCountColumn))
+
+	for i, frag := range f.Dimensions {
+		order, err := sqlDimensionOrder(frag, i+1, aliases)
+		if err != nil {
+			return "", nil, err
+		}
+		builder = builder.OrderBy(order)
+	}
+
+	return builder.ToSql()
+}
+
+// quoteIdentifier quotes each part of a dotted identifier, escaping the double quotes
+func quoteIdentifier(identifier string) string {
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+func quoteAlias(alias string) string {
+	return `"` + strings.ReplaceAll(alias, `"`, `""`) + `"`
+}
+
+// sqlColumn is an aggregate expression and its alias
+type sqlColumn struct {
+	expr  string
+	alias string
+}
+
+func buildSQLIntent(frag *engine.IntentFragment) ([]sqlColumn, error) {
+	if frag.Script {
+		return nil, errors.New("script intents are not supported in SQL")
+	}
+	column := quoteIdentifier(frag.Term)
+	alias := frag.AggregationName()
+
+	var expr string
+	switch frag.Operator {
+	case engine.Count, engine.DistinctCount:
+		expr = "COUNT(DISTINCT " + column + ")"
+	case engine.ValueCount:
+		expr = "COUNT(" + column + ")"
+	case engine.Sum:
+		expr = "COALESCE(SUM(" + column + "), 0)"
+	case engine.Avg:
+		expr = "AVG(" + column + ")"
+	case engine.Min:
+		expr = "MIN(" + column + ")"
+	case engine.Max:
+		expr = "MAX(" + column + ")"
+	case engine.Median:
+		expr = "percentile_cont(0.5) WITHIN GROUP (ORDER BY " + column + ")"
+	case engine.Percentiles:
+		percents := frag.Percents
+		if len(percents) == 0 {
+			percents = defaultPercents
+		}
+		fractions := make([]string, 0, len(percents))
+		for _, percent := range percents {
+			fractions = append(fractions, strconv.FormatFloat(percent/100, 'g', 12, 64))
+		}
+		expr = "percentile_cont(ARRAY[" + strings.Join(fractions, ",") + "]::float8[]) WITHIN GROUP (ORDER BY " + column + ")"
+	case engine.ExtendedStats:
+		stats := []struct {
+			name string
+			expr string
+		}{
+			{"count", "COUNT(" + column + ")"},
+			{"min", "MIN(" + column + ")"},
+			{"max", "MAX(" + column + ")"},
+			{"avg", "AVG(" + column + ")"},
+			{"sum", "COALESCE(SUM(" + column + "), 0)"},
+			{"sum_of_squares", "SUM(" + column + " * " + column + ")"},
+			{"variance", "var_pop(" + column + ")"},
+			{"std_deviation", "stddev_pop(" + column + ")"},
+		}
+		columns := make([]sqlColumn, 0, len(stats))
+		for _, stat := range stats {
+			columns = append(columns, sqlColumn{expr: stat.expr, alias: alias + "." + stat.name})
+		}
+		return columns, nil
+	default:
+		return nil, errors.New("Invalid intent kind: " + frag.Operator.String())
+	}
+	return []sqlColumn{{expr: expr, alias: alias}}, nil
+}
+
+func buildSQLDimension(frag *engine.DimensionFragment, ti time.Time) (sq.Sqlizer, error) {
+	column := quoteIdentifier(frag.Term)
+	alias := " AS " + quoteAlias(frag.AggregationName())
+
+	switch frag.Operator {
+	case engine.By:
+		if frag.Missing != "" {
+			return sq.Expr("COALESCE("+column+"::text, ?)"+alias, frag.Missing), nil
+		}
+		return sq.Expr(column + alias), nil
+
+	case engine.Histogram:
+		interval := frag.Interval
+		if interval == 0 {
+			interval = engine.DefaultHistogramInterval
+		}
+		return sq.Expr("floor("+column+" / ?) * ?"+alias, interval, interval), nil
+
+	case engine.DateHistogram:
+		if frag.CalendarFixed {
+			duration := 24 * time.Hour
+			if frag.DateInterval != "" {
+				var err error
+				duration, err = time.ParseDuration(frag.DateInterval)
+				if err != nil {
+					return nil, err
+				}
+			}
+			seconds := duration.Seconds()
+			return sq.Expr("to_timestamp(floor(extract(epoch from "+column+") / ?) * ?)"+alias, seconds, seconds), nil
+		}
+		interval := frag.DateInterval
+		if interval == "" {
+			// a calendar date histogram without interval is monthly, as in the elasticsearch translation and the restitution
+			interval = "month"
+		}
+		unit, ok := calendarUnits[interval]
+		if !ok {
+			return nil, errors.New("unsupported calendar interval " + interval)
+		}
+		if frag.TimeZone != "" {
+			return sq.Expr("date_trunc('"+unit+"', "+column+", ?)"+alias, frag.TimeZone), nil
+		}
+		return sq.Expr("date_trunc('" + unit + "', " + column + ")" + alias), nil
+
+	case engine.Range, engine.DateRange:
+		if len(frag.Ranges) == 0 {
+			return nil, errors.New("missing ranges")
+		}
+		var sql strings.Builder
+		args := make([]interface{}, 0)
+		sql.WriteString("CASE")
+		for _, r := range frag.Ranges {
+			from, to := r.From, r.To
+			if frag.Operator == engine.DateRange {
+				from, to = sqlDateValue(from, ti, frag.TimeZone), sqlDateValue(to, ti, frag.TimeZone)
+			}
+			bounds := make([]string, 0, 2)
+			if from != nil {
+				bounds = append(bounds, column+" >= ?")
+				args = append(args, from)
+			}
+			if to != nil {
+				bounds = append(bounds, column+" < ?")
+				args = append(args, to)
+			}
+			if len(bounds) == 0 {
+				bounds = append(bounds, column+" IS NOT NULL")
+			}
+			sql.WriteString(" WHEN " + strings.Join(bounds, " AND ") + " THEN ?")
+			args = append(args, sqlRangeKey(r))
+		}
+		sql.WriteString(" END")
+		return sq.Expr(sql.String()+alias, args...), nil
+
+	default:
+		return nil, errors.New("Invalid dimension kind: " + frag.Operator.String())
+	}
+}
+
+// sqlRangeKey returns the key of a range, formatted as the elasticsearch range keys if it has none
+func sqlRangeKey(r engine.DimensionRange) string {
+	if r.Key != "" {
+		return r.Key
+	}
+	return sqlRangeBound(r.From) + "-" + sqlRangeBound(r.To)
+}
+
+func sqlRangeBound(value interface{}) string {
+	if value == nil {
+		return "*"
+	}
+	if v, ok := sqlNumber(value); ok {
+		if v == math.Trunc(v) {
+			return strconv.FormatFloat(v, 'f', 1, 64)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// sqlDimensionOrder orders the groups by key, or as the terms aggregation order of a By dimension
+// As in elasticsearch, a By dimension can be ordered by any selected column, named as its aggregation
+func sqlDimensionOrder(frag *engine.DimensionFragment, position int, aliases map[string]bool) (string, error) {
+	if frag.Operator == engine.By && frag.OrderBy != "" {
+		direction := "DESC"
+		if frag.OrderDirection == "asc" {
+			direction = "ASC"
+		}
+		switch frag.OrderBy {
+		case "_key":
+			return strconv.Itoa(position) + " " + direction, nil
+		case "_count":
+			return quoteAlias(DocCountColumn) + " " + direction, nil
+		default:
+			if !aliases[frag.OrderBy] {
+				return "", errors.New("unknown order column " + frag.OrderBy)
+			}
+			return quoteAlias(frag.OrderBy) + " " + direction, nil
+		}
+	}
+	if frag.OrderDirection == "desc" {
+		return strconv.Itoa(position) + " DESC", nil
+	}
+	return strconv.Itoa(position) + " ASC", nil
+}
+
+func buildSQLCondition(fragment engine.ConditionFragment, ti time.Time, variables map[string]interface{}) (sq.Sqlizer, error) {
+	switch f := fragment.(type) {
+	case nil:
+		return nil, nil
+
+	case *engine.BooleanFragment:
+		if f.Operator == engine.If {
+			val, err := expression.Process(expression.LangEval, f.Expression, variables)
+			if err != nil {
+				return nil, fmt.Errorf("expression evaluation failed : %s", err)
+			}
+			if valIf, ok := val.(bool); !ok || !valIf {
+				return nil, nil
+			}
+		}
+
+		conditions := make([]sq.Sqlizer, 0)
+		for _, subFrag := range f.Fragments {
+			condition, err := buildSQLCondition(subFrag, ti, variables)
+			if err != nil {
+				return nil, err
+			}
+			if condition != nil {
+				conditions = append(conditions, condition)
+			}
+		}
+		if len(conditions) == 0 {
+			return nil, nil
+		}
+
+		switch f.Operator {
+		case engine.And, engine.If:
+			return sq.And(conditions), nil
+		case engine.Or:
+			minimum, err := engine.MinimumShouldMatch(f.MinimumShouldMatch, len(conditions))
+			if err != nil {
+				return nil, err
+			}
+			if minimum <= 0 {
+				return sq.Expr("TRUE"), nil
+			}
+			if minimum > 1 {
+				return minimumShouldMatch{conditions: conditions, minimum: minimum}, nil
+			}
+			return sq.Or(conditions), nil
+		case engine.Not:
+			return not{conditions: conditions}, nil
+		}
+		return nil, errors.New("Invalid filter kind: " + f.Operator.String())
+
+	case *engine.NestedFragment:
+		return nil, errors.New("Invalid filter kind: " + f.Operator.String())
+
+	case *engine.LeafConditionFragment:
+		column := quoteIdentifier(f.Field)
+		switch f.Operator {
+		case engine.Exists:
+			return sq.Expr(column + " IS NOT NULL"), nil
+
+		case engine.For:
+			return sq.Eq{column: f.Value}, nil
+		case engine.OptionalFor:
+			if f.Field == "" || engine.IsEmptyValue(f.Value) {
+				return nil, nil
+			}
+			return sq.Eq{column: f.Value}, nil
+
+		case engine.From:
+			return sqlRange(column, f.Value, nil, ti, f.TimeZone), nil
+		case engine.To:
+			return sqlRange(column, nil, f.Value, ti, f.TimeZone), nil
+		case engine.Between:
+			return sqlRange(column, f.Value, f.Value2, ti, f.TimeZone), nil
+
+		case engine.Regexp, engine.OptionalRegexp:
+			if f.Operator == engine.OptionalRegexp && (f.Field == "" || f.Value == "") {
+				return nil, nil
+			}
+			value, ok := f.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid regexp value %v", f.Value)
+			}
+			// elasticsearch regular expressions are always anchored
+			return sq.Expr(column+" ~ ?", "^(?:"+value+")$"), nil
+
+		case engine.Wildcard, engine.OptionalWildcard:
+			if f.Operator == engine.OptionalWildcard && (f.Field == "" || f.Value == "") {
+				return nil, nil
+			}
+			value, ok := f.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid wildcard value %v", f.Value)
+			}
+			return sq.Expr(column+" LIKE ?", wildcardToLike(value)), nil
+
+		default:
+			return nil, errors.New("Invalid filter kind: " + f.Operator.String())
+		}
+	}
+	return nil, fmt.Errorf("unsupported condition fragment %T", fragment)
+}
+
+// sqlRange builds a gte / lt range, the string bounds being parsed as absolute dates or date math expressions
+func sqlRange(column string, from interface{}, to interface{}, ti time.Time, timeZone string) sq.Sqlizer {
+	conditions := sq.And{}
+	if from != nil {
+		conditions = append(conditions, sq.GtOrEq{column: sqlDateValue(from, ti, timeZone)})
+	}
+	if to != nil {
+		conditions = append(conditions, sq.Lt{column: sqlDateValue(to, ti, timeZone)})
+	}
+	return conditions
+}
+
+// sqlDateValue converts a date string to a time, other values (and non date strings) are returned as is
+func sqlDateValue(value interface{}, ti time.Time, timeZone string) interface{} {
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return value
+	}
+	t, err := engine.ParseDateMath(s, ti, timeZone)
+	if err != nil {
+		return value
+	}
+	return t
+}
+
+func sqlNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// wildcardToLike converts an elasticsearch wildcard pattern (* and ?) to a LIKE pattern
+func wildcardToLike(pattern string) string {
+	var builder strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			builder.WriteRune('%')
+		case '?':
+			builder.WriteRune('_')
+		case '%', '_', '\\':
+			builder.WriteRune('\\')
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+// not matches when none of its conditions is true
+// A NULL condition is not true, so the rows without the column are kept like the elasticsearch must_not keeps
+// the documents without the field
+type not struct {
+	conditions []sq.Sqlizer
+}
+
+func (n not) ToSql() (string, []interface{}, error) {
+	parts := make([]string, 0, len(n.conditions))
+	args := make([]interface{}, 0)
+	for _, condition := range n.conditions {
+		sql, conditionArgs, err := condition.ToSql()
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+		args = append(args, conditionArgs...)
+	}
+	return "(" + strings.Join(parts, " OR ") + ") IS NOT TRUE", args, nil
+}
+
+// minimumShouldMatch matches when at least a minimum number of its conditions match
+type minimumShouldMatch struct {
+	conditions []sq.Sqlizer
+	minimum    int
+}
+
+func (m minimumShouldMatch) ToSql() (string, []interface{}, error) {
+	parts := make([]string, 0, len(m.conditions))
+	args := make([]interface{}, 0)
+	for _, condition := range m.conditions {
+		sql, conditionArgs, err := condition.ToSql()
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, "CASE WHEN "+sql+" THEN 1 ELSE 0 END")
+		args = append(args, conditionArgs...)
+	}
+	return "(" + strings.Join(parts, " + ") + ") >= ?", append(args, m.minimum), nil
+}
@@ -0,0 +1,315 @@
+package postgres
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/myrteametrics/myrtea-sdk/v5/engine"
+)
+
+func TestConvertFactToSQL(t *testing.T) {
+	ti := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	f := engine.Fact{
+		Name:   "test",
+		Model:  "parcel",
+		Intent: &engine.IntentFragment{Name: "weight", Operator: engine.Sum, Term: "weight"},
+		Dimensions: []*engine.DimensionFragment{
+			{Name: "customer", Operator: engine.By, Term: "customer", Missing: "none", OrderBy: "_count"},
+			{Name: "day", Operator: engine.DateHistogram, Term: "date", DateInterval: "day", TimeZone: "Europe/Paris"},
+		},
+		Condition: &engine.BooleanFragment{
+			Operator: engine.And,
+			Fragments: []engine.ConditionFragment{
+				&engine.LeafConditionFragment{Operator: engine.For, Field: "status", Value: []interface{}{"delivered", "lost"}},
+				&engine.LeafConditionFragment{Operator: engine.Between, Field: "date", Value: "now-1d/d", Value2: "now/d"},
+				&engine.LeafConditionFragment{Operator: engine.OptionalFor, Field: "carrier", Value: ""},
+				&engine.BooleanFragment{
+					Operator: engine.Not,
+					Fragments: []engine.ConditionFragment{
+						&engine.LeafConditionFragment{Operator: engine.Wildcard, Field: "sender.name", Value: "test_*"},
+					},
+				},
+			},
+		},
+	}
+
+	query, args, err := ConvertFactToSQL(f, ti, "parcels", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedQuery := `SELECT COALESCE("customer"::text, $1) AS "customer", date_trunc('day', "date", $2) AS "day", COALESCE(SUM("weight"), 0) AS "weight", COUNT(*) AS "doc_count" ` +
+		`FROM "parcels" WHERE ("status" IN ($3,$4) AND ("date" >= $5 AND "date" < $6) AND ("sender"."name" LIKE $7) IS NOT TRUE) AND "date" IS NOT NULL ` +
+		`GROUP BY 1, 2 ORDER BY "doc_count" DESC, 2 ASC`
+	if query != expectedQuery {
+		t.Errorf("invalid query\nexpected: %s\nactual:   %s", expectedQuery, query)
+	}
+	expectedArgs := []interface{}{
+		"none", "Europe/Paris", "delivered", "lost",
+		time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		`test\_%`,
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("invalid args\nexpected: %v\nactual:   %v", expectedArgs, args)
+	}
+}
+
+func TestConvertFactToSQLSelect(t *testing.T) {
+	f := engine.Fact{
+		Intent:    &engine.IntentFragment{Operator: engine.Select, Term: "parcel"},
+		Condition: &engine.LeafConditionFragment{Operator: engine.Regexp, Field: "code", Value: "ab.*"},
+		Sort:      []types.SortCombinations{map[string]interface{}{"date": map[string]interface{}{"order": "desc"}}},
+	}
+	query, args, err := ConvertFactToSQL(f, time.Now(), "public.parcels", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedQuery := `SELECT * FROM "public"."parcels" WHERE "code" ~ $1 ORDER BY "date" DESC NULLS LAST LIMIT 10`
+	if query != expectedQuery {
+		t.Errorf("invalid query\nexpected: %s\nactual:   %s", expectedQuery, query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"^(?:ab.*)$"}) {
+		t.Errorf("invalid args %v", args)
+	}
+}
+
+func TestConvertFactToSQLRanges(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Operator: engine.Percentiles, Term: "weight", Percents: []float64{50, 99.9}},
+		Dimensions: []*engine.DimensionFragment{
+			{Operator: engine.Range, Term: "weight", Ranges: []engine.DimensionRange{{To: 3}, {From: 3, Key: "heavy"}}},
+			{Operator: engine.Histogram, Term: "volume", Interval: 10},
+		},
+		Condition: &engine.BooleanFragment{
+			Operator:           engine.Or,
+			MinimumShouldMatch: 2,
+			Fragments: []engine.ConditionFragment{
+				&engine.LeafConditionFragment{Operator: engine.Exists, Field: "a"},
+				&engine.LeafConditionFragment{Operator: engine.From, Field: "b", Value: 5},
+				&engine.LeafConditionFragment{Operator: engine.For, Field: "c", Value: true},
+			},
+		},
+	}
+	query, args, err := ConvertFactToSQL(f, time.Now(), "parcels", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedQuery := `SELECT CASE WHEN "weight" < $1 THEN $2 WHEN "weight" >= $3 THEN $4 END AS "range_weight", floor("volume" / $5) * $6 AS "histogram_volume", ` +
+		`percentile_cont(ARRAY[0.5,0.999]::float8[]) WITHIN GROUP (ORDER BY "weight") AS "percentiles_weight", COUNT(*) AS "doc_count" ` +
+		`FROM "parcels" WHERE (CASE WHEN "a" IS NOT NULL THEN 1 ELSE 0 END + CASE WHEN ("b" >= $7) THEN 1 ELSE 0 END + CASE WHEN "c" = $8 THEN 1 ELSE 0 END) >= $9 AND "weight" IS NOT NULL AND "volume" IS NOT NULL ` +
+		`GROUP BY 1, 2 ORDER BY 1 ASC, 2 ASC`
+	if query != expectedQuery {
+		t.Errorf("invalid query\nexpected: %s\nactual:   %s", expectedQuery, query)
+	}
+	expectedArgs := []interface{}{3, "*-3.0", 3, "heavy", 10.0, 10.0, 5, true, 2}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("invalid args\nexpected: %v\nactual:   %v", expectedArgs, args)
+	}
+}
+
+func TestConvertFactToSQLMinimumShouldMatch(t *testing.T) {
+	values := []struct {
+		minimum  interface{}
+		expected string
+		arg      interface{}
+	}{
+		{"-1", `(CASE WHEN "a" IS NOT NULL THEN 1 ELSE 0 END + CASE WHEN "b" IS NOT NULL THEN 1 ELSE 0 END + CASE WHEN "c" IS NOT NULL THEN 1 ELSE 0 END) >= $1`, 2},
+		{"75%", `(CASE WHEN "a" IS NOT NULL THEN 1 ELSE 0 END + CASE WHEN "b" IS NOT NULL THEN 1 ELSE 0 END + CASE WHEN "c" IS NOT NULL THEN 1 ELSE 0 END) >= $1`, 2},
+		{"-75%", `("a" IS NOT NULL OR "b" IS NOT NULL OR "c" IS NOT NULL)`, nil},
+		{"-100%", `TRUE`, nil},
+	}
+	for _, v := range values {
+		f := engine.Fact{
+			Intent: &engine.IntentFragment{Operator: engine.Count, Term: "id"},
+			Condition: &engine.BooleanFragment{
+				Operator:           engine.Or,
+				MinimumShouldMatch: v.minimum,
+				Fragments: []engine.ConditionFragment{
+					&engine.LeafConditionFragment{Operator: engine.Exists, Field: "a"},
+					&engine.LeafConditionFragment{Operator: engine.Exists, Field: "b"},
+					&engine.LeafConditionFragment{Operator: engine.Exists, Field: "c"},
+				},
+			},
+		}
+		query, args, err := ConvertFactToSQL(f, time.Now(), "parcels", nil)
+		if err != nil {
+			t.Fatalf("%v: %s", v.minimum, err)
+		}
+		expectedQuery := `SELECT COUNT(DISTINCT "id") AS "count_id", COUNT(*) AS "doc_count" FROM "parcels" WHERE ` + v.expected
+		if query != expectedQuery {
+			t.Errorf("%v: invalid query\nexpected: %s\nactual:   %s", v.minimum, expectedQuery, query)
+		}
+		if v.arg != nil && (len(args) != 1 || args[0] != v.arg) {
+			t.Errorf("%v: invalid args %v", v.minimum, args)
+		}
+	}
+}
+
+func TestConvertFactToSQLMissing(t *testing.T) {
+	f := engine.Fact{
+		Intent:     &engine.IntentFragment{Operator: engine.Count, Term: "id"},
+		Dimensions: []*engine.DimensionFragment{{Name: "carrier", Operator: engine.By, Term: "carrier"}},
+	}
+	query, _, err := ConvertFactToSQL(f, time.Now(), "parcels", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// like the elasticsearch terms aggregation, the rows without carrier are not grouped
+	expectedQuery := `SELECT "carrier" AS "carrier", COUNT(DISTINCT "id") AS "count_id", COUNT(*) AS "doc_count" ` +
+		`FROM "parcels" WHERE "carrier" IS NOT NULL GROUP BY 1 ORDER BY 1 ASC`
+	if query != expectedQuery {
+		t.Errorf("invalid query\nexpected: %s\nactual:   %s", expectedQuery, query)
+	}
+
+	f.Dimensions[0].Missing = "none"
+	query, args, err := ConvertFactToSQL(f, time.Now(), "parcels", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedQuery = `SELECT COALESCE("carrier"::text, $1) AS "carrier", COUNT(DISTINCT "id") AS "count_id", COUNT(*) AS "doc_count" ` +
+		`FROM "parcels" GROUP BY 1 ORDER BY 1 ASC`
+	if query != expectedQuery || !reflect.DeepEqual(args, []interface{}{"none"}) {
+		t.Errorf("invalid query\nexpected: %s\nactual:   %s (%v)", expectedQuery, query, args)
+	}
+}
+
+func TestConvertFactToSQLOrder(t *testing.T) {
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Operator: engine.ExtendedStats, Term: "weight"},
+		Dimensions: []*engine.DimensionFragment{
+			{Operator: engine.By, Term: "customer", OrderBy: "extendedstats_weight.max", OrderDirection: "asc"},
+		},
+	}
+	query, _, err := ConvertFactToSQL(f, time.Now(), "parcels", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedQuery := `ORDER BY "extendedstats_weight.max" ASC`
+	if !strings.HasSuffix(query, expectedQuery) {
+		t.Errorf("invalid query\nexpected suffix: %s\nactual:   %s", expectedQuery, query)
+	}
+
+	f.Dimensions[0].OrderBy = "weight"
+	if _, _, err := ConvertFactToSQL(f, time.Now(), "parcels", nil); err == nil || err.Error() != "unknown order column weight" {
+		t.Errorf("expected an unknown order column error, got %v", err)
+	}
+}
+
+func TestConvertFactToSQLDefaultCalendarInterval(t *testing.T) {
+	f := engine.Fact{
+		Intent:     &engine.IntentFragment{Operator: engine.Count, Term: "id"},
+		Dimensions: []*engine.DimensionFragment{{Name: "date", Operator: engine.DateHistogram, Term: "date"}},
+	}
+	query, _, err := ConvertFactToSQL(f, time.Now(), "parcels", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedQuery := `SELECT date_trunc('month', "date") AS "date",`
+	if !strings.HasPrefix(query, expectedQuery) {
+		t.Errorf("invalid query\nexpected prefix: %s\nactual:   %s", expectedQuery, query)
+	}
+}
+
+func TestConvertFactToSQLMinDocCount(t *testing.T) {
+	minDocCount := 5
+	f := engine.Fact{
+		Intent: &engine.IntentFragment{Operator: engine.Count, Term: "parcel"},
+		Dimensions: []*engine.DimensionFragment{
+			{Operator: engine.By, Term: "customer"},
+			{Operator: engine.By, Term: "carrier", MinDocCount: &minDocCount},
+		},
+	}
+	query, args, err := ConvertFactToSQL(f, time.Now(), "parcels", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedQuery := `SELECT "customer" AS "by_customer", "carrier" AS "by_carrier", COUNT(DISTINCT "parcel") AS "count_parcel", COUNT(*) AS "doc_count" ` +
+		`FROM "parcels" WHERE "customer" IS NOT NULL AND "carrier" IS NOT NULL GROUP BY 1, 2 HAVING COUNT(*) >= $1 ORDER BY 1 ASC, 2 ASC`
+	if query != expectedQuery {
+		t.Errorf("invalid query\nexpected: %s\nactual:   %s", expectedQuery, query)
+	}
+	if !reflect.DeepEqual(args, []interface{}{5}) {
+		t.Errorf("invalid args %v", args)
+	}
+
+	// the outer buckets count the documents of every inner bucket, which a SQL group can not
+	f.Dimensions[0].MinDocCount, f.Dimensions[1].MinDocCount = &minDocCount, nil
+	if _, _, err := ConvertFactToSQL(f, time.Now(), "parcels", nil); err == nil {
+		t.Error("expected an error on a minDocCount of an outer dimension")
+	}
+}
+
+func TestConvertFactToSQLUnsupported(t *testing.T) {
+	facts := map[string]engine.Fact{
+		"Invalid intent kind: delete": {
+			Intent: &engine.IntentFragment{Operator: engine.Delete, Term: "parcel"},
+		},
+		"Invalid dimension kind: geohashgrid": {
+			Intent:     &engine.IntentFragment{Operator: engine.Count, Term: "parcel"},
+			Dimensions: []*engine.DimensionFragment{{Operator: engine.GeoHashGrid, Term: "location"}},
+		},
+		"Invalid filter kind: script": {
+			Intent:    &engine.IntentFragment{Operator: engine.Count, Term: "parcel"},
+			Condition: &engine.LeafConditionFragment{Operator: engine.Script, Value: "doc['a'].value > 1"},
+		},
+		"Invalid filter kind: nested": {
+			Intent: &engine.IntentFragment{Operator: engine.Count, Term: "parcel"},
+			Condition: &engine.NestedFragment{Operator: engine.Nested, Path: "items",
+				Fragment: &engine.LeafConditionFragment{Operator: engine.Exists, Field: "items.id"}},
+		},
+	}
+	for expected, f := range facts {
+		_, _, err := ConvertFactToSQL(f, time.Now(), "parcels", nil)
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected error %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestConvertFactToSQLNotNull(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping postgresql test in short mode")
+	}
+	db, err := DbConnection(Credentials{URL: "localhost", Port: "5432", DbName: "postgres", User: "postgres", Password: "postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`CREATE TEMPORARY TABLE parcels_not_null (id integer, status text) ON COMMIT DROP`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO parcels_not_null VALUES (1, 'lost'), (2, 'delivered'), (3, NULL)`); err != nil {
+		t.Fatal(err)
+	}
+
+	f := engine.Fact{
+		Name:   "test",
+		Model:  "parcel",
+		Intent: &engine.IntentFragment{Name: "parcels", Operator: engine.Count, Term: "id"},
+		Condition: &engine.BooleanFragment{
+			Operator: engine.Not,
+			Fragments: []engine.ConditionFragment{
+				&engine.LeafConditionFragment{Operator: engine.For, Field: "status", Value: "lost"},
+			},
+		},
+	}
+	query, args, err := ConvertFactToSQL(f, time.Now(), "parcels_not_null", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count, docCount int64
+	if err := tx.QueryRow(query, args...).Scan(&count, &docCount); err != nil {
+		t.Fatal(err)
+	}
+	// like an elasticsearch must_not, the row without status is kept
+	if count != 2 || docCount != 2 {
+		t.Errorf("expected 2 rows, got %d (doc count %d) with query %s", count, docCount, query)
+	}
+}
@@ -139,6 +139,8 @@ func NewChiRouterSimple(config ConfigSimple) *chi.Mux {
 			rg.Use(middleware.SetHeader("Content-Type", "application/json"))
 
 			rg.HandleFunc("/log_level", config.LogLevel.ServeHTTP)
+			rg.Get("/engine/facts/schema", handlers.GetFactJSONSchema)
+			rg.Get("/engine/facts/schema/openapi", handlers.GetFactOpenAPIComponents)
 
 			for path, handler := range config.ProtectedRoutes {
 				rg.Mount(path, handler)
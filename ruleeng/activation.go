@@ -0,0 +1,114 @@
+package ruleeng
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/calendar"
+	"github.com/robfig/cron/v3"
+)
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Activation defines when an enabled rule or case is active
+// * From and Until bound its validity window (Until excluded)
+// * Cron and Duration define a recurring activation: it is active during Duration after each fire of the cron
+// schedule (the schedule is evaluated in the location of the evaluation time, unless prefixed with CRON_TZ=)
+// * Calendar restricts its activation to the open days of a named calendar (see calendar.GetCalendar)
+type Activation struct {
+	From     *time.Time `json:"from,omitempty"`
+	Until    *time.Time `json:"until,omitempty"`
+	Cron     string     `json:"cron,omitempty"`
+	Duration string     `json:"duration,omitempty"`
+	Calendar string     `json:"calendar,omitempty"`
+}
+
+// Inactivity reports a rule, or a case of a rule, skipped because it was not active at the evaluation time
+type Inactivity struct {
+	RuleID int64  `json:"ruleId"`
+	Case   string `json:"case,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// IsValid checks if an activation is valid
+func (a Activation) IsValid() (bool, error) {
+	if a.From != nil && a.Until != nil && !a.From.Before(*a.Until) {
+		return false, errors.New("activation from must be before until")
+	}
+	if a.Cron == "" && a.Duration != "" {
+		return false, errors.New("activation duration requires a cron")
+	}
+	if a.Cron != "" {
+		if _, err := cronParser.Parse(a.Cron); err != nil {
+			return false, fmt.Errorf("invalid activation cron: %w", err)
+		}
+		if a.Duration == "" {
+			return false, errors.New("missing activation duration")
+		}
+		duration, err := time.ParseDuration(a.Duration)
+		if err != nil {
+			return false, fmt.Errorf("invalid activation duration: %w", err)
+		}
+		if duration <= 0 {
+			return false, fmt.Errorf("activation duration must be positive, got %s", a.Duration)
+		}
+	}
+	return true, nil
+}
+
+// IsActive returns true if the activation is active at a time, or the reason why it is not
+func (a Activation) IsActive(t time.Time) (bool, string) {
+	if a.From != nil && t.Before(*a.From) {
+		return false, "not valid before " + a.From.Format(time.RFC3339)
+	}
+	if a.Until != nil && !t.Before(*a.Until) {
+		return false, "not valid since " + a.Until.Format(time.RFC3339)
+	}
+	if a.Cron != "" {
+		active, err := a.isCronActive(t)
+		if err != nil {
+			return false, "invalid cron schedule: " + err.Error()
+		}
+		if !active {
+			return false, fmt.Sprintf("outside of the cron schedule %q for %s", a.Cron, a.Duration)
+		}
+	}
+	if a.Calendar != "" {
+		c, found := calendar.GetCalendar(a.Calendar)
+		if !found {
+			return false, fmt.Sprintf("calendar %q not found", a.Calendar)
+		}
+		if !calendar.IsOpenDay(c, t) {
+			return false, fmt.Sprintf("closed day in calendar %q", a.Calendar)
+		}
+	}
+	return true, ""
+}
+
+// isCronActive returns true if t is in [lastFire, lastFire + duration), lastFire being the last cron fire at or before t
+// which is true if the first fire after t - duration is at or before t (the fires in the duration are not enumerated)
+func (a Activation) isCronActive(t time.Time) (bool, error) {
+	schedule, err := cronParser.Parse(a.Cron)
+	if err != nil {
+		return false, err
+	}
+	duration, err := time.ParseDuration(a.Duration)
+	if err != nil {
+		return false, err
+	}
+	if duration <= 0 {
+		return false, fmt.Errorf("duration must be positive, got %s", a.Duration)
+	}
+
+	next := schedule.Next(t.Add(-duration))
+	return !next.IsZero() && !next.After(t), nil
+}
+
+// isActive returns true if an optional activation is active at a time, or the reason why it is not
+func isActive(a *Activation, t time.Time) (bool, string) {
+	if a == nil {
+		return true, ""
+	}
+	return a.IsActive(t)
+}
@@ -0,0 +1,129 @@
+package ruleeng
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestActivationIsValid(t *testing.T) {
+	from := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name       string
+		activation Activation
+		valid      bool
+	}{
+		{"empty", Activation{}, true},
+		{"window", Activation{From: &from, Until: &until}, true},
+		{"cron", Activation{Cron: "0 8 * * 1-5", Duration: "10h", Calendar: "default-fr"}, true},
+		{"cron with timezone", Activation{Cron: "CRON_TZ=Europe/Paris 0 8 * * *", Duration: "1h"}, true},
+		{"inverted window", Activation{From: &until, Until: &from}, false},
+		{"invalid cron", Activation{Cron: "0 8 * *", Duration: "1h"}, false},
+		{"missing duration", Activation{Cron: "0 8 * * *"}, false},
+		{"invalid duration", Activation{Cron: "0 8 * * *", Duration: "1 hour"}, false},
+		{"negative duration", Activation{Cron: "0 8 * * *", Duration: "-1h"}, false},
+		{"duration without cron", Activation{Duration: "1h"}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if ok, err := tc.activation.IsValid(); ok != tc.valid {
+				t.Errorf("IsValid() returned %t (%v), expected %t", ok, err, tc.valid)
+			}
+		})
+	}
+}
+
+func TestActivationIsActive(t *testing.T) {
+	activation := Activation{
+		From:     timePtr(time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)),
+		Until:    timePtr(time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)),
+		Cron:     "0 8 * * *",
+		Duration: "10h",
+		Calendar: "default-fr",
+	}
+
+	testCases := []struct {
+		name   string
+		time   time.Time
+		active bool
+		reason string
+	}{
+		{"active", time.Date(2024, 12, 2, 9, 0, 0, 0, time.UTC), true, ""},
+		{"cron fire", time.Date(2024, 12, 2, 8, 0, 0, 0, time.UTC), true, ""},
+		{"before window", time.Date(2024, 10, 31, 9, 0, 0, 0, time.UTC), false, "not valid before 2024-11-01T00:00:00Z"},
+		{"after window", time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC), false, "not valid since 2025-01-15T00:00:00Z"},
+		{"before cron", time.Date(2024, 12, 2, 7, 59, 0, 0, time.UTC), false, `outside of the cron schedule "0 8 * * *" for 10h`},
+		{"after cron duration", time.Date(2024, 12, 2, 18, 0, 0, 0, time.UTC), false, `outside of the cron schedule "0 8 * * *" for 10h`},
+		{"closed day", time.Date(2024, 12, 25, 9, 0, 0, 0, time.UTC), false, `closed day in calendar "default-fr"`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			active, reason := activation.IsActive(tc.time)
+			if active != tc.active || reason != tc.reason {
+				t.Errorf("IsActive() returned (%t, %q), expected (%t, %q)", active, reason, tc.active, tc.reason)
+			}
+		})
+	}
+
+	if active, reason := (Activation{Calendar: "unknown"}).IsActive(time.Now()); active || reason != `calendar "unknown" not found` {
+		t.Errorf("IsActive() returned (%t, %q) on an unknown calendar", active, reason)
+	}
+
+	// the fires of a frequent schedule over a long duration are not enumerated
+	frequent := Activation{Cron: "* * * * *", Duration: "87600h"}
+	if active, reason := frequent.IsActive(time.Date(2024, 12, 2, 9, 0, 30, 0, time.UTC)); !active {
+		t.Errorf("IsActive() returned (%t, %q) on a frequent schedule", active, reason)
+	}
+}
+
+func TestRuleEngineActivation(t *testing.T) {
+	rule := &DefaultRule{
+		ID:               1,
+		EvaluateAllCases: true,
+		Activation:       &Activation{Until: timePtr(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))},
+		Cases: []Case{
+			{Name: "always", Condition: "true", Enabled: true, Actions: []ActionDef{{Name: `"always"`, Enabled: true}}},
+			{Name: "office", Condition: "true", Enabled: true, Activation: &Activation{Cron: "0 8 * * 1-5", Duration: "10h"},
+				Actions: []ActionDef{{Name: `"office"`, Enabled: true}}},
+		},
+	}
+
+	engine := NewRuleEngine()
+	engine.SetExplain(true)
+	engine.InsertRule(rule)
+
+	engine.SetTime(time.Date(2024, 12, 2, 9, 0, 0, 0, time.UTC))
+	engine.ExecuteAllRules()
+	if len(engine.GetResults()) != 2 || len(engine.GetInactive()) != 0 {
+		t.Errorf("unexpected results %+v, inactive %+v", engine.GetResults(), engine.GetInactive())
+	}
+
+	engine.SetTime(time.Date(2024, 12, 2, 20, 0, 0, 0, time.UTC))
+	engine.ExecuteAllRules()
+	if len(engine.GetResults()) != 1 || engine.GetResults()[0].GetName() != "always" {
+		t.Errorf("the inactive case should be skipped %+v", engine.GetResults())
+	}
+	expected := []Inactivity{{RuleID: 1, Case: "office", Reason: `outside of the cron schedule "0 8 * * 1-5" for 10h`}}
+	if !reflect.DeepEqual(engine.GetInactive(), expected) {
+		t.Errorf("invalid inactive %+v, expected %+v", engine.GetInactive(), expected)
+	}
+	if c := engine.GetTrace()[0].Cases[1]; c.Inactive != expected[0].Reason || c.Evaluated {
+		t.Errorf("unexpected case trace %+v", c)
+	}
+
+	engine.SetTime(time.Date(2025, 1, 2, 9, 0, 0, 0, time.UTC))
+	engine.ExecuteAllRules()
+	expected = []Inactivity{{RuleID: 1, Reason: "not valid since 2025-01-01T00:00:00Z"}}
+	if len(engine.GetResults()) != 0 || !reflect.DeepEqual(engine.GetInactive(), expected) {
+		t.Errorf("the inactive rule should be skipped %+v, inactive %+v", engine.GetResults(), engine.GetInactive())
+	}
+	if trace := engine.GetTrace()[0]; trace.Inactive != expected[0].Reason {
+		t.Errorf("unexpected rule trace %+v", trace)
+	}
+}
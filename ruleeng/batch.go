@@ -0,0 +1,206 @@
+package ruleeng
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EntityKnowledge is the knowledge base of an entity (a site for example), identified by its key
+// A DefaultKnowledgeBase is cloned by each execution, so it can be shared by several entities. Other
+// implementations must not be shared, as the rules executions modify them
+type EntityKnowledge struct {
+	Key       string
+	Knowledge KnowledgeBase
+}
+
+// KnowledgeIterator iterates over the knowledge bases of the entities of a batch
+type KnowledgeIterator interface {
+	// Next moves to the next entity, and returns false when every entity has been read or if an error occurred
+	Next(ctx context.Context) bool
+	// Item returns the current entity
+	Item() EntityKnowledge
+	// Err returns the error which stopped the iteration, if any
+	Err() error
+}
+
+// SliceKnowledgeIterator is a KnowledgeIterator over a slice of entities
+type SliceKnowledgeIterator struct {
+	items []EntityKnowledge
+	index int
+}
+
+// NewSliceKnowledgeIterator returns an iterator over a slice of entities
+func NewSliceKnowledgeIterator(items []EntityKnowledge) *SliceKnowledgeIterator {
+	return &SliceKnowledgeIterator{items: items, index: -1}
+}
+
+// Next moves to the next entity, and returns false when every entity has been read
+func (it *SliceKnowledgeIterator) Next(ctx context.Context) bool {
+	if it.index+1 >= len(it.items) {
+		return false
+	}
+	it.index++
+	return true
+}
+
+// Item returns the current entity
+func (it *SliceKnowledgeIterator) Item() EntityKnowledge {
+	return it.items[it.index]
+}
+
+// Err always returns nil
+func (it *SliceKnowledgeIterator) Err() error {
+	return nil
+}
+
+// BatchOptions defines the execution of a batch
+// * Workers is the number of entities evaluated concurrently (default to GOMAXPROCS)
+// * RuleIDs restricts the executed rules (every rule of the rule base by default)
+// * Time is the evaluation time of the rules (default to the time of each execution)
+// * Store keeps the states of the stateful cases, scoped by entity key (in-process with DefaultStateTTL by default)
+// * Explain and ConflictStrategy are the explain mode and conflict strategy of the executions
+type BatchOptions struct {
+	Workers          int
+	RuleIDs          []int64
+	Time             time.Time
+	Store            StateStore
+	Explain          bool
+	ConflictStrategy ConflictStrategy
+}
+
+// BatchResult is the result of the execution of the rules on the knowledge base of an entity
+// A result with an empty Key and an Error reports the error which stopped the iteration over the entities
+type BatchResult struct {
+	Key      string       `json:"key"`
+	Actions  []Action     `json:"actions"`
+	Inactive []Inactivity `json:"inactive,omitempty"`
+	Trace    []RuleTrace  `json:"trace,omitempty"`
+	Error    error        `json:"-"`
+}
+
+// MarshalJSON marshals a batch result, with its error message as an "error" field
+func (result BatchResult) MarshalJSON() ([]byte, error) {
+	type batchResult BatchResult
+	var message string
+	if result.Error != nil {
+		message = result.Error.Error()
+	}
+	return json.Marshal(struct {
+		batchResult
+		Error string `json:"error,omitempty"`
+	}{batchResult: batchResult(result), Error: message})
+}
+
+// BatchExecutor executes the rules of a rule base on the knowledge bases of many entities, on a bounded worker pool
+// The rule base must not be modified during an execution
+type BatchExecutor struct {
+	rules   RuleBase
+	options BatchOptions
+}
+
+// NewBatchExecutor returns a new batch executor of the rules of a rule base
+func NewBatchExecutor(rules RuleBase, options BatchOptions) (*BatchExecutor, error) {
+	if ok, err := options.ConflictStrategy.IsValid(); !ok {
+		return nil, err
+	}
+	if options.Workers <= 0 {
+		options.Workers = runtime.GOMAXPROCS(0)
+	}
+	if options.Store == nil {
+		options.Store = NewMemoryStateStore(DefaultStateTTL)
+	}
+	return &BatchExecutor{rules: rules, options: options}, nil
+}
+
+// Execute executes the rules on every entity of the iterator, and streams their results in completion order
+// The results channel is closed once every entity has been executed, or when ctx is cancelled.
+// The iterator is only read by a single goroutine, and the executions only modify their own copy of a DefaultKnowledgeBase
+func (b *BatchExecutor) Execute(ctx context.Context, it KnowledgeIterator) <-chan BatchResult {
+	items := make(chan EntityKnowledge)
+	results := make(chan BatchResult, b.options.Workers)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(items)
+		for it.Next(ctx) {
+			select {
+			case items <- it.Item():
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			zap.L().Warn("BatchExecutor knowledge iterator", zap.Error(err))
+			select {
+			case results <- BatchResult{Error: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	for i := 0; i < b.options.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				if ctx.Err() != nil {
+					continue
+				}
+				select {
+				case results <- b.execute(item):
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// execute executes the rules on the knowledge base of an entity with a dedicated rule engine
+// A panic of a rule execution is reported as the entity result error
+func (b *BatchExecutor) execute(item EntityKnowledge) (result BatchResult) {
+	result.Key = item.Key
+	defer func() {
+		if r := recover(); r != nil {
+			zap.L().Error("BatchExecutor rule execution panic", zap.String("key", item.Key), zap.Any("panic", r))
+			result.Actions = nil
+			result.Error = fmt.Errorf("rule execution panic: %v", r)
+		}
+	}()
+
+	knowledge := item.Knowledge
+	if k, ok := knowledge.(*DefaultKnowledgeBase); ok {
+		knowledge = k.clone()
+	}
+	engine := newRuleEngine(b.rules, knowledge, b.options.Store)
+	engine.SetStateScope(item.Key)
+	engine.SetTime(b.options.Time)
+	engine.SetExplain(b.options.Explain)
+	engine.strategy = b.options.ConflictStrategy
+
+	if b.options.RuleIDs != nil {
+		engine.ExecuteRules(b.options.RuleIDs)
+	} else {
+		engine.ExecuteAllRules()
+	}
+
+	result.Actions = engine.GetResults()
+	result.Inactive = engine.GetInactive()
+	if b.options.Explain {
+		result.Trace = engine.GetTrace()
+	}
+	return result
+}
@@ -0,0 +1,208 @@
+package ruleeng
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func batchRules() RuleBase {
+	rules := NewRBase()
+	rules.InsertRule(&DefaultRule{
+		ID: 1,
+		Cases: []Case{{
+			Name:      "high",
+			Condition: "kpi > 50",
+			Enabled:   true,
+			Actions: []ActionDef{
+				{Name: `"set"`, Enabled: true, Parameters: map[string]Expression{"level": `"high"`}},
+				{Name: `"notify"`, Enabled: true, Parameters: map[string]Expression{"site": "site", "level": "level"}},
+			},
+		}},
+	})
+	rules.InsertRule(&DefaultRule{
+		ID:    2,
+		Cases: []Case{{Name: "consecutive", Condition: "true", Enabled: true, State: &StateConfig{Consecutive: 2}, Actions: []ActionDef{{Name: `"consecutive"`, Enabled: true}}}},
+	})
+	return rules
+}
+
+func batchEntities(count int) []EntityKnowledge {
+	entities := make([]EntityKnowledge, 0, count)
+	for i := 0; i < count; i++ {
+		k := NewKBase()
+		k.SetFacts(map[string]interface{}{"site": fmt.Sprintf("site-%d", i), "kpi": float64(i % 100)})
+		entities = append(entities, EntityKnowledge{Key: fmt.Sprintf("site-%d", i), Knowledge: k})
+	}
+	return entities
+}
+
+func TestBatchExecutor(t *testing.T) {
+	executor, err := NewBatchExecutor(batchRules(), BatchOptions{Workers: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for run := 1; run <= 2; run++ {
+		entities := batchEntities(500)
+		results := make(map[string]BatchResult)
+		for result := range executor.Execute(context.Background(), NewSliceKnowledgeIterator(entities)) {
+			if result.Error != nil {
+				t.Fatalf("unexpected error %v", result.Error)
+			}
+			if _, ok := results[result.Key]; ok {
+				t.Fatalf("duplicated result for %s", result.Key)
+			}
+			results[result.Key] = result
+		}
+		if len(results) != len(entities) {
+			t.Fatalf("invalid number of results, expected %d, got %d", len(entities), len(results))
+		}
+
+		for i, entity := range entities {
+			result := results[entity.Key]
+			names := make(map[string]Action)
+			for _, action := range result.Actions {
+				names[action.GetName()] = action
+			}
+
+			// The stateful case fires from the second execution, its state being scoped by entity
+			if _, ok := names["consecutive"]; ok != (run == 2) {
+				t.Errorf("run %d, %s: unexpected consecutive action %t", run, entity.Key, ok)
+			}
+			notify, ok := names["notify"]
+			if ok != (i%100 > 50) {
+				t.Errorf("run %d, %s: unexpected notify action %t", run, entity.Key, ok)
+				continue
+			}
+			if ok && (notify.GetParameters()["site"] != entity.Key || notify.GetParameters()["level"] != "high") {
+				t.Errorf("run %d, %s: invalid notify parameters %v", run, entity.Key, notify.GetParameters())
+			}
+		}
+	}
+}
+
+func TestBatchExecutorSharedKnowledge(t *testing.T) {
+	executor, err := NewBatchExecutor(batchRules(), BatchOptions{Workers: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rules insert facts in the knowledge base (level), which is shared by every entity
+	k := NewKBase()
+	k.SetFacts(map[string]interface{}{"site": "shared", "kpi": float64(60)})
+	entities := make([]EntityKnowledge, 0, 200)
+	for i := 0; i < 200; i++ {
+		entities = append(entities, EntityKnowledge{Key: fmt.Sprintf("site-%d", i), Knowledge: k})
+	}
+
+	count := 0
+	for result := range executor.Execute(context.Background(), NewSliceKnowledgeIterator(entities)) {
+		if result.Error != nil {
+			t.Fatalf("unexpected error %v", result.Error)
+		}
+		count++
+		notified := false
+		for _, action := range result.Actions {
+			if action.GetName() == "notify" {
+				notified = action.GetParameters()["level"] == "high"
+			}
+		}
+		if !notified {
+			t.Errorf("%s: missing notify action %v", result.Key, result.Actions)
+		}
+	}
+	if count != len(entities) {
+		t.Errorf("invalid number of results, expected %d, got %d", len(entities), count)
+	}
+	if _, ok := k.GetFacts()["level"]; ok {
+		t.Error("the executions should not modify the shared knowledge base")
+	}
+}
+
+func TestBatchExecutorCancel(t *testing.T) {
+	executor, err := NewBatchExecutor(batchRules(), BatchOptions{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	count := 0
+	for range executor.Execute(ctx, NewSliceKnowledgeIterator(batchEntities(1000))) {
+		count++
+		if count == 10 {
+			cancel()
+		}
+	}
+	if count >= 1000 {
+		t.Errorf("the execution should stop on cancellation, got %d results", count)
+	}
+}
+
+type failingIterator struct {
+	*SliceKnowledgeIterator
+	err error
+}
+
+func (it *failingIterator) Next(ctx context.Context) bool {
+	if !it.SliceKnowledgeIterator.Next(ctx) {
+		it.err = errors.New("iterator failure")
+		return false
+	}
+	return true
+}
+
+func (it *failingIterator) Err() error {
+	return it.err
+}
+
+func TestBatchExecutorIteratorError(t *testing.T) {
+	executor, err := NewBatchExecutor(batchRules(), BatchOptions{Explain: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures, successes int
+	for result := range executor.Execute(context.Background(), &failingIterator{SliceKnowledgeIterator: NewSliceKnowledgeIterator(batchEntities(3))}) {
+		if result.Error != nil {
+			if result.Key != "" {
+				t.Errorf("unexpected entity error %s: %v", result.Key, result.Error)
+			}
+			failures++
+			continue
+		}
+		if len(result.Trace) != 2 {
+			t.Errorf("invalid number of traces, expected 2, got %d", len(result.Trace))
+		}
+		successes++
+	}
+	if failures != 1 || successes != 3 {
+		t.Errorf("unexpected results: %d failures, %d successes", failures, successes)
+	}
+
+	if _, err := NewBatchExecutor(batchRules(), BatchOptions{ConflictStrategy: "unknown"}); err == nil {
+		t.Error("expected an error on an unknown conflict strategy")
+	}
+}
+
+func TestBatchResultMarshalJSON(t *testing.T) {
+	b, err := json.Marshal(BatchResult{Key: "site-1", Error: errors.New("rule execution panic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"key":"site-1","actions":null,"error":"rule execution panic"}`
+	if string(b) != expected {
+		t.Errorf("invalid JSON\nexpected: %s\nactual:   %s", expected, b)
+	}
+
+	b, err = json.Marshal(BatchResult{Key: "site-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"key":"site-2","actions":null}`; string(b) != expected {
+		t.Errorf("invalid JSON\nexpected: %s\nactual:   %s", expected, b)
+	}
+}
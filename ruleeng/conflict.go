@@ -0,0 +1,149 @@
+package ruleeng
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ConflictStrategy resolves the conflicts between the actions with the same name emitted by several rules
+type ConflictStrategy string
+
+const (
+	// ConflictKeepAll keeps every action (default)
+	ConflictKeepAll ConflictStrategy = ""
+	// ConflictFirstWins keeps the first action in execution order
+	ConflictFirstWins ConflictStrategy = "first"
+	// ConflictHighestPriority keeps the action of the rule with the highest salience (the first one on a tie)
+	ConflictHighestPriority ConflictStrategy = "priority"
+	// ConflictMergeParameters merges the parameters of the actions in a single action, the parameters of the
+	// highest salience rules taking precedence
+	ConflictMergeParameters ConflictStrategy = "merge"
+)
+
+// ConflictStrategies lists the supported conflict strategies
+var ConflictStrategies = []ConflictStrategy{ConflictKeepAll, ConflictFirstWins, ConflictHighestPriority, ConflictMergeParameters}
+
+// IsValid checks if a conflict strategy is supported
+func (s ConflictStrategy) IsValid() (bool, error) {
+	for _, strategy := range ConflictStrategies {
+		if s == strategy {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("unsupported conflict strategy %q", string(s))
+}
+
+// PrioritizedRule is a rule with a salience, the rules are executed by decreasing salience (default to 0)
+// See DefaultRule for an example implementation.
+type PrioritizedRule interface {
+	Rule
+	GetSalience() int
+}
+
+// TerminalRule is a rule which can stop the execution of the rule base once it emitted actions
+// See DefaultRule for an example implementation.
+type TerminalRule interface {
+	Rule
+	IsTerminal() bool
+}
+
+func ruleSalience(rule Rule) int {
+	if r, ok := rule.(PrioritizedRule); ok {
+		return r.GetSalience()
+	}
+	return 0
+}
+
+func isTerminal(rule Rule) bool {
+	r, ok := rule.(TerminalRule)
+	return ok && r.IsTerminal()
+}
+
+// sortRules sorts rules by decreasing salience, keeping their order on a tie
+func sortRules(rules []Rule) {
+	sort.SliceStable(rules, func(i, j int) bool { return ruleSalience(rules[i]) > ruleSalience(rules[j]) })
+}
+
+// sortedRules returns the rules of a rule base by decreasing salience, then by id
+func sortedRules(rules map[int64]Rule) []Rule {
+	sorted := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		sorted = append(sorted, rule)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetID() < sorted[j].GetID() })
+	sortRules(sorted)
+	return sorted
+}
+
+// actionOrigin is the rule which emitted an action
+type actionOrigin struct {
+	ruleID   int64
+	salience int
+}
+
+// resolveConflicts applies a conflict strategy on actions in execution order, with the rule which emitted them
+// The conflicts are only resolved between different rules, the winning rule keeps all its actions with the name
+// The resolved actions keep the execution order of the winning actions
+func resolveConflicts(strategy ConflictStrategy, actions []Action, origins []actionOrigin) []Action {
+	if strategy == ConflictKeepAll {
+		return append(make([]Action, 0, len(actions)), actions...)
+	}
+
+	// winners are the index of the first action of the rule kept for each name
+	winners := make(map[string]int)
+	for i, action := range actions {
+		winner, ok := winners[action.GetName()]
+		if !ok || (strategy != ConflictFirstWins && origins[i].salience > origins[winner].salience) {
+			winners[action.GetName()] = i
+		}
+	}
+
+	resolved := make([]Action, 0, len(winners))
+	for i, action := range actions {
+		if origins[i].ruleID != origins[winners[action.GetName()]].ruleID {
+			continue
+		}
+		if strategy == ConflictMergeParameters {
+			action = mergeActions(i, actions, origins)
+		}
+		resolved = append(resolved, action)
+	}
+	return resolved
+}
+
+// mergeActions merges the parameters of the winner action with the actions with its name emitted by the other rules,
+// by decreasing salience
+func mergeActions(winner int, actions []Action, origins []actionOrigin) Action {
+	indexes := []int{winner}
+	for i, action := range actions {
+		if action.GetName() == actions[winner].GetName() && origins[i].ruleID != origins[winner].ruleID {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 1 {
+		return actions[winner]
+	}
+	sort.SliceStable(indexes[1:], func(i, j int) bool {
+		return origins[indexes[1+i]].salience > origins[indexes[1+j]].salience
+	})
+
+	action := actions[winner]
+	merged := DefaultAction{
+		ID:                        action.GetID(),
+		Name:                      action.GetName(),
+		Parameters:                make(map[string]interface{}),
+		MetaData:                  action.GetMetaData(),
+		EnabledDependsAction:      action.GetEnabledDependsAction(),
+		EnableDependsForAllAction: action.GetEnableDependsForAllAction(),
+		EnableActionCondition:     action.GetEnableActionCondition(),
+		ActionCondition:           action.GetActionCondition(),
+	}
+	for _, i := range indexes {
+		for key, value := range actions[i].GetParameters() {
+			if _, ok := merged.Parameters[key]; !ok {
+				merged.Parameters[key] = value
+			}
+		}
+	}
+	return merged
+}
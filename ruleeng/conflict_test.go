@@ -0,0 +1,224 @@
+package ruleeng
+
+import (
+	"reflect"
+	"testing"
+)
+
+func actionRule(id int64, salience int, terminal bool, name string, parameters map[string]Expression) *DefaultRule {
+	return &DefaultRule{
+		ID:       id,
+		Salience: salience,
+		Terminal: terminal,
+		Cases: []Case{{
+			Name:      "case",
+			Condition: "true",
+			Enabled:   true,
+			Actions:   []ActionDef{{Name: Expression(`"` + name + `"`), Enabled: true, Parameters: parameters}},
+		}},
+	}
+}
+
+func actionRuleIDs(actions []Action) []int64 {
+	ids := make([]int64, 0, len(actions))
+	for _, action := range actions {
+		ids = append(ids, action.GetMetaData()["ruleID"].(int64))
+	}
+	return ids
+}
+
+func TestRuleSalienceOrder(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.InsertRules([]Rule{
+		actionRule(1, 0, false, "a", nil),
+		actionRule(2, 10, false, "b", nil),
+		actionRule(3, 0, false, "c", nil),
+		actionRule(4, -5, false, "d", nil),
+		actionRule(5, 10, false, "e", nil),
+	})
+
+	for i := 0; i < 10; i++ {
+		engine.ExecuteAllRules()
+		if ids := actionRuleIDs(engine.GetResults()); !reflect.DeepEqual(ids, []int64{2, 5, 1, 3, 4}) {
+			t.Fatalf("invalid execution order %v", ids)
+		}
+	}
+
+	engine.ExecuteRules([]int64{3, 1, 2})
+	if ids := actionRuleIDs(engine.GetResults()); !reflect.DeepEqual(ids, []int64{2, 3, 1}) {
+		t.Errorf("invalid execution order %v", ids)
+	}
+
+	rules := engine.GetRulesBase()
+	if ids := actionRuleIDs(rules.ExecuteAll(engine.GetKnowledgeBase())); !reflect.DeepEqual(ids, []int64{2, 5, 1, 3, 4}) {
+		t.Errorf("invalid rule base execution order %v", ids)
+	}
+}
+
+func TestCaseSalienceOrder(t *testing.T) {
+	rule := &DefaultRule{
+		ID:               1,
+		EvaluateAllCases: true,
+		Cases: []Case{
+			{Name: "low", Condition: "true", Enabled: true, Actions: []ActionDef{{Name: `"low"`, Enabled: true}}},
+			{Name: "high", Condition: "true", Enabled: true, Salience: 1, Actions: []ActionDef{{Name: `"high"`, Enabled: true}}},
+		},
+	}
+	actions := rule.Execute(NewKBase())
+	if len(actions) != 2 || actions[0].GetName() != "high" || actions[1].GetName() != "low" {
+		t.Errorf("invalid case order %+v", actions)
+	}
+
+	rule.EvaluateAllCases = false
+	actions = rule.Execute(NewKBase())
+	if len(actions) != 1 || actions[0].GetName() != "high" {
+		t.Errorf("the highest salience case should match first %+v", actions)
+	}
+}
+
+func TestTerminalRule(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetExplain(true)
+	engine.InsertRules([]Rule{
+		actionRule(1, 10, false, "a", nil),
+		actionRule(2, 5, true, "b", nil),
+		actionRule(3, 0, false, "c", nil),
+	})
+
+	engine.ExecuteAllRules()
+	if ids := actionRuleIDs(engine.GetResults()); !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("the terminal rule should stop the execution %v", ids)
+	}
+	traces := engine.GetTrace()
+	if len(traces) != 2 || traces[0].Terminated || !traces[1].Terminated || traces[1].Salience != 5 {
+		t.Errorf("unexpected traces %+v", traces)
+	}
+
+	rules := engine.GetRulesBase()
+	if ids := actionRuleIDs(rules.ExecuteRules([]int64{3, 2, 1}, engine.GetKnowledgeBase())); !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("the terminal rule should stop the rule base execution %v", ids)
+	}
+
+	// A terminal rule which does not emit any action does not stop the execution
+	engine.InsertRule(&DefaultRule{ID: 2, Salience: 5, Terminal: true, Cases: []Case{
+		{Name: "case", Condition: "false", Enabled: true, Actions: []ActionDef{{Name: `"b"`, Enabled: true}}},
+	}})
+	engine.ExecuteAllRules()
+	if ids := actionRuleIDs(engine.GetResults()); !reflect.DeepEqual(ids, []int64{1, 3}) {
+		t.Errorf("invalid execution %v", ids)
+	}
+}
+
+func TestRuleBaseExecuteContext(t *testing.T) {
+	rules := NewRBase().(ContextualRuleBase)
+	rules.InsertRules([]Rule{
+		actionRule(1, 10, false, "a", nil),
+		actionRule(2, 5, true, "b", nil),
+		actionRule(3, 0, false, "c", nil),
+	})
+
+	executions := rules.ExecuteRulesContext([]int64{3, 4, 2, 1}, NewKBase(), ExecutionContext{Explain: true})
+	if len(executions) != 3 {
+		t.Fatalf("unexpected executions %+v", executions)
+	}
+	if executions[0].RuleID != 4 || executions[0].Trace == nil || executions[0].Trace.Error == "" {
+		t.Errorf("the non existing rule should be traced %+v", executions[0])
+	}
+	if executions[1].RuleID != 1 || executions[1].Terminated || len(executions[1].Actions) != 1 {
+		t.Errorf("unexpected execution %+v", executions[1])
+	}
+	if executions[2].RuleID != 2 || !executions[2].Terminated || executions[2].Salience != 5 || !executions[2].Trace.Terminated {
+		t.Errorf("unexpected execution %+v", executions[2])
+	}
+
+	if _, err := rules.ExecuteByIDContext(4, NewKBase(), ExecutionContext{}); err == nil {
+		t.Error("executing a non existing rule should fail")
+	}
+}
+
+func TestConflictStrategies(t *testing.T) {
+	rules := []Rule{
+		actionRule(1, 0, false, "notify", map[string]Expression{"level": `"info"`, "title": `"low"`}),
+		actionRule(2, 10, false, "notify", map[string]Expression{"level": `"critical"`}),
+		actionRule(3, 0, false, "close", nil),
+		actionRule(4, 5, false, "notify", map[string]Expression{"title": `"medium"`, "groups": "[1]"}),
+	}
+
+	testCases := []struct {
+		name       string
+		strategy   ConflictStrategy
+		ids        []int64
+		parameters []map[string]interface{}
+	}{
+		{"keep all", ConflictKeepAll, []int64{2, 4, 1, 3}, nil},
+		{"first wins", ConflictFirstWins, []int64{1, 3}, nil},
+		{"highest priority", ConflictHighestPriority, []int64{3, 2}, nil},
+		{"merge", ConflictMergeParameters, []int64{3, 2}, []map[string]interface{}{
+			{},
+			{"level": "critical", "title": "medium", "groups": []interface{}{1.0}},
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine := NewRuleEngine()
+			engine.InsertRules(rules)
+			if err := engine.SetConflictStrategy(tc.strategy); err != nil {
+				t.Fatal(err)
+			}
+			// Rules executed one by one out of salience order, the conflicts are resolved on all the emitted actions
+			for _, id := range []int64{1, 3, 2, 4} {
+				if err := engine.ExecuteRule(id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.strategy == ConflictKeepAll {
+				engine.Reset()
+				engine.ExecuteAllRules()
+			}
+
+			actions := engine.GetResults()
+			if ids := actionRuleIDs(actions); !reflect.DeepEqual(ids, tc.ids) {
+				t.Errorf("invalid resolved actions %v, expected %v", ids, tc.ids)
+			}
+			for i, parameters := range tc.parameters {
+				if !reflect.DeepEqual(actions[i].GetParameters(), parameters) {
+					t.Errorf("invalid parameters %v, expected %v", actions[i].GetParameters(), parameters)
+				}
+			}
+		})
+	}
+
+	if err := NewRuleEngine().SetConflictStrategy("unknown"); err == nil {
+		t.Error("expected an error on an unknown strategy")
+	}
+}
+
+func TestConflictSameRuleActions(t *testing.T) {
+	rules := []Rule{
+		&DefaultRule{ID: 1, Salience: 10, Cases: []Case{{Name: "case", Condition: "true", Enabled: true, Actions: []ActionDef{
+			{Name: `"notify"`, Enabled: true, Parameters: map[string]Expression{"level": `"critical"`}},
+			{Name: `"notify"`, Enabled: true, Parameters: map[string]Expression{"level": `"info"`}},
+		}}}},
+		actionRule(2, 0, false, "notify", map[string]Expression{"level": `"warning"`, "title": `"low"`}),
+	}
+
+	for _, strategy := range []ConflictStrategy{ConflictFirstWins, ConflictHighestPriority, ConflictMergeParameters} {
+		engine := NewRuleEngine()
+		engine.InsertRules(rules)
+		if err := engine.SetConflictStrategy(strategy); err != nil {
+			t.Fatal(err)
+		}
+		engine.ExecuteAllRules()
+
+		actions := engine.GetResults()
+		if ids := actionRuleIDs(actions); !reflect.DeepEqual(ids, []int64{1, 1}) {
+			t.Fatalf("%s: the winning rule should keep its two actions %v", strategy, ids)
+		}
+		if actions[0].GetParameters()["level"] != "critical" || actions[1].GetParameters()["level"] != "info" {
+			t.Errorf("%s: invalid parameters %v %v", strategy, actions[0].GetParameters(), actions[1].GetParameters())
+		}
+		if merged := strategy == ConflictMergeParameters; merged != (actions[1].GetParameters()["title"] == "low") {
+			t.Errorf("%s: invalid merged parameters %v", strategy, actions[1].GetParameters())
+		}
+	}
+}
@@ -1,10 +1,21 @@
 package ruleeng
 
+import "time"
+
 // RuleEngine represents an instance of a rule engine
 type RuleEngine struct {
 	knowledgeBase KnowledgeBase
 	ruleBase      RuleBase
 	agenda        []Action
+	explain       bool
+	trace         []RuleTrace
+	store         StateStore
+	scope         string
+	time          time.Time
+	strategy      ConflictStrategy
+	emitted       []Action
+	origins       []actionOrigin
+	inactive      []Inactivity
 }
 
 //KnowledgeBase ...
@@ -29,12 +40,30 @@ type RuleBase interface {
 	ExecuteByID(id int64, k KnowledgeBase) ([]Action, error)
 }
 
+// ContextualRuleBase is a rule base which can execute its rules in an execution context
+// The RuleEngine executes the rules through it, a RuleBase which is not a ContextualRuleBase is
+// executed without execution context (no state, no trace and no salience for the conflicts resolution)
+// See DefaultRuleBase for an example implementation.
+type ContextualRuleBase interface {
+	RuleBase
+	ExecuteAllContext(k KnowledgeBase, ec ExecutionContext) []RuleExecution
+	ExecuteRulesContext(ids []int64, k KnowledgeBase, ec ExecutionContext) []RuleExecution
+	ExecuteByIDContext(id int64, k KnowledgeBase, ec ExecutionContext) (RuleExecution, error)
+}
+
 // NewRuleEngine builds a RuleEngine
 func NewRuleEngine() *RuleEngine {
+	return newRuleEngine(NewRBase(), NewKBase(), NewMemoryStateStore(DefaultStateTTL))
+}
+
+func newRuleEngine(r RuleBase, k KnowledgeBase, store StateStore) *RuleEngine {
 	return &RuleEngine{
-		knowledgeBase: NewKBase(),
-		ruleBase:      NewRBase(),
+		knowledgeBase: k,
+		ruleBase:      r,
 		agenda:        make([]Action, 0),
+		trace:         make([]RuleTrace, 0),
+		store:         store,
+		inactive:      make([]Inactivity, 0),
 	}
 }
 
@@ -61,6 +90,10 @@ func (engine *RuleEngine) GetRulesBase() RuleBase {
 // Reset remove all the results added in previous rules execution
 func (engine *RuleEngine) Reset() {
 	engine.agenda = []Action{}
+	engine.emitted = []Action{}
+	engine.origins = []actionOrigin{}
+	engine.inactive = []Inactivity{}
+	engine.trace = []RuleTrace{}
 	engine.knowledgeBase.Reset()
 }
 
@@ -84,27 +117,141 @@ func (engine *RuleEngine) InsertKnowledge(key string, value interface{}) {
 	engine.knowledgeBase.InsertFact(key, value)
 }
 
+// SetExplain enables or disables the explain mode, in which the rules executions record their evaluation trace
+func (engine *RuleEngine) SetExplain(explain bool) {
+	engine.explain = explain
+}
+
+// SetStateStore overwrites the store of the stateful cases states (in-process with DefaultStateTTL by default)
+// The stateful cases are evaluated without state if store is nil
+func (engine *RuleEngine) SetStateStore(store StateStore) {
+	engine.store = store
+}
+
+// SetStateScope sets the scope of the stateful cases states, which isolates the executions on different
+// knowledge bases (a situation instance for example)
+func (engine *RuleEngine) SetStateScope(scope string) {
+	engine.scope = scope
+}
+
+// SetTime sets the evaluation time of the rules (zero means the time of each execution)
+func (engine *RuleEngine) SetTime(t time.Time) {
+	engine.time = t
+}
+
+// SetConflictStrategy sets the resolution of the conflicts between the actions with the same name
+// emitted by several rules (all actions are kept by default)
+func (engine *RuleEngine) SetConflictStrategy(strategy ConflictStrategy) error {
+	if ok, err := strategy.IsValid(); !ok {
+		return err
+	}
+	engine.strategy = strategy
+	return nil
+}
+
 // ExecuteAllRules executes all the rules in the baseRules using the knowledgeBase
+// The rules are executed by decreasing salience then by id, until a terminal rule emits actions
 func (engine *RuleEngine) ExecuteAllRules() {
-	engine.agenda = engine.ruleBase.ExecuteAll(engine.knowledgeBase)
+	engine.resetExecution()
+	if rBase, ok := engine.ruleBase.(ContextualRuleBase); ok {
+		engine.record(rBase.ExecuteAllContext(engine.knowledgeBase, engine.context()))
+	} else {
+		engine.record(actionsExecutions(engine.ruleBase.ExecuteAll(engine.knowledgeBase)))
+	}
+	engine.agenda = resolveConflicts(engine.strategy, engine.emitted, engine.origins)
 }
 
 // ExecuteRules executes all a list of rules in the baseRules using the knowledgeBase
+// The rules are executed by decreasing salience then in the list order, until a terminal rule emits actions
 func (engine *RuleEngine) ExecuteRules(ids []int64) {
-	engine.agenda = engine.ruleBase.ExecuteRules(ids, engine.knowledgeBase)
+	engine.resetExecution()
+	if rBase, ok := engine.ruleBase.(ContextualRuleBase); ok {
+		engine.record(rBase.ExecuteRulesContext(ids, engine.knowledgeBase, engine.context()))
+	} else {
+		engine.record(actionsExecutions(engine.ruleBase.ExecuteRules(ids, engine.knowledgeBase)))
+	}
+	engine.agenda = resolveConflicts(engine.strategy, engine.emitted, engine.origins)
 }
 
 // ExecuteRule executes a single rule by id using the knowledgeBase
+// The actions of the rule are added to the results, unless the rule cannot be executed and its error is returned
 func (engine *RuleEngine) ExecuteRule(id int64) error {
-	actions, err := engine.ruleBase.ExecuteByID(id, engine.knowledgeBase)
+	executions := make([]RuleExecution, 1)
+	var err error
+	if rBase, ok := engine.ruleBase.(ContextualRuleBase); ok {
+		executions[0], err = rBase.ExecuteByIDContext(id, engine.knowledgeBase, engine.context())
+	} else {
+		var actions []Action
+		actions, err = engine.ruleBase.ExecuteByID(id, engine.knowledgeBase)
+		executions = actionsExecutions(actions)
+	}
 	if err != nil {
-		engine.agenda = append(engine.agenda, actions...)
-		return nil
+		if engine.explain {
+			engine.trace = append(engine.trace, RuleTrace{RuleID: id, Error: err.Error()})
+		}
+		return err
+	}
+	engine.record(executions)
+	engine.agenda = resolveConflicts(engine.strategy, engine.emitted, engine.origins)
+	return nil
+}
+
+// context returns the execution context of the engine
+func (engine *RuleEngine) context() ExecutionContext {
+	return ExecutionContext{
+		Time:     engine.time,
+		Store:    engine.store,
+		Scope:    engine.scope,
+		Explain:  engine.explain,
+		Inactive: &engine.inactive,
 	}
-	return err
+}
+
+func (engine *RuleEngine) resetExecution() {
+	engine.emitted = make([]Action, 0)
+	engine.origins = make([]actionOrigin, 0)
+	engine.inactive = make([]Inactivity, 0)
+	engine.trace = make([]RuleTrace, 0)
+}
+
+// record records the actions emitted by the rules executions and their traces in explain mode
+func (engine *RuleEngine) record(executions []RuleExecution) {
+	for _, execution := range executions {
+		for _, action := range execution.Actions {
+			engine.emitted = append(engine.emitted, action)
+			engine.origins = append(engine.origins, actionOrigin{ruleID: execution.RuleID, salience: execution.Salience})
+		}
+		if engine.explain && execution.Trace != nil {
+			engine.trace = append(engine.trace, *execution.Trace)
+		}
+	}
+}
+
+// GetInactive returns the rules and cases skipped by the executions because they were not active
+func (engine *RuleEngine) GetInactive() []Inactivity {
+	return engine.inactive
+}
+
+// GetTrace returns the evaluation traces of the rules executed in explain mode
+func (engine *RuleEngine) GetTrace() []RuleTrace {
+	return engine.trace
 }
 
 // GetResults returns the Results of the rules executed
 func (engine *RuleEngine) GetResults() []Action {
 	return engine.agenda
 }
+
+// actionsExecutions groups the actions executed by a RuleBase which is not a ContextualRuleBase by the rule
+// which emitted them (from their "ruleID" metadata)
+func actionsExecutions(actions []Action) []RuleExecution {
+	executions := make([]RuleExecution, 0)
+	for _, action := range actions {
+		ruleID, _ := action.GetMetaData()["ruleID"].(int64)
+		if len(executions) == 0 || executions[len(executions)-1].RuleID != ruleID {
+			executions = append(executions, RuleExecution{RuleID: ruleID})
+		}
+		executions[len(executions)-1].Actions = append(executions[len(executions)-1].Actions, action)
+	}
+	return executions
+}
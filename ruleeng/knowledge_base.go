@@ -21,6 +21,21 @@ func NewKBase() KnowledgeBase {
 	}
 }
 
+// clone returns a copy of the KBase sharing its facts values, the facts inserted in the copy are not inserted in the KBase
+func (kBase *DefaultKnowledgeBase) clone() *DefaultKnowledgeBase {
+	facts := make(map[string]interface{}, len(kBase.facts))
+	for key, value := range kBase.facts {
+		facts[key] = value
+	}
+	defaultKeys := make([]string, len(kBase.defaultKeys))
+	copy(defaultKeys, kBase.defaultKeys)
+	return &DefaultKnowledgeBase{
+		facts:       facts,
+		defaultKeys: defaultKeys,
+		indexs:      make(map[string]interface{}),
+	}
+}
+
 // GetFacts returns the facts maps of the KBase
 func (kBase *DefaultKnowledgeBase) GetFacts() map[string]interface{} {
 	return kBase.facts
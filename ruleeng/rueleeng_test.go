@@ -46,6 +46,42 @@ func TestRuleEng(t *testing.T) {
 	}
 }
 
+func TestRuleEngExecuteRule(t *testing.T) {
+	engine := NewRuleEngine()
+
+	var rule DefaultRule
+	json.Unmarshal([]byte(ruleStr), &rule)
+	rule.ID = 1
+
+	facts := map[string]interface{}{
+		"fact_test_1": map[string]interface{}{
+			"aggs": map[string]interface{}{
+				"agg0":      map[string]interface{}{"value": 1},
+				"doc_count": map[string]interface{}{"value": 1},
+			},
+		},
+	}
+
+	engine.InsertRule(&rule)
+	engine.knowledgeBase.SetFacts(facts)
+
+	// the actions of an executed rule are kept in the results
+	if err := engine.ExecuteRule(1); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if len(engine.GetResults()) != 3 {
+		t.Errorf("Invalid number of actions returned %d", len(engine.GetResults()))
+	}
+
+	// a rule which cannot be executed returns its error, without changing the results
+	if err := engine.ExecuteRule(2); err == nil {
+		t.Error("Expected an error on a non existing rule")
+	}
+	if len(engine.GetResults()) != 3 {
+		t.Errorf("Invalid number of actions returned %d", len(engine.GetResults()))
+	}
+}
+
 func TestRuleActionDependency(t *testing.T) {
 
 	var rule DefaultRule
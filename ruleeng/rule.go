@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/myrteametrics/myrtea-sdk/v5/expression"
 )
@@ -17,13 +19,41 @@ type Rule interface {
 	IsValid() (bool, error)
 }
 
+// ContextualRule is a rule which can be executed in an execution context
+// See DefaultRule for an example implementation.
+type ContextualRule interface {
+	Rule
+	ExecuteContext(k KnowledgeBase, ec ExecutionContext) []Action
+}
+
+// ExecutionContext is the context of a rule execution
+// * Time is the evaluation time (default to now)
+// * Store keeps the states of the stateful cases, which are evaluated without state if it is nil
+// * Scope isolates the states of the executions on different knowledge bases (a situation instance for example)
+// * Trace records the evaluation of the rule if it is not nil
+// * Explain records the trace of each rule executed by a rule base
+// * Inactive records the rule and cases skipped because they are not active at Time if it is not nil
+type ExecutionContext struct {
+	Time     time.Time
+	Store    StateStore
+	Scope    string
+	Trace    *RuleTrace
+	Explain  bool
+	Inactive *[]Inactivity
+}
+
 // DefaultRule default rule implementation
+// The rules are executed by decreasing Salience, and a Terminal rule stops the rule base execution once it emitted actions
+// A rule with an Activation is skipped when it is not active at the evaluation time
 type DefaultRule struct {
 	ID               int64                  `json:"id,omitempty"`
 	Cases            []Case                 `json:"cases"`
 	Version          int64                  `json:"version"`
 	Parameters       map[string]interface{} `json:"parameters"`
 	EvaluateAllCases bool                   `json:"evaluateallcase"`
+	Salience         int                    `json:"salience,omitempty"`
+	Terminal         bool                   `json:"terminal,omitempty"`
+	Activation       *Activation            `json:"activation,omitempty"`
 }
 
 // GetID returns the rule id
@@ -31,6 +61,16 @@ func (r DefaultRule) GetID() int64 {
 	return r.ID
 }
 
+// GetSalience returns the rule salience
+func (r DefaultRule) GetSalience() int {
+	return r.Salience
+}
+
+// IsTerminal returns true if the rule stops the rule base execution once it emitted actions
+func (r DefaultRule) IsTerminal() bool {
+	return r.Terminal
+}
+
 // GetDefaultValues returns rule default values
 func (r DefaultRule) GetDefaultValues() map[string]interface{} {
 	return r.Parameters
@@ -44,6 +84,11 @@ func (r DefaultRule) IsValid() (bool, error) {
 	if len(r.Cases) <= 0 {
 		return false, errors.New("missing rule cases")
 	}
+	if r.Activation != nil {
+		if ok, err := r.Activation.IsValid(); !ok {
+			return false, fmt.Errorf("invalid rule activation: %w", err)
+		}
+	}
 
 	// Validate each case
 	for i, c := range r.Cases {
@@ -58,6 +103,16 @@ func (r DefaultRule) IsValid() (bool, error) {
 		if err := ValidateExpressionSyntax(string(c.Condition)); err != nil {
 			return false, fmt.Errorf("invalid condition syntax in case '%s': %w", c.Name, err)
 		}
+		if c.State != nil {
+			if ok, err := c.State.IsValid(); !ok {
+				return false, fmt.Errorf("invalid state in case '%s': %w", c.Name, err)
+			}
+		}
+		if c.Activation != nil {
+			if ok, err := c.Activation.IsValid(); !ok {
+				return false, fmt.Errorf("invalid activation in case '%s': %w", c.Name, err)
+			}
+		}
 		if c.Actions == nil {
 			return false, fmt.Errorf("missing case actions for case: %s", c.Name)
 		}
@@ -93,17 +148,69 @@ func (r DefaultRule) IsValid() (bool, error) {
 }
 
 // Execute executes the rule and return the resulting actions
+// The stateful cases are evaluated without their state, use ExecuteContext with a StateStore to keep it
 func (r DefaultRule) Execute(k KnowledgeBase) []Action {
+	return r.ExecuteContext(k, ExecutionContext{})
+}
+
+// Explain executes the rule and returns the resulting actions with the trace of the evaluation
+func (r DefaultRule) Explain(k KnowledgeBase) ([]Action, RuleTrace) {
+	var trace RuleTrace
+	actions := r.ExecuteContext(k, ExecutionContext{Trace: &trace})
+	return actions, trace
+}
+
+// ExecuteContext executes the rule in an execution context and return the resulting actions
+func (r DefaultRule) ExecuteContext(k KnowledgeBase, ec ExecutionContext) []Action {
+	if ec.Time.IsZero() {
+		ec.Time = time.Now()
+	}
+	if ec.Trace != nil {
+		*ec.Trace = RuleTrace{
+			RuleID:      r.ID,
+			RuleVersion: r.Version,
+			Parameters:  r.Parameters,
+			Cases:       make([]CaseTrace, 0, len(r.Cases)),
+		}
+		for _, c := range r.Cases {
+			ec.Trace.Cases = append(ec.Trace.Cases, CaseTrace{Name: c.Name, Condition: string(c.Condition), Skipped: !c.Enabled})
+		}
+	}
+
+	if active, reason := isActive(r.Activation, ec.Time); !active {
+		if ec.Trace != nil {
+			ec.Trace.Inactive = reason
+		}
+		if ec.Inactive != nil {
+			*ec.Inactive = append(*ec.Inactive, Inactivity{RuleID: r.ID, Reason: reason})
+		}
+		return nil
+	}
+
 	result := make([]Action, 0)
 
 	k.SetDefaultValues(r.Parameters)
 
-	for _, c := range r.Cases {
+	for _, i := range r.sortedCases() {
+		c := r.Cases[i]
 
 		if !c.Enabled {
 			continue
 		}
-		actions := c.evaluate(k)
+		var caseTrace *CaseTrace
+		if ec.Trace != nil {
+			caseTrace = &ec.Trace.Cases[i]
+		}
+		if active, reason := isActive(c.Activation, ec.Time); !active {
+			if caseTrace != nil {
+				caseTrace.Inactive = reason
+			}
+			if ec.Inactive != nil {
+				*ec.Inactive = append(*ec.Inactive, Inactivity{RuleID: r.ID, Case: c.Name, Reason: reason})
+			}
+			continue
+		}
+		actions := c.evaluate(k, r.ID, ec, caseTrace)
 		if actions != nil {
 			for _, a := range actions {
 
@@ -124,6 +231,16 @@ func (r DefaultRule) Execute(k KnowledgeBase) []Action {
 	return nil
 }
 
+// sortedCases returns the indexes of the cases by decreasing salience, keeping their order on a tie
+func (r DefaultRule) sortedCases() []int {
+	indexes := make([]int, len(r.Cases))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool { return r.Cases[indexes[i]].Salience > r.Cases[indexes[j]].Salience })
+	return indexes
+}
+
 // UnmarshalJSON unmashals a quoted json string to Expression
 func (r *DefaultRule) UnmarshalJSON(data []byte) error {
 	type Alias DefaultRule
@@ -148,33 +265,62 @@ func (r *DefaultRule) UnmarshalJSON(data []byte) error {
 }
 
 // Case : pair condition tasks use to compose a Rule
+// The cases are evaluated by decreasing Salience, and a case with a State configuration is stateful (see StateConfig)
+// A case with an Activation is skipped when it is not active at the evaluation time
 type Case struct {
-	Name                      string      `json:"name"`
-	Condition                 Expression  `json:"condition"`
-	Actions                   []ActionDef `json:"actions"`
-	Enabled                   bool        `json:"enabled"`
-	EnableDependsForAllAction bool        `json:"enableDependsForALLAction"`
+	Name                      string       `json:"name"`
+	Condition                 Expression   `json:"condition"`
+	Actions                   []ActionDef  `json:"actions"`
+	Enabled                   bool         `json:"enabled"`
+	EnableDependsForAllAction bool         `json:"enableDependsForALLAction"`
+	State                     *StateConfig `json:"state,omitempty"`
+	Salience                  int          `json:"salience,omitempty"`
+	Activation                *Activation  `json:"activation,omitempty"`
 }
 
-func (c Case) evaluate(k KnowledgeBase) []DefaultAction {
-
-	val, _ := c.Condition.EvaluateAsBool(k)
+func (c Case) evaluate(k KnowledgeBase, ruleID int64, ec ExecutionContext, trace *CaseTrace) []DefaultAction {
+	var val bool
+	if c.State != nil && ec.Store != nil {
+		val = c.evaluateState(k, ruleID, ec, trace)
+	} else {
+		val = c.evaluateCondition(k, c.Condition, trace)
+	}
 	if val {
-		return resolve(c, k)
+		return resolve(c, k, trace)
 	}
 	return nil
 }
 
-// resolve creates a lis86t of actions from the case actions Definitions
-func resolve(c Case, k KnowledgeBase) []DefaultAction {
+// evaluateCondition evaluates a condition of the case (errors are evaluated as false)
+func (c Case) evaluateCondition(k KnowledgeBase, condition Expression, trace *CaseTrace) bool {
+	val, err := condition.EvaluateAsBool(k)
+	if trace != nil {
+		trace.Condition = string(condition)
+		trace.Evaluated = true
+		trace.Result = val
+		if err != nil {
+			trace.Error = err.Error()
+		}
+		trace.Knowledge, trace.Missing = readKnowledge(k, nil, nil, condition)
+	}
+	return val
+}
+
+// resolve creates a list of actions from the case actions Definitions
+func resolve(c Case, k KnowledgeBase, trace *CaseTrace) []DefaultAction {
 	resolvedActions := make([]DefaultAction, 0)
 
 	for _, a := range c.Actions {
 
+		var actionTrace *ActionTrace
+		if trace != nil {
+			trace.Actions = append(trace.Actions, ActionTrace{ID: a.ID, Name: string(a.Name), Skipped: !a.Enabled})
+			actionTrace = &trace.Actions[len(trace.Actions)-1]
+		}
 		if !a.Enabled {
 			continue
 		}
-		rAction, err := a.Resolve(k, c)
+		rAction, err := a.resolve(k, c, actionTrace)
 		if err == nil {
 			rAction.MetaData["caseName"] = c.Name
 			resolvedActions = append(resolvedActions, rAction)
@@ -248,10 +394,21 @@ type ActionCondition struct {
 
 // Resolve resolves the ActionDef into a DefaultAction
 func (a ActionDef) Resolve(k KnowledgeBase, c Case) (DefaultAction, error) {
+	return a.resolve(k, c, nil)
+}
+
+// resolve resolves the ActionDef into a DefaultAction, and records the resolution in trace if it is not nil
+func (a ActionDef) resolve(k KnowledgeBase, c Case, trace *ActionTrace) (DefaultAction, error) {
 
 	name, err := a.Name.EvaluateAsString(k)
+	if trace != nil {
+		trace.Knowledge, trace.Missing = readKnowledge(k, nil, nil, a.Name)
+	}
 
 	if err != nil {
+		if trace != nil {
+			trace.Error = err.Error()
+		}
 		return DefaultAction{}, err
 	}
 
@@ -270,6 +427,21 @@ func (a ActionDef) Resolve(k KnowledgeBase, c Case) (DefaultAction, error) {
 		value, err := exp.Evaluate(k)
 		if err == nil {
 			rAction.Parameters[key] = value
+		} else if trace != nil {
+			if trace.ParameterErrors == nil {
+				trace.ParameterErrors = make(map[string]string)
+			}
+			trace.ParameterErrors[key] = err.Error()
+		}
+		if trace != nil {
+			trace.Knowledge, trace.Missing = readKnowledge(k, trace.Knowledge, trace.Missing, exp)
+		}
+	}
+	if trace != nil {
+		trace.Name = name
+		trace.Parameters = make(map[string]interface{}, len(rAction.Parameters))
+		for key, value := range rAction.Parameters {
+			trace.Parameters[key] = value
 		}
 	}
 
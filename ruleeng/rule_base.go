@@ -3,6 +3,7 @@ package ruleeng
 import (
 	"errors"
 	"strconv"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -12,6 +13,18 @@ type DefaultRuleBase struct {
 	rules map[int64]Rule
 }
 
+// RuleExecution is the execution of a rule of a rule base
+// * Actions are the actions emitted by the rule
+// * Terminated is true if the rule is terminal and emitted actions, which stops the rule base execution
+// * Trace is the evaluation trace of the rule if the execution context Explain is enabled
+type RuleExecution struct {
+	RuleID     int64
+	Salience   int
+	Actions    []Action
+	Terminated bool
+	Trace      *RuleTrace
+}
+
 // NewRBase creates a new rulesBase
 func NewRBase() RuleBase {
 	return &DefaultRuleBase{rules: make(map[int64]Rule)}
@@ -47,39 +60,112 @@ func (rBase *DefaultRuleBase) Reset() {
 }
 
 // ExecuteAll executes all the rules of the ruleBase using the knowledgeBase provided as parameter
+// The rules are executed without state, use ExecuteAllContext to execute them in an execution context
 func (rBase *DefaultRuleBase) ExecuteAll(k KnowledgeBase) []Action {
-	results := make([]Action, 0)
-	for _, rule := range rBase.rules {
-		actions := rBase.executeRule(rule, k)
-		if actions != nil {
-			results = append(results, actions...)
-		}
-	}
-	return results
+	return executionsActions(rBase.ExecuteAllContext(k, ExecutionContext{}))
 }
 
 // ExecuteRules executes a list of the rules of the ruleBase using the knowledgeBase provided as parameter
+// The rules are executed without state, use ExecuteRulesContext to execute them in an execution context
 func (rBase *DefaultRuleBase) ExecuteRules(ruleIDs []int64, k KnowledgeBase) []Action {
-	results := make([]Action, 0)
+	return executionsActions(rBase.ExecuteRulesContext(ruleIDs, k, ExecutionContext{}))
+}
+
+// ExecuteByID executes the rule with the name provide in the parameter 'ruleName' using the knowledgeBase provided as parameter
+// The rule is executed without state, use ExecuteByIDContext to execute it in an execution context
+func (rBase *DefaultRuleBase) ExecuteByID(ruleID int64, k KnowledgeBase) ([]Action, error) {
+	execution, err := rBase.ExecuteByIDContext(ruleID, k, ExecutionContext{})
+	return execution.Actions, err
+}
+
+// ExecuteAllContext executes all the rules of the ruleBase in an execution context
+// The rules are executed by decreasing salience then by id, until a terminal rule emits actions
+func (rBase *DefaultRuleBase) ExecuteAllContext(k KnowledgeBase, ec ExecutionContext) []RuleExecution {
+	return rBase.executeSorted(sortedRules(rBase.rules), k, ec)
+}
+
+// ExecuteRulesContext executes a list of the rules of the ruleBase in an execution context
+// The rules are executed by decreasing salience then in the list order, until a terminal rule emits actions
+// A non existing rule is skipped, with an error trace if the execution context Explain is enabled
+func (rBase *DefaultRuleBase) ExecuteRulesContext(ruleIDs []int64, k KnowledgeBase, ec ExecutionContext) []RuleExecution {
+	missing := make([]RuleExecution, 0)
+	rules := make([]Rule, 0, len(ruleIDs))
 	for _, ruleID := range ruleIDs {
-		actions, err := rBase.ExecuteByID(ruleID, k)
-		if err != nil {
+		rule, ok := rBase.rules[ruleID]
+		if !ok {
 			zap.L().Warn("Trying to execute non existing rule:", zap.Int64("ruleID", ruleID))
-		} else {
-			results = append(results, actions...)
+			if ec.Explain {
+				missing = append(missing, RuleExecution{RuleID: ruleID, Trace: &RuleTrace{RuleID: ruleID, Error: notExistsError(ruleID).Error()}})
+			}
+			continue
 		}
+		rules = append(rules, rule)
 	}
-	return results
+	sortRules(rules)
+	return append(missing, rBase.executeSorted(rules, k, ec)...)
 }
 
-// ExecuteByID executes the rule with the name provide in the parameter 'ruleName' using the knowledgeBase provided as parameter
-func (rBase *DefaultRuleBase) ExecuteByID(ruleID int64, k KnowledgeBase) ([]Action, error) {
-	if rule, ok := rBase.rules[ruleID]; ok {
-		return rBase.executeRule(rule, k), nil
+// ExecuteByIDContext executes a rule of the ruleBase in an execution context
+func (rBase *DefaultRuleBase) ExecuteByIDContext(ruleID int64, k KnowledgeBase, ec ExecutionContext) (RuleExecution, error) {
+	rule, ok := rBase.rules[ruleID]
+	if !ok {
+		return RuleExecution{RuleID: ruleID}, notExistsError(ruleID)
+	}
+	if ec.Time.IsZero() {
+		ec.Time = time.Now()
 	}
-	return nil, errors.New(strconv.FormatInt(ruleID, 10) + " does not exists")
+	return executeRule(rule, k, ec), nil
+}
+
+func (rBase *DefaultRuleBase) executeSorted(rules []Rule, k KnowledgeBase, ec ExecutionContext) []RuleExecution {
+	if ec.Time.IsZero() {
+		ec.Time = time.Now()
+	}
+	executions := make([]RuleExecution, 0, len(rules))
+	for _, rule := range rules {
+		execution := executeRule(rule, k, ec)
+		executions = append(executions, execution)
+		if execution.Terminated {
+			break
+		}
+	}
+	return executions
+}
+
+// executeRule executes a rule in an execution context, with its trace if the execution context Explain is enabled
+// The trace of a rule which is not a ContextualRule only records that it cannot be explained
+func executeRule(rule Rule, k KnowledgeBase, ec ExecutionContext) RuleExecution {
+	execution := RuleExecution{RuleID: rule.GetID(), Salience: ruleSalience(rule)}
+	if ec.Explain {
+		execution.Trace = &RuleTrace{RuleID: rule.GetID()}
+	}
+
+	if r, ok := rule.(ContextualRule); ok {
+		ec.Trace = execution.Trace
+		execution.Actions = r.ExecuteContext(k, ec)
+	} else {
+		execution.Actions = rule.Execute(k)
+		if execution.Trace != nil {
+			execution.Trace.Error = "rule does not support explain mode"
+		}
+	}
+
+	execution.Terminated = len(execution.Actions) > 0 && isTerminal(rule)
+	if execution.Trace != nil {
+		execution.Trace.Salience = execution.Salience
+		execution.Trace.Terminated = execution.Terminated
+	}
+	return execution
+}
+
+func executionsActions(executions []RuleExecution) []Action {
+	results := make([]Action, 0)
+	for _, execution := range executions {
+		results = append(results, execution.Actions...)
+	}
+	return results
 }
 
-func (rBase *DefaultRuleBase) executeRule(rule Rule, k KnowledgeBase) []Action {
-	return rule.Execute(k)
+func notExistsError(ruleID int64) error {
+	return errors.New(strconv.FormatInt(ruleID, 10) + " does not exists")
 }
@@ -0,0 +1,246 @@
+package ruleeng
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// StateConfig defines the stateful evaluation of a case
+// * Consecutive is the number of consecutive true evaluations of the condition before the case fires (default to 1)
+// * Cooldown is the period during which the case stays silent after it fired ("30m", "1h"...)
+// * ExitCondition separates the enter and exit conditions: once the condition fired, the case stays active
+// until the exit condition is true. Without exit condition, the case is active while its condition is true
+// The case fires when it becomes active. While it stays active, it fires again only once the cooldown is over,
+// and never without cooldown
+type StateConfig struct {
+	Consecutive   int        `json:"consecutive,omitempty"`
+	Cooldown      string     `json:"cooldown,omitempty"`
+	ExitCondition Expression `json:"exitCondition,omitempty"`
+}
+
+// IsValid checks if a state configuration is valid
+func (s StateConfig) IsValid() (bool, error) {
+	if s.Consecutive < 0 {
+		return false, fmt.Errorf("invalid consecutive evaluations %d", s.Consecutive)
+	}
+	if s.Cooldown != "" {
+		cooldown, err := time.ParseDuration(s.Cooldown)
+		if err != nil {
+			return false, fmt.Errorf("invalid cooldown: %w", err)
+		}
+		if cooldown < 0 {
+			return false, fmt.Errorf("invalid negative cooldown %s", s.Cooldown)
+		}
+	}
+	if s.ExitCondition != "" {
+		if err := ValidateExpressionSyntax(string(s.ExitCondition)); err != nil {
+			return false, fmt.Errorf("invalid exit condition syntax: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// CaseState is the state of a stateful case
+type CaseState struct {
+	Consecutive int       `json:"consecutive"`
+	Active      bool      `json:"active"`
+	LastFired   time.Time `json:"lastFired"`
+	Updated     time.Time `json:"updated"`
+}
+
+// StateKey identifies the state of a case of a rule in a scope
+type StateKey struct {
+	Scope  string
+	RuleID int64
+	Case   string
+}
+
+func (key StateKey) String() string {
+	return key.Scope + ":" + strconv.FormatInt(key.RuleID, 10) + ":" + key.Case
+}
+
+// StateUpdateFunc returns the new state of a case from its current state (an empty state and false if there is none)
+// It can be called several times by an update, if the state is concurrently updated
+type StateUpdateFunc func(state CaseState, found bool) CaseState
+
+// StateStore stores the states of the stateful cases
+// Update must be atomic, as the same case can be evaluated concurrently in the same scope (by several instances for example)
+// See MemoryStateStore and RedisStateStore for example implementations.
+type StateStore interface {
+	Get(key StateKey) (CaseState, bool, error)
+	Set(key StateKey, state CaseState) error
+	Update(key StateKey, fn StateUpdateFunc) (CaseState, error)
+	Delete(key StateKey) error
+}
+
+// DefaultStateTTL is the time to live of the states of the default in-process StateStore
+const DefaultStateTTL = 24 * time.Hour
+
+// MemoryStateStore is an in-process StateStore, safe for concurrent use
+// The states which were not updated for the store time to live are evicted (never if it is 0)
+type MemoryStateStore struct {
+	mu        sync.RWMutex
+	ttl       time.Duration
+	states    map[StateKey]memoryState
+	nextSweep time.Time
+}
+
+type memoryState struct {
+	state   CaseState
+	expires time.Time
+}
+
+// NewMemoryStateStore returns a new in-process StateStore, which evicts the states not updated for ttl (never if it is 0)
+func NewMemoryStateStore(ttl time.Duration) *MemoryStateStore {
+	return &MemoryStateStore{ttl: ttl, states: make(map[StateKey]memoryState)}
+}
+
+// Get returns the state of a case, and false if there is none
+func (store *MemoryStateStore) Get(key StateKey) (CaseState, bool, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	state, ok := store.states[key]
+	if !ok || state.expired(time.Now()) {
+		return CaseState{}, false, nil
+	}
+	return state.state, true, nil
+}
+
+// Set stores the state of a case
+func (store *MemoryStateStore) Set(key StateKey, state CaseState) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.set(key, state, time.Now())
+	return nil
+}
+
+// Update atomically replaces the state of a case by the result of fn
+func (store *MemoryStateStore) Update(key StateKey, fn StateUpdateFunc) (CaseState, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	now := time.Now()
+	current, ok := store.states[key]
+	if ok && current.expired(now) {
+		current, ok = memoryState{}, false
+	}
+	state := fn(current.state, ok)
+	store.set(key, state, now)
+	return state, nil
+}
+
+// Delete removes the state of a case
+func (store *MemoryStateStore) Delete(key StateKey) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.states, key)
+	return nil
+}
+
+// Len returns the number of stored states, expired states included until they are evicted
+func (store *MemoryStateStore) Len() int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return len(store.states)
+}
+
+// set stores a state, and evicts the expired states at most once per time to live
+// The lock must be held by the caller
+func (store *MemoryStateStore) set(key StateKey, state CaseState, now time.Time) {
+	if store.ttl <= 0 {
+		store.states[key] = memoryState{state: state}
+		return
+	}
+	store.states[key] = memoryState{state: state, expires: now.Add(store.ttl)}
+	if now.Before(store.nextSweep) {
+		return
+	}
+	for k, s := range store.states {
+		if s.expired(now) {
+			delete(store.states, k)
+		}
+	}
+	store.nextSweep = now.Add(store.ttl)
+}
+
+func (s memoryState) expired(now time.Time) bool {
+	return !s.expires.IsZero() && !now.Before(s.expires)
+}
+
+// evaluateState evaluates a stateful case, atomically updates its state and returns true if the case fires
+// A case which state could not be updated does not fire (its cooldown could not be enforced), the state store
+// error is logged and recorded in the trace
+func (c Case) evaluateState(k KnowledgeBase, ruleID int64, ec ExecutionContext, trace *CaseTrace) bool {
+	key := StateKey{Scope: ec.Scope, RuleID: ruleID, Case: c.Name}
+	var fired bool
+	var suppressed string
+	update := func(state CaseState, found bool) CaseState {
+		fired, suppressed = c.State.next(&state, c, k, ec.Time, trace)
+		state.Updated = ec.Time
+		return state
+	}
+
+	state, err := ec.Store.Update(key, update)
+	if err != nil {
+		zap.L().Warn("Rule case state update", zap.String("key", key.String()), zap.Error(err))
+		if trace != nil {
+			trace.Error = "state update: " + err.Error()
+		}
+		return false
+	}
+
+	if trace != nil {
+		trace.Suppressed = suppressed
+		trace.State = &state
+	}
+	return fired
+}
+
+// next updates the state of a case evaluated at a time, and returns true if the case fires,
+// or the reason why it does not fire while it is active
+func (s StateConfig) next(state *CaseState, c Case, k KnowledgeBase, t time.Time, trace *CaseTrace) (bool, string) {
+	consecutive := s.Consecutive
+	if consecutive <= 0 {
+		consecutive = 1
+	}
+	wasActive := state.Active
+
+	if state.Active && s.ExitCondition != "" {
+		if trace != nil {
+			trace.Exit = true
+		}
+		if c.evaluateCondition(k, s.ExitCondition, trace) {
+			state.Active = false
+			state.Consecutive = 0
+			return false, ""
+		}
+	} else {
+		if !c.evaluateCondition(k, c.Condition, trace) {
+			state.Consecutive = 0
+			state.Active = false
+			return false, ""
+		}
+		if state.Consecutive < consecutive {
+			state.Consecutive++
+		}
+		if state.Consecutive < consecutive {
+			return false, fmt.Sprintf("%d/%d consecutive evaluations", state.Consecutive, consecutive)
+		}
+		state.Active = true
+	}
+
+	if wasActive && s.Cooldown == "" {
+		return false, "already active"
+	}
+	if s.Cooldown != "" && !state.LastFired.IsZero() {
+		cooldown, err := time.ParseDuration(s.Cooldown)
+		if err == nil && t.Before(state.LastFired.Add(cooldown)) {
+			return false, "cooldown until " + state.LastFired.Add(cooldown).Format(time.RFC3339)
+		}
+	}
+	state.LastFired = t
+	return true, ""
+}
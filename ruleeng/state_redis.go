@@ -0,0 +1,128 @@
+package ruleeng
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/redis"
+	"github.com/redis/rueidis"
+)
+
+const (
+	defaultStatePrefix     = "rule-state:"
+	maxStateUpdateAttempts = 10
+)
+
+// RedisStateStore is a StateStore sharing the states of the stateful cases across instances through redis
+type RedisStateStore struct {
+	client rueidis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisStateStore returns a new redis StateStore, using the global redis client if client is nil
+// The states expire after ttl without evaluation (0 means never), and their keys are prefixed with prefix
+// (default to "rule-state:")
+func NewRedisStateStore(client rueidis.Client, prefix string, ttl time.Duration) *RedisStateStore {
+	if client == nil {
+		client = redis.C()
+	}
+	if prefix == "" {
+		prefix = defaultStatePrefix
+	}
+	return &RedisStateStore{client: client, prefix: prefix, ttl: ttl}
+}
+
+// Get returns the state of a case, and false if there is none
+func (store *RedisStateStore) Get(key StateKey) (CaseState, bool, error) {
+	return store.get(context.Background(), store.client, store.prefix+key.String())
+}
+
+// Set stores the state of a case
+func (store *RedisStateStore) Set(key StateKey, state CaseState) error {
+	ctx := context.Background()
+	set, err := store.set(store.client, store.prefix+key.String(), state)
+	if err != nil {
+		return err
+	}
+	return store.client.Do(ctx, set).Error()
+}
+
+// Update atomically replaces the state of a case by the result of fn, with an optimistic WATCH / MULTI transaction
+// The transaction is retried if the state is concurrently updated
+func (store *RedisStateStore) Update(key StateKey, fn StateUpdateFunc) (CaseState, error) {
+	ctx := context.Background()
+	redisKey := store.prefix + key.String()
+	for attempt := 0; attempt < maxStateUpdateAttempts; attempt++ {
+		var state CaseState
+		var committed bool
+		err := store.client.Dedicated(func(client rueidis.DedicatedClient) error {
+			if err := client.Do(ctx, client.B().Watch().Key(redisKey).Build()).Error(); err != nil {
+				return err
+			}
+			current, found, err := store.get(ctx, client, redisKey)
+			if err != nil {
+				client.Do(ctx, client.B().Unwatch().Build())
+				return err
+			}
+			state = fn(current, found)
+			set, err := store.set(client, redisKey, state)
+			if err != nil {
+				client.Do(ctx, client.B().Unwatch().Build())
+				return err
+			}
+			responses := client.DoMulti(ctx, client.B().Multi().Build(), set, client.B().Exec().Build())
+			if err := responses[2].Error(); err != nil {
+				if rueidis.IsRedisNil(err) {
+					// the transaction was aborted by a concurrent update of the state
+					return nil
+				}
+				return err
+			}
+			committed = true
+			return nil
+		})
+		if err != nil {
+			return CaseState{}, err
+		}
+		if committed {
+			return state, nil
+		}
+	}
+	return CaseState{}, fmt.Errorf("state %s concurrently updated %d times", key.String(), maxStateUpdateAttempts)
+}
+
+func (store *RedisStateStore) get(ctx context.Context, client rueidis.CoreClient, redisKey string) (CaseState, bool, error) {
+	data, err := client.Do(ctx, client.B().Get().Key(redisKey).Build()).AsBytes()
+	if err != nil {
+		if rueidis.IsRedisNil(err) {
+			return CaseState{}, false, nil
+		}
+		return CaseState{}, false, err
+	}
+	var state CaseState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return CaseState{}, false, err
+	}
+	return state, true, nil
+}
+
+func (store *RedisStateStore) set(client rueidis.CoreClient, redisKey string, state CaseState) (rueidis.Completed, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return rueidis.Completed{}, err
+	}
+	set := client.B().Set().Key(redisKey).Value(rueidis.BinaryString(data))
+	if store.ttl > 0 {
+		return set.Px(store.ttl).Build(), nil
+	}
+	return set.Build(), nil
+}
+
+// Delete removes the state of a case
+func (store *RedisStateStore) Delete(key StateKey) error {
+	ctx := context.Background()
+	return store.client.Do(ctx, store.client.B().Del().Key(store.prefix+key.String()).Build()).Error()
+}
@@ -0,0 +1,253 @@
+package ruleeng
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/redis"
+)
+
+func statefulRule(state *StateConfig) *DefaultRule {
+	return &DefaultRule{
+		ID: 1,
+		Cases: []Case{{
+			Name:      "open",
+			Condition: "kpi > 10",
+			Enabled:   true,
+			State:     state,
+			Actions:   []ActionDef{{Name: `"open"`, Enabled: true, Parameters: map[string]Expression{}}},
+		}},
+	}
+}
+
+// executeSequence executes a rule on a sequence of kpi values, one minute apart, and returns which executions fired
+func executeSequence(engine *RuleEngine, values []float64) []bool {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fired := make([]bool, 0, len(values))
+	for i, value := range values {
+		engine.SetTime(start.Add(time.Duration(i) * time.Minute))
+		engine.InsertKnowledge("kpi", value)
+		engine.ExecuteAllRules()
+		fired = append(fired, len(engine.GetResults()) > 0)
+	}
+	return fired
+}
+
+func compareFired(t *testing.T, got []bool, expected []bool) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("invalid number of executions, expected %d, got %d", len(expected), len(got))
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("execution %d: expected fired %t, got %t", i, expected[i], got[i])
+		}
+	}
+}
+
+func TestStatefulCaseConsecutive(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.InsertRule(statefulRule(&StateConfig{Consecutive: 3}))
+
+	fired := executeSequence(engine, []float64{11, 12, 5, 11, 12, 13, 14, 1})
+	compareFired(t, fired, []bool{false, false, false, false, false, true, false, false})
+}
+
+func TestStatefulCaseCooldown(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.InsertRule(statefulRule(&StateConfig{Cooldown: "3m"}))
+
+	fired := executeSequence(engine, []float64{11, 11, 11, 11, 11, 1, 11})
+	compareFired(t, fired, []bool{true, false, false, true, false, false, true})
+}
+
+func TestStatefulCaseExitCondition(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.InsertRule(statefulRule(&StateConfig{ExitCondition: "kpi < 5"}))
+
+	// The kpi oscillating between the exit and enter thresholds keeps the case active, it fires only when it becomes active
+	fired := executeSequence(engine, []float64{11, 9, 11, 8, 4, 9, 11})
+	compareFired(t, fired, []bool{true, false, false, false, false, false, true})
+}
+
+func TestStatefulCaseFiresOnce(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.InsertRule(statefulRule(&StateConfig{}))
+
+	// A case held true fires once, when it becomes active, then again only after its condition was false
+	fired := executeSequence(engine, []float64{11, 12, 13, 14, 15, 1, 11})
+	compareFired(t, fired, []bool{true, false, false, false, false, false, true})
+}
+
+func TestStatefulCaseWithoutStore(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetStateStore(nil)
+	engine.InsertRule(statefulRule(&StateConfig{Consecutive: 3}))
+
+	fired := executeSequence(engine, []float64{11, 12, 5})
+	compareFired(t, fired, []bool{true, true, false})
+}
+
+func TestStatefulCaseScope(t *testing.T) {
+	store := NewMemoryStateStore(0)
+	rule := statefulRule(&StateConfig{Consecutive: 2})
+
+	engineA := NewRuleEngine()
+	engineA.SetStateStore(store)
+	engineA.SetStateScope("a")
+	engineA.InsertRule(rule)
+
+	engineB := NewRuleEngine()
+	engineB.SetStateStore(store)
+	engineB.SetStateScope("b")
+	engineB.InsertRule(rule)
+
+	compareFired(t, executeSequence(engineA, []float64{11}), []bool{false})
+	compareFired(t, executeSequence(engineB, []float64{11}), []bool{false})
+	compareFired(t, executeSequence(engineA, []float64{11}), []bool{true})
+
+	state, ok, err := store.Get(StateKey{Scope: "b", RuleID: 1, Case: "open"})
+	if err != nil || !ok || state.Consecutive != 1 || state.Active {
+		t.Errorf("unexpected state of scope b %+v (found %t, error %v)", state, ok, err)
+	}
+}
+
+func TestStatefulCaseTrace(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetExplain(true)
+	engine.InsertRule(statefulRule(&StateConfig{Consecutive: 2}))
+
+	executeSequence(engine, []float64{11})
+	trace := engine.GetTrace()[0].Cases[0]
+	if !trace.Result || trace.Suppressed != "1/2 consecutive evaluations" || trace.State == nil || trace.State.Consecutive != 1 {
+		t.Errorf("unexpected case trace %+v", trace)
+	}
+}
+
+// failingStateStore is a StateStore which updates always fail
+type failingStateStore struct {
+	*MemoryStateStore
+}
+
+func (store failingStateStore) Update(key StateKey, fn StateUpdateFunc) (CaseState, error) {
+	return CaseState{}, errors.New("store unavailable")
+}
+
+func TestStatefulCaseStoreError(t *testing.T) {
+	engine := NewRuleEngine()
+	engine.SetExplain(true)
+	engine.SetStateStore(failingStateStore{NewMemoryStateStore(0)})
+	engine.InsertRule(statefulRule(&StateConfig{Cooldown: "1h"}))
+
+	compareFired(t, executeSequence(engine, []float64{11, 11}), []bool{false, false})
+	if trace := engine.GetTrace()[0].Cases[0]; trace.Error != "state update: store unavailable" {
+		t.Errorf("the state store error should be traced %+v", trace)
+	}
+}
+
+func TestStateConfigIsValid(t *testing.T) {
+	testCases := []struct {
+		name  string
+		state StateConfig
+		valid bool
+	}{
+		{"empty", StateConfig{}, true},
+		{"complete", StateConfig{Consecutive: 2, Cooldown: "1h", ExitCondition: "kpi < 5"}, true},
+		{"negative consecutive", StateConfig{Consecutive: -1}, false},
+		{"invalid cooldown", StateConfig{Cooldown: "1 hour"}, false},
+		{"negative cooldown", StateConfig{Cooldown: "-1h"}, false},
+		{"invalid exit condition", StateConfig{ExitCondition: "kpi <"}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if ok, err := tc.state.IsValid(); ok != tc.valid {
+				t.Errorf("IsValid() returned %t (%v), expected %t", ok, err, tc.valid)
+			}
+		})
+	}
+}
+
+// concurrentUpdates increments the consecutive evaluations of a state from concurrent goroutines
+func concurrentUpdates(t *testing.T, store StateStore, key StateKey, count int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.Update(key, func(state CaseState, found bool) CaseState {
+				state.Consecutive++
+				return state
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	state, ok, err := store.Get(key)
+	if err != nil || !ok || state.Consecutive != count {
+		t.Errorf("lost concurrent updates, expected %d, got %+v (found %t, error %v)", count, state, ok, err)
+	}
+}
+
+func TestMemoryStateStoreUpdate(t *testing.T) {
+	concurrentUpdates(t, NewMemoryStateStore(0), StateKey{Scope: "test", RuleID: 1, Case: "open"}, 50)
+}
+
+func TestMemoryStateStoreTTL(t *testing.T) {
+	store := NewMemoryStateStore(20 * time.Millisecond)
+	expired := StateKey{Scope: "a", RuleID: 1, Case: "open"}
+	if err := store.Set(expired, CaseState{Consecutive: 1}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	if _, ok, err := store.Get(expired); ok || err != nil {
+		t.Errorf("the state should be expired (found %t, error %v)", ok, err)
+	}
+	state, err := store.Update(StateKey{Scope: "b", RuleID: 1, Case: "open"}, func(state CaseState, found bool) CaseState {
+		state.Consecutive++
+		return state
+	})
+	if err != nil || state.Consecutive != 1 {
+		t.Errorf("unexpected state %+v (error %v)", state, err)
+	}
+	if store.Len() != 1 {
+		t.Errorf("the expired state should be evicted, %d states left", store.Len())
+	}
+}
+
+func TestRedisStateStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping redis test in short mode.")
+	}
+	cli, err := redis.NewRedisClient([]string{"localhost:6379"}, "", true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	store := NewRedisStateStore(cli, "test-rule-state:", time.Minute)
+	key := StateKey{Scope: "test", RuleID: 1, Case: "open"}
+	state := CaseState{Consecutive: 2, Active: true, LastFired: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	if err := store.Set(key, state); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := store.Get(key)
+	if err != nil || !ok || got.Consecutive != 2 || !got.Active || !got.LastFired.Equal(state.LastFired) {
+		t.Errorf("unexpected state %+v (found %t, error %v)", got, ok, err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.Get(key); ok || err != nil {
+		t.Errorf("state should be deleted (found %t, error %v)", ok, err)
+	}
+
+	concurrentUpdates(t, store, key, 5)
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,118 @@
+package ruleeng
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/myrteametrics/myrtea-sdk/v5/expression"
+)
+
+// RuleTrace is the evaluation trace of a rule, recorded in explain mode
+// * Inactive is the reason why the rule is not active at the evaluation time
+// * Terminated is set if the rule is terminal and stopped the rule base execution
+type RuleTrace struct {
+	RuleID      int64                  `json:"ruleId"`
+	RuleVersion int64                  `json:"ruleVersion"`
+	Salience    int                    `json:"salience"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Cases       []CaseTrace            `json:"cases"`
+	Inactive    string                 `json:"inactive,omitempty"`
+	Terminated  bool                   `json:"terminated,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+}
+
+// CaseTrace is the evaluation trace of a rule case
+// * Skipped is set if the case is disabled, Inactive is the reason why it is not active at the evaluation time
+// * Evaluated is unset if the case is skipped or inactive, or not reached because a previous case matched
+// * Knowledge are the knowledge values read by the condition, Missing the paths which are not in the knowledge base
+// * Exit is set if the evaluated condition is the exit condition of an active stateful case
+// * Suppressed is the reason why a stateful case did not fire although its condition is true
+// * State is the state of a stateful case after the evaluation
+type CaseTrace struct {
+	Name       string                 `json:"name"`
+	Condition  string                 `json:"condition"`
+	Skipped    bool                   `json:"skipped"`
+	Inactive   string                 `json:"inactive,omitempty"`
+	Evaluated  bool                   `json:"evaluated"`
+	Result     bool                   `json:"result"`
+	Error      string                 `json:"error,omitempty"`
+	Knowledge  map[string]interface{} `json:"knowledge,omitempty"`
+	Missing    []string               `json:"missing,omitempty"`
+	Exit       bool                   `json:"exit,omitempty"`
+	Suppressed string                 `json:"suppressed,omitempty"`
+	State      *CaseState             `json:"state,omitempty"`
+	Actions    []ActionTrace          `json:"actions,omitempty"`
+}
+
+// ActionTrace is the resolution trace of a case action
+// * Skipped is set if the action is disabled
+// * Parameters are the resolved parameters, ParameterErrors the errors of the parameters which could not be resolved
+// * Knowledge are the knowledge values read by the name and parameters, Missing the paths which are not in the knowledge base
+type ActionTrace struct {
+	ID              string                 `json:"id,omitempty"`
+	Name            string                 `json:"name"`
+	Skipped         bool                   `json:"skipped"`
+	Error           string                 `json:"error,omitempty"`
+	Parameters      map[string]interface{} `json:"parameters,omitempty"`
+	ParameterErrors map[string]string      `json:"parameterErrors,omitempty"`
+	Knowledge       map[string]interface{} `json:"knowledge,omitempty"`
+	Missing         []string               `json:"missing,omitempty"`
+}
+
+// readKnowledge records the knowledge values read by some expressions
+func readKnowledge(k KnowledgeBase, knowledge map[string]interface{}, missing []string, expressions ...Expression) (map[string]interface{}, []string) {
+	facts := k.GetFacts()
+	for _, exp := range expressions {
+		for _, identifier := range expression.Identifiers(string(exp)) {
+			if _, ok := knowledge[identifier.Path]; ok {
+				continue
+			}
+			if containsString(missing, identifier.Path) {
+				continue
+			}
+			value, ok := lookupKnowledge(facts, identifier.Path)
+			if !ok {
+				missing = append(missing, identifier.Path)
+				continue
+			}
+			if knowledge == nil {
+				knowledge = make(map[string]interface{})
+			}
+			knowledge[identifier.Path] = value
+		}
+	}
+	sort.Strings(missing)
+	return knowledge, missing
+}
+
+func lookupKnowledge(facts map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = facts
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			val, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = val
+		case map[interface{}]interface{}:
+			val, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = val
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
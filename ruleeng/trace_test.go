@@ -0,0 +1,146 @@
+package ruleeng
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var ruleTraceStr = `{
+	"id": 7,
+	"version": 2,
+	"cases": [
+	  {
+		"name": "disabled",
+		"enabled": false,
+		"condition": "true",
+		"actions": [{"name": "\"notify\"", "enabled": true, "parameters": {}}]
+	  },
+	  {
+		"name": "invalid",
+		"enabled": true,
+		"condition": "unknown.value > 1",
+		"actions": [{"name": "\"notify\"", "enabled": true, "parameters": {}}]
+	  },
+	  {
+		"name": "match",
+		"enabled": true,
+		"condition": "fact.aggs.doc_count.value >= threshold",
+		"actions": [
+		  {"name": "\"set\"", "enabled": false, "id": "skipped", "parameters": {"status": "\"ko\""}},
+		  {"name": "\"notify\"", "enabled": true, "id": "notify", "parameters": {"count": "fact.aggs.doc_count.value", "title": "missing.title"}}
+		]
+	  },
+	  {
+		"name": "unreached",
+		"enabled": true,
+		"condition": "true",
+		"actions": [{"name": "\"notify\"", "enabled": true, "parameters": {}}]
+	  }
+	],
+	"parameters": {"threshold": 10}
+  }`
+
+func TestRuleEngineExplain(t *testing.T) {
+	var rule DefaultRule
+	if err := json.Unmarshal([]byte(ruleTraceStr), &rule); err != nil {
+		t.Fatalf("could not unmarshal rule: %v", err)
+	}
+
+	engine := NewRuleEngine()
+	engine.SetExplain(true)
+	engine.InsertRule(&rule)
+	engine.knowledgeBase.SetFacts(map[string]interface{}{
+		"fact": map[string]interface{}{"aggs": map[string]interface{}{"doc_count": map[string]interface{}{"value": 12}}},
+	})
+	engine.ExecuteAllRules()
+
+	actions := engine.GetResults()
+	if len(actions) != 1 || actions[0].GetName() != "notify" {
+		t.Fatalf("unexpected actions %+v", actions)
+	}
+
+	traces := engine.GetTrace()
+	if len(traces) != 1 {
+		t.Fatalf("invalid number of traces, expected 1, got %d", len(traces))
+	}
+	trace := traces[0]
+	if trace.RuleID != 7 || trace.RuleVersion != 2 || len(trace.Cases) != 4 {
+		t.Fatalf("unexpected rule trace %+v", trace)
+	}
+
+	if c := trace.Cases[0]; !c.Skipped || c.Evaluated {
+		t.Errorf("disabled case should be skipped: %+v", c)
+	}
+	if c := trace.Cases[1]; !c.Evaluated || c.Result || c.Error == "" || !reflect.DeepEqual(c.Missing, []string{"unknown.value"}) {
+		t.Errorf("invalid case should record its error and missing knowledge: %+v", c)
+	}
+	c := trace.Cases[2]
+	if !c.Evaluated || !c.Result || c.Error != "" {
+		t.Errorf("matching case should be evaluated as true: %+v", c)
+	}
+	expectedKnowledge := map[string]interface{}{"fact.aggs.doc_count.value": 12, "threshold": 10.0}
+	if !reflect.DeepEqual(c.Knowledge, expectedKnowledge) {
+		t.Errorf("invalid case knowledge %+v, expected %+v", c.Knowledge, expectedKnowledge)
+	}
+	if len(c.Actions) != 2 {
+		t.Fatalf("invalid number of action traces, expected 2, got %d", len(c.Actions))
+	}
+	if a := c.Actions[0]; !a.Skipped || a.ID != "skipped" {
+		t.Errorf("disabled action should be skipped: %+v", a)
+	}
+	a := c.Actions[1]
+	if a.Skipped || a.Name != "notify" || a.Error != "" {
+		t.Errorf("unexpected action trace %+v", a)
+	}
+	if !reflect.DeepEqual(a.Parameters, map[string]interface{}{"count": 12}) {
+		t.Errorf("invalid resolved parameters %+v", a.Parameters)
+	}
+	if _, ok := a.ParameterErrors["title"]; !ok || len(a.ParameterErrors) != 1 {
+		t.Errorf("invalid parameter errors %+v", a.ParameterErrors)
+	}
+	if !reflect.DeepEqual(a.Missing, []string{"missing.title"}) {
+		t.Errorf("invalid action missing knowledge %+v", a.Missing)
+	}
+	if c := trace.Cases[3]; c.Skipped || c.Evaluated {
+		t.Errorf("case after the first match should not be evaluated: %+v", c)
+	}
+
+	if _, err := json.Marshal(traces); err != nil {
+		t.Errorf("trace should be serializable: %v", err)
+	}
+}
+
+func TestRuleEngineExecuteRule(t *testing.T) {
+	var rule DefaultRule
+	if err := json.Unmarshal([]byte(ruleTraceStr), &rule); err != nil {
+		t.Fatalf("could not unmarshal rule: %v", err)
+	}
+
+	for _, explain := range []bool{false, true} {
+		engine := NewRuleEngine()
+		engine.SetExplain(explain)
+		engine.InsertRule(&rule)
+		engine.knowledgeBase.SetFacts(map[string]interface{}{
+			"fact": map[string]interface{}{"aggs": map[string]interface{}{"doc_count": map[string]interface{}{"value": 12}}},
+		})
+
+		if err := engine.ExecuteRule(7); err != nil {
+			t.Errorf("explain=%t: unexpected error %v", explain, err)
+		}
+		if len(engine.GetResults()) != 1 {
+			t.Errorf("explain=%t: invalid number of actions, expected 1, got %d", explain, len(engine.GetResults()))
+		}
+		if err := engine.ExecuteRule(8); err == nil {
+			t.Errorf("explain=%t: expected an error on a non existing rule", explain)
+		}
+
+		expectedTraces := 0
+		if explain {
+			expectedTraces = 2
+		}
+		if len(engine.GetTrace()) != expectedTraces {
+			t.Errorf("explain=%t: invalid number of traces, expected %d, got %d", explain, expectedTraces, len(engine.GetTrace()))
+		}
+	}
+}